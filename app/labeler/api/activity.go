@@ -0,0 +1,96 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, activityAuthRouter())
+}
+
+func activityAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		g.GET("/api/v1/labeler/tasks/:id/history", api.TaskHistory())
+		g.GET("/api/v1/labeler/tasks/:id/snapshots", api.TaskSnapshots())
+		g.GET("/api/v1/labeler/snapshots/diff", api.DiffSnapshots())
+		g.GET("/api/v1/labeler/snapshots/:id", api.GetSnapshot())
+	}
+}
+
+func (api *LabelerAPI) TaskHistory() GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.TaskHistory(c.Request.Context(), oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) TaskSnapshots() GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.TaskSnapshots(c.Request.Context(), oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) GetSnapshot() GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetSnapshot(c.Request.Context(), oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+// DiffSnapshots 比较两个快照，from 必填，to 为空时和任务当前的内容比较，all=true 时包含流程字段
+func (api *LabelerAPI) DiffSnapshots() GinHandler {
+	return func(c *gin.Context) {
+		var req service.SnapshotDiffReq
+		var err error
+		if req.From, err = primitive.ObjectIDFromHex(c.Query("from")); err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if to := c.Query("to"); to != "" {
+			if req.To, err = primitive.ObjectIDFromHex(to); err != nil {
+				response.Error(c, 400, err, "参数异常")
+				return
+			}
+		}
+		req.All = c.Query("all") == "true"
+		resp, err := api.LabelerService.DiffSnapshots(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"go-admin/app/labeler/model"
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, allocationAuthRouter())
+}
+
+func allocationAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.GET("/api/v1/labeler/"+name+"/allocation", api.GetAllocationSetting(name))
+			g.PUT("/api/v1/labeler/"+name+"/allocation", api.SaveAllocationSetting(name))
+			g.POST("/api/v1/labeler/"+name+"/allocate/preview", api.PreviewAlloc(name))
+		}
+	}
+}
+
+func (api *LabelerAPI) GetAllocationSetting(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		oid, err := QueryObjectID(c)
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetAllocationSetting(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) SaveAllocationSetting(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req model.AllocationSetting
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.SaveAllocationSetting(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+// PreviewAlloc 按项目配置的策略试算分配结果，不修改任务
+func (api *LabelerAPI) PreviewAlloc(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.PreviewAllocReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.PreviewAlloc(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
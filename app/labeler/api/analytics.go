@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, analyticsAuthRouter())
+}
+
+func analyticsAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.GET("/api/v1/labeler/"+name+"/analytics/productivity", api.Productivity(name))
+		}
+	}
+}
+
+func (api *LabelerAPI) Productivity(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.ProductivityReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.Productivity(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
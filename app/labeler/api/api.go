@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
 	"github.com/xuri/excelize/v2"
 	"go-admin/app/labeler/service"
 	"go-admin/common/actions"
@@ -11,6 +12,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"io"
 	"mime/multipart"
+	"net/http"
 )
 
 type (
@@ -62,6 +64,34 @@ func QueryObjectID(c *gin.Context) (primitive.ObjectID, error) {
 	return oid, nil
 }
 
+// VersionConflict 任务已被其他人修改时返回 409 和服务器上的任务，前端据此合并或刷新，其他错误返回 false
+func VersionConflict(c *gin.Context, err error, task interface{}) bool {
+	if !errors.Is(err, service.ErrVersionConflict) {
+		return false
+	}
+	response.Custum(c, gin.H{
+		"code": http.StatusConflict,
+		"msg":  err.Error(),
+		"data": task,
+	})
+	return true
+}
+
+// PageOK 在 response.PageOK 的 count/pageIndex/pageSize/list 之外返回游标翻页的 next 和 estimated
+func PageOK(c *gin.Context, list interface{}, page service.Page, pageIndex int, pageSize int, msg string) {
+	response.OK(c, struct {
+		response.Page
+		Estimated bool        `json:"estimated"`
+		Next      string      `json:"next"`
+		List      interface{} `json:"list"`
+	}{
+		Page:      response.Page{Count: page.Count, PageIndex: pageIndex, PageSize: pageSize},
+		Estimated: page.Estimated,
+		Next:      page.Next,
+		List:      list,
+	}, msg)
+}
+
 func ReadFileHeader(fh *multipart.FileHeader) (string, error) {
 	f, err := fh.Open()
 	if err != nil {
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, commentAuthRouter())
+}
+
+func commentAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.GET("/api/v1/labeler/"+name+"/comments", api.ListComments(name))
+			g.POST("/api/v1/labeler/"+name+"/comments", api.CreateComment(name))
+		}
+		g.PUT("/api/v1/labeler/comments/resolve", api.ResolveComment())
+		g.GET("/api/v1/labeler/comments/inbox", api.CommentInbox())
+	}
+}
+
+// ListComments 任务的讨论，id 为任务 ID
+func (api *LabelerAPI) ListComments(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		oid, err := QueryObjectID(c)
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		var req service.ListCommentsReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		req.TaskID = oid
+		resp, err := api.LabelerService.ListComments(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) CreateComment(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		var req service.CreateCommentReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.CreateComment(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) ResolveComment() GinHandler {
+	return func(c *gin.Context) {
+		var req service.ResolveCommentReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.ResolveComment(c.Request.Context(), req); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "")
+	}
+}
+
+// CommentInbox 当前用户待处理的讨论
+func (api *LabelerAPI) CommentInbox() GinHandler {
+	return func(c *gin.Context) {
+		var req service.CommentInboxReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.CommentInbox(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, exportAuthRouter())
+}
+
+func exportAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		g.GET("/api/v1/labeler/exports", api.SearchExports())
+		g.GET("/api/v1/labeler/exports/:id", api.GetExport())
+		g.GET("/api/v1/labeler/exports/:id/file", api.ExportFile())
+	}
+}
+
+func (api *LabelerAPI) SearchExports() GinHandler {
+	return func(c *gin.Context) {
+		var req service.SearchExportsReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.SearchExports(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
+
+func (api *LabelerAPI) GetExport() GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetExport(c.Request.Context(), oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) ExportFile() GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.ExportFile(c.Request.Context(), oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
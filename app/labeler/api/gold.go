@@ -0,0 +1,108 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, goldAuthRouter())
+}
+
+func goldAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range []string{"t2", "t3", "t4", "t5"} {
+			g.PUT("/api/v1/labeler/"+name+"/gold", api.SetGold(name))
+			g.DELETE("/api/v1/labeler/"+name+"/gold/:id", api.UnsetGold(name))
+			g.GET("/api/v1/labeler/"+name+"/gold", api.SearchGold(name))
+			g.GET("/api/v1/labeler/"+name+"/gold/accuracy", api.GoldAccuracy(name))
+		}
+	}
+}
+
+func (api *LabelerAPI) SetGold(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.SetGoldReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.SetGold(c.Request.Context(), taskType, req); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "设置成功")
+	}
+}
+
+func (api *LabelerAPI) UnsetGold(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.UnsetGold(c.Request.Context(), taskType, oid); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "取消成功")
+	}
+}
+
+func (api *LabelerAPI) SearchGold(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Query("projectId"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.SearchGold(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) GoldAccuracy(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Query("projectId"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		var req service.GoldAccuracyReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		req.ProjectID = oid
+		resp, err := api.LabelerService.GoldAccuracy(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		g.POST("/api/v1/labeler/t2/import", api.ImportTask2())
+		g.POST("/api/v1/labeler/t3/import", api.ImportTask3())
+	})
+}
+
+// handleImport 读取表单：file 为导入的文件，format 为空时按扩展名判断，
+// mapping 为 ImportColumn 数组的 JSON，dryRun 为 true 时只返回校验报告
+func handleImport(c *gin.Context, do func(req service.ImportTaskReq) (service.ImportTaskResp, error)) {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+		response.Error(c, 400, err, "")
+		return
+	}
+	projectID, err := primitive.ObjectIDFromHex(c.Request.FormValue("projectId"))
+	if err != nil {
+		log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+		response.Error(c, 400, err, "")
+		return
+	}
+	req := service.ImportTaskReq{
+		ProjectID: projectID,
+		Format:    c.Request.FormValue("format"),
+		Prefix:    strings.Split(fh.Filename, ".")[0],
+	}
+	if req.Format == "" {
+		req.Format = service.ImportFormat(fh.Filename)
+	}
+	if req.Format == "" {
+		response.Error(c, 400, errors.New("无法识别的文件格式"), "只支持 csv 和 jsonl 文件")
+		return
+	}
+	if mapping := c.Request.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &req.Mapping); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "列映射格式错误")
+			return
+		}
+	}
+	if dryRun := c.Request.FormValue("dryRun"); dryRun != "" {
+		if req.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+	}
+	f, err := fh.Open()
+	if err != nil {
+		log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+		response.Error(c, 500, err, "")
+		return
+	}
+	defer f.Close()
+	req.File = f
+
+	resp, err := do(req)
+	if err != nil {
+		log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+		response.Error(c, 500, err, "")
+		return
+	}
+	msg := fmt.Sprintf("导入 %d 条，%d 条有错误", resp.Imported, resp.Invalid)
+	if resp.DryRun {
+		msg = fmt.Sprintf("校验完成，%d 条可以导入，%d 条有错误", resp.Valid, resp.Invalid)
+	}
+	response.OK(c, resp, msg)
+}
+
+func (api *LabelerAPI) ImportTask2() GinHandler {
+	return func(c *gin.Context) {
+		handleImport(c, func(req service.ImportTaskReq) (service.ImportTaskResp, error) {
+			return api.LabelerService.ImportTask2(c.Request.Context(), req)
+		})
+	}
+}
+
+func (api *LabelerAPI) ImportTask3() GinHandler {
+	return func(c *gin.Context) {
+		handleImport(c, func(req service.ImportTaskReq) (service.ImportTaskResp, error) {
+			return api.LabelerService.ImportTask3(c.Request.Context(), req)
+		})
+	}
+}
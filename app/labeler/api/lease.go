@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, leaseAuthRouter())
+}
+
+func leaseAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.POST("/api/v1/labeler/"+name+"/task/heartbeat", api.RenewLease(name))
+		}
+	}
+}
+
+// RenewLease 标注员的心跳，续约自己待标注的任务
+func (api *LabelerAPI) RenewLease(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		var req service.RenewLeaseReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		req.UserID = strconv.Itoa(user.GetUserId(c))
+		resp, err := api.LabelerService.RenewLease(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, overlapAuthRouter())
+}
+
+func overlapAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range []string{"t2", "t3", "t4"} {
+			g.POST("/api/v1/labeler/"+name+"/submissions/allocate", api.AllocSubmissions(name))
+			g.GET("/api/v1/labeler/"+name+"/submissions", api.SearchSubmissions(name))
+			g.GET("/api/v1/labeler/"+name+"/submissions/:id", api.GetSubmission(name))
+			g.PUT("/api/v1/labeler/"+name+"/submissions/:id", api.SaveSubmission(name))
+			g.GET("/api/v1/labeler/"+name+"/agreement", api.Agreement(name))
+			g.GET("/api/v1/labeler/"+name+"/adjudications", api.SearchAdjudications(name))
+			g.POST("/api/v1/labeler/"+name+"/adjudicate", api.Adjudicate(name))
+		}
+	}
+}
+
+func (api *LabelerAPI) AllocSubmissions(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.BatchAllocReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		count, err := api.LabelerService.AllocSubmissions(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, service.BatchAllocResp{Count: count}, "分配成功")
+	}
+}
+
+func (api *LabelerAPI) SearchSubmissions(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		var req service.SearchSubmissionsReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.SearchSubmissions(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
+
+func (api *LabelerAPI) GetSubmission(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetSubmission(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) SaveSubmission(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		var req service.SaveSubmissionReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		req.ID = oid
+		resp, err := api.LabelerService.SaveSubmission(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "保存成功")
+	}
+}
+
+func (api *LabelerAPI) Agreement(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Query("projectId"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.Agreement(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) SearchAdjudications(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.SearchAdjudicationsReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.SearchAdjudications(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
+
+func (api *LabelerAPI) Adjudicate(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.AdjudicateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.Adjudicate(c.Request.Context(), taskType, req); err != nil {
+			if VersionConflict(c, err, nil) {
+				return
+			}
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "裁决成功")
+	}
+}
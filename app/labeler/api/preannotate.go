@@ -0,0 +1,84 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, preAnnotateAuthRouter())
+}
+
+func preAnnotateAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range []string{"t2", "t3", "t4"} {
+			g.POST("/api/v1/labeler/"+name+"/preannotate", api.CreatePreAnnotate(name))
+			g.GET("/api/v1/labeler/"+name+"/preannotate", api.SearchPreAnnotate(name))
+			g.GET("/api/v1/labeler/"+name+"/preannotate/:id", api.GetPreAnnotate(name))
+		}
+	}
+}
+
+func (api *LabelerAPI) CreatePreAnnotate(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.CreatePreAnnotateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.CreatePreAnnotate(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "已开始预标注")
+	}
+}
+
+func (api *LabelerAPI) SearchPreAnnotate(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.SearchPreAnnotateReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.SearchPreAnnotate(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
+
+func (api *LabelerAPI) GetPreAnnotate(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetPreAnnotate(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
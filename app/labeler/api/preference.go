@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		g.POST("/api/v1/labeler/t3/download/preference", api.DownloadPreference(api.LabelerService.DownloadTask3Preference))
+		g.POST("/api/v1/labeler/t4/download/preference", api.DownloadPreference(api.LabelerService.DownloadTask4Preference))
+	})
+}
+
+// DownloadPreference 导出偏好数据，mode 为 pairs 或 listwise
+func (api *LabelerAPI) DownloadPreference(download func(ctx context.Context, req service.DownloadPreferenceReq) (service.DownloadPreferenceResp, error)) GinHandler {
+	return func(c *gin.Context) {
+		var req service.DownloadPreferenceReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 500, err, "参数异常")
+			return
+		}
+		if req.ProjectID.IsZero() {
+			response.Error(c, 500, nil, "项目id不能为空")
+			return
+		}
+		if len(req.Status) == 0 {
+			response.Error(c, 500, nil, "状态不能为空")
+			return
+		}
+		resp, err := download(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "已创建导出任务")
+	}
+}
@@ -21,6 +21,7 @@ func project5AuthRouter() RouterCheckRole {
 		g.DELETE("/api/v1/labeler/p5/", api.DeleteProject5())
 		g.POST("/api/v1/labeler/p5/search", api.SearchProject5())
 		g.GET("/api/v1/labeler/p5/count", api.Project5Count())
+		g.PUT("/api/v1/labeler/p5/rubric", api.SaveRubric5())
 	}
 }
 
@@ -120,3 +121,20 @@ func (api *LabelerAPI) Project5Count() GinHandler {
 		response.OK(c, resp, "")
 	}
 }
+
+func (api *LabelerAPI) SaveRubric5() GinHandler {
+	return func(c *gin.Context) {
+		var req service.SaveRubric5Req
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.SaveRubric5(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "保存成功")
+	}
+}
@@ -21,6 +21,7 @@ func project6AuthRouter() RouterCheckRole {
 		g.DELETE("/api/v1/labeler/p6/", api.DeleteProject6())
 		g.POST("/api/v1/labeler/p6/search", api.SearchProject6())
 		g.GET("/api/v1/labeler/p6/count", api.Project6Count())
+		g.POST("/api/v1/labeler/p6/revalidate", api.RevalidateProject6())
 	}
 }
 
@@ -120,3 +121,20 @@ func (api *LabelerAPI) Project6Count() GinHandler {
 		response.OK(c, resp, "")
 	}
 }
+
+func (api *LabelerAPI) RevalidateProject6() GinHandler {
+	return func(c *gin.Context) {
+		var req service.RevalidateProject6Req
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.RevalidateProject6(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, qaAuthRouter())
+}
+
+func qaAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.POST("/api/v1/labeler/"+name+"/qa/batches", api.CreateQABatch(name))
+			g.GET("/api/v1/labeler/"+name+"/qa/batches", api.SearchQABatches(name))
+		}
+		g.GET("/api/v1/labeler/qa/batches/:id/report", api.QAReport())
+		g.POST("/api/v1/labeler/qa/allocate", api.AllocateQA())
+		g.GET("/api/v1/labeler/qa/items", api.SearchQAItems())
+		g.POST("/api/v1/labeler/qa/review", api.ReviewQA())
+	}
+}
+
+// CreateQABatch 抽样生成质检批次
+func (api *LabelerAPI) CreateQABatch(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.CreateQABatchReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.CreateQABatch(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+// SearchQABatches 项目的质检批次，id 为项目 ID
+func (api *LabelerAPI) SearchQABatches(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := QueryObjectID(c)
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.SearchQABatches(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+// QAReport 质检批次的错误率和置信区间，level 为置信水平，默认 0.95
+func (api *LabelerAPI) QAReport() GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		var level float64
+		if s := c.Query("level"); s != "" {
+			if level, err = strconv.ParseFloat(s, 64); err != nil {
+				response.Error(c, 400, err, "参数异常")
+				return
+			}
+		}
+		resp, err := api.LabelerService.QAReport(c.Request.Context(), oid, level)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) AllocateQA() GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.AllocateQAReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		count, err := api.LabelerService.AllocateQA(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, service.BatchAllocResp{Count: count}, "分配成功")
+	}
+}
+
+// SearchQAItems 质检队列，质检员只能看到分配给自己的任务
+func (api *LabelerAPI) SearchQAItems() GinHandler {
+	return func(c *gin.Context) {
+		var req service.SearchQAItemsReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.SearchQAItems(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
+
+func (api *LabelerAPI) ReviewQA() GinHandler {
+	return func(c *gin.Context) {
+		var req service.ReviewQAReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.ReviewQA(c.Request.Context(), req); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "")
+	}
+}
@@ -39,6 +39,7 @@ func taskAuthRouter() RouterCheckRole {
 		g.POST("/api/v1/labeler/t/checkallocate", api.AllocateCheckTasks())
 		g.POST("/api/v1/labeler/t/my", api.SearchMyTask())
 		g.POST("/api/v1/labeler/t/download", api.DownloadTask())
+		g.POST("/api/v1/labeler/t/download/ner", api.DownloadTaskNER())
 		g.DELETE("/api/v1/labeler/t/", api.DeleteTask())
 	}
 }
@@ -103,6 +104,9 @@ func (api *LabelerAPI) LabelTask() GinHandler {
 		userID := user.GetUserId(c)
 		resp, err := api.LabelerService.LabelTask(c, req, userID)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -123,13 +127,13 @@ func (api *LabelerAPI) SearchTask() GinHandler {
 		req.UserID = p.UserId
 		req.DataScope = p.DataScope
 
-		resp, total, err := api.LabelerService.SearchTask(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchTask(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -163,6 +167,7 @@ func (api *LabelerAPI) AllocateTasks() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		if err := api.LabelerService.AllocateTasks(c.Request.Context(), req); err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
@@ -180,11 +185,6 @@ func (api *LabelerAPI) ModelParse() GinHandler {
 			response.Error(c, 500, err, "参数异常")
 			return
 		}
-		if req.ModelURL == "" {
-			response.Error(c, 500, nil, "modelURL为空")
-			return
-		}
-
 		resp, err := api.LabelerService.ModelParse(c.Request.Context(), req)
 		if err != nil {
 			response.Error(c, 500, err, "")
@@ -212,6 +212,7 @@ func (api *LabelerAPI) ResetTasks() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(p.UserId)
 		if err := api.LabelerService.ResetTasks(c.Request.Context(), req); err != nil {
 			response.Error(c, 500, err, "")
 			return
@@ -235,6 +236,9 @@ func (api *LabelerAPI) CheckTask() GinHandler {
 		userID := user.GetUserId(c)
 		resp, err := api.LabelerService.CheckTask(c, req, userID)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -285,6 +289,7 @@ func (api *LabelerAPI) AllocateCheckTasks() GinHandler {
 			response.Error(c, 500, err, "参数异常")
 			return
 		}
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		if err := api.LabelerService.AllocateCheckTasks(c.Request.Context(), req); err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
@@ -304,13 +309,17 @@ func (api *LabelerAPI) SearchMyTask() GinHandler {
 		}
 		p := actions.GetPermissionFromContext(c)
 		req.UserID = strconv.Itoa(p.UserId)
-		resp, total, err := api.LabelerService.SearchMyTask(c.Request.Context(), req)
+		// 不传 pageSize 时和原来一样一次返回全部任务
+		if req.PageSize <= 0 {
+			req.PageSize = 10000
+		}
+		resp, page, err := api.LabelerService.SearchMyTask(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, 1, 10000, "查询成功")
+		PageOK(c, resp, page, req.GetPageIndex(), req.PageSize, "查询成功")
 	}
 }
 
@@ -335,7 +344,33 @@ func (api *LabelerAPI) DownloadTask() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "下载成功")
+		response.OK(c, resp, "已创建导出任务")
+	}
+}
+
+// DownloadTaskNER 导出实体标注，format 为 conll、doccano 或 labelstudio
+func (api *LabelerAPI) DownloadTaskNER() GinHandler {
+	return func(c *gin.Context) {
+		var req service.DownloadTaskNERReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 500, err, "参数异常")
+			return
+		}
+		if req.ProjectID.IsZero() {
+			response.Error(c, 500, nil, "项目id不能为空")
+			return
+		}
+		if len(req.Status) == 0 {
+			response.Error(c, 500, nil, "状态不能为空")
+			return
+		}
+		resp, err := api.LabelerService.DownloadTaskNER(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -97,13 +97,13 @@ func (api *LabelerAPI) SearchTask2() GinHandler {
 		req.UserID = p.UserId
 		req.DataScope = p.DataScope
 
-		resp, total, err := api.LabelerService.SearchTask2(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchTask2(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -120,6 +120,7 @@ func (api *LabelerAPI) Task2BatchAllocLabeler() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		resp, err := api.LabelerService.Task2BatchAllocLabeler(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
@@ -150,6 +151,7 @@ func (api *LabelerAPI) Task2BatchAllocChecker() GinHandler {
 			response.Error(c, 500, err, "参数异常")
 			return
 		}
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		resp, err := api.LabelerService.Task2BatchAllocChecker(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
@@ -178,6 +180,7 @@ func (api *LabelerAPI) ResetTasks2() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(p.UserId)
 		resp, err := api.LabelerService.ResetTasks2(c.Request.Context(), req)
 		if err != nil {
 			response.Error(c, 500, err, "")
@@ -205,6 +208,9 @@ func (api *LabelerAPI) UpdateTask2() GinHandler {
 		req.UserDataScope = p.DataScope
 		resp, err := api.LabelerService.UpdateTask2(c, req)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -243,13 +249,13 @@ func (api *LabelerAPI) SearchMyTask2() GinHandler {
 		}
 		p := actions.GetPermissionFromContext(c)
 		req.UserID = strconv.Itoa(p.UserId)
-		resp, total, err := api.LabelerService.SearchMyTask2(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchMyTask2(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -295,6 +301,6 @@ func (api *LabelerAPI) DownloadTask2() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "下载成功")
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
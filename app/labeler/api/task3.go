@@ -94,13 +94,13 @@ func (api *LabelerAPI) SearchTask3() GinHandler {
 		req.UserID = p.UserId
 		req.DataScope = p.DataScope
 
-		resp, total, err := api.LabelerService.SearchTask3(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchTask3(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -117,6 +117,7 @@ func (api *LabelerAPI) Task3BatchAllocLabeler() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		resp, err := api.LabelerService.Task3BatchAllocLabeler(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
@@ -145,6 +146,7 @@ func (api *LabelerAPI) ResetTasks3() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(p.UserId)
 		resp, err := api.LabelerService.ResetTasks3(c.Request.Context(), req)
 		if err != nil {
 			response.Error(c, 500, err, "")
@@ -172,6 +174,9 @@ func (api *LabelerAPI) UpdateTask3() GinHandler {
 		req.UserDataScope = p.DataScope
 		resp, err := api.LabelerService.UpdateTask3(c, req)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -210,13 +215,13 @@ func (api *LabelerAPI) SearchMyTask3() GinHandler {
 		}
 		p := actions.GetPermissionFromContext(c)
 		req.UserID = strconv.Itoa(p.UserId)
-		resp, total, err := api.LabelerService.SearchMyTask3(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchMyTask3(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -262,7 +267,7 @@ func (api *LabelerAPI) DownloadTask3() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "下载成功")
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -96,13 +96,13 @@ func (api *LabelerAPI) SearchTask4() GinHandler {
 		req.UserID = p.UserId
 		req.DataScope = p.DataScope
 
-		resp, total, err := api.LabelerService.SearchTask4(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchTask4(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -119,6 +119,7 @@ func (api *LabelerAPI) Task4BatchAllocLabeler() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		resp, err := api.LabelerService.Task4BatchAllocLabeler(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
@@ -158,6 +159,7 @@ func (api *LabelerAPI) ResetTasks4() GinHandler {
 			response.Error(c, 400, nil, "重置类型错误")
 			return
 		}
+		req.Actor = strconv.Itoa(p.UserId)
 		resp, err := api.LabelerService.ResetTasks4(c.Request.Context(), req)
 		if err != nil {
 			response.Error(c, 500, err, "")
@@ -185,6 +187,9 @@ func (api *LabelerAPI) UpdateTask4() GinHandler {
 		req.UserDataScope = p.DataScope
 		resp, err := api.LabelerService.UpdateTask4(c, req)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -231,13 +236,13 @@ func (api *LabelerAPI) SearchMyTask4() GinHandler {
 		}
 		p := actions.GetPermissionFromContext(c)
 		req.UserID = strconv.Itoa(p.UserId)
-		resp, total, err := api.LabelerService.SearchMyTask4(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchMyTask4(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -283,7 +288,7 @@ func (api *LabelerAPI) DownloadTask4() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "下载成功")
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -328,6 +333,7 @@ func (api *LabelerAPI) Task4BatchAllocChecker() GinHandler {
 			response.Error(c, 400, nil, "项目id不能为空")
 			return
 		}
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		err := api.LabelerService.Task4BatchAllocChecker(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
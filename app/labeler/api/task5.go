@@ -34,6 +34,7 @@ func task5AuthRouter() RouterCheckRole {
 		g.POST("/api/v1/labeler/t5/my", api.SearchMyTask5())
 		g.DELETE("/api/v1/labeler/t5/", api.DeleteTask5())
 		g.POST("/api/v1/labeler/t5/download", api.DownloadTask5())
+		g.POST("/api/v1/labeler/t5/download/sft", api.DownloadTask5SFT())
 		g.POST("/api/v1/labeler/t5/detail", api.GetTask5())
 		g.POST("/api/v1/labeler/t5/mycount", api.SearchMyTask5Count())
 		g.POST("/api/v1/labeler/t5/action", api.GetActionTags())
@@ -127,13 +128,13 @@ func (api *LabelerAPI) SearchTask5() GinHandler {
 		req.UserID = p.UserId
 		req.DataScope = p.DataScope
 
-		resp, total, err := api.LabelerService.SearchTask5(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchTask5(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -196,6 +197,7 @@ func (api *LabelerAPI) ResetTasks5() GinHandler {
 			response.Error(c, 400, nil, "重置类型错误")
 			return
 		}
+		req.Actor = strconv.Itoa(p.UserId)
 		resp, err := api.LabelerService.ResetTasks5(c.Request.Context(), req)
 		if err != nil {
 			response.Error(c, 500, err, "")
@@ -224,6 +226,9 @@ func (api *LabelerAPI) UpdateTask5() GinHandler {
 		req.UserDataScope = p.DataScope
 		resp, err := api.LabelerService.UpdateTask5(c, req)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -270,13 +275,13 @@ func (api *LabelerAPI) SearchMyTask5() GinHandler {
 		}
 		p := actions.GetPermissionFromContext(c)
 		req.UserID = strconv.Itoa(p.UserId)
-		resp, total, err := api.LabelerService.SearchMyTask5(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchMyTask5(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -322,7 +327,33 @@ func (api *LabelerAPI) DownloadTask5() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "下载成功")
+		response.OK(c, resp, "已创建导出任务")
+	}
+}
+
+// DownloadTask5SFT 导出对话微调数据
+func (api *LabelerAPI) DownloadTask5SFT() GinHandler {
+	return func(c *gin.Context) {
+		var req service.DownloadTask5SFTReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 500, err, "参数异常")
+			return
+		}
+		if req.ProjectID.IsZero() {
+			response.Error(c, 500, nil, "项目id不能为空")
+			return
+		}
+		if len(req.Status) == 0 {
+			response.Error(c, 500, nil, "状态不能为空")
+			return
+		}
+		resp, err := api.LabelerService.DownloadTask5SFT(c.Request.Context(), req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -399,7 +430,7 @@ func (api *LabelerAPI) DownloadScore() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "查询成功")
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -417,7 +448,7 @@ func (api *LabelerAPI) DownloadWorkload() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "查询成功")
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -470,6 +501,7 @@ func (api *LabelerAPI) Task5BatchAllocChecker() GinHandler {
 			response.Error(c, 400, nil, "项目id不能为空")
 			return
 		}
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		err := api.LabelerService.Task5BatchAllocChecker(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
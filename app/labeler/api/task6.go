@@ -115,13 +115,13 @@ func (api *LabelerAPI) SearchTask6() GinHandler {
 		req.UserID = p.UserId
 		req.DataScope = p.DataScope
 
-		resp, total, err := api.LabelerService.SearchTask6(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchTask6(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -138,6 +138,7 @@ func (api *LabelerAPI) Task6BatchAllocLabeler() GinHandler {
 			return
 		}
 
+		req.Actor = strconv.Itoa(actions.GetPermissionFromContext(c).UserId)
 		resp, err := api.LabelerService.Task6BatchAllocLabeler(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
@@ -177,6 +178,7 @@ func (api *LabelerAPI) ResetTasks6() GinHandler {
 			response.Error(c, 400, nil, "重置类型错误")
 			return
 		}
+		req.Actor = strconv.Itoa(p.UserId)
 		resp, err := api.LabelerService.ResetTasks6(c.Request.Context(), req)
 		if err != nil {
 			response.Error(c, 500, err, "")
@@ -204,6 +206,9 @@ func (api *LabelerAPI) UpdateTask6() GinHandler {
 		req.UserDataScope = p.DataScope
 		resp, err := api.LabelerService.UpdateTask6(c, req)
 		if err != nil {
+			if VersionConflict(c, err, resp) {
+				return
+			}
 			response.Error(c, 500, err, "")
 			return
 		}
@@ -250,13 +255,13 @@ func (api *LabelerAPI) SearchMyTask6() GinHandler {
 		}
 		p := actions.GetPermissionFromContext(c)
 		req.UserID = strconv.Itoa(p.UserId)
-		resp, total, err := api.LabelerService.SearchMyTask6(c.Request.Context(), req)
+		resp, page, err := api.LabelerService.SearchMyTask6(c.Request.Context(), req)
 		if err != nil {
 			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.PageOK(c, resp, total, req.PageIndex, req.PageSize, "查询成功")
+		PageOK(c, resp, page, req.PageIndex, req.PageSize, "查询成功")
 	}
 }
 
@@ -302,7 +307,7 @@ func (api *LabelerAPI) DownloadTask6() GinHandler {
 			response.Error(c, 500, err, "")
 			return
 		}
-		response.OK(c, resp, "下载成功")
+		response.OK(c, resp, "已创建导出任务")
 	}
 }
 
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/actions"
+	"go-admin/common/log"
+)
+
+func init() {
+	routerCheckRole = append(routerCheckRole, trashAuthRouter())
+}
+
+func trashAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.GET("/api/v1/labeler/"+name+"/trash", api.SearchTrash(name))
+			g.POST("/api/v1/labeler/"+name+"/trash/:id/restore", api.RestoreTrash(name))
+			g.DELETE("/api/v1/labeler/"+name+"/trash/:id", api.PurgeTrash(name))
+		}
+	}
+}
+
+// requireAdmin 回收站只有管理员可以操作，不是管理员时返回错误
+func requireAdmin(c *gin.Context) bool {
+	p := actions.GetPermissionFromContext(c)
+	if p.DataScope != "1" && p.DataScope != "2" {
+		response.Error(c, http.StatusUnauthorized, nil, "当前用户没有操作权限")
+		return false
+	}
+	return true
+}
+
+func (api *LabelerAPI) SearchTrash(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.SearchTrashReq
+		if err := c.ShouldBindQuery(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, count, err := api.LabelerService.SearchTrash(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.PageOK(c, resp, count, req.GetPageIndex(), req.GetPageSize(), "")
+	}
+}
+
+func (api *LabelerAPI) RestoreTrash(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.RestoreTrash(c.Request.Context(), taskType, oid); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "恢复成功")
+	}
+}
+
+func (api *LabelerAPI) PurgeTrash(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.PurgeTrash(c.Request.Context(), taskType, oid); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "已彻底删除")
+	}
+}
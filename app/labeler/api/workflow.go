@@ -0,0 +1,98 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"go-admin/app/labeler/service"
+	"go-admin/common/log"
+)
+
+// taskTypeNames 已注册的任务类型，与路由 /api/v1/labeler/{name}/ 对应
+var taskTypeNames = []string{"t", "t2", "t3", "t4", "t5", "t6"}
+
+func init() {
+	routerCheckRole = append(routerCheckRole, workflowAuthRouter())
+}
+
+func workflowAuthRouter() RouterCheckRole {
+	return func(g *gin.RouterGroup, api *LabelerAPI, authMiddleware *jwt.GinJWTMiddleware) {
+		for _, name := range taskTypeNames {
+			g.GET("/api/v1/labeler/"+name+"/workflow", api.GetWorkflow(name))
+			g.PUT("/api/v1/labeler/"+name+"/workflow", api.SaveWorkflow(name))
+			g.DELETE("/api/v1/labeler/"+name+"/workflow", api.DeleteWorkflow(name))
+			g.GET("/api/v1/labeler/"+name+"/transitions", api.GetTaskTransitions(name))
+		}
+	}
+}
+
+func (api *LabelerAPI) GetWorkflow(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		oid, err := QueryObjectID(c)
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetWorkflow(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
+
+func (api *LabelerAPI) SaveWorkflow(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req service.SaveWorkflowReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Logger().WithContext(c.Request.Context()).Error(err.Error())
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.SaveWorkflow(c.Request.Context(), taskType, req)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "保存成功")
+	}
+}
+
+func (api *LabelerAPI) DeleteWorkflow(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		oid, err := QueryObjectID(c)
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		if err := api.LabelerService.DeleteWorkflow(c.Request.Context(), taskType, oid); err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, nil, "已恢复默认流程")
+	}
+}
+
+func (api *LabelerAPI) GetTaskTransitions(taskType string) GinHandler {
+	return func(c *gin.Context) {
+		oid, err := QueryObjectID(c)
+		if err != nil {
+			response.Error(c, 400, err, "参数异常")
+			return
+		}
+		resp, err := api.LabelerService.GetTaskTransitions(c.Request.Context(), taskType, oid)
+		if err != nil {
+			response.Error(c, 500, err, "")
+			return
+		}
+		response.OK(c, resp, "")
+	}
+}
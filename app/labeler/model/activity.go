@@ -0,0 +1,45 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+const (
+	ActivityUpload      = "上传"
+	ActivityAllocate    = "分配"
+	ActivityClaim       = "领取"
+	ActivitySave        = "保存"
+	ActivitySubmit      = "提交"
+	ActivityPass        = "审核通过"
+	ActivityFail        = "审核不通过"
+	ActivityStatus      = "修改状态"
+	ActivityReset       = "重置"
+	ActivityDelete      = "删除"
+	ActivityRestore     = "恢复"
+	ActivityComment     = "备注"
+	ActivityPreAnnotate = "预标注"
+	ActivityAdjudicate  = "裁决"
+	ActivityReclaim     = "回收"
+)
+
+// TaskActivity 任务动态，每次修改任务记录一条，存放在 task_activity 中
+type TaskActivity struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskID    primitive.ObjectID `bson:"taskId" json:"taskId"`
+	Activity  `bson:",inline"`
+	NickName  string        `bson:"-" json:"nickName"`
+	Changes   []FieldChange `bson:"changes,omitempty" json:"changes"`
+	// CreateTime 动态产生的时间
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+}
+
+// FieldChange 字段级别的修改，Field 用 . 分隔，数组用下标
+type FieldChange struct {
+	Field string      `bson:"field" json:"field"`
+	Old   interface{} `bson:"old" json:"old"`
+	New   interface{} `bson:"new" json:"new"`
+}
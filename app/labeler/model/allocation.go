@@ -0,0 +1,36 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// 分配策略
+const (
+	// AllocStrategyEven 平均分配，每人最多分到 任务数/人数 个
+	AllocStrategyEven = "even"
+	// AllocStrategyLeastLoaded 优先分给未完成任务最少的人
+	AllocStrategyLeastLoaded = "least_loaded"
+	// AllocStrategyWeighted 按人员的技能权重比例分配
+	AllocStrategyWeighted = "weighted"
+	// AllocStrategyGroup 同一组（会话、文件）的任务分给同一人
+	AllocStrategyGroup = "group"
+)
+
+var AllocStrategies = []string{AllocStrategyEven, AllocStrategyLeastLoaded, AllocStrategyWeighted, AllocStrategyGroup}
+
+// AllocationSetting 项目的分配策略配置，存放在 allocation_setting 中，各类型共用，未配置的项目平均分配
+type AllocationSetting struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	// Labeler 分配标注使用的策略，Checker 分配审核使用的策略
+	Labeler string `bson:"labeler" json:"labeler"`
+	Checker string `bson:"checker" json:"checker"`
+	// Weights 按技能加权时各人员的权重，没有配置的人员权重为 1，权重为 0 的人员不分配
+	Weights map[string]float64 `bson:"weights,omitempty" json:"weights"`
+	// GroupField 同组分配时任务的分组字段，如 name、sessionId，为空时使用任务类型的默认字段
+	GroupField string        `bson:"groupField,omitempty" json:"groupField"`
+	UpdateTime util.Datetime `bson:"updateTime" json:"updateTime"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// TaskComment 任务的评论，存放在 task_comment 中，各类型共用。
+// 没有 ThreadID 的评论开启一个讨论，回复的 ThreadID 为讨论第一条评论的 ID，解决状态记录在第一条评论上
+type TaskComment struct {
+	ID        primitive.ObjectID  `bson:"_id" json:"id"`
+	TaskType  string              `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID  `bson:"projectId" json:"projectId"`
+	TaskID    primitive.ObjectID  `bson:"taskId" json:"taskId"`
+	ThreadID  *primitive.ObjectID `bson:"threadId,omitempty" json:"threadId,omitempty"`
+	// Path 评论的任务字段，用 . 分隔，数组用下标，如 dialog.2、output.1，为空表示整个任务
+	Path     string   `bson:"path" json:"path"`
+	Author   string   `bson:"author" json:"author"`
+	NickName string   `bson:"-" json:"nickName"`
+	Content  string   `bson:"content" json:"content"`
+	Mentions []string `bson:"mentions,omitempty" json:"mentions"`
+	// Participants 讨论中评论过或被 @ 的用户，只记录在第一条评论上
+	Participants []string `bson:"participants,omitempty" json:"-"`
+	// LastAuthor 讨论中最后一条评论的作者，只记录在第一条评论上
+	LastAuthor   string        `bson:"lastAuthor,omitempty" json:"lastAuthor,omitempty"`
+	Resolved     bool          `bson:"resolved" json:"resolved"`
+	ResolvedBy   string        `bson:"resolvedBy,omitempty" json:"resolvedBy,omitempty"`
+	ResolvedTime util.Datetime `bson:"resolvedTime,omitempty" json:"resolvedTime,omitempty"`
+	CreateTime   util.Datetime `bson:"createTime" json:"createTime"`
+	UpdateTime   util.Datetime `bson:"updateTime" json:"updateTime"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+const (
+	ExportStatusWaiting = "等待中"
+	ExportStatusRunning = "导出中"
+	ExportStatusDone    = "已完成"
+	ExportStatusFailed  = "导出失败"
+)
+
+// ExportJob 后台导出任务，文件导出完成后保存在 MinIO 中
+type ExportJob struct {
+	ID primitive.ObjectID `bson:"_id" json:"id"`
+	// Type 导出类型，如 t2、t5score
+	Type string `bson:"type" json:"type"`
+	// Args 创建导出时的请求参数，json 格式
+	Args     string `bson:"args" json:"args"`
+	Status   string `bson:"status" json:"status"`
+	FileName string `bson:"fileName" json:"fileName"`
+	// ObjectName 文件在 MinIO 中的名称
+	ObjectName string `bson:"objectName" json:"-"`
+	// Total 需要导出的任务数，Done 已经导出的任务数
+	Total      int64         `bson:"total" json:"total"`
+	Done       int64         `bson:"done" json:"done"`
+	Error      string        `bson:"error,omitempty" json:"error,omitempty"`
+	Creator    string        `bson:"creator" json:"creator"`
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+	UpdateTime util.Datetime `bson:"updateTime" json:"updateTime"`
+	FinishTime util.Datetime `bson:"finishTime" json:"finishTime"`
+}
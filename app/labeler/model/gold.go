@@ -0,0 +1,40 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// GoldSetting 项目的金标准配置，Ratio 为 0 时不混入金标准任务
+type GoldSetting struct {
+	// Ratio 分配时混入的金标准任务占正常任务的比例
+	Ratio float64 `bson:"ratio" json:"ratio"`
+	// Threshold 标注员的金标准准确率低于该值时被标记
+	Threshold float64 `bson:"threshold" json:"threshold"`
+}
+
+// Gold 金标准任务的标准答案，保存在任务（t5 为待领取的对话）的 gold 字段上，不返回给前端。
+// 分配时为每个标注员复制一份，副本的 goldSource 指向金标准任务，提交后和标准答案比较
+type Gold struct {
+	// Answer 标准答案，字段和任务文档相同
+	Answer     bson.Raw      `bson:"answer"`
+	Creator    string        `bson:"creator"`
+	CreateTime util.Datetime `bson:"createTime"`
+}
+
+// GoldResult 标注员提交一个金标准任务的评分，每个副本一条，重新提交时覆盖
+type GoldResult struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskID    primitive.ObjectID `bson:"taskId" json:"taskId"`
+	GoldID    primitive.ObjectID `bson:"goldId" json:"goldId"`
+	Labeler   string             `bson:"labeler" json:"labeler"`
+	// Correct 和标准答案一致的标注项数，Total 标准答案的标注项数
+	Correct    int           `bson:"correct" json:"correct"`
+	Total      int           `bson:"total" json:"total"`
+	Accuracy   float64       `bson:"accuracy" json:"accuracy"`
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+const (
+	PreAnnotateStatusWaiting = "等待中"
+	PreAnnotateStatusRunning = "预标注中"
+	PreAnnotateStatusDone    = "已完成"
+	PreAnnotateStatusFailed  = "预标注失败"
+)
+
+// PreAnnotateJob 项目的后台预标注任务，用模型的预测结果填充项目中未分配的任务
+type PreAnnotateJob struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	// Overwrite 为 true 时重新预标注已经预标注过的任务
+	Overwrite bool   `bson:"overwrite" json:"overwrite"`
+	Status    string `bson:"status" json:"status"`
+	// ModelVersion 模型服务返回的模型版本
+	ModelVersion string `bson:"modelVersion" json:"modelVersion"`
+	// Total 需要预标注的任务数，Done 已经预标注的任务数，Skipped 预标注期间被修改或分配而跳过的任务数
+	Total      int64         `bson:"total" json:"total"`
+	Done       int64         `bson:"done" json:"done"`
+	Skipped    int64         `bson:"skipped" json:"skipped"`
+	Error      string        `bson:"error,omitempty" json:"error,omitempty"`
+	Creator    string        `bson:"creator" json:"creator"`
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+	UpdateTime util.Datetime `bson:"updateTime" json:"updateTime"`
+	FinishTime util.Datetime `bson:"finishTime" json:"finishTime"`
+}
+
+// PreAnnotation 任务的预标注记录，标注员在此基础上修改
+type PreAnnotation struct {
+	JobID        primitive.ObjectID `bson:"jobId" json:"jobId"`
+	ModelVersion string             `bson:"modelVersion" json:"modelVersion"`
+	CreateTime   util.Datetime      `bson:"createTime" json:"createTime"`
+}
@@ -8,6 +8,9 @@ type Project3 struct {
 	FolderID primitive.ObjectID `bson:"folderId" json:"folderId"`
 	Status   string             `bson:"status" json:"status"`
 	Schema   Schema3            `bson:"schema" json:"schema"`
+	// Overlap 每个任务由几个标注员独立标注，大于 1 时通过多人标注分配，裁决后得到任务的结果
+	Overlap int         `bson:"overlap" json:"overlap"`
+	Gold    GoldSetting `bson:"gold" json:"gold"`
 }
 
 type Schema3 struct {
@@ -1,10 +1,72 @@
 package model
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
 
 type Project5 struct {
 	ID       primitive.ObjectID `bson:"_id" json:"id"`
 	Name     string             `bson:"name" json:"name"`
 	FolderID primitive.ObjectID `bson:"folderId" json:"folderId"`
 	Status   string             `bson:"status" json:"status"`
+	// Rubrics 打分模板的所有版本，最后一个为当前版本；为空时使用 LegacyRubric
+	Rubrics []ScoreRubric `bson:"rubrics,omitempty" json:"rubrics"`
+	Gold    GoldSetting   `bson:"gold" json:"gold"`
+}
+
+// CurrentRubric 当前使用的打分模板
+func (p Project5) CurrentRubric() ScoreRubric {
+	if len(p.Rubrics) == 0 {
+		return LegacyRubric
+	}
+	return p.Rubrics[len(p.Rubrics)-1]
+}
+
+// Rubric 按版本查找打分模板，版本 0 为 LegacyRubric
+func (p Project5) Rubric(version int) (ScoreRubric, bool) {
+	if version == LegacyRubric.Version {
+		return LegacyRubric, true
+	}
+	for _, r := range p.Rubrics {
+		if r.Version == version {
+			return r, true
+		}
+	}
+	return ScoreRubric{}, false
+}
+
+// ScoreRubric 打分模板，保存后不再修改，修改模板时生成新版本，已有的打分按原版本解释
+type ScoreRubric struct {
+	Version    int              `bson:"version" json:"version"`
+	Dimensions []ScoreDimension `bson:"dimensions" json:"dimensions"`
+	CreateTime util.Datetime    `bson:"createTime" json:"createTime"`
+}
+
+// ScoreDimension 打分维度，Key 为分数在 Scores 中的键
+type ScoreDimension struct {
+	Key      string  `bson:"key" json:"key"`
+	Label    string  `bson:"label" json:"label"`
+	Min      int     `bson:"min" json:"min"`
+	Max      int     `bson:"max" json:"max"`
+	Required bool    `bson:"required" json:"required"`
+	Weight   float64 `bson:"weight" json:"weight"`
+}
+
+// LegacyRubric 配置打分模板之前使用的九个维度。键是接口和历史数据中的字段名，部分键名和维度含义不一致，
+// 以 Label 为准；键不能修改。Mongo 迁移 1792195260000 把没有打分模板的项目改为使用新键的版本 1
+var LegacyRubric = ScoreRubric{
+	Version: 0,
+	Dimensions: []ScoreDimension{
+		{Key: "identifyRisk", Label: "能准确识别风险并提出转介建议", Max: 5, Weight: 1},
+		{Key: "understandingVisitor", Label: "尊重、好奇地倾听和理解来访者", Max: 5, Weight: 1},
+		{Key: "respondingVisitor", Label: "向来访者表达适当的共情和关怀", Max: 5, Weight: 1},
+		{Key: "respectVisitor", Label: "接纳并恰当回应来访者的负面反馈", Max: 5, Weight: 1},
+		{Key: "acceptFeedback", Label: "在来访者所说的内容中选择并进行了恰当回应或提问以推进咨询进程", Max: 5, Weight: 1},
+		{Key: "advanceProcess", Label: "促进来访者在咨询中更多表达、呈现更多内容", Max: 5, Weight: 1},
+		{Key: "findSolution", Label: "启发或协助来访者有了解决方案或思路，或一小步的行动", Max: 5, Weight: 1},
+		{Key: "enoughContent", Label: "缓解了来访者的负面情绪/提升了其积极情绪", Max: 5, Weight: 1},
+		{Key: "visitorFeedback", Label: "来访者是否反馈良好", Max: 5, Weight: 1},
+	},
 }
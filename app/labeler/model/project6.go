@@ -1,10 +1,16 @@
 package model
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
 
 type Project6 struct {
 	ID       primitive.ObjectID `bson:"_id" json:"id"`
 	Name     string             `bson:"name" json:"name"`
 	FolderID primitive.ObjectID `bson:"folderId" json:"folderId"`
 	Status   string             `bson:"status" json:"status"`
+	// JSONSchema 任务 Rpg 需要符合的 JSON Schema（draft 2020-12），为空时不校验
+	JSONSchema util.GzipJSON `bson:"jsonSchema,omitempty" json:"jsonSchema,omitempty"`
 }
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// 质检任务的状态
+const (
+	QAStatusAllocate = "未分配"
+	QAStatusChecking = "待质检"
+	QAStatusDone     = "已质检"
+)
+
+// QABatch 一次质检抽样，存放在 qa_batch 中，各类型共用。抽中的任务进入 qa_item，不修改任务本身
+type QABatch struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	// Rate 每层的抽样比例，Stratify 分层方式，Field 按标注值分层时的字段
+	Rate     float64 `bson:"rate" json:"rate"`
+	Stratify string  `bson:"stratify" json:"stratify"`
+	Field    string  `bson:"field,omitempty" json:"field,omitempty"`
+	// MinPerLabeler 每个标注员至少抽几个任务，标注员的任务不够时全部抽中
+	MinPerLabeler int `bson:"minPerLabeler" json:"minPerLabeler"`
+	// Status 参与抽样的任务状态
+	Status     []string      `bson:"status" json:"status"`
+	Population int64         `bson:"population" json:"population"`
+	Sampled    int64         `bson:"sampled" json:"sampled"`
+	Strata     []QAStratum   `bson:"strata" json:"strata"`
+	Creator    string        `bson:"creator" json:"creator"`
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+}
+
+// QAStratum 一层的任务数和抽中的任务数
+type QAStratum struct {
+	Key        string `bson:"key" json:"key"`
+	Population int64  `bson:"population" json:"population"`
+	Sampled    int64  `bson:"sampled" json:"sampled"`
+}
+
+// QAItem 质检队列中的一个任务，存放在 qa_item 中。Labeler 为抽样时任务的标注员，质检员不能质检自己标注的任务
+type QAItem struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	BatchID   primitive.ObjectID `bson:"batchId" json:"batchId"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskID    primitive.ObjectID `bson:"taskId" json:"taskId"`
+	TaskName  string             `bson:"taskName" json:"taskName"`
+	Stratum   string             `bson:"stratum" json:"stratum"`
+	Labeler   string             `bson:"labeler" json:"labeler"`
+	Reviewer  string             `bson:"reviewer,omitempty" json:"reviewer"`
+	Status    string             `bson:"status" json:"status"`
+	// HasError 质检结果，任务的标注有错误
+	HasError     bool          `bson:"hasError" json:"hasError"`
+	Note         string        `bson:"note,omitempty" json:"note"`
+	CreateTime   util.Datetime `bson:"createTime" json:"createTime"`
+	AllocateTime util.Datetime `bson:"allocateTime,omitempty" json:"allocateTime"`
+	ReviewTime   util.Datetime `bson:"reviewTime,omitempty" json:"reviewTime"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// TaskSnapshot 任务在提交、审核和裁决后的完整内容，存放在 task_snapshot 中，各类型共用，写入后不再修改
+type TaskSnapshot struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskID    primitive.ObjectID `bson:"taskId" json:"taskId"`
+	// ActivityID 产生快照的任务动态
+	ActivityID primitive.ObjectID `bson:"activityId" json:"activityId"`
+	Activity   `bson:",inline"`
+	NickName   string `bson:"-" json:"nickName"`
+	// Version 快照时任务的版本号，Status 快照时任务的状态
+	Version int    `bson:"version" json:"version"`
+	Status  string `bson:"status" json:"status"`
+	// Document 任务文档，不包含 searchGrams
+	Document   bson.Raw      `bson:"document" json:"-"`
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+}
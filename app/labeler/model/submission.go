@@ -0,0 +1,31 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// Submission 多人标注时一个标注员对任务的独立标注，存放在 task_submission 中，各类型共用。
+// 状态为待标注或已提交，裁决后由裁决结果写回任务
+type Submission struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType  string             `bson:"taskType" json:"taskType"`
+	ProjectID primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskID    primitive.ObjectID `bson:"taskId" json:"taskId"`
+	Labeler   Person             `bson:"labeler" json:"labeler"`
+	Status    string             `bson:"status" json:"status"`
+	// Answer 标注结果，字段和任务文档相同，不包含任务内容
+	Answer     bson.Raw      `bson:"answer" json:"-"`
+	CreateTime util.Datetime `bson:"createTime" json:"createTime"`
+	UpdateTime util.Datetime `bson:"updateTime" json:"updateTime"`
+	SubmitTime util.Datetime `bson:"submitTime,omitempty" json:"submitTime"`
+}
+
+// Adjudication 任务的裁决记录，SubmissionID 为采用的标注，为空表示裁决人给出了新的结果
+type Adjudication struct {
+	SubmissionID *primitive.ObjectID `bson:"submissionId,omitempty" json:"submissionId,omitempty"`
+	Adjudicator  string              `bson:"adjudicator" json:"adjudicator"`
+	CreateTime   util.Datetime       `bson:"createTime" json:"createTime"`
+}
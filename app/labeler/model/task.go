@@ -25,9 +25,22 @@ type Task struct {
 	Contents    []Content          `bson:"contents" json:"contents"`
 	Activities  []Activity         `bson:"activities" json:"activities"`
 	UpdateTime  util.Datetime      `bson:"updateTime" json:"updateTime"`
+	Version     int                `bson:"version" json:"version"`
 	Comments    []Comment          `bson:"comments,omitempty" json:"comments,omitempty"`
 }
 
+// TaskMeta 各任务类型共有的字段，通用的分配、重置、状态流转和统计只读取这部分
+type TaskMeta struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	ProjectID   primitive.ObjectID `bson:"projectId" json:"projectId"`
+	Name        string             `bson:"name" json:"name"`
+	Status      string             `bson:"status" json:"status"`
+	Permissions Permissions        `bson:"permissions" json:"permissions"`
+	UpdateTime  util.Datetime      `bson:"updateTime" json:"updateTime"`
+	// Version 每次修改加一，用于发现并发修改，旧数据没有该字段按 0 处理
+	Version int `bson:"version" json:"version"`
+}
+
 type Comment struct {
 	ID         string        `bson:"id" json:"id"`
 	Content    string        `bson:"content" json:"content"`
@@ -56,6 +69,14 @@ func (p Permissions) IsChecker(id string) bool {
 	return p.Checker != nil && p.Checker.ID == id
 }
 
+// LabelerID 标注员 ID，未分配时为空
+func (p Permissions) LabelerID() string {
+	if p.Labeler == nil {
+		return ""
+	}
+	return p.Labeler.ID
+}
+
 type Person struct {
 	ID       string `bson:"id" json:"id"`
 	NickName string `json:"nickName"`
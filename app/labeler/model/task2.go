@@ -17,12 +17,17 @@ type Task2LabelItem struct {
 }
 
 type Task2 struct {
-	ID          primitive.ObjectID `bson:"_id" json:"id"`
-	Name        string             `bson:"name" json:"name"`
-	ProjectID   primitive.ObjectID `bson:"projectId" json:"projectId"`
-	Status      string             `bson:"status" json:"status"`
-	Permissions Permissions        `bson:"permissions" json:"permissions"`
-	UpdateTime  util.Datetime      `bson:"updateTime" json:"updateTime"`
-	Contents    []Task2ContentItem `bson:"contents" json:"contents"`
-	Labels      []Task2LabelItem   `bson:"labels" json:"labels"`
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Name          string             `bson:"name" json:"name"`
+	ProjectID     primitive.ObjectID `bson:"projectId" json:"projectId"`
+	Status        string             `bson:"status" json:"status"`
+	Permissions   Permissions        `bson:"permissions" json:"permissions"`
+	UpdateTime    util.Datetime      `bson:"updateTime" json:"updateTime"`
+	Version       int                `bson:"version" json:"version"`
+	Contents      []Task2ContentItem `bson:"contents" json:"contents"`
+	Labels        []Task2LabelItem   `bson:"labels" json:"labels"`
+	PreAnnotation *PreAnnotation     `bson:"preAnnotation,omitempty" json:"preAnnotation,omitempty"`
+	Adjudication  *Adjudication      `bson:"adjudication,omitempty" json:"adjudication,omitempty"`
+	// GoldSource 金标准任务的副本指向的金标准任务，不返回给前端
+	GoldSource *primitive.ObjectID `bson:"goldSource,omitempty" json:"-"`
 }
@@ -47,12 +47,17 @@ type Judgment struct {
 	Value string `bson:"value" json:"value"`
 }
 type Task3 struct {
-	ID          primitive.ObjectID `bson:"_id" json:"id"`
-	Name        string             `bson:"name" json:"name"`
-	ProjectID   primitive.ObjectID `bson:"projectId" json:"projectId"`
-	Status      string             `bson:"status" json:"status"`
-	Permissions Permissions        `bson:"permissions" json:"permissions"`
-	UpdateTime  util.Datetime      `bson:"updateTime" json:"updateTime"`
-	Command     Task3CommandItem   `bson:"command" json:"command"`
-	Output      []Task3OutputItem  `bson:"output" json:"output"`
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Name          string             `bson:"name" json:"name"`
+	ProjectID     primitive.ObjectID `bson:"projectId" json:"projectId"`
+	Status        string             `bson:"status" json:"status"`
+	Permissions   Permissions        `bson:"permissions" json:"permissions"`
+	UpdateTime    util.Datetime      `bson:"updateTime" json:"updateTime"`
+	Version       int                `bson:"version" json:"version"`
+	Command       Task3CommandItem   `bson:"command" json:"command"`
+	Output        []Task3OutputItem  `bson:"output" json:"output"`
+	PreAnnotation *PreAnnotation     `bson:"preAnnotation,omitempty" json:"preAnnotation,omitempty"`
+	Adjudication  *Adjudication      `bson:"adjudication,omitempty" json:"adjudication,omitempty"`
+	// GoldSource 金标准任务的副本指向的金标准任务，不返回给前端
+	GoldSource *primitive.ObjectID `bson:"goldSource,omitempty" json:"-"`
 }
@@ -11,12 +11,15 @@ type Task5 struct {
 	Name           string             `bson:"name" json:"name"`
 	FullName       string             `bson:"fullName" json:"fullName"`
 	ProjectID      primitive.ObjectID `bson:"projectId" json:"projectId"`
+	SessionID      string             `bson:"sessionId,omitempty" json:"sessionId,omitempty"` //领取时写入，与标注员一起唯一
 	Status         string             `bson:"status" json:"status"`
 	Permissions    Permissions        `bson:"permissions" json:"permissions"`
 	UpdateTime     util.Datetime      `bson:"updateTime" json:"updateTime"`
+	Version        int                `bson:"version" json:"version"`
 	SubmittedTime  util.Datetime      `bson:"submittedTime" json:"submittedTime"`
 	ApprovedTime   util.Datetime      `bson:"approvedTime" json:"approvedTime"`
 	UnsanctionTime util.Datetime      `bson:"unsanctionTime" json:"unsanctionTime"`
+	AllocatedTime  util.Datetime      `bson:"allocatedTime" json:"allocatedTime"` //领取时间
 	Dialog         []ContentText      `bson:"dialog" json:"dialog"`
 	Remark         string             `bson:"remark" json:"remark"`
 	RemarkLen      int                `bson:"remarkLen" json:"remarkLen"`
@@ -25,30 +28,18 @@ type Task5 struct {
 	EditQuantity   int                `bson:"editQuantity" json:"editQuantity"` //修改量
 	WorkQuantity   int                `bson:"workQuantity" json:"workQuantity"` //工作量
 	Score          Scores             `bson:"score" json:"score"`
+	ScoreVersion   int                `bson:"scoreVersion" json:"scoreVersion"` //打分使用的模板版本
+	ScoreTotal     float64            `bson:"scoreTotal" json:"scoreTotal"`     //加权总分
 	HasScore       bool               `bson:"hasScore" json:"hasScore"`
 	RequireScore   int                `bson:"requireScore" json:"requireScore"`
+	// GoldSource 金标准对话的副本指向待领取的金标准对话，不返回给前端
+	GoldSource *primitive.ObjectID `bson:"goldSource,omitempty" json:"-"`
+	// LeaseExpireTime 待标注时租约的到期时间，到期未续约的对话被回收，归还到待领取的对话中
+	LeaseExpireTime util.Datetime `bson:"leaseExpireTime" json:"leaseExpireTime"`
 }
 
-type Scores struct {
-	//能准确识别风险并提出转介建议
-	IdentifyRisk int `bson:"identifyRisk" json:"identifyRisk"`
-	//尊重、好奇地倾听和理解来访者
-	UnderstandingVisitor int `bson:"understandingVisitor" json:"understandingVisitor"`
-	//向来访者表达适当的共情和关怀
-	ExpressingCare int `bson:"respondingVisitor" json:"respondingVisitor"`
-	//接纳并恰当回应来访者的负面反馈
-	AcceptFeedback int `bson:"respectVisitor" json:"respectVisitor"`
-	//在来访者所说的内容中选择并进行了恰当回应或提问以推进咨询进程
-	AdvanceProcess int `bson:"acceptFeedback" json:"acceptFeedback"`
-	//促进来访者在咨询中更多表达、呈现更多内容
-	PromoteProcess int `bson:"advanceProcess" json:"advanceProcess"`
-	//启发或协助来访者有了解决方案或思路，或一小步的行动
-	InspirationAssistance int `bson:"findSolution" json:"findSolution"`
-	//缓解了来访者的负面情绪/提升了其积极情绪
-	RelieveEmotions int `bson:"enoughContent" json:"enoughContent"`
-	//来访者是否反馈良好
-	VisitorFeedback int `bson:"visitorFeedback" json:"visitorFeedback"`
-}
+// Scores 打分维度的键到分数，维度由任务的 ScoreVersion 对应的打分模板决定
+type Scores map[string]int
 
 type ContentText struct {
 	SessionID         string         `bson:"sessionId" json:"session_id"`
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+const (
+	TrashKindFolder  = "文件夹"
+	TrashKindProject = "项目"
+	TrashKindTask    = "任务"
+)
+
+// Trash 回收站中的一次删除，删除文件夹或项目时其下的数据一起删除。
+// 被删除的文档上写入 deletedAt、deletedBy 和 deletedBatch，deletedBatch 为本记录的 ID
+type Trash struct {
+	ID       primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType string             `bson:"taskType" json:"taskType"`
+	// Kind 删除的是文件夹、项目还是任务
+	Kind     string             `bson:"kind" json:"kind"`
+	TargetID primitive.ObjectID `bson:"targetId" json:"targetId"`
+	Name     string             `bson:"name" json:"name"`
+	// 一起删除的文件夹、项目和任务数量
+	Folders   int64         `bson:"folders" json:"folders"`
+	Projects  int64         `bson:"projects" json:"projects"`
+	Tasks     int64         `bson:"tasks" json:"tasks"`
+	DeletedBy string        `bson:"deletedBy" json:"deletedBy"`
+	NickName  string        `bson:"-" json:"nickName"`
+	DeletedAt util.Datetime `bson:"deletedAt" json:"deletedAt"`
+}
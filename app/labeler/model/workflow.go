@@ -0,0 +1,96 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/common/util"
+)
+
+// TaskStatuses 默认流程中的任务状态
+var TaskStatuses = []string{
+	TaskStatusAllocate,
+	TaskStatusLabeling,
+	TaskStatusSubmit,
+	TaskStatusChecking,
+	TaskStatusPassed,
+	TaskStatusFailed,
+}
+
+// Workflow 项目的任务状态流转定义，未配置的项目使用任务类型的默认流程
+type Workflow struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	ProjectID   primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskType    string             `bson:"taskType" json:"taskType"`
+	States      []string           `bson:"states" json:"states"`
+	Transitions []Transition       `bson:"transitions" json:"transitions"`
+	UpdateTime  util.Datetime      `bson:"updateTime" json:"updateTime"`
+}
+
+type Transition struct {
+	// From 为空表示任意状态
+	From []string `bson:"from" json:"from"`
+	To   string   `bson:"to" json:"to"`
+	// Roles 允许执行的角色：标注、审核、管理员
+	Roles []string `bson:"roles" json:"roles"`
+	// Required 流转前必须填写的字段，如 labels、dialog.0.content
+	Required []string `bson:"required,omitempty" json:"required"`
+}
+
+func (w Workflow) HasState(state string) bool {
+	for _, s := range w.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Find 查找 roles 中任一角色可以执行的 from -> to 流转
+func (w Workflow) Find(from string, to string, roles []string) (Transition, bool) {
+	for _, t := range w.Transitions {
+		if t.To != to || !t.allowFrom(from) {
+			continue
+		}
+		for _, role := range roles {
+			if t.allowRole(role) {
+				return t, true
+			}
+		}
+	}
+	return Transition{}, false
+}
+
+func (t Transition) allowFrom(from string) bool {
+	if len(t.From) == 0 {
+		return true
+	}
+	for _, s := range t.From {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Transition) allowRole(role string) bool {
+	for _, r := range t.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskTransition 任务状态流转记录
+type TaskTransition struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	TaskType   string             `bson:"taskType" json:"taskType"`
+	ProjectID  primitive.ObjectID `bson:"projectId" json:"projectId"`
+	TaskID     primitive.ObjectID `bson:"taskId" json:"taskId"`
+	From       string             `bson:"from" json:"from"`
+	To         string             `bson:"to" json:"to"`
+	Actor      string             `bson:"actor" json:"actor"`
+	Role       string             `bson:"role" json:"role"`
+	Reason     string             `bson:"reason" json:"reason"`
+	CreateTime util.Datetime      `bson:"createTime" json:"createTime"`
+}
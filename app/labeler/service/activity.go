@@ -0,0 +1,274 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/actions"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+const PermissionTypeSystem = "系统"
+
+// operator 当前请求的用户，后台任务中没有用户
+func operator(ctx context.Context) (userID string, admin bool) {
+	p := actions.GetPermissionFromContext(ctx)
+	if p.UserId == 0 {
+		return "", false
+	}
+	return strconv.Itoa(p.UserId), p.DataScope == "1" || p.DataScope == "2"
+}
+
+// activityRole 用户修改任务时的角色
+func activityRole(p model.Permissions, userID string, admin bool) string {
+	switch {
+	case userID == "":
+		return PermissionTypeSystem
+	case p.IsChecker(userID):
+		return PermissionTypeChecker
+	case p.IsLabeler(userID):
+		return PermissionTypeLabeler
+	case admin:
+		return PermissionTypeAdmin
+	}
+	return ""
+}
+
+// statusAction 修改到目标状态对应的动态
+func statusAction(status string) string {
+	switch status {
+	case model.TaskStatusSubmit:
+		return model.ActivitySubmit
+	case model.TaskStatusPassed:
+		return model.ActivityPass
+	case model.TaskStatusFailed:
+		return model.ActivityFail
+	}
+	return model.ActivityStatus
+}
+
+// newActivity 生成当前用户对任务的一条动态
+func (t *TaskType) newActivity(ctx context.Context, meta model.TaskMeta, action string, changes []model.FieldChange) model.TaskActivity {
+	userID, admin := operator(ctx)
+	return model.TaskActivity{
+		ID:        primitive.NewObjectID(),
+		TaskType:  t.Name,
+		ProjectID: meta.ProjectID,
+		TaskID:    meta.ID,
+		Activity: model.Activity{
+			User:   userID,
+			Role:   activityRole(meta.Permissions, userID, admin),
+			Action: action,
+		},
+		Changes:    changes,
+		CreateTime: util.Datetime(time.Now()),
+	}
+}
+
+func (t *TaskType) recordActivities(ctx context.Context, activities []model.TaskActivity) error {
+	if len(activities) == 0 {
+		return nil
+	}
+	if _, err := t.Activities.InsertMany(ctx, util.Map(activities, func(v model.TaskActivity) any { return v })); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// updateRetries 读取任务后任务被其他人修改时重试的次数
+const updateRetries = 3
+
+// updateOne 修改一个不在回收站中的任务、版本号加一并记录带字段差异的动态，filter 没有匹配到任务时返回 false。
+// 先读取修改前的任务，再按读到的版本号修改并返回修改后的任务，保证动态和快照比较的是相邻的两个版本；
+// 重试 updateRetries 次后任务仍在被其他人修改时返回 ErrVersionConflict
+func (t *TaskType) updateOne(ctx context.Context, filter bson.M, update bson.M, action string) (bool, error) {
+	inc, _ := update["$inc"].(bson.M)
+	if inc == nil {
+		inc = bson.M{}
+	}
+	inc["version"] = 1
+	update["$inc"] = inc
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for i := 0; i < updateRetries; i++ {
+		before, err := t.Tasks.FindOne(ctx, notDeleted(filter)).DecodeBytes()
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return false, nil
+			}
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return false, err
+		}
+		var meta model.TaskMeta
+		if err := bson.Unmarshal(before, &meta); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return false, err
+		}
+		ft := bson.M{"$and": bson.A{filter, versionFilter(bson.M{"_id": meta.ID}, meta.Version)}}
+		after, err := t.Tasks.FindOneAndUpdate(ctx, notDeleted(ft), update, opts).DecodeBytes()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return false, err
+		}
+		if err := t.refreshSearchGrams(ctx, after); err != nil {
+			return true, err
+		}
+		activity := t.newActivity(ctx, meta, action, diffDocument("", before, after))
+		if err := t.recordActivities(ctx, []model.TaskActivity{activity}); err != nil {
+			return true, err
+		}
+		return true, t.recordSnapshot(ctx, activity, after)
+	}
+	return false, ErrVersionConflict
+}
+
+// diffDocument 比较两个文档的字段差异，数组按下标比较，不比较 updateTime、version 和 searchGrams
+func diffDocument(path string, a, b bson.Raw) []model.FieldChange {
+	var changes []model.FieldChange
+	elements, _ := a.Elements()
+	seen := make(map[string]bool, len(elements))
+	for _, e := range elements {
+		key := e.Key()
+		seen[key] = true
+		if path == "" && ignoredField(key) {
+			continue
+		}
+		other, _ := b.LookupErr(key)
+		changes = append(changes, diffValue(joinPath(path, key), e.Value(), other)...)
+	}
+	elements, _ = b.Elements()
+	for _, e := range elements {
+		key := e.Key()
+		if seen[key] || (path == "" && ignoredField(key)) {
+			continue
+		}
+		changes = append(changes, diffValue(joinPath(path, key), bson.RawValue{}, e.Value())...)
+	}
+	return changes
+}
+
+func ignoredField(key string) bool {
+	return key == "updateTime" || key == "version" || key == "searchGrams"
+}
+
+func diffValue(path string, a, b bson.RawValue) []model.FieldChange {
+	if a.Type == b.Type && bytes.Equal(a.Value, b.Value) {
+		return nil
+	}
+	if a.Type == bsontype.EmbeddedDocument && b.Type == bsontype.EmbeddedDocument {
+		return diffDocument(path, a.Document(), b.Document())
+	}
+	if a.Type == bsontype.Array && b.Type == bsontype.Array {
+		av, _ := a.Array().Values()
+		bv, _ := b.Array().Values()
+		var changes []model.FieldChange
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			var x, y bson.RawValue
+			if i < len(av) {
+				x = av[i]
+			}
+			if i < len(bv) {
+				y = bv[i]
+			}
+			changes = append(changes, diffValue(joinPath(path, strconv.Itoa(i)), x, y)...)
+		}
+		return changes
+	}
+	return []model.FieldChange{{Field: path, Old: rawInterface(a), New: rawInterface(b)}}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// rawInterface 转为可以保存和输出的值，二进制内容只记录长度
+func rawInterface(v bson.RawValue) interface{} {
+	switch v.Type {
+	case 0, bsontype.Null, bsontype.Undefined:
+		return nil
+	case bsontype.Binary:
+		_, data := v.Binary()
+		return fmt.Sprintf("二进制数据 %d 字节", len(data))
+	}
+	var x interface{}
+	if err := v.Unmarshal(&x); err != nil {
+		return v.String()
+	}
+	return x
+}
+
+type TaskHistoryResp = model.TaskActivity
+
+// TaskHistory 查询任务的动态，管理员可以查看所有任务，其他人只能查看自己标注或审核的任务
+func (svc *LabelerService) TaskHistory(ctx context.Context, taskID primitive.ObjectID) ([]TaskHistoryResp, error) {
+	if err := svc.checkTaskViewer(ctx, "", taskID); err != nil {
+		return nil, err
+	}
+	cursor, err := svc.CollectionTaskActivity.Find(ctx, bson.M{"taskId": taskID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	res := make([]TaskHistoryResp, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	userMap := svc.userNickNames(ctx, util.Map(res, func(v TaskHistoryResp) string { return v.User }))
+	for i := range res {
+		res[i].NickName = userMap[res[i].User]
+	}
+	return res, nil
+}
+
+// checkTaskViewer 管理员可以查看所有任务，其他人只能查看自己标注或审核的任务；taskType 为空时在所有任务类型中查找任务
+func (svc *LabelerService) checkTaskViewer(ctx context.Context, taskType string, taskID primitive.ObjectID) error {
+	userID, admin := operator(ctx)
+	if admin {
+		return nil
+	}
+	types := make([]*TaskType, 0, len(svc.TaskTypes))
+	if taskType == "" {
+		for _, t := range svc.TaskTypes {
+			types = append(types, t)
+		}
+	} else {
+		t, err := svc.TaskType(taskType)
+		if err != nil {
+			return err
+		}
+		types = append(types, t)
+	}
+	for _, t := range types {
+		tasks, err := findMeta(ctx, t.Tasks, bson.M{"_id": taskID})
+		if err != nil {
+			return err
+		}
+		if len(tasks) > 0 {
+			if tasks[0].Permissions.IsLabeler(userID) || tasks[0].Permissions.IsChecker(userID) {
+				return nil
+			}
+			break
+		}
+	}
+	return errors.New("权限不足")
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"math"
+	"sort"
+)
+
+// 一致性统计，结果无法计算（样本不足或者只有一种取值）时返回 nil
+
+// fleissKappa 多个标注员对分类标注的一致性，units 为每个标注项各类别的标注人数，
+// 每项的标注人数可以不同，少于 2 人的项不参与统计
+func fleissKappa(units []map[string]int) *float64 {
+	var agreement, total float64
+	var count int
+	categories := make(map[string]float64)
+	for _, unit := range units {
+		n := 0
+		for _, c := range unit {
+			n += c
+		}
+		if n < 2 {
+			continue
+		}
+		var same float64
+		for category, c := range unit {
+			same += float64(c * (c - 1))
+			categories[category] += float64(c)
+		}
+		agreement += same / float64(n*(n-1))
+		total += float64(n)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+	observed := agreement / float64(count)
+	var expected float64
+	for _, c := range categories {
+		p := c / total
+		expected += p * p
+	}
+	if expected == 1 {
+		return nil
+	}
+	return ratio((observed - expected) / (1 - expected))
+}
+
+// cohenKappa 两个标注员对同一批项的分类标注的一致性，a、b 按下标对应
+func cohenKappa(a, b []string) *float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return nil
+	}
+	n := float64(len(a))
+	var same float64
+	countA := make(map[string]float64)
+	countB := make(map[string]float64)
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+		countA[a[i]]++
+		countB[b[i]]++
+	}
+	observed := same / n
+	var expected float64
+	for category, c := range countA {
+		expected += c / n * countB[category] / n
+	}
+	if expected == 1 {
+		return nil
+	}
+	return ratio((observed - expected) / (1 - expected))
+}
+
+// observedDisagreement Krippendorff's alpha 中各项内部的差异，返回平均差异和参与统计的取值，少于 2 个取值的项不参与统计
+func observedDisagreement[V any](units [][]V, delta func(a, b V) float64) (float64, []V) {
+	var values []V
+	var disagreement float64
+	for _, unit := range units {
+		m := len(unit)
+		if m < 2 {
+			continue
+		}
+		var d float64
+		for i := range unit {
+			for j := range unit {
+				if i != j {
+					d += delta(unit[i], unit[j])
+				}
+			}
+		}
+		disagreement += d / float64(m-1)
+		values = append(values, unit...)
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	return disagreement / float64(len(values)), values
+}
+
+// alphaNominal 分类标注的 Krippendorff's alpha，允许任意多个标注员和缺失
+func alphaNominal(units [][]string) *float64 {
+	observed, values := observedDisagreement(units, nominalDelta)
+	n := float64(len(values))
+	if n < 2 {
+		return nil
+	}
+	counts := make(map[string]float64)
+	for _, v := range values {
+		counts[v]++
+	}
+	var same float64
+	for _, c := range counts {
+		same += c * c
+	}
+	expected := (n*n - same) / (n * (n - 1))
+	if expected == 0 {
+		return nil
+	}
+	return ratio(1 - observed/expected)
+}
+
+// alphaInterval 分数的 Krippendorff's alpha，差异为分数差的平方
+func alphaInterval(units [][]float64) *float64 {
+	observed, values := observedDisagreement(units, intervalDelta)
+	n := float64(len(values))
+	if n < 2 {
+		return nil
+	}
+	var sum, sumSq float64
+	for _, v := range values {
+		sum += v
+		sumSq += v * v
+	}
+	expected := (2*n*sumSq - 2*sum*sum) / (n * (n - 1))
+	if expected <= 0 {
+		return nil
+	}
+	return ratio(1 - observed/expected)
+}
+
+func nominalDelta(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	return 1
+}
+
+func intervalDelta(a, b float64) float64 {
+	return (a - b) * (a - b)
+}
+
+// spearman 两个标注员对同一批项打分的等级相关系数，相同的分数取平均等级
+func spearman(a, b []float64) *float64 {
+	if len(a) < 2 || len(a) != len(b) {
+		return nil
+	}
+	ra, rb := ranks(a), ranks(b)
+	n := float64(len(a))
+	var meanA, meanB float64
+	for i := range ra {
+		meanA += ra[i]
+		meanB += rb[i]
+	}
+	meanA /= n
+	meanB /= n
+	var cov, varA, varB float64
+	for i := range ra {
+		cov += (ra[i] - meanA) * (rb[i] - meanB)
+		varA += (ra[i] - meanA) * (ra[i] - meanA)
+		varB += (rb[i] - meanB) * (rb[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return nil
+	}
+	return ratio(cov / math.Sqrt(varA*varB))
+}
+
+func ranks(values []float64) []float64 {
+	index := make([]int, len(values))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool { return values[index[i]] < values[index[j]] })
+	res := make([]float64, len(values))
+	for i := 0; i < len(index); {
+		j := i
+		for j+1 < len(index) && values[index[j+1]] == values[index[i]] {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			res[index[k]] = rank
+		}
+		i = j + 1
+	}
+	return res
+}
+
+// ratio 保留 4 位小数
+func ratio(v float64) *float64 {
+	v = math.Round(v*10000) / 10000
+	return &v
+}
@@ -0,0 +1,38 @@
+package service
+
+import "testing"
+
+func TestAgreementStats(t *testing.T) {
+	check := func(t *testing.T, got *float64, want float64) {
+		t.Helper()
+		if got == nil {
+			t.Fatalf("want %v got nil", want)
+		}
+		if *got != want {
+			t.Errorf("want %v got %v", want, *got)
+		}
+	}
+	t.Run("cohen", func(t *testing.T) {
+		check(t, cohenKappa([]string{"y", "y", "n", "n"}, []string{"y", "n", "n", "n"}), 0.5)
+	})
+	t.Run("cohen single category", func(t *testing.T) {
+		if got := cohenKappa([]string{"y", "y"}, []string{"y", "y"}); got != nil {
+			t.Errorf("want nil got %v", *got)
+		}
+	})
+	t.Run("fleiss", func(t *testing.T) {
+		check(t, fleissKappa([]map[string]int{{"a": 3}, {"b": 3}}), 1)
+		check(t, fleissKappa([]map[string]int{{"a": 2, "b": 1}, {"a": 1, "b": 2}}), -0.3333)
+	})
+	t.Run("alpha nominal", func(t *testing.T) {
+		check(t, alphaNominal([][]string{{"a", "a"}, {"b", "b"}}), 1)
+		check(t, alphaNominal([][]string{{"a", "b"}, {"a", "b"}, {"a"}}), -0.5)
+	})
+	t.Run("alpha interval", func(t *testing.T) {
+		check(t, alphaInterval([][]float64{{1, 2}, {3, 4}}), 0.7)
+	})
+	t.Run("spearman", func(t *testing.T) {
+		check(t, spearman([]float64{1, 2, 3}, []float64{3, 2, 1}), -1)
+		check(t, spearman([]float64{1, 2, 2, 3}, []float64{1, 2, 2, 3}), 1)
+	})
+}
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+// AllocTask 待分配的任务
+type AllocTask struct {
+	Meta model.TaskMeta
+	// Group 同组分配时任务所属的组，为空时任务自成一组
+	Group string
+}
+
+// AllocInput 分配策略的输入，Tasks 按优先分配的顺序排列
+type AllocInput struct {
+	Tasks   []AllocTask
+	Persons []string
+	// Number 本次最多分配的任务数
+	Number int
+	// Load 每人当前未完成的任务数
+	Load map[string]int
+	// Weights 每人的权重，没有配置的人员为 1
+	Weights map[string]float64
+	// Owners 组已经分给的人员，同组分配时沿用
+	Owners map[string]string
+	// Exclude 任务不能分给该人员时返回 true，如审核员不能审核自己标注的任务
+	Exclude func(task model.TaskMeta, person string) bool
+}
+
+func (in AllocInput) excluded(task model.TaskMeta, person string) bool {
+	return in.Exclude != nil && in.Exclude(task, person)
+}
+
+// Allocator 分配策略，为每个任务选择人员，返回和 Tasks 一一对应的人员 ID，不分配的任务为空
+type Allocator interface {
+	Allocate(in AllocInput) []string
+}
+
+// NewAllocator 按名称查找分配策略，为空时平均分配
+func NewAllocator(strategy string) (Allocator, error) {
+	switch strategy {
+	case "", model.AllocStrategyEven:
+		return EvenAllocator{}, nil
+	case model.AllocStrategyLeastLoaded:
+		return LeastLoadedAllocator{}, nil
+	case model.AllocStrategyWeighted:
+		return WeightedAllocator{}, nil
+	case model.AllocStrategyGroup:
+		return GroupAllocator{}, nil
+	}
+	return nil, fmt.Errorf("分配策略不存在：%s", strategy)
+}
+
+// pickPerson 选出 score 最小且可以分配该任务的人员，score 返回 false 表示该人员不参与，相同时按人员顺序
+func pickPerson(in AllocInput, task model.TaskMeta, score func(person string) (float64, bool)) string {
+	best, min := "", math.Inf(1)
+	for _, p := range in.Persons {
+		if in.excluded(task, p) {
+			continue
+		}
+		v, ok := score(p)
+		if ok && v < min {
+			best, min = p, v
+		}
+	}
+	return best
+}
+
+// EvenAllocator 平均分配，每人最多分到 Number/人数 个，每个任务分给本次分到最少的人
+type EvenAllocator struct{}
+
+func (EvenAllocator) Allocate(in AllocInput) []string {
+	res := make([]string, len(in.Tasks))
+	if len(in.Persons) == 0 {
+		return res
+	}
+	limit := in.Number / len(in.Persons)
+	if limit < 1 {
+		limit = 1
+	}
+	assigned := make(map[string]int, len(in.Persons))
+	total := 0
+	for i, task := range in.Tasks {
+		if total >= in.Number {
+			break
+		}
+		p := pickPerson(in, task.Meta, func(p string) (float64, bool) {
+			return float64(assigned[p]), assigned[p] < limit
+		})
+		if p == "" {
+			continue
+		}
+		res[i] = p
+		assigned[p]++
+		total++
+	}
+	return res
+}
+
+// LeastLoadedAllocator 每个任务分给未完成任务（已有的加上本次分到的）最少的人
+type LeastLoadedAllocator struct{}
+
+func (LeastLoadedAllocator) Allocate(in AllocInput) []string {
+	res := make([]string, len(in.Tasks))
+	load := make(map[string]int, len(in.Persons))
+	for _, p := range in.Persons {
+		load[p] = in.Load[p]
+	}
+	total := 0
+	for i, task := range in.Tasks {
+		if total >= in.Number {
+			break
+		}
+		p := pickPerson(in, task.Meta, func(p string) (float64, bool) {
+			return float64(load[p]), true
+		})
+		if p == "" {
+			continue
+		}
+		res[i] = p
+		load[p]++
+		total++
+	}
+	return res
+}
+
+// WeightedAllocator 按权重比例分配，每个任务分给 (本次分到的数量+1)/权重 最小的人
+type WeightedAllocator struct{}
+
+func (WeightedAllocator) Allocate(in AllocInput) []string {
+	res := make([]string, len(in.Tasks))
+	assigned := make(map[string]int, len(in.Persons))
+	total := 0
+	for i, task := range in.Tasks {
+		if total >= in.Number {
+			break
+		}
+		p := pickPerson(in, task.Meta, func(p string) (float64, bool) {
+			w := personWeight(in.Weights, p)
+			return float64(assigned[p]+1) / w, w > 0
+		})
+		if p == "" {
+			continue
+		}
+		res[i] = p
+		assigned[p]++
+		total++
+	}
+	return res
+}
+
+func personWeight(weights map[string]float64, person string) float64 {
+	if w, ok := weights[person]; ok {
+		return w
+	}
+	return 1
+}
+
+// GroupAllocator 同一组的任务分给同一人，组已有负责人时沿用，否则分给本次分到最少的人；
+// 组整体分配，超出 Number 的组跳过
+type GroupAllocator struct{}
+
+func (GroupAllocator) Allocate(in AllocInput) []string {
+	res := make([]string, len(in.Tasks))
+	var order []string
+	groups := make(map[string][]int)
+	for i, task := range in.Tasks {
+		key := task.Group
+		if key == "" {
+			key = "#" + task.Meta.ID.Hex()
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	persons := make(map[string]bool, len(in.Persons))
+	for _, p := range in.Persons {
+		persons[p] = true
+	}
+	assigned := make(map[string]int, len(in.Persons))
+	total := 0
+	for _, key := range order {
+		indexes := groups[key]
+		if total+len(indexes) > in.Number {
+			continue
+		}
+		first := in.Tasks[indexes[0]].Meta
+		p, ok := in.Owners[key]
+		if !ok || !persons[p] {
+			p = pickPerson(in, first, func(p string) (float64, bool) {
+				return float64(assigned[p]), true
+			})
+		}
+		if p == "" {
+			continue
+		}
+		for _, i := range indexes {
+			if in.excluded(in.Tasks[i].Meta, p) {
+				continue
+			}
+			res[i] = p
+			assigned[p]++
+			total++
+		}
+	}
+	return res
+}
+
+// AllocPreview 分配预览，展示每人将分到的任务数，不修改任务
+type AllocPreview struct {
+	Strategy string             `json:"strategy"`
+	Total    int                `json:"total"`
+	Persons  []AllocPreviewItem `json:"persons"`
+}
+
+type AllocPreviewItem struct {
+	Person model.Person `json:"person"`
+	// Count 本次分到的任务数，Load 分配前未完成的任务数
+	Count int `json:"count"`
+	Load  int `json:"load"`
+}
+
+// allocPlan 一次分配的结果，Assign 为每人分到的任务
+type allocPlan struct {
+	Strategy string
+	Persons  []string
+	Load     map[string]int
+	Assign   map[string][]model.TaskMeta
+}
+
+func (p allocPlan) preview() AllocPreview {
+	res := AllocPreview{Strategy: p.Strategy, Persons: make([]AllocPreviewItem, len(p.Persons))}
+	for i, id := range p.Persons {
+		count := len(p.Assign[id])
+		res.Total += count
+		res.Persons[i] = AllocPreviewItem{Person: model.Person{ID: id}, Count: count, Load: p.Load[id]}
+	}
+	return res
+}
+
+// allocRole 分配标注员或审核员时的差异
+type allocRole struct {
+	// Field 任务上的人员字段，Open 该角色未完成的任务状态
+	Field string
+	Open  string
+	// Strategy 从项目配置中取出该角色的策略
+	Strategy func(model.AllocationSetting) string
+}
+
+var (
+	labelerRole = allocRole{
+		Field:    "permissions.labeler.id",
+		Open:     model.TaskStatusLabeling,
+		Strategy: func(s model.AllocationSetting) string { return s.Labeler },
+	}
+	checkerRole = allocRole{
+		Field:    "permissions.checker.id",
+		Open:     model.TaskStatusChecking,
+		Strategy: func(s model.AllocationSetting) string { return s.Checker },
+	}
+)
+
+// planAlloc 按项目的分配策略为 filter 匹配的任务选择人员，order 调整任务的优先顺序
+func (t *TaskType) planAlloc(ctx context.Context, req BatchAllocReq, role allocRole, filter bson.M,
+	exclude func(model.TaskMeta, string) bool, order func([]AllocTask) error) (allocPlan, error) {
+	setting, err := t.AllocationSetting(ctx, req.ProjectID)
+	if err != nil {
+		return allocPlan{}, err
+	}
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = role.Strategy(setting)
+	}
+	if strategy == "" {
+		strategy = model.AllocStrategyEven
+	}
+	allocator, err := NewAllocator(strategy)
+	if err != nil {
+		return allocPlan{}, err
+	}
+
+	groupField := setting.GroupField
+	if groupField == "" {
+		groupField = t.defaultGroupField()
+	}
+	projection := bson.M{"_id": 1, "projectId": 1, "name": 1, "status": 1, "permissions": 1, "version": 1}
+	if strategy == model.AllocStrategyGroup {
+		projection[groupField] = 1
+	}
+	opts := options.Find().SetProjection(projection).SetSort(bson.M{"_id": 1})
+	if strategy != model.AllocStrategyGroup && order == nil {
+		opts.SetLimit(req.Number)
+	}
+	docs, err := findRaw(ctx, t.Tasks, filter, opts)
+	if err != nil {
+		return allocPlan{}, err
+	}
+	tasks := make([]AllocTask, len(docs))
+	for i, doc := range docs {
+		if err := bson.Unmarshal(doc, &tasks[i].Meta); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return allocPlan{}, err
+		}
+		if strategy == model.AllocStrategyGroup {
+			tasks[i].Group = groupValue(doc, groupField)
+		}
+	}
+	if order != nil {
+		if err := order(tasks); err != nil {
+			return allocPlan{}, err
+		}
+	}
+
+	load, err := t.openLoad(ctx, role, req.Persons)
+	if err != nil {
+		return allocPlan{}, err
+	}
+	in := AllocInput{
+		Tasks:   tasks,
+		Persons: req.Persons,
+		Number:  int(req.Number),
+		Load:    load,
+		Weights: setting.Weights,
+		Exclude: exclude,
+	}
+	if strategy == model.AllocStrategyGroup {
+		if in.Owners, err = t.groupOwners(ctx, req.ProjectID, role, groupField); err != nil {
+			return allocPlan{}, err
+		}
+	}
+	plan := allocPlan{
+		Strategy: strategy,
+		Persons:  req.Persons,
+		Load:     load,
+		Assign:   make(map[string][]model.TaskMeta, len(req.Persons)),
+	}
+	for i, p := range allocator.Allocate(in) {
+		if p != "" {
+			plan.Assign[p] = append(plan.Assign[p], tasks[i].Meta)
+		}
+	}
+	return plan, nil
+}
+
+// defaultGroupField t5 按会话分组，其他类型按任务名称（上传的文件）分组
+func (t *TaskType) defaultGroupField() string {
+	if t.Pool != nil {
+		return "sessionId"
+	}
+	return "name"
+}
+
+func groupValue(doc bson.Raw, field string) string {
+	v, err := doc.LookupErr(strings.Split(field, ".")...)
+	if err != nil {
+		return ""
+	}
+	if s, ok := v.StringValueOK(); ok {
+		return s
+	}
+	return v.String()
+}
+
+// openLoad 每人在该任务类型中未完成的任务数
+func (t *TaskType) openLoad(ctx context.Context, role allocRole, persons []string) (map[string]int, error) {
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{role.Field: bson.M{"$in": persons}, "status": role.Open})}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + role.Field, "count": bson.M{"$sum": 1}}}},
+	}
+	var groups []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := aggregateAll(ctx, t.Tasks, pipe, &groups); err != nil {
+		return nil, err
+	}
+	res := make(map[string]int, len(groups))
+	for _, g := range groups {
+		res[g.ID] = g.Count
+	}
+	return res, nil
+}
+
+// groupOwners 项目中已经分配的组和负责人，同一组有多个负责人时取任意一个
+func (t *TaskType) groupOwners(ctx context.Context, projectID primitive.ObjectID, role allocRole, field string) (map[string]string, error) {
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{"projectId": projectID, role.Field: bson.M{"$exists": true}, field: bson.M{"$exists": true}})}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "owner": bson.M{"$first": "$" + role.Field}}}},
+	}
+	var groups []struct {
+		ID    any    `bson:"_id"`
+		Owner string `bson:"owner"`
+	}
+	if err := aggregateAll(ctx, t.Tasks, pipe, &groups); err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(groups))
+	for _, g := range groups {
+		if s, ok := g.ID.(string); ok {
+			res[s] = g.Owner
+		} else {
+			res[fmt.Sprint(g.ID)] = g.Owner
+		}
+	}
+	return res, nil
+}
+
+// AllocationSetting 查询项目的分配策略，没有配置时平均分配
+func (t *TaskType) AllocationSetting(ctx context.Context, projectID primitive.ObjectID) (model.AllocationSetting, error) {
+	var setting model.AllocationSetting
+	err := t.Allocations.FindOne(ctx, bson.M{"projectId": projectID}).Decode(&setting)
+	if err == nil {
+		return setting, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return setting, err
+	}
+	return model.AllocationSetting{
+		ProjectID: projectID,
+		TaskType:  t.Name,
+		Labeler:   model.AllocStrategyEven,
+		Checker:   model.AllocStrategyEven,
+	}, nil
+}
+
+func (t *TaskType) SaveAllocationSetting(ctx context.Context, setting model.AllocationSetting) (model.AllocationSetting, error) {
+	if setting.ProjectID.IsZero() {
+		return model.AllocationSetting{}, errors.New("项目id不能为空")
+	}
+	for _, s := range []string{setting.Labeler, setting.Checker} {
+		if _, err := NewAllocator(s); err != nil {
+			return model.AllocationSetting{}, err
+		}
+	}
+	for id, w := range setting.Weights {
+		if w < 0 {
+			return model.AllocationSetting{}, fmt.Errorf("权重不能小于0：%s", id)
+		}
+	}
+	count, err := t.Projects.CountDocuments(ctx, notDeleted(bson.M{"_id": setting.ProjectID}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.AllocationSetting{}, err
+	}
+	if count == 0 {
+		return model.AllocationSetting{}, ErrProjectNotFound
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"taskType":   t.Name,
+			"labeler":    setting.Labeler,
+			"checker":    setting.Checker,
+			"weights":    setting.Weights,
+			"groupField": setting.GroupField,
+			"updateTime": util.Datetime(time.Now()),
+		},
+		"$setOnInsert": bson.M{
+			"_id": primitive.NewObjectID(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := t.Allocations.FindOneAndUpdate(ctx, bson.M{"projectId": setting.ProjectID}, update, opts).Decode(&setting); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.AllocationSetting{}, err
+	}
+	return setting, nil
+}
+
+func (svc *LabelerService) GetAllocationSetting(ctx context.Context, taskType string, projectID primitive.ObjectID) (model.AllocationSetting, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return model.AllocationSetting{}, err
+	}
+	return t.AllocationSetting(ctx, projectID)
+}
+
+func (svc *LabelerService) SaveAllocationSetting(ctx context.Context, taskType string, req model.AllocationSetting) (model.AllocationSetting, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return model.AllocationSetting{}, err
+	}
+	return t.SaveAllocationSetting(ctx, req)
+}
+
+type PreviewAllocReq struct {
+	BatchAllocReq
+	// Role 标注或审核
+	Role string `json:"role"`
+}
+
+// PreviewAlloc 按分配策略预览每人将分到的任务数，不修改任务
+func (svc *LabelerService) PreviewAlloc(ctx context.Context, taskType string, req PreviewAllocReq) (AllocPreview, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return AllocPreview{}, err
+	}
+	var plan allocPlan
+	switch req.Role {
+	case PermissionTypeLabeler:
+		plan, err = t.planLabeler(ctx, req.BatchAllocReq)
+	case PermissionTypeChecker:
+		plan, err = t.planChecker(ctx, req.BatchAllocReq)
+	default:
+		return AllocPreview{}, fmt.Errorf("角色不存在：%s", req.Role)
+	}
+	if err != nil {
+		return AllocPreview{}, err
+	}
+	preview := plan.preview()
+	userMap := svc.userNickNames(ctx, req.Persons)
+	for i := range preview.Persons {
+		preview.Persons[i].Person.NickName = userMap[preview.Persons[i].Person.ID]
+	}
+	return preview, nil
+}
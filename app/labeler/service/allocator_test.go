@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+)
+
+func TestAllocators(t *testing.T) {
+	tasks := func(groups ...string) []AllocTask {
+		res := make([]AllocTask, len(groups))
+		for i, g := range groups {
+			res[i] = AllocTask{Meta: model.TaskMeta{ID: primitive.NewObjectID()}, Group: g}
+		}
+		return res
+	}
+	counts := func(assign []string) map[string]int {
+		res := make(map[string]int)
+		for _, p := range assign {
+			res[p]++
+		}
+		return res
+	}
+	check := func(t *testing.T, got map[string]int, want map[string]int) {
+		t.Helper()
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%q: want %d got %d (%v)", k, v, got[k], got)
+			}
+		}
+	}
+	persons := []string{"a", "b", "c"}
+
+	t.Run("even", func(t *testing.T) {
+		got := EvenAllocator{}.Allocate(AllocInput{Tasks: tasks("", "", "", "", "", "", ""), Persons: persons, Number: 6})
+		check(t, counts(got), map[string]int{"a": 2, "b": 2, "c": 2, "": 1})
+	})
+	t.Run("even exclude", func(t *testing.T) {
+		in := AllocInput{Tasks: tasks("", ""), Persons: []string{"a", "b"}, Number: 2,
+			Exclude: func(_ model.TaskMeta, p string) bool { return p == "a" }}
+		check(t, counts(EvenAllocator{}.Allocate(in)), map[string]int{"b": 1, "": 1})
+	})
+	t.Run("least loaded", func(t *testing.T) {
+		in := AllocInput{Tasks: tasks("", "", "", ""), Persons: persons, Number: 4, Load: map[string]int{"a": 3, "b": 1}}
+		check(t, counts(LeastLoadedAllocator{}.Allocate(in)), map[string]int{"a": 0, "b": 2, "c": 2})
+	})
+	t.Run("weighted", func(t *testing.T) {
+		in := AllocInput{Tasks: tasks("", "", "", "", "", ""), Persons: persons, Number: 6,
+			Weights: map[string]float64{"a": 2, "c": 0}}
+		check(t, counts(WeightedAllocator{}.Allocate(in)), map[string]int{"a": 4, "b": 2, "c": 0})
+	})
+	t.Run("group", func(t *testing.T) {
+		in := AllocInput{Tasks: tasks("s1", "s2", "s1", "s3", "s2"), Persons: persons, Number: 5,
+			Owners: map[string]string{"s3": "c"}}
+		got := GroupAllocator{}.Allocate(in)
+		if got[0] != got[2] || got[1] != got[4] || got[3] != "c" {
+			t.Errorf("groups split: %v", got)
+		}
+	})
+	t.Run("group number", func(t *testing.T) {
+		in := AllocInput{Tasks: tasks("s1", "s1", "s2"), Persons: persons, Number: 1}
+		check(t, counts(GroupAllocator{}.Allocate(in)), map[string]int{"": 2})
+	})
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+)
+
+// 工作量统计的事件，取自任务上的时间字段，零值（早于 1970 年）表示没有发生
+const (
+	eventAllocate = "allocate"
+	eventSubmit   = "submit"
+	eventApprove  = "approve"
+	eventReject   = "reject"
+)
+
+// productivityKeys 分组维度到任务字段
+var productivityKeys = map[string]string{
+	"labeler": "$permissions.labeler.id",
+	"checker": "$permissions.checker.id",
+	"project": "$projectId",
+}
+
+type ProductivityReq struct {
+	ProjectID string `form:"projectId"`
+	// GroupBy 分组维度，逗号分隔，可选 labeler、checker、project、day，默认 labeler
+	GroupBy string `form:"groupBy"`
+	// Start、End 统计的时间范围，格式为 2006-01-02 15:04:05，按事件发生的时间过滤
+	Start string `form:"start"`
+	End   string `form:"end"`
+}
+
+type ProductivityRow struct {
+	Labeler   *model.Person       `json:"labeler,omitempty"`
+	Checker   *model.Person       `json:"checker,omitempty"`
+	ProjectID *primitive.ObjectID `json:"projectId,omitempty"`
+	Day       string              `json:"day,omitempty"`
+	// Allocated 分配给标注员的任务数，Labeled 标注员保存过标注的任务数，Submitted 提交的任务数
+	Allocated int `json:"allocated"`
+	Labeled   int `json:"labeled"`
+	Submitted int `json:"submitted"`
+	// Approved 审核通过数，Rejected 审核不通过数，RejectionRate 为不通过数占审核数的比例
+	Approved      int      `json:"approved"`
+	Rejected      int      `json:"rejected"`
+	RejectionRate *float64 `json:"rejectionRate"`
+	// MedianSubmitSeconds 从分配到提交用时的中位数，没有分配时间的旧任务不参与统计
+	MedianSubmitSeconds *float64 `json:"medianSubmitSeconds"`
+	// MedianReviewSeconds 从分配审核到审核完成用时的中位数
+	MedianReviewSeconds *float64 `json:"medianReviewSeconds"`
+}
+
+// Productivity 按标注员、审核员、项目、天统计任务类型的工作量，分组和统计都在数据库中完成
+func (svc *LabelerService) Productivity(ctx context.Context, taskType string, req ProductivityReq) ([]ProductivityRow, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := t.productivity(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, row := range rows {
+		if row.Labeler != nil {
+			ids = append(ids, row.Labeler.ID)
+		}
+		if row.Checker != nil {
+			ids = append(ids, row.Checker.ID)
+		}
+	}
+	userMap := svc.userNickNames(ctx, ids)
+	for i := range rows {
+		if rows[i].Labeler != nil {
+			rows[i].Labeler.NickName = userMap[rows[i].Labeler.ID]
+		}
+		if rows[i].Checker != nil {
+			rows[i].Checker.NickName = userMap[rows[i].Checker.ID]
+		}
+	}
+	return rows, nil
+}
+
+func (t *TaskType) productivity(ctx context.Context, req ProductivityReq) ([]ProductivityRow, error) {
+	groupBy := strings.Split(req.GroupBy, ",")
+	if req.GroupBy == "" {
+		groupBy = []string{"labeler"}
+	}
+	group := bson.D{}
+	for _, key := range groupBy {
+		key = strings.TrimSpace(key)
+		switch {
+		case key == "day":
+			group = append(group, bson.E{Key: "day", Value: "$day"})
+		case productivityKeys[key] != "":
+			group = append(group, bson.E{Key: key, Value: "$" + key})
+		default:
+			return nil, fmt.Errorf("不支持的分组：%s", key)
+		}
+	}
+
+	since := time.Unix(0, 0)
+	timeFilter := bson.M{"$gt": since}
+	if req.Start != "" || req.End != "" {
+		filter := bson.M{}
+		if err := timeRange(filter, "time", req.Start, req.End); err != nil {
+			return nil, err
+		}
+		if filter["time"] == nil {
+			return nil, ErrTimeParse
+		}
+		timeFilter = filter["time"].(bson.M)
+	}
+	match := bson.M{}
+	if req.ProjectID != "" {
+		projectID, err := primitive.ObjectIDFromHex(req.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		match["projectId"] = projectID
+	}
+
+	// 每个任务展开为分配、提交、审核通过、审核不通过四个事件，按事件的时间过滤和按天分组
+	timezone := time.Now().Format("-07:00")
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(match)}},
+		{{Key: "$project", Value: bson.M{
+			"labeler":            productivityKeys["labeler"],
+			"checker":            productivityKeys["checker"],
+			"project":            productivityKeys["project"],
+			"allocatedTime":      1,
+			"checkAllocatedTime": 1,
+			"events": bson.A{
+				bson.M{"type": eventAllocate, "time": "$allocatedTime"},
+				bson.M{"type": eventSubmit, "time": "$submittedTime"},
+				bson.M{"type": eventApprove, "time": "$approvedTime"},
+				bson.M{"type": eventReject, "time": "$unsanctionTime"},
+			},
+		}}},
+		{{Key: "$unwind", Value: "$events"}},
+		{{Key: "$match", Value: bson.M{"events.time": timeFilter}}},
+		{{Key: "$addFields", Value: bson.M{
+			"day": bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$events.time", "timezone": timezone}},
+			"duration": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$eq": bson.A{"$events.type", eventSubmit}}, "then": durationExpr("$allocatedTime", "$events.time", since)},
+					bson.M{"case": bson.M{"$in": bson.A{"$events.type", bson.A{eventApprove, eventReject}}}, "then": durationExpr("$checkAllocatedTime", "$events.time", since)},
+				},
+				"default": nil,
+			}},
+		}}},
+		// 先按用时排序，分组后 push 得到的数组有序，用于取中位数
+		{{Key: "$sort", Value: bson.D{{Key: "duration", Value: 1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: group},
+			{Key: "allocated", Value: eventCount(eventAllocate)},
+			{Key: "submitted", Value: eventCount(eventSubmit)},
+			{Key: "approved", Value: eventCount(eventApprove)},
+			{Key: "rejected", Value: eventCount(eventReject)},
+			{Key: "submitDurations", Value: eventPush(eventSubmit)},
+			{Key: "reviewDurations", Value: eventPush(eventApprove, eventReject)},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"allocated":           1,
+			"submitted":           1,
+			"approved":            1,
+			"rejected":            1,
+			"medianSubmitSeconds": medianExpr(nonNull("$submitDurations")),
+			"medianReviewSeconds": medianExpr(nonNull("$reviewDurations")),
+		}}},
+	}
+	var groups []struct {
+		ID                  productivityID `bson:"_id"`
+		Allocated           int            `bson:"allocated"`
+		Submitted           int            `bson:"submitted"`
+		Approved            int            `bson:"approved"`
+		Rejected            int            `bson:"rejected"`
+		MedianSubmitSeconds *float64       `bson:"medianSubmitSeconds"`
+		MedianReviewSeconds *float64       `bson:"medianReviewSeconds"`
+	}
+	// 按用时排序的数据可能超过聚合的内存限制
+	if err := aggregateAll(ctx, t.Tasks, pipe, &groups, options.Aggregate().SetAllowDiskUse(true)); err != nil {
+		return nil, err
+	}
+	saves, err := t.labelSaves(ctx, group, match, timeFilter, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]productivityID, 0, len(groups)+len(saves))
+	rows := make(map[string]*ProductivityRow, len(groups)+len(saves))
+	row := func(id productivityID) *ProductivityRow {
+		if r, ok := rows[id.key()]; ok {
+			return r
+		}
+		r := &ProductivityRow{ProjectID: id.Project, Day: id.Day}
+		if id.Labeler != nil {
+			r.Labeler = &model.Person{ID: *id.Labeler}
+		}
+		if id.Checker != nil {
+			r.Checker = &model.Person{ID: *id.Checker}
+		}
+		rows[id.key()] = r
+		ids = append(ids, id)
+		return r
+	}
+	for _, g := range groups {
+		r := row(g.ID)
+		r.Allocated = g.Allocated
+		r.Submitted = g.Submitted
+		r.Approved = g.Approved
+		r.Rejected = g.Rejected
+		r.MedianSubmitSeconds = g.MedianSubmitSeconds
+		r.MedianReviewSeconds = g.MedianReviewSeconds
+		if reviewed := g.Approved + g.Rejected; reviewed > 0 {
+			r.RejectionRate = ratio(float64(g.Rejected) / float64(reviewed))
+		}
+	}
+	for _, v := range saves {
+		row(v.ID).Labeled = v.Labeled
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return ids[i].less(ids[j], group)
+	})
+	res := make([]ProductivityRow, len(ids))
+	for i, id := range ids {
+		res[i] = *rows[id.key()]
+	}
+	return res, nil
+}
+
+// productivityID 工作量统计的分组，没有参与分组的维度为空
+type productivityID struct {
+	Labeler *string             `bson:"labeler"`
+	Checker *string             `bson:"checker"`
+	Project *primitive.ObjectID `bson:"project"`
+	Day     string              `bson:"day"`
+}
+
+func (id productivityID) field(name string) string {
+	switch name {
+	case "labeler":
+		if id.Labeler != nil {
+			return *id.Labeler
+		}
+	case "checker":
+		if id.Checker != nil {
+			return *id.Checker
+		}
+	case "project":
+		if id.Project != nil {
+			return id.Project.Hex()
+		}
+	case "day":
+		return id.Day
+	}
+	return ""
+}
+
+func (id productivityID) key() string {
+	return strings.Join([]string{id.field("labeler"), id.field("checker"), id.field("project"), id.field("day")}, "\x00")
+}
+
+// less 按分组维度的顺序比较
+func (id productivityID) less(other productivityID, group bson.D) bool {
+	for _, e := range group {
+		a, b := id.field(e.Key), other.field(e.Key)
+		if a != b {
+			return a < b
+		}
+	}
+	return false
+}
+
+type labelSaveCount struct {
+	ID      productivityID `bson:"_id"`
+	Labeled int            `bson:"labeled"`
+}
+
+// labelSaves 按分组统计标注员保存过标注的任务数，取自任务的动态，同一个任务在一个分组中只计一次
+func (t *TaskType) labelSaves(ctx context.Context, group bson.D, match bson.M, timeFilter bson.M, timezone string) ([]labelSaveCount, error) {
+	filter := bson.M{
+		"taskType":   t.Name,
+		"action":     model.ActivitySave,
+		"role":       PermissionTypeLabeler,
+		"createTime": timeFilter,
+	}
+	if projectID, ok := match["projectId"]; ok {
+		filter["projectId"] = projectID
+	}
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$project", Value: bson.M{
+			"taskId":  1,
+			"labeler": "$user",
+			"project": "$projectId",
+			"day":     bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$createTime", "timezone": timezone}},
+		}}},
+	}
+	for _, e := range group {
+		if e.Key == "checker" {
+			pipe = append(pipe,
+				bson.D{{Key: "$lookup", Value: bson.M{
+					"from":         t.Tasks.Name(),
+					"localField":   "taskId",
+					"foreignField": "_id",
+					"as":           "task",
+				}}},
+				bson.D{{Key: "$addFields", Value: bson.M{"checker": bson.M{"$arrayElemAt": bson.A{"$task.permissions.checker.id", 0}}}}},
+			)
+		}
+	}
+	pipe = append(pipe,
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "taskId", Value: "$taskId"}, {Key: "key", Value: group}}}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$_id.key"}, {Key: "labeled", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+	)
+	var res []labelSaveCount
+	if err := aggregateAll(ctx, t.Activities, pipe, &res, options.Aggregate().SetAllowDiskUse(true)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// durationExpr 从 from 到 to 的秒数，from 没有发生或晚于 to（上一轮的时间）时为 null
+func durationExpr(from, to string, since time.Time) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{
+			bson.M{"$gt": bson.A{from, since}},
+			bson.M{"$gte": bson.A{to, from}},
+		}},
+		bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{to, from}}, 1000}},
+		nil,
+	}}
+}
+
+func eventCount(event string) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$events.type", event}}, 1, 0}}}
+}
+
+// eventPush 收集某几种事件的用时，其他事件放入 null，之后由 nonNull 去掉
+func eventPush(events ...string) bson.M {
+	return bson.M{"$push": bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"$events.type", events}}, "$duration", nil}}}
+}
+
+func nonNull(array string) bson.M {
+	return bson.M{"$filter": bson.M{"input": array, "cond": bson.M{"$ne": bson.A{"$$this", nil}}}}
+}
+
+// medianExpr 有序数组的中位数，数组为空时为 null
+func medianExpr(sorted any) bson.M {
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"values": sorted},
+		"in": bson.M{"$let": bson.M{
+			"vars": bson.M{"n": bson.M{"$size": "$$values"}},
+			"in": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$eq": bson.A{"$$n", 0}}, "then": nil},
+					bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$mod": bson.A{"$$n", 2}}, 1}}, "then": bson.M{
+						"$arrayElemAt": bson.A{"$$values", bson.M{"$floor": bson.M{"$divide": bson.A{"$$n", 2}}}},
+					}},
+				},
+				"default": bson.M{"$avg": bson.A{
+					bson.M{"$arrayElemAt": bson.A{"$$values", bson.M{"$subtract": bson.A{bson.M{"$divide": bson.A{"$$n", 2}}, 1}}}},
+					bson.M{"$arrayElemAt": bson.A{"$$values", bson.M{"$divide": bson.A{"$$n", 2}}}},
+				}},
+			}},
+		}},
+	}}
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+var ErrCommentNotFound = errors.New("评论不存在")
+
+type CreateCommentReq struct {
+	TaskID primitive.ObjectID `json:"taskId"`
+	// ThreadID 回复的讨论，为空时开启新的讨论
+	ThreadID *primitive.ObjectID `json:"threadId"`
+	// Path 评论的任务字段，回复时使用讨论的字段
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// Mentions 被 @ 的用户 ID
+	Mentions []string `json:"mentions"`
+}
+
+type ListCommentsReq struct {
+	TaskID primitive.ObjectID `form:"-"`
+	// Path 只返回该字段及其子字段的讨论
+	Path string `form:"path"`
+	// Resolved 为空时返回所有讨论
+	Resolved *bool `form:"resolved"`
+}
+
+type ResolveCommentReq struct {
+	ID       primitive.ObjectID `json:"id"`
+	Resolved bool               `json:"resolved"`
+}
+
+type CommentInboxReq struct {
+	dto.Pagination
+}
+
+// CommentThread 一个讨论，Replies 按时间顺序
+type CommentThread struct {
+	model.TaskComment `bson:",inline"`
+	Replies           []model.TaskComment `json:"replies"`
+}
+
+// CommentInboxItem 收件箱中的讨论，只包含第一条评论和回复数
+type CommentInboxItem struct {
+	model.TaskComment `bson:",inline"`
+	TaskName          string `json:"taskName"`
+	ReplyCount        int64  `json:"replyCount"`
+}
+
+// commentMentions 去掉重复的用户和作者自己
+func commentMentions(ids []string, author string) []string {
+	res := make([]string, 0, len(ids))
+	seen := map[string]bool{author: true}
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		res = append(res, id)
+	}
+	return res
+}
+
+// lookupPath 检查字段是否存在于任务中，空字段表示整个任务
+func lookupPath(doc bson.Raw, path string) error {
+	if path == "" {
+		return nil
+	}
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("字段格式错误：%s", path)
+		}
+	}
+	if _, err := doc.LookupErr(keys...); err != nil {
+		return fmt.Errorf("任务中没有字段：%s", path)
+	}
+	return nil
+}
+
+func isParticipant(thread model.TaskComment, userID string) bool {
+	for _, id := range thread.Participants {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// canComment 管理员、任务的标注员和审核员可以查看和评论任务
+func canComment(meta model.TaskMeta, userID string, admin bool) bool {
+	return admin || meta.Permissions.IsLabeler(userID) || meta.Permissions.IsChecker(userID)
+}
+
+func (svc *LabelerService) commentTask(ctx context.Context, t *TaskType, taskID primitive.ObjectID) (model.TaskMeta, error) {
+	tasks, err := findMeta(ctx, t.Tasks, bson.M{"_id": taskID})
+	if err != nil {
+		return model.TaskMeta{}, err
+	}
+	if len(tasks) == 0 {
+		return model.TaskMeta{}, errors.New("任务不存在")
+	}
+	return tasks[0], nil
+}
+
+func (svc *LabelerService) findComment(ctx context.Context, filter bson.M) (model.TaskComment, error) {
+	var comment model.TaskComment
+	if err := svc.CollectionTaskComment.FindOne(ctx, filter).Decode(&comment); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return comment, ErrCommentNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return comment, err
+	}
+	return comment, nil
+}
+
+// CreateComment 评论任务或回复讨论。被 @ 的用户可以查看和回复所在的讨论，回复已解决的讨论会重新打开
+func (svc *LabelerService) CreateComment(ctx context.Context, taskType string, req CreateCommentReq) (model.TaskComment, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return model.TaskComment{}, err
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		return model.TaskComment{}, errors.New("评论内容不能为空")
+	}
+	userID, admin := operator(ctx)
+	meta, err := svc.commentTask(ctx, t, req.TaskID)
+	if err != nil {
+		return model.TaskComment{}, err
+	}
+
+	var thread model.TaskComment
+	if req.ThreadID != nil {
+		thread, err = svc.findComment(ctx, bson.M{"_id": *req.ThreadID, "taskType": t.Name, "taskId": req.TaskID, "threadId": bson.M{"$exists": false}})
+		if err != nil {
+			return model.TaskComment{}, err
+		}
+		req.Path = thread.Path
+		if !canComment(meta, userID, admin) && !isParticipant(thread, userID) {
+			return model.TaskComment{}, errors.New("权限不足")
+		}
+	} else {
+		if !canComment(meta, userID, admin) {
+			return model.TaskComment{}, errors.New("权限不足")
+		}
+		doc, err := t.Tasks.FindOne(ctx, notDeleted(bson.M{"_id": req.TaskID})).DecodeBytes()
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return model.TaskComment{}, err
+		}
+		if err := lookupPath(doc, req.Path); err != nil {
+			return model.TaskComment{}, err
+		}
+	}
+
+	mentions := commentMentions(req.Mentions, userID)
+	if len(mentions) > 0 {
+		users := svc.userNickNames(ctx, mentions)
+		for _, id := range mentions {
+			if _, ok := users[id]; !ok {
+				return model.TaskComment{}, fmt.Errorf("用户不存在：%s", id)
+			}
+		}
+	}
+
+	now := util.Datetime(time.Now())
+	comment := model.TaskComment{
+		ID:         primitive.NewObjectID(),
+		TaskType:   t.Name,
+		ProjectID:  meta.ProjectID,
+		TaskID:     meta.ID,
+		ThreadID:   req.ThreadID,
+		Path:       req.Path,
+		Author:     userID,
+		Content:    req.Content,
+		Mentions:   mentions,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if req.ThreadID == nil {
+		comment.Participants = append([]string{userID}, mentions...)
+		comment.LastAuthor = userID
+	}
+	if _, err := svc.CollectionTaskComment.InsertOne(ctx, comment); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.TaskComment{}, err
+	}
+	if req.ThreadID != nil {
+		update := bson.M{
+			"$set":      bson.M{"lastAuthor": userID, "updateTime": now, "resolved": false},
+			"$unset":    bson.M{"resolvedBy": "", "resolvedTime": ""},
+			"$addToSet": bson.M{"participants": bson.M{"$each": append([]string{userID}, mentions...)}},
+		}
+		if _, err := svc.CollectionTaskComment.UpdateByID(ctx, thread.ID, update); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return model.TaskComment{}, err
+		}
+	}
+
+	field := req.Path
+	if field == "" {
+		field = "comments"
+	}
+	activity := t.newActivity(ctx, meta, model.ActivityComment, []model.FieldChange{{Field: field, New: req.Content}})
+	if err := t.recordActivities(ctx, []model.TaskActivity{activity}); err != nil {
+		return model.TaskComment{}, err
+	}
+	comment.NickName = svc.userNickNames(ctx, []string{userID})[userID]
+	return comment, nil
+}
+
+// ListComments 任务的讨论，按开启时间排序。不是任务的标注员或审核员时只返回自己参与的讨论
+func (svc *LabelerService) ListComments(ctx context.Context, taskType string, req ListCommentsReq) ([]CommentThread, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return nil, err
+	}
+	userID, admin := operator(ctx)
+	meta, err := svc.commentTask(ctx, t, req.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"taskType": t.Name, "taskId": req.TaskID, "threadId": bson.M{"$exists": false}}
+	if !canComment(meta, userID, admin) {
+		filter["participants"] = userID
+	}
+	if req.Path != "" {
+		filter["$or"] = bson.A{
+			bson.M{"path": req.Path},
+			bson.M{"path": bson.M{"$regex": "^" + regexp.QuoteMeta(req.Path) + `\.`}},
+		}
+	}
+	if req.Resolved != nil {
+		filter["resolved"] = *req.Resolved
+	}
+	cursor, err := svc.CollectionTaskComment.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	res := make([]CommentThread, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	if len(res) == 0 {
+		return res, nil
+	}
+
+	threadIDs := util.Map(res, func(v CommentThread) primitive.ObjectID { return v.ID })
+	cursor, err = svc.CollectionTaskComment.Find(ctx, bson.M{"threadId": bson.M{"$in": threadIDs}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	var replies []model.TaskComment
+	if err := cursor.All(ctx, &replies); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	users := []string{}
+	index := make(map[primitive.ObjectID]int, len(res))
+	for i := range res {
+		index[res[i].ID] = i
+		res[i].Replies = make([]model.TaskComment, 0)
+		users = append(users, res[i].Author)
+	}
+	for _, r := range replies {
+		i := index[*r.ThreadID]
+		res[i].Replies = append(res[i].Replies, r)
+		users = append(users, r.Author)
+	}
+	userMap := svc.userNickNames(ctx, users)
+	for i := range res {
+		res[i].NickName = userMap[res[i].Author]
+		for j := range res[i].Replies {
+			res[i].Replies[j].NickName = userMap[res[i].Replies[j].Author]
+		}
+	}
+	return res, nil
+}
+
+// ResolveComment 解决或重新打开讨论，传入回复时修改所在的讨论。讨论的作者、任务的审核员和管理员可以修改
+func (svc *LabelerService) ResolveComment(ctx context.Context, req ResolveCommentReq) error {
+	comment, err := svc.findComment(ctx, bson.M{"_id": req.ID})
+	if err != nil {
+		return err
+	}
+	if comment.ThreadID != nil {
+		if comment, err = svc.findComment(ctx, bson.M{"_id": *comment.ThreadID}); err != nil {
+			return err
+		}
+	}
+	userID, admin := operator(ctx)
+	if !admin && comment.Author != userID {
+		t, err := svc.TaskType(comment.TaskType)
+		if err != nil {
+			return err
+		}
+		meta, err := svc.commentTask(ctx, t, comment.TaskID)
+		if err != nil {
+			return err
+		}
+		if !meta.Permissions.IsChecker(userID) {
+			return errors.New("权限不足")
+		}
+	}
+	now := util.Datetime(time.Now())
+	update := bson.M{"$set": bson.M{"resolved": false, "updateTime": now}, "$unset": bson.M{"resolvedBy": "", "resolvedTime": ""}}
+	if req.Resolved {
+		update = bson.M{"$set": bson.M{"resolved": true, "resolvedBy": userID, "resolvedTime": now, "updateTime": now}}
+	}
+	if _, err := svc.CollectionTaskComment.UpdateByID(ctx, comment.ID, update); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// CommentInbox 当前用户待处理的讨论：未解决、最后一条评论不是自己，并且是自己标注或审核的任务，或者自己参与了讨论。
+// 按最后更新时间倒序
+func (svc *LabelerService) CommentInbox(ctx context.Context, req CommentInboxReq) ([]CommentInboxItem, int, error) {
+	userID, _ := operator(ctx)
+	open := bson.M{"threadId": bson.M{"$exists": false}, "resolved": false, "lastAuthor": bson.M{"$ne": userID}}
+
+	// 有未解决讨论的任务中，当前用户标注或审核的任务
+	or := bson.A{bson.M{"participants": userID}}
+	for name, t := range svc.TaskTypes {
+		filter := bson.M{"taskType": name}
+		for k, v := range open {
+			filter[k] = v
+		}
+		ids, err := svc.CollectionTaskComment.Distinct(ctx, "taskId", filter)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return nil, 0, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		tasks, err := findMeta(ctx, t.Tasks, bson.M{
+			"_id": bson.M{"$in": ids},
+			"$or": bson.A{bson.M{"permissions.labeler.id": userID}, bson.M{"permissions.checker.id": userID}},
+		}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(tasks) > 0 {
+			or = append(or, bson.M{"taskType": name, "taskId": bson.M{"$in": util.Map(tasks, func(v model.TaskMeta) primitive.ObjectID { return v.ID })}})
+		}
+	}
+	filter := bson.M{"$or": or}
+	for k, v := range open {
+		filter[k] = v
+	}
+	count, err := svc.CollectionTaskComment.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	cursor, err := svc.CollectionTaskComment.Find(ctx, filter, pageOptions(req.Pagination).SetSort(bson.D{{Key: "updateTime", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	res := make([]CommentInboxItem, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+
+	userMap := svc.userNickNames(ctx, util.Map(res, func(v CommentInboxItem) string { return v.Author }))
+	for i := range res {
+		res[i].NickName = userMap[res[i].Author]
+		res[i].ReplyCount, err = svc.CollectionTaskComment.CountDocuments(ctx, bson.M{"threadId": res[i].ID})
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return nil, 0, err
+		}
+		if t, ok := svc.TaskTypes[res[i].TaskType]; ok {
+			if tasks, err := findMeta(ctx, t.Tasks, bson.M{"_id": res[i].TaskID}); err == nil && len(tasks) > 0 {
+				res[i].TaskName = tasks[0].Name
+			}
+		}
+	}
+	return res, int(count), nil
+}
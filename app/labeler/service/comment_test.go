@@ -0,0 +1,35 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCommentMentions(t *testing.T) {
+	got := commentMentions([]string{"2", " 3 ", "1", "2", ""}, "1")
+	if want := []string{"2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	doc, err := bson.Marshal(bson.M{"dialog": bson.A{bson.M{"userContent": "hi"}, bson.M{"userContent": "ok"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, ok := range map[string]bool{
+		"":                     true,
+		"dialog":               true,
+		"dialog.1":             true,
+		"dialog.1.userContent": true,
+		"dialog.2":             false,
+		"dialog..1":            false,
+		"output":               false,
+	} {
+		if err := lookupPath(doc, path); (err == nil) != ok {
+			t.Errorf("%q: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+	ext "go-admin/config"
+)
+
+const (
+	ExportTypeTask     = "t"
+	ExportTypeTaskNER  = "tner"
+	ExportTypeTask2    = "t2"
+	ExportTypeTask3    = "t3"
+	ExportTypeTask4    = "t4"
+	ExportTypeTask5    = "t5"
+	ExportTypeTask6    = "t6"
+	ExportTypeScore    = "t5score"
+	ExportTypeWorkload = "t5workload"
+)
+
+const (
+	exportPollInterval = 3 * time.Second
+	// exportStaleAfter 导出中的任务超过该时间没有更新进度，认为导出进程已经退出，重新导出
+	exportStaleAfter = 10 * time.Minute
+	// exportProgressEvery 每导出多少个任务更新一次进度
+	exportProgressEvery = 100
+	// exportPartSize 上传 MinIO 的分片大小，长度未知时默认分片很大，会占用大量内存
+	exportPartSize   = 16 << 20
+	exportLinkExpiry = time.Hour
+)
+
+// ExportPlan 一次导出的文件名、任务总数和写文件的方法
+type ExportPlan struct {
+	FileName string
+	// Total 需要导出的任务数，0 表示无法预先统计
+	Total int64
+	// Write 把文件内容写入 w，每导出一个任务调用一次 progress
+	Write func(ctx context.Context, w io.Writer, progress func()) error
+}
+
+// ExportFunc 解析导出参数并生成 ExportPlan。创建导出时调用一次用于校验参数和统计总数，后台导出时再调用一次
+type ExportFunc func(ctx context.Context, args string) (ExportPlan, error)
+
+// exportFunc 把请求参数为 R 的导出方法转为 ExportFunc
+func exportFunc[R any](f func(ctx context.Context, req R) (ExportPlan, error)) ExportFunc {
+	return func(ctx context.Context, args string) (ExportPlan, error) {
+		var req R
+		if err := json.Unmarshal([]byte(args), &req); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return ExportPlan{}, err
+		}
+		return f(ctx, req)
+	}
+}
+
+func (svc *LabelerService) registerExporters() {
+	svc.Exporters = map[string]ExportFunc{
+		ExportTypeTask:     exportFunc(svc.exportTask),
+		ExportTypeTaskNER:  exportFunc(svc.exportTaskNER),
+		ExportTypeTask2:    exportFunc(svc.exportTask2),
+		ExportTypeTask3:    exportFunc(svc.exportTask3),
+		ExportTypeTask4:    exportFunc(svc.exportTask4),
+		ExportTypeTask5:    exportFunc(svc.exportTask5),
+		ExportTypeTask6:    exportFunc(svc.exportTask6),
+		ExportTypeScore:    exportFunc(svc.exportScore),
+		ExportTypeWorkload: exportFunc(svc.exportWorkload),
+	}
+	svc.Exporters[ExportTypeTask3Preference] = exportFunc(svc.exportTask3Preference)
+	svc.Exporters[ExportTypeTask4Preference] = exportFunc(svc.exportTask4Preference)
+	svc.Exporters[ExportTypeTask5SFT] = exportFunc(svc.exportTask5SFT)
+}
+
+// CreateExport 校验参数并创建后台导出任务，由 RunExports 执行
+func (svc *LabelerService) CreateExport(ctx context.Context, exportType string, req any) (model.ExportJob, error) {
+	export, ok := svc.Exporters[exportType]
+	if !ok {
+		return model.ExportJob{}, errors.New("导出类型不存在")
+	}
+	args, err := json.Marshal(req)
+	if err != nil {
+		return model.ExportJob{}, err
+	}
+	plan, err := export(ctx, string(args))
+	if err != nil {
+		return model.ExportJob{}, err
+	}
+	userID, _ := operator(ctx)
+	now := util.Datetime(time.Now())
+	job := model.ExportJob{
+		ID:         primitive.NewObjectID(),
+		Type:       exportType,
+		Args:       string(args),
+		Status:     model.ExportStatusWaiting,
+		FileName:   plan.FileName,
+		Total:      plan.Total,
+		Creator:    userID,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if _, err := svc.CollectionExportJob.InsertOne(ctx, job); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.ExportJob{}, err
+	}
+	return job, nil
+}
+
+// RunExports 依次执行等待中的导出任务，需要在单独的 goroutine 中运行
+func (svc *LabelerService) RunExports() {
+	for {
+		found := false
+		_ = log.WithTracer(context.Background(), PackageName, "Labeler Export", func(ctx context.Context) error {
+			job, err := svc.claimExport(ctx)
+			if err != nil {
+				if !errors.Is(err, mongo.ErrNoDocuments) {
+					log.Logger().WithContext(ctx).Error("claim export: ", err.Error())
+				}
+				return err
+			}
+			found = true
+			svc.runExport(ctx, job)
+			return nil
+		})
+		if !found {
+			time.Sleep(exportPollInterval)
+		}
+	}
+}
+
+// claimExport 领取一个等待中或者进度长时间没有更新的导出任务
+func (svc *LabelerService) claimExport(ctx context.Context) (model.ExportJob, error) {
+	now := time.Now()
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"status": model.ExportStatusWaiting},
+			bson.M{
+				"status":     model.ExportStatusRunning,
+				"updateTime": bson.M{"$lt": now.Add(-exportStaleAfter)},
+			},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     model.ExportStatusRunning,
+			"done":       0,
+			"updateTime": util.Datetime(now),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After)
+	var job model.ExportJob
+	err := svc.CollectionExportJob.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+func (svc *LabelerService) runExport(ctx context.Context, job model.ExportJob) {
+	objectName, done, err := svc.export(ctx, job)
+	now := util.Datetime(time.Now())
+	set := bson.M{
+		"done":       done,
+		"updateTime": now,
+	}
+	if err != nil {
+		log.Logger().WithContext(ctx).Error("export ", job.ID.Hex(), ": ", err.Error())
+		set["status"] = model.ExportStatusFailed
+		set["error"] = err.Error()
+	} else {
+		set["status"] = model.ExportStatusDone
+		set["objectName"] = objectName
+		set["finishTime"] = now
+	}
+	if _, err := svc.CollectionExportJob.UpdateByID(ctx, job.ID, bson.M{"$set": set}); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+	}
+}
+
+// export 边生成文件边上传到 MinIO，返回文件名和导出的任务数
+func (svc *LabelerService) export(ctx context.Context, job model.ExportJob) (string, int64, error) {
+	export, ok := svc.Exporters[job.Type]
+	if !ok {
+		return "", 0, fmt.Errorf("导出类型不存在：%s", job.Type)
+	}
+	plan, err := export(ctx, job.Args)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var done int64
+	progress := func() {
+		done++
+		if done%exportProgressEvery != 0 {
+			return
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"done":       done,
+				"updateTime": util.Datetime(time.Now()),
+			},
+		}
+		if _, err := svc.CollectionExportJob.UpdateByID(ctx, job.ID, update); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+		}
+	}
+
+	objectName := "labeler/" + job.ID.Hex() + path.Ext(job.FileName)
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := plan.Write(ctx, pw, progress)
+		_ = pw.CloseWithError(err)
+		errc <- err
+	}()
+	_, err = svc.MinIOClient.PutObject(ctx, ext.ExtConfig.MinIO.ExportFileBucket, objectName, pr, -1, minio.PutObjectOptions{
+		PartSize: exportPartSize,
+	})
+	if err != nil {
+		// 上传失败时关闭读端，让写文件的 goroutine 退出
+		_ = pr.CloseWithError(err)
+	}
+	if werr := <-errc; werr != nil {
+		return "", done, werr
+	}
+	if err != nil {
+		log.Logger().WithContext(ctx).Error("minio save file: ", err.Error())
+		return "", done, err
+	}
+	return objectName, done, nil
+}
+
+type SearchExportsReq struct {
+	Type   string `form:"type"`
+	Status string `form:"status"`
+	dto.Pagination
+}
+
+// SearchExports 查询导出任务，管理员可以查看所有人的导出
+func (svc *LabelerService) SearchExports(ctx context.Context, req SearchExportsReq) ([]model.ExportJob, int, error) {
+	filter := bson.M{}
+	if userID, admin := operator(ctx); !admin {
+		filter["creator"] = userID
+	}
+	if req.Type != "" {
+		filter["type"] = req.Type
+	}
+	if req.Status != "" {
+		filter["status"] = req.Status
+	}
+	count, err := svc.CollectionExportJob.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	opts := pageOptions(req.Pagination).SetSort(bson.D{{Key: "_id", Value: -1}})
+	cursor, err := svc.CollectionExportJob.Find(ctx, filter, opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	res := make([]model.ExportJob, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	return res, int(count), nil
+}
+
+// GetExport 查询导出任务的状态和进度
+func (svc *LabelerService) GetExport(ctx context.Context, id primitive.ObjectID) (model.ExportJob, error) {
+	var job model.ExportJob
+	if err := svc.CollectionExportJob.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.ExportJob{}, errors.New("导出任务不存在")
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.ExportJob{}, err
+	}
+	if userID, admin := operator(ctx); !admin && job.Creator != userID {
+		return model.ExportJob{}, errors.New("权限不足")
+	}
+	return job, nil
+}
+
+type ExportFileResp struct {
+	URL      string `json:"url"`
+	FileName string `json:"fileName"`
+}
+
+// ExportFile 生成导出文件的临时下载链接
+func (svc *LabelerService) ExportFile(ctx context.Context, id primitive.ObjectID) (ExportFileResp, error) {
+	job, err := svc.GetExport(ctx, id)
+	if err != nil {
+		return ExportFileResp{}, err
+	}
+	switch job.Status {
+	case model.ExportStatusDone:
+	case model.ExportStatusFailed:
+		return ExportFileResp{}, errors.New("导出失败：" + job.Error)
+	default:
+		return ExportFileResp{}, errors.New("正在后台导出中,请稍候")
+	}
+	params := url.Values{}
+	params.Set("response-content-disposition", "attachment; filename*=UTF-8''"+url.PathEscape(job.FileName))
+	u, err := svc.MinIOClient.PresignedGetObject(ctx, ext.ExtConfig.MinIO.ExportFileBucket, job.ObjectName, exportLinkExpiry, params)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error("minio presign: ", err.Error())
+		return ExportFileResp{}, err
+	}
+	return ExportFileResp{URL: u.String(), FileName: job.FileName}, nil
+}
+
+// exportZipJSON 统计并逐个导出任务为 zip 中的 json 文件，文件名取任务名第一个 . 之前的部分
+func exportZipJSON[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, name func(T) string) (ExportPlan, error) {
+	total, err := collection.CountDocuments(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return ExportPlan{}, err
+	}
+	return ExportPlan{
+		FileName: time.Now().Format("2006-01-02 15-04-05") + "下载文件.zip",
+		Total:    total,
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			cursor, err := collection.Find(ctx, notDeleted(filter))
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			defer func() {
+				_ = cursor.Close(ctx)
+			}()
+			zipWriter := zip.NewWriter(w)
+			for cursor.Next(ctx) {
+				var task T
+				if err := cursor.Decode(&task); err != nil {
+					log.Logger().WithContext(ctx).Error(err.Error())
+					return err
+				}
+				data, err := json.Marshal(task)
+				if err != nil {
+					return err
+				}
+				f, err := zipWriter.Create(strings.Split(name(task), ".")[0] + ".json")
+				if err != nil {
+					return err
+				}
+				if _, err := f.Write(data); err != nil {
+					return err
+				}
+				progress()
+			}
+			if err := cursor.Err(); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			return zipWriter.Close()
+		},
+	}, nil
+}
+
+// writeExcel 把游标中的任务逐行写入 Excel，第一行为表头
+func writeExcel[T any](ctx context.Context, cursor *mongo.Cursor, w io.Writer, columns []string, row func(index int, task T) []interface{}, progress func()) error {
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		return err
+	}
+	if err := sw.SetRow("A1", util.Map(columns, func(v string) interface{} { return v })); err != nil {
+		return err
+	}
+	for index := 0; cursor.Next(ctx); index++ {
+		var task T
+		if err := cursor.Decode(&task); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return err
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, index+2)
+		if err := sw.SetRow(cell, row(index, task)); err != nil {
+			return err
+		}
+		progress()
+	}
+	if err := cursor.Err(); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
+
+// timeRange start 和 end 都不为空时按 field 过滤
+func timeRange(filter bson.M, field string, start string, end string) error {
+	if len(start) == 0 || len(end) == 0 {
+		return nil
+	}
+	startTime, err := time.Parse(util.TimeLayoutDatetime, start)
+	if err != nil {
+		return ErrTimeParse
+	}
+	endTime, err := time.Parse(util.TimeLayoutDatetime, end)
+	if err != nil {
+		return ErrTimeParse
+	}
+	filter[field] = bson.M{
+		"$gte": startTime,
+		"$lte": endTime,
+	}
+	return nil
+}
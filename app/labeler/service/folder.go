@@ -12,7 +12,23 @@ import (
 )
 
 func (svc *LabelerService) GetFolders(ctx context.Context) ([]*model.Folder, error) {
-	cursor, err := svc.CollectionFolder.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{"createTime", -1}}))
+	return svc.StoreTask.GetFolders(ctx)
+}
+
+func (svc *LabelerService) CreateFolder(ctx context.Context, req model.Folder) (model.Folder, error) {
+	return svc.StoreTask.CreateFolder(ctx, req)
+}
+
+func (svc *LabelerService) UpdateFolder(ctx context.Context, req model.Folder) (model.Folder, error) {
+	return svc.StoreTask.UpdateFolder(ctx, req)
+}
+
+func (svc *LabelerService) DeleteFolder(ctx context.Context, id primitive.ObjectID) error {
+	return svc.StoreTask.DeleteFolder(ctx, id)
+}
+
+func (t *TaskType) GetFolders(ctx context.Context) ([]*model.Folder, error) {
+	cursor, err := t.Folders.Find(ctx, notDeleted(bson.D{}), options.Find().SetSort(bson.D{{Key: "createTime", Value: -1}}))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error("get folders: ", err.Error())
 		return nil, ErrDatabase
@@ -49,9 +65,9 @@ func FolderTree(folders []*model.Folder) []*model.Folder {
 	return tree
 }
 
-func (svc *LabelerService) CreateFolder(ctx context.Context, req model.Folder) (model.Folder, error) {
+func (t *TaskType) CreateFolder(ctx context.Context, req model.Folder) (model.Folder, error) {
 	InitObjectID(&req.ID)
-	if _, err := svc.CollectionFolder.InsertOne(ctx, req); err != nil {
+	if _, err := t.Folders.InsertOne(ctx, req); err != nil {
 		log.Logger().WithContext(ctx).Error("create folder: ", err.Error())
 		return model.Folder{}, ErrDatabase
 	}
@@ -59,23 +75,12 @@ func (svc *LabelerService) CreateFolder(ctx context.Context, req model.Folder) (
 	return req, nil
 }
 
-func (svc *LabelerService) UpdateFolder(ctx context.Context, req model.Folder) (model.Folder, error) {
+func (t *TaskType) UpdateFolder(ctx context.Context, req model.Folder) (model.Folder, error) {
 	data := bson.M{"$set": bson.M{"name": req.Name}}
-	if _, err := svc.CollectionFolder.UpdateByID(ctx, req.ID, data); err != nil {
+	if _, err := t.Folders.UpdateOne(ctx, notDeleted(bson.M{"_id": req.ID}), data); err != nil {
 		log.Logger().WithContext(ctx).Error("update folder: ", err.Error())
 		return model.Folder{}, ErrDatabase
 	}
 
 	return req, nil
 }
-
-func (svc *LabelerService) DeleteFolder(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionFolder.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete folder: ", err.Error())
-		return ErrDatabase
-	}
-
-	log.Logger().WithContext(ctx).Warnf("delete folder:%s", id.Hex())
-
-	return nil
-}
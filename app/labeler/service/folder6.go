@@ -3,57 +3,23 @@ package service
 import (
 	"context"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go-admin/app/labeler/model"
-	"go-admin/common/log"
 )
 
 func (svc *LabelerService) GetFolders6(ctx context.Context) ([]*model.Folder, error) {
-	cursor, err := svc.CollectionFolder6.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{"createTime", -1}}))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error("get folders: ", err.Error())
-		return nil, ErrDatabase
-	}
-
-	var folders []*model.Folder
-	if err = cursor.All(ctx, &folders); err != nil {
-		log.Logger().WithContext(ctx).Error("get folders: ", err.Error())
-		return nil, ErrDatabase
-	}
-
-	return FolderTree(folders), nil
+	return svc.StoreTask6.GetFolders(ctx)
 }
 
 func (svc *LabelerService) CreateFolder6(ctx context.Context, req model.Folder) (model.Folder, error) {
-	InitObjectID(&req.ID)
-	if _, err := svc.CollectionFolder6.InsertOne(ctx, req); err != nil {
-		log.Logger().WithContext(ctx).Error("create folder: ", err.Error())
-		return model.Folder{}, ErrDatabase
-	}
-
-	return req, nil
+	return svc.StoreTask6.CreateFolder(ctx, req)
 }
 
 func (svc *LabelerService) UpdateFolder6(ctx context.Context, req model.Folder) (model.Folder, error) {
-	data := bson.M{"$set": bson.M{"name": req.Name}}
-	if _, err := svc.CollectionFolder6.UpdateByID(ctx, req.ID, data); err != nil {
-		log.Logger().WithContext(ctx).Error("update folder: ", err.Error())
-		return model.Folder{}, ErrDatabase
-	}
-
-	return req, nil
+	return svc.StoreTask6.UpdateFolder(ctx, req)
 }
 
 func (svc *LabelerService) DeleteFolder6(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionFolder6.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete folder: ", err.Error())
-		return ErrDatabase
-	}
-
-	log.Logger().WithContext(ctx).Warnf("delete folder:%s", id.Hex())
-
-	return nil
+	return svc.StoreTask6.DeleteFolder(ctx, id)
 }
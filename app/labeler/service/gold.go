@@ -0,0 +1,706 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+const (
+	// goldMinGraded 标注员至少提交几个金标准任务后才按准确率标记
+	goldMinGraded = 5
+	// goldTrendDays 准确率趋势默认统计的天数
+	goldTrendDays = 30
+)
+
+var ErrGoldUnsupported = errors.New("该任务类型不支持金标准")
+
+var (
+	goldRandMu sync.Mutex
+	goldRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func goldFloat64() float64 {
+	goldRandMu.Lock()
+	defer goldRandMu.Unlock()
+	return goldRand.Float64()
+}
+
+func checkGold(g model.GoldSetting) error {
+	if g.Ratio < 0 || g.Ratio > 1 {
+		return errors.New("金标准任务比例必须在0到1之间")
+	}
+	if g.Threshold < 0 || g.Threshold > 1 {
+		return errors.New("金标准准确率阈值必须在0到1之间")
+	}
+	return nil
+}
+
+// goldCount 给标注员分配 n 个正常任务时混入的金标准任务数，小数部分按概率取整
+func goldCount(n int64, ratio float64) int64 {
+	v := float64(n) * ratio
+	count := int64(v)
+	if goldFloat64() < v-float64(count) {
+		count++
+	}
+	return count
+}
+
+// goldType 任务类型的金标准，标准答案和提交结果都按多人标注的标注项比较
+type goldType struct {
+	// answer 把前端提交的标准答案转换为任务文档中的字段
+	answer func(answer json.RawMessage) (bson.M, error)
+	// decode 把保存的标准答案转换为前端的任务格式
+	decode func(answer bson.Raw) (any, error)
+	// ratings 取出任务文档中和标准答案比较的标注项
+	ratings func(doc bson.Raw) ([]rating, error)
+}
+
+func newGoldType[T any](answer func(T) bson.M, ratings func(T) []rating) *goldType {
+	return &goldType{
+		answer: func(raw json.RawMessage) (bson.M, error) {
+			var task T
+			if err := json.Unmarshal(raw, &task); err != nil {
+				return nil, fmt.Errorf("标准答案格式不正确：%w", err)
+			}
+			return answer(task), nil
+		},
+		decode: func(raw bson.Raw) (any, error) {
+			var task T
+			err := bson.Unmarshal(raw, &task)
+			return task, err
+		},
+		ratings: func(doc bson.Raw) ([]rating, error) {
+			var task T
+			if err := bson.Unmarshal(doc, &task); err != nil {
+				return nil, err
+			}
+			return ratings(task), nil
+		},
+	}
+}
+
+func (svc *LabelerService) registerGolds() {
+	svc.TaskTypes["t2"].Gold = newGoldType(task2Overlap.answer, task2Overlap.ratings)
+	svc.TaskTypes["t3"].Gold = newGoldType(task3Overlap.answer, task3Overlap.ratings)
+	svc.TaskTypes["t4"].Gold = newGoldType(task4Overlap.answer, task4Overlap.ratings)
+	svc.TaskTypes["t5"].Gold = newGoldType(func(t model.Task5) bson.M {
+		return bson.M{"score": t.Score}
+	}, task5Ratings)
+}
+
+func task5Ratings(t model.Task5) []rating {
+	res := make([]rating, 0, len(t.Score))
+	for key, score := range t.Score {
+		res = append(res, rating{Label: "打分：" + key, Score: float64(score), Numeric: true})
+	}
+	return res
+}
+
+// compareRatings 标准答案中的标注项有几项和提交结果一致，提交结果中没有填写的项算作不一致
+func compareRatings(gold, answer []rating) (correct int, total int) {
+	submitted := make(map[string]rating, len(answer))
+	for _, r := range answer {
+		submitted[r.Label+"\x00"+r.Unit] = r
+	}
+	for _, g := range gold {
+		total++
+		r, ok := submitted[g.Label+"\x00"+g.Unit]
+		if !ok {
+			continue
+		}
+		if g.Numeric && r.Score == g.Score || !g.Numeric && r.Value == g.Value {
+			correct++
+		}
+	}
+	return correct, total
+}
+
+// goldTemplates 金标准任务所在的集合，t5 为待领取的对话
+func (t *TaskType) goldTemplates() *mongo.Collection {
+	if t.Pool != nil {
+		return t.Pool
+	}
+	return t.Tasks
+}
+
+// projectGold 项目的金标准配置
+func (t *TaskType) projectGold(ctx context.Context, projectID primitive.ObjectID) (model.GoldSetting, error) {
+	var project struct {
+		Gold model.GoldSetting `bson:"gold"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"gold": 1})
+	if err := t.Projects.FindOne(ctx, notDeleted(bson.M{"_id": projectID}), opts).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.GoldSetting{}, ErrProjectNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.GoldSetting{}, err
+	}
+	return project.Gold, nil
+}
+
+// notGold 在查询条件上排除金标准任务和金标准副本，用于项目进度、任务列表和导出；标注员自己的任务列表中保留副本
+func notGold(filter bson.M) bson.M {
+	ft := make(bson.M, len(filter)+2)
+	for k, v := range filter {
+		ft[k] = v
+	}
+	ft["gold"] = bson.M{"$exists": false}
+	ft["goldSource"] = bson.M{"$exists": false}
+	return ft
+}
+
+// goldSources 标注员已经分配过的金标准任务
+func (t *TaskType) goldSources(ctx context.Context, projectID primitive.ObjectID, labelerID string) ([]primitive.ObjectID, error) {
+	filter := bson.M{
+		"projectId":              projectID,
+		"permissions.labeler.id": labelerID,
+		"goldSource":             bson.M{"$exists": true},
+	}
+	var copies []struct {
+		GoldSource primitive.ObjectID `bson:"goldSource"`
+	}
+	cursor, err := t.Tasks.Find(ctx, filter, options.Find().SetProjection(bson.M{"goldSource": 1}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	if err := cursor.All(ctx, &copies); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	res := make([]primitive.ObjectID, 0, len(copies))
+	for _, v := range copies {
+		res = append(res, v.GoldSource)
+	}
+	return res, nil
+}
+
+// allocGold 给标注员复制 count 个还没有做过的金标准任务，副本和正常分配的任务一样记录流转和动态
+func (t *TaskType) allocGold(ctx context.Context, req BatchAllocReq, labelerID string, count int64) error {
+	if count <= 0 {
+		return nil
+	}
+	done, err := t.goldSources(ctx, req.ProjectID, labelerID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{
+		"projectId": req.ProjectID,
+		"gold":      bson.M{"$exists": true},
+		"_id":       bson.M{"$nin": done},
+	}
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(filter)}},
+		{{Key: "$sample", Value: bson.M{"size": count}}},
+	}
+	var templates []bson.M
+	if err := aggregateAll(ctx, t.Tasks, pipe, &templates); err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+	now := util.Datetime(time.Now())
+	docs := make([]any, len(templates))
+	metas := make([]model.TaskMeta, len(templates))
+	for i, doc := range templates {
+		source := doc["_id"].(primitive.ObjectID)
+		delete(doc, "gold")
+		delete(doc, "adjudication")
+		doc["_id"] = primitive.NewObjectID()
+		doc["goldSource"] = source
+		doc["permissions"] = model.Permissions{Labeler: &model.Person{ID: labelerID}}
+		doc["status"] = model.TaskStatusLabeling
+		doc["updateTime"] = now
+		doc["allocatedTime"] = now
+		docs[i] = doc
+		metas[i] = model.TaskMeta{
+			ID:        doc["_id"].(primitive.ObjectID),
+			ProjectID: req.ProjectID,
+			Status:    model.TaskStatusAllocate,
+		}
+	}
+	if _, err := t.Tasks.InsertMany(ctx, docs); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	records := util.Map(metas, func(v model.TaskMeta) model.TaskTransition {
+		record := t.newTransition(v, model.TaskStatusLabeling)
+		record.Actor = req.Actor
+		record.Role = PermissionTypeAdmin
+		record.Reason = "分配标注：" + labelerID
+		return record
+	})
+	if err := t.recordTransitions(ctx, records); err != nil {
+		return err
+	}
+	activities := util.Map(metas, func(v model.TaskMeta) model.TaskActivity {
+		return t.newActivity(ctx, v, model.ActivityAllocate, []model.FieldChange{
+			{Field: "status", Old: v.Status, New: model.TaskStatusLabeling},
+			{Field: "permissions.labeler.id", New: labelerID},
+		})
+	})
+	return t.recordActivities(ctx, activities)
+}
+
+// gradeGold 金标准任务的副本提交后和标准答案比较，评分失败不影响提交
+func (t *TaskType) gradeGold(ctx context.Context, ids []primitive.ObjectID) {
+	if t.Gold == nil || len(ids) == 0 {
+		return
+	}
+	if err := t.gradeGoldTasks(ctx, ids); err != nil {
+		log.Logger().WithContext(ctx).Error("grade gold: ", err.Error())
+	}
+}
+
+func (t *TaskType) gradeGoldTasks(ctx context.Context, ids []primitive.ObjectID) error {
+	filter := bson.M{
+		"_id":        bson.M{"$in": ids},
+		"goldSource": bson.M{"$exists": true},
+	}
+	docs, err := findRaw(ctx, t.Tasks, filter)
+	if err != nil {
+		return err
+	}
+	now := util.Datetime(time.Now())
+	for _, doc := range docs {
+		var task struct {
+			model.TaskMeta `bson:",inline"`
+			GoldSource     primitive.ObjectID `bson:"goldSource"`
+		}
+		if err := bson.Unmarshal(doc, &task); err != nil {
+			return err
+		}
+		if task.Permissions.Labeler == nil {
+			continue
+		}
+		// 金标准任务被删除或取消后仍然按原答案评分
+		var template struct {
+			Gold *model.Gold `bson:"gold"`
+		}
+		err := t.goldTemplates().FindOne(ctx, bson.M{"_id": task.GoldSource}).Decode(&template)
+		if errors.Is(err, mongo.ErrNoDocuments) || err == nil && template.Gold == nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		gold, err := t.Gold.ratings(template.Gold.Answer)
+		if err != nil {
+			return err
+		}
+		answer, err := t.Gold.ratings(doc)
+		if err != nil {
+			return err
+		}
+		correct, total := compareRatings(gold, answer)
+		if total == 0 {
+			continue
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"taskType":   t.Name,
+				"projectId":  task.ProjectID,
+				"goldId":     task.GoldSource,
+				"labeler":    task.Permissions.Labeler.ID,
+				"correct":    correct,
+				"total":      total,
+				"accuracy":   float64(correct) / float64(total),
+				"createTime": now,
+			},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		}
+		opts := options.Update().SetUpsert(true)
+		if _, err := t.GoldResults.UpdateOne(ctx, bson.M{"taskId": task.ID}, update, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelerAccuracies 项目中各标注员的金标准准确率，按标注项计算
+func (t *TaskType) labelerAccuracies(ctx context.Context, projectID primitive.ObjectID) (map[string]*LabelerAccuracy, model.GoldSetting, error) {
+	setting, err := t.projectGold(ctx, projectID)
+	if err != nil {
+		return nil, setting, err
+	}
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"taskType": t.Name, "projectId": projectID}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$labeler"},
+			{Key: "graded", Value: bson.M{"$sum": 1}},
+			{Key: "correct", Value: bson.M{"$sum": "$correct"}},
+			{Key: "total", Value: bson.M{"$sum": "$total"}},
+		}}},
+	}
+	var groups []struct {
+		Labeler string `bson:"_id"`
+		Graded  int    `bson:"graded"`
+		Correct int    `bson:"correct"`
+		Total   int    `bson:"total"`
+	}
+	if err := aggregateAll(ctx, t.GoldResults, pipe, &groups); err != nil {
+		return nil, setting, err
+	}
+	res := make(map[string]*LabelerAccuracy, len(groups))
+	for _, g := range groups {
+		v := &LabelerAccuracy{
+			Labeler: model.Person{ID: g.Labeler},
+			Graded:  g.Graded,
+			Correct: g.Correct,
+			Total:   g.Total,
+		}
+		if g.Total > 0 {
+			v.Accuracy = ratio(float64(g.Correct) / float64(g.Total))
+			v.Flagged = setting.Threshold > 0 && g.Graded >= goldMinGraded && *v.Accuracy < setting.Threshold
+		}
+		res[g.Labeler] = v
+	}
+	return res, setting, nil
+}
+
+// flaggedLabelers 准确率低于项目阈值的标注员
+func (t *TaskType) flaggedLabelers(ctx context.Context, projectID primitive.ObjectID) (map[string]bool, error) {
+	if t.Gold == nil {
+		return nil, nil
+	}
+	accuracies, _, err := t.labelerAccuracies(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]bool)
+	for id, v := range accuracies {
+		if v.Flagged {
+			res[id] = true
+		}
+	}
+	return res, nil
+}
+
+type SetGoldReq struct {
+	TaskID primitive.ObjectID `json:"taskId"`
+	// Answer 标准答案，格式和任务相同，t5 为 {"score": {...}}
+	Answer json.RawMessage `json:"answer"`
+}
+
+// SetGold 把未分配的任务设为金标准任务，已经是金标准任务时修改标准答案
+func (svc *LabelerService) SetGold(ctx context.Context, taskType string, req SetGoldReq) error {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return err
+	}
+	if t.Gold == nil {
+		return ErrGoldUnsupported
+	}
+	answer, err := t.Gold.answer(req.Answer)
+	if err != nil {
+		return err
+	}
+	raw, err := bson.Marshal(answer)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{
+		"_id":        req.TaskID,
+		"goldSource": bson.M{"$exists": false},
+	}
+	if t.Pool == nil {
+		filter["status"] = model.TaskStatusAllocate
+		filter["permissions.labeler"] = bson.M{"$exists": false}
+	}
+	userID, _ := operator(ctx)
+	gold := model.Gold{
+		Answer:     raw,
+		Creator:    userID,
+		CreateTime: util.Datetime(time.Now()),
+	}
+	result, err := t.goldTemplates().UpdateOne(ctx, notDeleted(filter), bson.M{"$set": bson.M{"gold": gold}})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("任务不存在或已分配，只能把未分配的任务设为金标准")
+	}
+	return nil
+}
+
+// UnsetGold 取消金标准任务，已分配的副本仍然按原答案评分
+func (svc *LabelerService) UnsetGold(ctx context.Context, taskType string, id primitive.ObjectID) error {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return err
+	}
+	if t.Gold == nil {
+		return ErrGoldUnsupported
+	}
+	result, err := t.goldTemplates().UpdateOne(ctx, notDeleted(bson.M{"_id": id}), bson.M{"$unset": bson.M{"gold": ""}})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+type GoldTaskResp struct {
+	ID         primitive.ObjectID `json:"id"`
+	Name       string             `json:"name"`
+	Answer     any                `json:"answer"`
+	Creator    string             `json:"creator"`
+	CreateTime util.Datetime      `json:"createTime"`
+	// Graded 副本的提交数，Accuracy 提交的平均准确率
+	Graded   int      `json:"graded"`
+	Accuracy *float64 `json:"accuracy"`
+}
+
+// SearchGold 项目中的金标准任务和各自的提交情况
+func (svc *LabelerService) SearchGold(ctx context.Context, taskType string, projectID primitive.ObjectID) ([]GoldTaskResp, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return nil, err
+	}
+	if t.Gold == nil {
+		return nil, ErrGoldUnsupported
+	}
+	filter := bson.M{
+		"projectId": projectID,
+		"gold":      bson.M{"$exists": true},
+	}
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "name": 1, "gold": 1})
+	cursor, err := t.goldTemplates().Find(ctx, notDeleted(filter), opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	var templates []struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Name string             `bson:"name"`
+		Gold model.Gold         `bson:"gold"`
+	}
+	if err := cursor.All(ctx, &templates); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"taskType": t.Name, "projectId": projectID}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$goldId"},
+			{Key: "graded", Value: bson.M{"$sum": 1}},
+			{Key: "accuracy", Value: bson.M{"$avg": "$accuracy"}},
+		}}},
+	}
+	var groups []struct {
+		GoldID   primitive.ObjectID `bson:"_id"`
+		Graded   int                `bson:"graded"`
+		Accuracy float64            `bson:"accuracy"`
+	}
+	if err := aggregateAll(ctx, t.GoldResults, pipe, &groups); err != nil {
+		return nil, err
+	}
+	stats := make(map[primitive.ObjectID]int, len(groups))
+	for i, g := range groups {
+		stats[g.GoldID] = i
+	}
+
+	res := make([]GoldTaskResp, len(templates))
+	for i, v := range templates {
+		answer, err := t.Gold.decode(v.Gold.Answer)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return nil, err
+		}
+		res[i] = GoldTaskResp{
+			ID:         v.ID,
+			Name:       v.Name,
+			Answer:     answer,
+			Creator:    v.Gold.Creator,
+			CreateTime: v.Gold.CreateTime,
+		}
+		if j, ok := stats[v.ID]; ok {
+			res[i].Graded = groups[j].Graded
+			res[i].Accuracy = ratio(groups[j].Accuracy)
+		}
+	}
+	return res, nil
+}
+
+type GoldAccuracyReq struct {
+	ProjectID primitive.ObjectID `form:"-"`
+	// Days 趋势统计最近几天，默认 30 天
+	Days int `form:"days"`
+}
+
+type GoldAccuracyResp struct {
+	Threshold float64 `json:"threshold"`
+	// MinGraded 提交的金标准任务达到该数量后才会被标记
+	MinGraded int               `json:"minGraded"`
+	Labelers  []LabelerAccuracy `json:"labelers"`
+}
+
+type LabelerAccuracy struct {
+	Labeler model.Person `json:"labeler"`
+	// Graded 提交的金标准任务数，Correct、Total 和标准答案一致的标注项数和标注项总数
+	Graded   int      `json:"graded"`
+	Correct  int      `json:"correct"`
+	Total    int      `json:"total"`
+	Accuracy *float64 `json:"accuracy"`
+	// Flagged 准确率低于项目阈值
+	Flagged bool            `json:"flagged"`
+	Trend   []AccuracyPoint `json:"trend"`
+}
+
+type AccuracyPoint struct {
+	Date     string   `json:"date"`
+	Graded   int      `json:"graded"`
+	Accuracy *float64 `json:"accuracy"`
+}
+
+// GoldAccuracy 项目中各标注员的金标准准确率和按天的趋势，被标记的排在前面
+func (svc *LabelerService) GoldAccuracy(ctx context.Context, taskType string, req GoldAccuracyReq) (GoldAccuracyResp, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return GoldAccuracyResp{}, err
+	}
+	if t.Gold == nil {
+		return GoldAccuracyResp{}, ErrGoldUnsupported
+	}
+	accuracies, setting, err := t.labelerAccuracies(ctx, req.ProjectID)
+	if err != nil {
+		return GoldAccuracyResp{}, err
+	}
+	if req.Days <= 0 {
+		req.Days = goldTrendDays
+	}
+	since := time.Now().AddDate(0, 0, -req.Days)
+	filter := bson.M{
+		"taskType":   t.Name,
+		"projectId":  req.ProjectID,
+		"createTime": bson.M{"$gte": since},
+	}
+	opts := options.Find().SetSort(bson.M{"createTime": 1}).
+		SetProjection(bson.M{"labeler": 1, "correct": 1, "total": 1, "createTime": 1})
+	cursor, err := t.GoldResults.Find(ctx, filter, opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return GoldAccuracyResp{}, err
+	}
+	var results []model.GoldResult
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return GoldAccuracyResp{}, err
+	}
+	type day struct {
+		graded, correct, total int
+	}
+	days := make(map[string]map[string]*day)
+	for _, r := range results {
+		v, ok := accuracies[r.Labeler]
+		if !ok {
+			continue
+		}
+		date := time.Time(r.CreateTime).Local().Format("2006-01-02")
+		if days[r.Labeler] == nil {
+			days[r.Labeler] = make(map[string]*day)
+		}
+		d, ok := days[r.Labeler][date]
+		if !ok {
+			d = &day{}
+			days[r.Labeler][date] = d
+			v.Trend = append(v.Trend, AccuracyPoint{Date: date})
+		}
+		d.graded++
+		d.correct += r.Correct
+		d.total += r.Total
+	}
+
+	labelers := make([]LabelerAccuracy, 0, len(accuracies))
+	ids := make([]string, 0, len(accuracies))
+	for id, v := range accuracies {
+		for i, p := range v.Trend {
+			d := days[id][p.Date]
+			v.Trend[i].Graded = d.graded
+			if d.total > 0 {
+				v.Trend[i].Accuracy = ratio(float64(d.correct) / float64(d.total))
+			}
+		}
+		if v.Trend == nil {
+			v.Trend = []AccuracyPoint{}
+		}
+		labelers = append(labelers, *v)
+		ids = append(ids, id)
+	}
+	userMap := svc.userNickNames(ctx, ids)
+	for i := range labelers {
+		labelers[i].Labeler.NickName = userMap[labelers[i].Labeler.ID]
+	}
+	sort.Slice(labelers, func(i, j int) bool {
+		if labelers[i].Flagged != labelers[j].Flagged {
+			return labelers[i].Flagged
+		}
+		return accuracyValue(labelers[i].Accuracy) < accuracyValue(labelers[j].Accuracy)
+	})
+	return GoldAccuracyResp{
+		Threshold: setting.Threshold,
+		MinGraded: goldMinGraded,
+		Labelers:  labelers,
+	}, nil
+}
+
+func accuracyValue(v *float64) float64 {
+	if v == nil {
+		return math.Inf(1)
+	}
+	return *v
+}
+
+// claimGoldTask5 按项目的金标准比例随机领取一个标注员没有做过的金标准对话，
+// 比例为金标准对话和正常对话的数量比，没有领取到时返回 false
+func (svc *LabelerService) claimGoldTask5(ctx context.Context, projectID primitive.ObjectID, sessionIDs []string) (model.Task5, bool, error) {
+	gold, err := svc.StoreTask5.projectGold(ctx, projectID)
+	if err != nil {
+		return model.Task5{}, false, err
+	}
+	if gold.Ratio <= 0 || goldFloat64() >= gold.Ratio/(1+gold.Ratio) {
+		return model.Task5{}, false, nil
+	}
+	filter := bson.M{
+		"projectId": projectID,
+		"gold":      bson.M{"$exists": true},
+		"dialog.0.sessionId": bson.M{
+			"$nin": sessionIDs,
+		},
+	}
+	pipe := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(filter)}},
+		{{Key: "$sample", Value: bson.M{"size": 1}}},
+	}
+	var tasks []model.Task5
+	if err := aggregateAll(ctx, svc.CollectionTask5, pipe, &tasks); err != nil {
+		return model.Task5{}, false, err
+	}
+	if len(tasks) == 0 {
+		return model.Task5{}, false, nil
+	}
+	return tasks[0], true, nil
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 导入文件的格式
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+)
+
+const (
+	// importBatchSize 校验通过的任务每批写入的条数
+	importBatchSize = 500
+	// maxImportErrors 报告中最多返回的行错误数
+	maxImportErrors = 200
+	// importFieldName 任务名称字段，没有映射时名称为 文件名-行号
+	importFieldName = "name"
+)
+
+// ImportColumn 文件中的一列对应任务的一个字段，CSV 为表头，JSONL 为对象的键
+type ImportColumn struct {
+	Column string `json:"column"`
+	Field  string `json:"field"`
+}
+
+type ImportTaskReq struct {
+	ProjectID primitive.ObjectID
+	Format    string
+	// Prefix 没有映射名称时任务名称为 Prefix-行号，与 Excel 上传一致
+	Prefix  string
+	File    io.Reader
+	Mapping []ImportColumn
+	// DryRun 只校验并返回报告，不写入任务
+	DryRun bool
+}
+
+// ImportRowError 第 Row 行数据（不含表头，从 1 开始）的错误
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportTaskResp struct {
+	DryRun   bool `json:"dryRun"`
+	Total    int  `json:"total"`
+	Valid    int  `json:"valid"`
+	Invalid  int  `json:"invalid"`
+	Imported int  `json:"imported"`
+	// Errors 最多 maxImportErrors 条，Invalid 为实际出错的行数
+	Errors []ImportRowError `json:"errors"`
+}
+
+// ImportFormat 按文件扩展名判断导入格式
+func ImportFormat(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return ImportFormatCSV
+	case ".jsonl", ".ndjson":
+		return ImportFormatJSONL
+	}
+	return ""
+}
+
+// importRow 文件中的一行，Values 的键为列名，JSONL 中的数组展开为多个值
+type importRow struct {
+	Row    int
+	Values map[string][]string
+	Err    error
+}
+
+// parseImport 读取全部行，单行格式错误记录在该行上，不影响其他行
+func parseImport(format string, r io.Reader) ([]importRow, []string, error) {
+	switch format {
+	case ImportFormatCSV:
+		return parseImportCSV(r)
+	case ImportFormatJSONL:
+		rows, err := parseImportJSONL(r)
+		return rows, nil, err
+	}
+	return nil, nil, fmt.Errorf("不支持的导入格式：%s", format)
+}
+
+func parseImportCSV(r io.Reader) ([]importRow, []string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("文件为空")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	var rows []importRow
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row := importRow{Row: n}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			row.Err = pe.Err
+			rows = append(rows, row)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(record) > len(header) {
+			row.Err = fmt.Errorf("列数 %d 多于表头 %d", len(record), len(header))
+			rows = append(rows, row)
+			continue
+		}
+		row.Values = make(map[string][]string, len(record))
+		for i, v := range record {
+			row.Values[header[i]] = append(row.Values[header[i]], v)
+		}
+		rows = append(rows, row)
+	}
+	return rows, header, nil
+}
+
+func parseImportJSONL(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var rows []importRow
+	n := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		n++
+		row := importRow{Row: n}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(line, &obj); err != nil {
+			row.Err = errors.New("不是合法的 JSON 对象")
+			rows = append(rows, row)
+			continue
+		}
+		row.Values = make(map[string][]string, len(obj))
+		for k, raw := range obj {
+			values, err := jsonImportValues(raw)
+			if err != nil {
+				row.Err = fmt.Errorf("%s：%w", k, err)
+				break
+			}
+			row.Values[k] = values
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// jsonImportValues 字符串原样保留，数字和布尔值取 JSON 文本，数组展开，null 为空
+func jsonImportValues(raw json.RawMessage) ([]string, error) {
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{t}, nil
+	case json.Number:
+		return []string{t.String()}, nil
+	case bool:
+		return []string{strconv.FormatBool(t)}, nil
+	case []any:
+		values := make([]string, 0, len(t))
+		for _, item := range t {
+			switch it := item.(type) {
+			case string:
+				values = append(values, it)
+			case json.Number:
+				values = append(values, it.String())
+			case bool:
+				values = append(values, strconv.FormatBool(it))
+			default:
+				return nil, errors.New("数组中只能是字符串、数字或布尔值")
+			}
+		}
+		return values, nil
+	}
+	return nil, errors.New("不支持嵌套对象")
+}
+
+// importMapping 检查映射的字段是否存在、CSV 的列是否存在；没有配置映射时列名与字段名相同的列自动映射
+func importMapping(mapping []ImportColumn, fields []string, header []string) ([]ImportColumn, error) {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+	if len(mapping) == 0 {
+		for _, c := range header {
+			if known[c] {
+				mapping = append(mapping, ImportColumn{Column: c, Field: c})
+			}
+		}
+		if header == nil {
+			for _, f := range fields {
+				mapping = append(mapping, ImportColumn{Column: f, Field: f})
+			}
+		}
+		return mapping, nil
+	}
+	columns := make(map[string]bool, len(header))
+	for _, c := range header {
+		columns[c] = true
+	}
+	for _, m := range mapping {
+		if !known[m.Field] {
+			return nil, fmt.Errorf("字段 %s 不存在，可选字段：%s", m.Field, strings.Join(fields, "、"))
+		}
+		if header != nil && !columns[m.Column] {
+			return nil, fmt.Errorf("文件中没有列 %s", m.Column)
+		}
+	}
+	return mapping, nil
+}
+
+// mapImportRow 按映射得到字段的值，多列映射到同一字段时按映射顺序合并
+func mapImportRow(row importRow, mapping []ImportColumn) map[string][]string {
+	values := make(map[string][]string, len(mapping))
+	for _, m := range mapping {
+		for _, v := range row.Values[m.Column] {
+			values[m.Field] = append(values[m.Field], strings.TrimSpace(v))
+		}
+	}
+	return values
+}
+
+// firstValue 字段的第一个值，没有时为空
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// importOption 项目没有配置选项时不限制取值
+func importOption(options []string, v string) bool {
+	if len(options) == 0 {
+		return true
+	}
+	for _, o := range options {
+		if o == v {
+			return true
+		}
+	}
+	return false
+}
+
+// importBuilder 把一行字段的值转成任务，返回的错误写入报告
+type importBuilder[T any] func(row int, values map[string][]string) (T, []ImportRowError)
+
+// runImport 解析、校验全部行后把校验通过的任务分批写入，DryRun 时只返回报告
+func runImport[T any](ctx context.Context, store *TaskStore[T], req ImportTaskReq, fields []string, build importBuilder[T]) (ImportTaskResp, error) {
+	resp := ImportTaskResp{DryRun: req.DryRun, Errors: []ImportRowError{}}
+	rows, header, err := parseImport(req.Format, req.File)
+	if err != nil {
+		return resp, err
+	}
+	mapping, err := importMapping(req.Mapping, fields, header)
+	if err != nil {
+		return resp, err
+	}
+	if len(mapping) == 0 {
+		return resp, errors.New("没有可导入的列，请配置列和字段的映射")
+	}
+	names := make(map[string]int, len(rows))
+	tasks := make([]T, 0, len(rows))
+	for _, row := range rows {
+		var errs []ImportRowError
+		var task T
+		if row.Err != nil {
+			errs = []ImportRowError{{Row: row.Row, Message: row.Err.Error()}}
+		} else {
+			values := mapImportRow(row, mapping)
+			name := firstValue(values[importFieldName])
+			if name == "" {
+				name = req.Prefix + "-" + strconv.Itoa(row.Row)
+				values[importFieldName] = []string{name}
+			}
+			if prev, ok := names[name]; ok {
+				errs = append(errs, ImportRowError{Row: row.Row, Field: importFieldName, Message: fmt.Sprintf("名称与第 %d 行重复", prev)})
+			} else {
+				names[name] = row.Row
+			}
+			var buildErrs []ImportRowError
+			task, buildErrs = build(row.Row, values)
+			errs = append(errs, buildErrs...)
+		}
+		if len(errs) > 0 {
+			resp.Invalid++
+			for _, e := range errs {
+				if len(resp.Errors) < maxImportErrors {
+					resp.Errors = append(resp.Errors, e)
+				}
+			}
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	resp.Total = len(rows)
+	resp.Valid = len(tasks)
+	if req.DryRun {
+		return resp, nil
+	}
+	batch := primitive.NewObjectID()
+	for start := 0; start < len(tasks); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		count, err := store.InsertBatch(ctx, tasks[start:end], batch)
+		resp.Imported += count
+		if err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImport(t *testing.T) {
+	rows, header, err := parseImport(ImportFormatCSV, strings.NewReader("\ufeffname,q,a\nn1,\"你好,世界\",x\nn2,y,z,extra\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(header, []string{"name", "q", "a"}) {
+		t.Errorf("header %v", header)
+	}
+	if len(rows) != 2 || rows[0].Values["q"][0] != "你好,世界" || rows[1].Err == nil {
+		t.Errorf("rows %+v", rows)
+	}
+
+	rows, _, err = parseImport(ImportFormatJSONL, strings.NewReader("{\"command\":\"c\",\"output\":[\"o1\",2]}\n\nnot json\n{\"command\":{\"x\":1}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("want 3 rows got %d", len(rows))
+	}
+	if !reflect.DeepEqual(rows[0].Values["output"], []string{"o1", "2"}) || rows[1].Err == nil || rows[2].Err == nil {
+		t.Errorf("rows %+v", rows)
+	}
+}
+
+func TestImportMapping(t *testing.T) {
+	fields := []string{"name", "command", "output"}
+	mapping, err := importMapping(nil, fields, []string{"name", "command", "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 2 {
+		t.Errorf("default mapping %v", mapping)
+	}
+	if _, err := importMapping([]ImportColumn{{Column: "q", Field: "unknown"}}, fields, []string{"q"}); err == nil {
+		t.Error("want error for unknown field")
+	}
+	if _, err := importMapping([]ImportColumn{{Column: "missing", Field: "command"}}, fields, []string{"q"}); err == nil {
+		t.Error("want error for missing column")
+	}
+}
+
+func TestRunImportDryRun(t *testing.T) {
+	req := ImportTaskReq{
+		Format:  ImportFormatCSV,
+		Prefix:  "f",
+		File:    strings.NewReader("q,out1,out2\nhello,a,b\n,c,\nhi,,\n"),
+		Mapping: []ImportColumn{{"q", "command"}, {"out1", "output"}, {"out2", "output"}},
+		DryRun:  true,
+	}
+	var names []string
+	resp, err := runImport[string](context.Background(), nil, req, []string{"name", "command", "output"}, func(row int, values map[string][]string) (string, []ImportRowError) {
+		names = append(names, values["name"][0])
+		if firstValue(values["command"]) == "" {
+			return "", []ImportRowError{{Row: row, Field: "command", Message: "指令为空"}}
+		}
+		return values["command"][0], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 3 || resp.Valid != 2 || resp.Invalid != 1 || resp.Imported != 0 || resp.Errors[0].Row != 2 {
+		t.Errorf("resp %+v", resp)
+	}
+	if !reflect.DeepEqual(names, []string{"f-1", "f-2", "f-3"}) {
+		t.Errorf("names %v", names)
+	}
+}
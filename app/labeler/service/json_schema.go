@@ -0,0 +1,86 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// maxSchemaErrors 一个文档最多返回的校验错误数
+const maxSchemaErrors = 20
+
+// SchemaError 文档中一处不符合 JSON Schema 的位置，Path 为 JSON Pointer
+type SchemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaErrors 文档不符合 JSON Schema 时返回的错误
+type SchemaErrors []SchemaError
+
+func (e SchemaErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		path := v.Path
+		if path == "" {
+			path = "/"
+		}
+		msgs[i] = path + "：" + v.Message
+	}
+	return strings.Join(msgs, "；")
+}
+
+// compileJSONSchema 按 draft 2020-12 编译项目配置的 JSON Schema，不允许引用外部文档
+func compileJSONSchema(schema []byte) (*jsonschema.Schema, error) {
+	const url = "https://labeler.local/project6.schema.json"
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("不支持引用外部文档：%s", s)
+	}
+	if err := c.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("JSON Schema 不合法：%w", err)
+	}
+	s, err := c.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("JSON Schema 不合法：%w", err)
+	}
+	return s, nil
+}
+
+// validateJSON 校验 JSON 文档，不符合时返回 SchemaErrors，只保留最内层的错误
+func validateJSON(schema *jsonschema.Schema, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return SchemaErrors{{Message: "不是合法的 JSON：" + err.Error()}}
+	}
+	err := schema.Validate(v)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err
+	}
+	var errs SchemaErrors
+	var leaves func(*jsonschema.ValidationError)
+	leaves = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			if len(errs) < maxSchemaErrors {
+				errs = append(errs, SchemaError{Path: ve.InstanceLocation, Message: ve.Message})
+			}
+			return
+		}
+		for _, cause := range ve.Causes {
+			leaves(cause)
+		}
+	}
+	leaves(ve)
+	return errs
+}
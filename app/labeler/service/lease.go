@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+const (
+	// DefaultTaskLease 没有配置时 t5 领取的对话的租约时长
+	DefaultTaskLease     = 2 * time.Hour
+	leaseReclaimInterval = time.Minute
+)
+
+// leaseExpireTime 从 now 开始计算的租约到期时间
+func (t *TaskType) leaseExpireTime(now time.Time) util.Datetime {
+	lease := t.Lease
+	if lease <= 0 {
+		lease = DefaultTaskLease
+	}
+	return util.Datetime(now.Add(lease))
+}
+
+type RenewLeaseReq struct {
+	IDs    []primitive.ObjectID `json:"ids"`
+	UserID string               `json:"-"`
+}
+
+type RenewLeaseResp struct {
+	// Count 续约成功的任务数，不是自己的或者不在待标注的任务不续约
+	Count           int64         `json:"count"`
+	LeaseExpireTime util.Datetime `json:"leaseExpireTime"`
+}
+
+// RenewLease 标注员续约自己待标注的任务，前端在标注页面定时调用
+func (svc *LabelerService) RenewLease(ctx context.Context, taskType string, req RenewLeaseReq) (RenewLeaseResp, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return RenewLeaseResp{}, err
+	}
+	if len(req.IDs) == 0 {
+		return RenewLeaseResp{}, ErrNoDoc
+	}
+	count, expire, err := t.renewLease(ctx, req.IDs, req.UserID)
+	if err != nil {
+		return RenewLeaseResp{}, err
+	}
+	if count == 0 {
+		return RenewLeaseResp{}, ErrTaskNotFound
+	}
+	return RenewLeaseResp{Count: count, LeaseExpireTime: expire}, nil
+}
+
+// renewLease 续约 userID 待标注的任务，返回续约的任务数。只续约有租约的任务，批量分配的任务没有租约
+func (t *TaskType) renewLease(ctx context.Context, ids []primitive.ObjectID, userID string) (int64, util.Datetime, error) {
+	expire := t.leaseExpireTime(time.Now())
+	filter := bson.M{
+		"_id":                    bson.M{"$in": ids},
+		"status":                 model.TaskStatusLabeling,
+		"permissions.labeler.id": userID,
+		"leaseExpireTime":        bson.M{"$gt": time.Unix(0, 0)},
+	}
+	result, err := t.Tasks.UpdateMany(ctx, notDeleted(filter), bson.M{"$set": bson.M{"leaseExpireTime": expire}})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, expire, err
+	}
+	return result.MatchedCount, expire, nil
+}
+
+// RunLeaseReclaim 定期回收租约到期的任务，需要在单独的 goroutine 中运行
+func (svc *LabelerService) RunLeaseReclaim() {
+	for {
+		_ = log.WithTracer(context.Background(), PackageName, "Labeler Lease Reclaim", func(ctx context.Context) error {
+			for _, t := range svc.TaskTypes {
+				count, err := t.reclaimExpired(ctx, time.Now())
+				if err != nil {
+					log.Logger().WithContext(ctx).Error(t.Name, " reclaim: ", err.Error())
+					continue
+				}
+				if count > 0 {
+					log.Logger().WithContext(ctx).Infof("reclaim expired tasks:%s %d", t.Name, count)
+				}
+			}
+			return nil
+		})
+		time.Sleep(leaseReclaimInterval)
+	}
+}
+
+// reclaimExpired 回收租约到期的待标注任务。只有 t5 领取的对话有租约，领取时按标注员生成副本，
+// 回收时直接删除副本，普通对话归还扣减的优先级，可以被重新领取。没有租约的任务不回收
+func (t *TaskType) reclaimExpired(ctx context.Context, now time.Time) (int, error) {
+	filter := bson.M{
+		"status":          model.TaskStatusLabeling,
+		"leaseExpireTime": bson.M{"$gt": time.Unix(0, 0), "$lt": now},
+	}
+	cursor, err := t.Tasks.Find(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	var tasks []struct {
+		model.TaskMeta `bson:",inline"`
+		GoldSource     *primitive.ObjectID `bson:"goldSource"`
+		SessionID      string              `bson:"sessionId"`
+	}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+
+	count := 0
+	for _, task := range tasks {
+		copied := task.GoldSource != nil || t.Pool != nil
+		matched, err := t.reclaimTask(ctx, task.TaskMeta, copied, now)
+		if err != nil {
+			// 一个任务失败不影响其他任务的回收，下次检查时重试
+			log.Logger().WithContext(ctx).Error(t.Name, " reclaim ", task.ID.Hex(), ": ", err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		count++
+		if !copied {
+			record := t.newTransition(task.TaskMeta, model.TaskStatusAllocate)
+			record.Role = PermissionTypeSystem
+			record.Reason = "租约到期回收"
+			if task.Permissions.Labeler != nil {
+				record.Reason += "：" + task.Permissions.Labeler.ID
+			}
+			if err := t.recordTransitions(ctx, []model.TaskTransition{record}); err != nil {
+				log.Logger().WithContext(ctx).Error(t.Name, " reclaim ", task.ID.Hex(), ": ", err.Error())
+			}
+		}
+		if task.GoldSource == nil && t.Pool != nil && task.SessionID != "" {
+			pool := bson.M{"projectId": task.ProjectID, "dialog.0.sessionId": task.SessionID}
+			if _, err := t.Pool.UpdateOne(ctx, notDeleted(pool), bson.M{"$inc": bson.M{"dialog.$[].priority": 1}}); err != nil {
+				log.Logger().WithContext(ctx).Error("restore task priority: ", err.Error())
+			}
+		}
+	}
+	return count, nil
+}
+
+// reclaimTask 回收一个租约到期的任务，续约或提交与回收并发时以先完成的为准。
+// 副本连同动态等关联记录直接删除，不进入回收站，也不先重置，避免重置后和同一会话的其他副本冲突
+func (t *TaskType) reclaimTask(ctx context.Context, meta model.TaskMeta, copied bool, now time.Time) (bool, error) {
+	ft := bson.M{
+		"_id":             meta.ID,
+		"status":          model.TaskStatusLabeling,
+		"leaseExpireTime": bson.M{"$lt": now},
+	}
+	if copied {
+		result, err := t.Tasks.DeleteOne(ctx, notDeleted(ft))
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return false, err
+		}
+		if result.DeletedCount == 0 {
+			return false, nil
+		}
+		return true, t.purgeTaskData(ctx, []primitive.ObjectID{meta.ID})
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"permissions": model.Permissions{},
+			"status":      model.TaskStatusAllocate,
+			"updateTime":  util.Datetime(now),
+		},
+		"$unset": bson.M{
+			"allocatedTime":   "",
+			"leaseExpireTime": "",
+		},
+	}
+	matched, err := t.updateOne(ctx, ft, update, model.ActivityReclaim)
+	if errors.Is(err, ErrVersionConflict) {
+		// 任务正在被修改，下次检查时再回收
+		return false, nil
+	}
+	return matched, err
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+)
+
+const modelTimeout = 5 * time.Minute
+
+var ErrModelNotConfigured = errors.New("没有配置模型服务")
+
+// ModelClient 调用模型解析或预测标注结果
+type ModelClient interface {
+	// Parse 解析原始三元组，用于 t 类型任务
+	Parse(ctx context.Context, raw model.Tuple) ([]model.Tuple, error)
+	// Predict 预测一批任务的标注结果，返回的 Predictions 与 Tasks 一一对应
+	Predict(ctx context.Context, req PredictReq) (PredictResp, error)
+}
+
+type PredictReq struct {
+	TaskType string `json:"taskType"`
+	// Schema 项目的标注配置，模型只能在其中的选项里选择
+	Schema any           `json:"schema"`
+	Tasks  []PredictTask `json:"tasks"`
+}
+
+type PredictTask struct {
+	ID primitive.ObjectID `json:"id"`
+	// Input 任务的内容，和接口返回的任务格式相同
+	Input any `json:"input"`
+}
+
+type PredictResp struct {
+	ModelVersion string       `json:"modelVersion"`
+	Predictions  []Prediction `json:"predictions"`
+}
+
+// Prediction 一个任务的预测结果，没有预测的字段保持原样
+type Prediction struct {
+	// Labels 任务的标签，t2 为 labels，t3 为指令的 judgment：名称 -> 值
+	Labels map[string]string `json:"labels,omitempty"`
+	// Outputs 每个输出的预测结果，按下标和任务的输出对应
+	Outputs []OutputPrediction `json:"outputs,omitempty"`
+}
+
+type OutputPrediction struct {
+	// Judgment 输出的判断：名称 -> 值
+	Judgment map[string]string `json:"judgment,omitempty"`
+	// Scores 评分组名称 -> 评分项名称 -> 分数
+	Scores map[string]map[string]int64 `json:"scores,omitempty"`
+}
+
+// newModelClient 配置了模型服务地址时通过 HTTP 调用；stub 为 true 时使用本地的模拟模型，只用于开发调试；
+// 都没有配置时返回 nil，不能解析和预标注
+func newModelClient(serverURL string, stub bool) ModelClient {
+	switch {
+	case serverURL != "":
+		return NewHTTPModelClient(serverURL)
+	case stub:
+		return StubModelClient{}
+	}
+	return nil
+}
+
+// HTTPModelClient 通过 HTTP 调用模型服务，接口返回 {code, error_msg, data}
+type HTTPModelClient struct {
+	ParseURL   string
+	PredictURL string
+	Client     *http.Client
+}
+
+// NewHTTPModelClient 解析和预测接口分别为 baseURL 下的 /parse 和 /predict
+func NewHTTPModelClient(baseURL string) *HTTPModelClient {
+	base := strings.TrimRight(baseURL, "/")
+	return &HTTPModelClient{
+		ParseURL:   base + "/parse",
+		PredictURL: base + "/predict",
+		Client:     &http.Client{Timeout: modelTimeout},
+	}
+}
+
+func (c *HTTPModelClient) Parse(ctx context.Context, raw model.Tuple) ([]model.Tuple, error) {
+	var data struct {
+		Results []model.Tuple `json:"results"`
+	}
+	body := struct {
+		Raw model.Tuple `json:"raw"`
+	}{Raw: raw}
+	if err := c.post(ctx, c.ParseURL, body, &data); err != nil {
+		return nil, fmt.Errorf("解析出错: %w", err)
+	}
+	if len(data.Results) == 0 {
+		return nil, errors.New("解析失败")
+	}
+	return data.Results, nil
+}
+
+func (c *HTTPModelClient) Predict(ctx context.Context, req PredictReq) (PredictResp, error) {
+	var resp PredictResp
+	if err := c.post(ctx, c.PredictURL, req, &resp); err != nil {
+		return PredictResp{}, fmt.Errorf("模型预测出错: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *HTTPModelClient) post(ctx context.Context, url string, body any, data any) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(buf))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json;charset=utf-8")
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: modelTimeout}
+	}
+	resp, err := client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("模型服务返回 %s", resp.Status)
+	}
+
+	var respBody struct {
+		Code int             `json:"code"`
+		Msg  string          `json:"error_msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+		return err
+	}
+	if respBody.Msg != "" {
+		return errors.New(respBody.Msg)
+	}
+	if len(respBody.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody.Data, data)
+}
+
+const (
+	stubModelVersion = "stub"
+	stubJudgment     = "是"
+)
+
+// StubModelClient 本地的模拟模型，配置 modelstub 后用于开发调试，不能用于正式数据：
+// 解析原样返回，标签选择第一个选项，判断都为"是"，分数都为满分
+type StubModelClient struct{}
+
+func (StubModelClient) Parse(_ context.Context, raw model.Tuple) ([]model.Tuple, error) {
+	return []model.Tuple{raw}, nil
+}
+
+func (StubModelClient) Predict(_ context.Context, req PredictReq) (PredictResp, error) {
+	resp := PredictResp{
+		ModelVersion: stubModelVersion,
+		Predictions:  make([]Prediction, len(req.Tasks)),
+	}
+	for i, task := range req.Tasks {
+		var p Prediction
+		switch schema := req.Schema.(type) {
+		case model.Schema2:
+			p.Labels = make(map[string]string, len(schema.Labels))
+			for _, l := range schema.Labels {
+				if len(l.Values) > 0 {
+					p.Labels[l.Name] = l.Values[0]
+				}
+			}
+		case model.Schema3:
+			p.Labels = stubJudgments(schema.CommandJudgment)
+			if t, ok := task.Input.(model.Task3); ok {
+				p.Outputs = make([]OutputPrediction, len(t.Output))
+				for j := range p.Outputs {
+					p.Outputs[j].Judgment = stubJudgments(schema.OutputJudgment)
+				}
+			}
+		case model.Schema4:
+			if t, ok := task.Input.(model.Task4); ok {
+				p.Outputs = make([]OutputPrediction, len(t.Output))
+				for j := range p.Outputs {
+					p.Outputs[j].Scores = make(map[string]map[string]int64, len(schema.ScoreGroups))
+					for _, g := range schema.ScoreGroups {
+						scores := make(map[string]int64, len(g.Scores))
+						for _, s := range g.Scores {
+							scores[s] = g.Max
+						}
+						p.Outputs[j].Scores[g.Name] = scores
+					}
+				}
+			}
+		default:
+			return PredictResp{}, fmt.Errorf("模拟模型不支持该任务类型：%s", req.TaskType)
+		}
+		resp.Predictions[i] = p
+	}
+	return resp, nil
+}
+
+func stubJudgments(names []string) map[string]string {
+	res := make(map[string]string, len(names))
+	for _, name := range names {
+		res[name] = stubJudgment
+	}
+	return res
+}
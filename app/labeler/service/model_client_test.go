@@ -0,0 +1,15 @@
+package service
+
+import "testing"
+
+func TestNewModelClient(t *testing.T) {
+	if c := newModelClient("", false); c != nil {
+		t.Errorf("want nil without model server, got %T", c)
+	}
+	if _, ok := newModelClient("", true).(StubModelClient); !ok {
+		t.Error("want stub when modelstub is set")
+	}
+	if _, ok := newModelClient("http://model", true).(*HTTPModelClient); !ok {
+		t.Error("model server should take precedence over stub")
+	}
+}
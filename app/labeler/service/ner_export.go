@@ -0,0 +1,391 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+)
+
+// NER 标注的导出格式
+const (
+	NERFormatCoNLL       = "conll"
+	NERFormatDoccano     = "doccano"
+	NERFormatLabelStudio = "labelstudio"
+)
+
+// maxNERErrors 错误报告中最多保留的片段数
+const maxNERErrors = 10000
+
+var nerFileNames = map[string]string{
+	NERFormatCoNLL:       "train.conll",
+	NERFormatDoccano:     "doccano.jsonl",
+	NERFormatLabelStudio: "label_studio.json",
+}
+
+type DownloadTaskNERReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Status    []string           `json:"status"`
+	Format    string             `json:"format"`
+}
+
+type DownloadTaskNERResp = model.ExportJob
+
+// nerSpan 校验通过的标注片段，Start、End 为文档中字符（rune）的下标，左闭右开，Label 为分组类型
+type nerSpan struct {
+	ID    string
+	Start int
+	End   int
+	Label string
+	Text  string
+}
+
+// NERSpanError 没有导出的片段和原因
+type NERSpanError struct {
+	TaskID     primitive.ObjectID `json:"taskId"`
+	TaskName   string             `json:"taskName"`
+	SentenceID string             `json:"sentenceId,omitempty"`
+	Label      string             `json:"label,omitempty"`
+	Left       int                `json:"left"`
+	Right      int                `json:"right"`
+	Text       string             `json:"text,omitempty"`
+	Message    string             `json:"message"`
+}
+
+// DownloadTaskNER 创建后台导出，把实体标注导出为 CoNLL(BIO)、doccano 或 Label Studio 格式，
+// 偏移量和文档对不上的片段不导出，记录在 zip 中的 errors.jsonl
+func (svc *LabelerService) DownloadTaskNER(ctx context.Context, req DownloadTaskNERReq) (DownloadTaskNERResp, error) {
+	return svc.CreateExport(ctx, ExportTypeTaskNER, req)
+}
+
+func (svc *LabelerService) exportTaskNER(ctx context.Context, req DownloadTaskNERReq) (ExportPlan, error) {
+	fileName, ok := nerFileNames[req.Format]
+	if !ok {
+		return ExportPlan{}, fmt.Errorf("不支持的导出格式：%s", req.Format)
+	}
+	filter := notGold(bson.M{
+		"projectId": req.ProjectID,
+		"status": bson.M{
+			"$in": req.Status,
+		},
+	})
+	total, err := svc.CollectionTask.CountDocuments(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return ExportPlan{}, err
+	}
+	return ExportPlan{
+		FileName: time.Now().Format("2006-01-02 15-04-05") + "实体标注-" + req.Format + ".zip",
+		Total:    total,
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			cursor, err := svc.CollectionTask.Find(ctx, notDeleted(filter))
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			defer func() {
+				_ = cursor.Close(ctx)
+			}()
+			zipWriter := zip.NewWriter(w)
+			f, err := zipWriter.Create(fileName)
+			if err != nil {
+				return err
+			}
+			out := bufio.NewWriter(f)
+			var report []NERSpanError
+			addErrors := func(errs []NERSpanError) {
+				for _, e := range errs {
+					if len(report) < maxNERErrors {
+						report = append(report, e)
+					}
+				}
+			}
+			if req.Format == NERFormatLabelStudio {
+				_, _ = out.WriteString("[")
+			}
+			for n := 0; cursor.Next(ctx); n++ {
+				var task model.Task
+				if err := cursor.Decode(&task); err != nil {
+					log.Logger().WithContext(ctx).Error(err.Error())
+					return err
+				}
+				doc := []rune(task.Document)
+				spans, errs := taskSpans(task, doc)
+				addErrors(errs)
+				switch req.Format {
+				case NERFormatCoNLL:
+					tags, errs := bioTags(task, doc, spans)
+					addErrors(errs)
+					err = writeCoNLL(out, doc, tags)
+				case NERFormatDoccano:
+					err = writeJSONLine(out, doccanoTask(task, spans))
+				case NERFormatLabelStudio:
+					if n > 0 {
+						_, _ = out.WriteString(",\n")
+					}
+					err = json.NewEncoder(out).Encode(labelStudioTask(task, doc, spans))
+				}
+				if err != nil {
+					return err
+				}
+				progress()
+			}
+			if err := cursor.Err(); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			if req.Format == NERFormatLabelStudio {
+				_, _ = out.WriteString("]\n")
+			}
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			if len(report) > 0 {
+				f, err := zipWriter.Create("errors.jsonl")
+				if err != nil {
+					return err
+				}
+				out := bufio.NewWriter(f)
+				for _, e := range report {
+					if err := writeJSONLine(out, e); err != nil {
+						return err
+					}
+				}
+				if err := out.Flush(); err != nil {
+					return err
+				}
+			}
+			return zipWriter.Close()
+		},
+	}, nil
+}
+
+// nerTuple 内容的标注结果取 Results 中最后一个没有删除的，没有标注结果时取 Raw
+func nerTuple(content model.Content) model.Tuple {
+	for i := len(content.Results) - 1; i >= 0; i-- {
+		if !content.Results[i].Del {
+			return content.Results[i]
+		}
+	}
+	return content.Raw
+}
+
+// taskSpans 收集任务中没有删除的片段，按文档校验偏移量：下标在文档范围内且与片段文本一致，
+// 同一位置、同一类型的片段只保留一个，结果按起始位置排序
+func taskSpans(task model.Task, doc []rune) ([]nerSpan, []NERSpanError) {
+	var spans []nerSpan
+	var errs []NERSpanError
+	if len(doc) == 0 {
+		return nil, []NERSpanError{{TaskID: task.ID, TaskName: task.Name, Message: "文档为空"}}
+	}
+	seen := make(map[nerSpan]bool)
+	for _, content := range task.Contents {
+		if content.Del {
+			continue
+		}
+		for _, group := range nerTuple(content).Groups {
+			if group.Del {
+				continue
+			}
+			for _, entity := range group.Entities {
+				if entity.Del {
+					continue
+				}
+				for _, s := range entity.Sentences {
+					if s.Del {
+						continue
+					}
+					if msg := checkSpan(doc, s); msg != "" {
+						errs = append(errs, NERSpanError{
+							TaskID:     task.ID,
+							TaskName:   task.Name,
+							SentenceID: s.ID,
+							Label:      group.Type,
+							Left:       s.Span.Left,
+							Right:      s.Span.Right,
+							Text:       s.Text,
+							Message:    msg,
+						})
+						continue
+					}
+					span := nerSpan{Start: s.Span.Left, End: s.Span.Right, Label: group.Type, Text: string(doc[s.Span.Left:s.Span.Right])}
+					if seen[span] {
+						continue
+					}
+					seen[span] = true
+					span.ID = s.ID
+					spans = append(spans, span)
+				}
+			}
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	return spans, errs
+}
+
+func checkSpan(doc []rune, s model.Sentence) string {
+	if s.Span.Left < 0 || s.Span.Right > len(doc) || s.Span.Left >= s.Span.Right {
+		return fmt.Sprintf("偏移量 [%d, %d) 超出文档范围 %d", s.Span.Left, s.Span.Right, len(doc))
+	}
+	if s.Text != "" && string(doc[s.Span.Left:s.Span.Right]) != s.Text {
+		return fmt.Sprintf("偏移量对应的文本为 %q，与片段文本不一致", string(doc[s.Span.Left:s.Span.Right]))
+	}
+	return ""
+}
+
+// bioTags 按字符生成 BIO 标签，BIO 不能表示重叠的片段，重叠时保留先出现且较长的片段
+func bioTags(task model.Task, doc []rune, spans []nerSpan) ([]string, []NERSpanError) {
+	tags := make([]string, len(doc))
+	for i := range tags {
+		tags[i] = "O"
+	}
+	var errs []NERSpanError
+	for _, span := range spans {
+		free := true
+		for i := span.Start; i < span.End; i++ {
+			if tags[i] != "O" {
+				free = false
+				break
+			}
+		}
+		if !free {
+			errs = append(errs, NERSpanError{
+				TaskID:     task.ID,
+				TaskName:   task.Name,
+				SentenceID: span.ID,
+				Label:      span.Label,
+				Left:       span.Start,
+				Right:      span.End,
+				Text:       span.Text,
+				Message:    "与其他片段重叠，CoNLL 格式中不导出",
+			})
+			continue
+		}
+		tags[span.Start] = "B-" + span.Label
+		for i := span.Start + 1; i < span.End; i++ {
+			tags[i] = "I-" + span.Label
+		}
+	}
+	return tags, errs
+}
+
+// writeCoNLL 每行一个字符和标签，空白字符不输出，换行处和文档之间用空行分隔；
+// 片段的第一个字符被跳过或跨行时，输出的第一个 I- 改为 B-
+func writeCoNLL(w *bufio.Writer, doc []rune, tags []string) error {
+	prev := ""
+	for i, r := range doc {
+		if r == '\n' {
+			if prev != "" {
+				_, _ = w.WriteString("\n")
+				prev = ""
+			}
+			continue
+		}
+		if unicode.IsSpace(r) {
+			continue
+		}
+		tag := tags[i]
+		if strings.HasPrefix(tag, "I-") && prev != tag && prev != "B-"+tag[2:] {
+			tag = "B-" + tag[2:]
+		}
+		_, _ = w.WriteString(string(r) + " " + tag + "\n")
+		prev = tag
+	}
+	if prev != "" {
+		_, _ = w.WriteString("\n")
+	}
+	return nil
+}
+
+func writeJSONLine(w *bufio.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, _ = w.Write(data)
+	return w.WriteByte('\n')
+}
+
+// doccanoTask doccano 序列标注的 JSONL，label 为 [起始, 结束, 类型]，偏移量按字符计算
+func doccanoTask(task model.Task, spans []nerSpan) any {
+	labels := make([][]any, len(spans))
+	for i, s := range spans {
+		labels[i] = []any{s.Start, s.End, s.Label}
+	}
+	return map[string]any{
+		"id":    task.ID.Hex(),
+		"name":  task.Name,
+		"text":  task.Document,
+		"label": labels,
+	}
+}
+
+type labelStudioResult struct {
+	ID       string           `json:"id"`
+	FromName string           `json:"from_name"`
+	ToName   string           `json:"to_name"`
+	Type     string           `json:"type"`
+	Value    labelStudioValue `json:"value"`
+}
+
+type labelStudioValue struct {
+	Start  int      `json:"start"`
+	End    int      `json:"end"`
+	Text   string   `json:"text"`
+	Labels []string `json:"labels"`
+}
+
+// labelStudioTask Label Studio 的任务，偏移量按 JavaScript 字符串的 UTF-16 下标计算
+func labelStudioTask(task model.Task, doc []rune, spans []nerSpan) any {
+	offsets := utf16Offsets(doc)
+	results := make([]labelStudioResult, len(spans))
+	for i, s := range spans {
+		results[i] = labelStudioResult{
+			ID:       s.ID,
+			FromName: "label",
+			ToName:   "text",
+			Type:     "labels",
+			Value: labelStudioValue{
+				Start:  offsets[s.Start],
+				End:    offsets[s.End],
+				Text:   s.Text,
+				Labels: []string{s.Label},
+			},
+		}
+	}
+	return map[string]any{
+		"id":          task.ID.Hex(),
+		"data":        map[string]string{"text": task.Document, "name": task.Name},
+		"annotations": []any{map[string]any{"result": results}},
+	}
+}
+
+// utf16Offsets 第 i 个字符在 UTF-16 编码中的下标，长度为字符数加一
+func utf16Offsets(doc []rune) []int {
+	offsets := make([]int, len(doc)+1)
+	for i, r := range doc {
+		n := 1
+		if r > 0xFFFF {
+			n = 2
+		}
+		offsets[i+1] = offsets[i] + n
+	}
+	return offsets
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-admin/app/labeler/model"
+)
+
+func nerTestTask(doc string, sentences ...model.Sentence) model.Task {
+	return model.Task{
+		Name:     "t1",
+		Document: doc,
+		Contents: []model.Content{{
+			Results: []model.Tuple{{Groups: []model.Group{{
+				Type:     "LOC",
+				Entities: []model.Entity{{Sentences: sentences}},
+			}}}},
+		}},
+	}
+}
+
+func TestTaskSpans(t *testing.T) {
+	task := nerTestTask("我在北京 天安门",
+		model.Sentence{ID: "a", Text: "北京 天安门", Span: model.Span{Left: 2, Right: 8}},
+		model.Sentence{ID: "b", Text: "天安门", Span: model.Span{Left: 5, Right: 8}},
+		model.Sentence{ID: "c", Text: "上海", Span: model.Span{Left: 2, Right: 4}},
+		model.Sentence{ID: "d", Text: "门", Span: model.Span{Left: 7, Right: 9}},
+	)
+	doc := []rune(task.Document)
+	spans, errs := taskSpans(task, doc)
+	if len(spans) != 2 || spans[0].ID != "a" || len(errs) != 2 {
+		t.Fatalf("spans %+v errs %+v", spans, errs)
+	}
+
+	tags, errs := bioTags(task, doc, spans)
+	if len(errs) != 1 || errs[0].SentenceID != "b" {
+		t.Errorf("overlap errs %+v", errs)
+	}
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	_ = writeCoNLL(w, doc, tags)
+	_ = w.Flush()
+	want := "我 O\n在 O\n北 B-LOC\n京 I-LOC\n天 I-LOC\n安 I-LOC\n门 I-LOC\n\n"
+	if sb.String() != want {
+		t.Errorf("want %q got %q", want, sb.String())
+	}
+}
+
+func TestWriteCoNLLSkippedBegin(t *testing.T) {
+	doc := []rune(" 北京\n上海")
+	tags := []string{"B-LOC", "I-LOC", "I-LOC", "O", "I-LOC", "I-LOC"}
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	_ = writeCoNLL(w, doc, tags)
+	_ = w.Flush()
+	want := "北 B-LOC\n京 I-LOC\n\n上 B-LOC\n海 I-LOC\n\n"
+	if sb.String() != want {
+		t.Errorf("want %q got %q", want, sb.String())
+	}
+}
+
+func TestUTF16Offsets(t *testing.T) {
+	got := utf16Offsets([]rune("a😀b"))
+	if want := []int{0, 1, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
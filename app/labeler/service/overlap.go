@@ -0,0 +1,1021 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+// maxOverlap 每个任务最多由几个标注员独立标注
+const maxOverlap = 10
+
+var ErrSubmissionNotFound = errors.New("标注不存在")
+
+func checkOverlap(overlap int) error {
+	if overlap < 0 || overlap > maxOverlap {
+		return fmt.Errorf("每个任务的标注人数必须在0到%d之间", maxOverlap)
+	}
+	return nil
+}
+
+// projectOverlap 项目中每个任务由几个标注员独立标注，没有开启多人标注时为 0 或 1
+func (t *TaskType) projectOverlap(ctx context.Context, projectID primitive.ObjectID) (int, error) {
+	var project struct {
+		Overlap int `bson:"overlap"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"overlap": 1})
+	if err := t.Projects.FindOne(ctx, notDeleted(bson.M{"_id": projectID}), opts).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrProjectNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	return project.Overlap, nil
+}
+
+// rating 标注结果中参与一致性统计的一项
+type rating struct {
+	// Label 标注项名称，如标签名称、输出的判断名称
+	Label string
+	// Unit 任务中被标注的对象，任务本身为空，输出为 #下标
+	Unit    string
+	Value   string
+	Score   float64
+	Numeric bool
+}
+
+// overlapSpec 任务类型在多人标注中由标注员填写的部分
+type overlapSpec[T any] struct {
+	// answer 取出任务中的标注结果，不包含任务内容
+	answer func(T) bson.M
+	// merge 裁决时写回任务的字段
+	merge func(task, answer T) bson.M
+	// ratings 标注结果中参与一致性统计的标注项
+	ratings func(answer T) []rating
+}
+
+// overlapper 一种任务类型的多人标注，请求和返回中的任务为该类型的任务
+type overlapper interface {
+	allocate(ctx context.Context, req BatchAllocReq) (int64, error)
+	search(ctx context.Context, req SearchSubmissionsReq) ([]SubmissionResp, int, error)
+	get(ctx context.Context, id primitive.ObjectID) (SubmissionResp, error)
+	save(ctx context.Context, req SaveSubmissionReq) (SubmissionResp, error)
+	agreement(ctx context.Context, projectID primitive.ObjectID) (AgreementReport, error)
+	adjudications(ctx context.Context, req SearchAdjudicationsReq) ([]AdjudicationResp, int, error)
+	adjudicate(ctx context.Context, req AdjudicateReq) error
+}
+
+func (svc *LabelerService) registerOverlaps() {
+	svc.Overlaps = map[string]overlapper{
+		"t2": &overlapStore[model.Task2]{svc: svc, store: svc.StoreTask2, spec: task2Overlap},
+		"t3": &overlapStore[model.Task3]{svc: svc, store: svc.StoreTask3, spec: task3Overlap},
+		"t4": &overlapStore[model.Task4]{svc: svc, store: svc.StoreTask4, spec: task4Overlap},
+	}
+}
+
+func (svc *LabelerService) overlap(taskType string) (overlapper, error) {
+	o, ok := svc.Overlaps[taskType]
+	if !ok {
+		return nil, fmt.Errorf("该任务类型不支持多人标注：%s", taskType)
+	}
+	return o, nil
+}
+
+type overlapStore[T any] struct {
+	svc   *LabelerService
+	store *TaskStore[T]
+	spec  overlapSpec[T]
+}
+
+type SubmissionResp struct {
+	model.Submission
+	// Answer 标注结果，格式和任务相同
+	Answer any `json:"answer"`
+	// Task 标注的任务，查询单个标注时返回
+	Task any `json:"task,omitempty"`
+}
+
+func (s *overlapStore[T]) decodeAnswer(submission model.Submission) (T, error) {
+	var answer T
+	if len(submission.Answer) == 0 {
+		return answer, nil
+	}
+	err := bson.Unmarshal(submission.Answer, &answer)
+	return answer, err
+}
+
+func (s *overlapStore[T]) newSubmissionResps(ctx context.Context, submissions []model.Submission) ([]SubmissionResp, error) {
+	userMap := s.svc.userNickNames(ctx, util.Map(submissions, func(v model.Submission) string { return v.Labeler.ID }))
+	res := make([]SubmissionResp, len(submissions))
+	for i, v := range submissions {
+		answer, err := s.decodeAnswer(v)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return nil, err
+		}
+		v.Labeler.NickName = userMap[v.Labeler.ID]
+		res[i] = SubmissionResp{Submission: v, Answer: answer}
+	}
+	return res, nil
+}
+
+// allocate 给项目中未分配的任务分配标注员，每个任务分给还没有标注过的人直到满足项目的标注人数，
+// Number 为本次分配的任务数
+func (s *overlapStore[T]) allocate(ctx context.Context, req BatchAllocReq) (int64, error) {
+	if len(req.Persons) == 0 {
+		return 0, errors.New("分配人员数量不能为0")
+	}
+	overlap, err := s.store.projectOverlap(ctx, req.ProjectID)
+	if err != nil {
+		return 0, err
+	}
+	if overlap < 2 {
+		return 0, errors.New("项目没有开启多人标注")
+	}
+	filter := bson.M{
+		"projectId":    req.ProjectID,
+		"status":       model.TaskStatusAllocate,
+		"adjudication": bson.M{"$exists": false},
+	}
+	cursor, err := s.store.Tasks.Find(ctx, notDeleted(filter), options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var total int64
+	next := 0
+	now := util.Datetime(time.Now())
+	for total < req.Number && cursor.Next(ctx) {
+		var task T
+		var meta model.TaskMeta
+		if err := cursor.Decode(&task); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		if err := cursor.Decode(&meta); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		labelers, err := s.svc.CollectionSubmission.Distinct(ctx, "labeler.id", notDeleted(bson.M{"taskId": meta.ID}))
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		existed := make(map[string]bool, len(labelers))
+		for _, v := range labelers {
+			if id, ok := v.(string); ok {
+				existed[id] = true
+			}
+		}
+		need := overlap - len(existed)
+		if need <= 0 {
+			continue
+		}
+		answer, err := bson.Marshal(s.spec.answer(task))
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		// 每个任务从下一个标注员开始选，使各标注员分到的任务数接近
+		var docs []interface{}
+		for i := 0; i < len(req.Persons) && len(docs) < need; i++ {
+			id := req.Persons[(next+i)%len(req.Persons)]
+			if existed[id] {
+				continue
+			}
+			existed[id] = true
+			docs = append(docs, model.Submission{
+				ID:         primitive.NewObjectID(),
+				TaskType:   s.store.Name,
+				ProjectID:  meta.ProjectID,
+				TaskID:     meta.ID,
+				Labeler:    model.Person{ID: id},
+				Status:     model.TaskStatusLabeling,
+				Answer:     answer,
+				CreateTime: now,
+				UpdateTime: now,
+			})
+		}
+		next = (next + 1) % len(req.Persons)
+		if len(docs) == 0 {
+			continue
+		}
+		// 同时分配时由唯一索引保证同一个人不会重复标注一个任务
+		if _, err := s.svc.CollectionSubmission.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		total++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return total, err
+	}
+	return total, nil
+}
+
+type SearchSubmissionsReq struct {
+	ProjectID string `form:"projectId"`
+	TaskID    string `form:"taskId"`
+	Status    string `form:"status"`
+	dto.Pagination
+}
+
+// search 查询多人标注的标注，标注员只能查看自己的
+func (s *overlapStore[T]) search(ctx context.Context, req SearchSubmissionsReq) ([]SubmissionResp, int, error) {
+	filter := bson.M{"taskType": s.store.Name}
+	if userID, admin := operator(ctx); !admin {
+		filter["labeler.id"] = userID
+	}
+	for key, hex := range map[string]string{"projectId": req.ProjectID, "taskId": req.TaskID} {
+		if hex == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter[key] = id
+	}
+	if req.Status != "" {
+		filter["status"] = req.Status
+	}
+	count, err := s.svc.CollectionSubmission.CountDocuments(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	opts := pageOptions(req.Pagination).SetSort(bson.D{{Key: "_id", Value: -1}})
+	cursor, err := s.svc.CollectionSubmission.Find(ctx, notDeleted(filter), opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	var submissions []model.Submission
+	if err := cursor.All(ctx, &submissions); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	res, err := s.newSubmissionResps(ctx, submissions)
+	return res, int(count), err
+}
+
+// findSubmission 查询一个标注，标注员只能查看自己的
+func (s *overlapStore[T]) findSubmission(ctx context.Context, id primitive.ObjectID) (model.Submission, error) {
+	filter := bson.M{"_id": id, "taskType": s.store.Name}
+	if userID, admin := operator(ctx); !admin {
+		filter["labeler.id"] = userID
+	}
+	var submission model.Submission
+	if err := s.svc.CollectionSubmission.FindOne(ctx, notDeleted(filter)).Decode(&submission); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return submission, ErrSubmissionNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return submission, err
+	}
+	return submission, nil
+}
+
+// get 查询一个标注和标注的任务
+func (s *overlapStore[T]) get(ctx context.Context, id primitive.ObjectID) (SubmissionResp, error) {
+	submission, err := s.findSubmission(ctx, id)
+	if err != nil {
+		return SubmissionResp{}, err
+	}
+	task, err := s.store.Get(ctx, submission.TaskID)
+	if err != nil {
+		return SubmissionResp{}, err
+	}
+	res, err := s.newSubmissionResps(ctx, []model.Submission{submission})
+	if err != nil {
+		return SubmissionResp{}, err
+	}
+	res[0].Task = task
+	return res[0], nil
+}
+
+type SaveSubmissionReq struct {
+	ID primitive.ObjectID `json:"id"`
+	// Answer 标注结果，格式和任务相同，只保存标注员填写的部分
+	Answer json.RawMessage `json:"answer"`
+	// Submit 为 true 时提交，提交后不能再修改
+	Submit bool `json:"submit"`
+}
+
+// save 标注员保存或提交自己的标注
+func (s *overlapStore[T]) save(ctx context.Context, req SaveSubmissionReq) (SubmissionResp, error) {
+	var task T
+	if err := json.Unmarshal(req.Answer, &task); err != nil {
+		return SubmissionResp{}, fmt.Errorf("标注结果格式不正确：%w", err)
+	}
+	answer, err := bson.Marshal(s.spec.answer(task))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return SubmissionResp{}, err
+	}
+	userID, _ := operator(ctx)
+	now := util.Datetime(time.Now())
+	set := bson.M{
+		"answer":     answer,
+		"updateTime": now,
+	}
+	if req.Submit {
+		set["status"] = model.TaskStatusSubmit
+		set["submitTime"] = now
+	}
+	filter := bson.M{
+		"_id":        req.ID,
+		"taskType":   s.store.Name,
+		"labeler.id": userID,
+		"status":     model.TaskStatusLabeling,
+	}
+	result, err := s.svc.CollectionSubmission.UpdateOne(ctx, notDeleted(filter), bson.M{"$set": set})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return SubmissionResp{}, err
+	}
+	if result.MatchedCount == 0 {
+		return SubmissionResp{}, errors.New("标注不存在或已提交")
+	}
+	return s.get(ctx, req.ID)
+}
+
+type AgreementReport struct {
+	Overlap int `json:"overlap"`
+	// Tasks 至少两人提交了标注的任务数，Submissions 已提交的标注数
+	Tasks       int              `json:"tasks"`
+	Submissions int              `json:"submissions"`
+	Project     ProjectAgreement `json:"project"`
+	Labels      []LabelAgreement `json:"labels"`
+	Pairs       []PairAgreement  `json:"pairs"`
+}
+
+// ProjectAgreement 项目整体的一致性：Kappa 为所有分类标注项合并计算的 Fleiss' kappa，
+// Alpha 为分数标注项按标注对象数加权平均的 Krippendorff's alpha
+type ProjectAgreement struct {
+	Kappa *float64 `json:"kappa"`
+	Alpha *float64 `json:"alpha"`
+}
+
+// LabelAgreement 一个标注项的一致性：分类标注为 Fleiss' kappa 和 nominal alpha，分数和排序为 interval alpha
+type LabelAgreement struct {
+	Label   string `json:"label"`
+	Numeric bool   `json:"numeric"`
+	// Units 至少两人标注的对象数
+	Units int      `json:"units"`
+	Kappa *float64 `json:"kappa"`
+	Alpha *float64 `json:"alpha"`
+}
+
+// PairAgreement 两个标注员的一致性：分类标注为 Cohen's kappa，分数和排序为各标注项 Spearman 系数按对象数的加权平均
+type PairAgreement struct {
+	Labelers []model.Person `json:"labelers"`
+	// Units 两人都标注的对象数
+	Units    int      `json:"units"`
+	Kappa    *float64 `json:"kappa"`
+	Spearman *float64 `json:"spearman"`
+}
+
+// agreement 按已提交的标注统计项目的标注一致性
+func (s *overlapStore[T]) agreement(ctx context.Context, projectID primitive.ObjectID) (AgreementReport, error) {
+	overlap, err := s.store.projectOverlap(ctx, projectID)
+	if err != nil {
+		return AgreementReport{}, err
+	}
+	filter := bson.M{
+		"taskType":  s.store.Name,
+		"projectId": projectID,
+		"status":    model.TaskStatusSubmit,
+	}
+	cursor, err := s.svc.CollectionSubmission.Find(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return AgreementReport{}, err
+	}
+	defer cursor.Close(ctx)
+
+	report := AgreementReport{Overlap: overlap}
+	// 标注项 -> 标注对象 -> 标注员 -> 标注
+	labels := make(map[string]map[string]map[string]rating)
+	taskLabelers := make(map[primitive.ObjectID]int)
+	for cursor.Next(ctx) {
+		var submission model.Submission
+		if err := cursor.Decode(&submission); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return AgreementReport{}, err
+		}
+		answer, err := s.decodeAnswer(submission)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return AgreementReport{}, err
+		}
+		report.Submissions++
+		taskLabelers[submission.TaskID]++
+		for _, r := range s.spec.ratings(answer) {
+			units, ok := labels[r.Label]
+			if !ok {
+				units = make(map[string]map[string]rating)
+				labels[r.Label] = units
+			}
+			unit := submission.TaskID.Hex() + r.Unit
+			if units[unit] == nil {
+				units[unit] = make(map[string]rating)
+			}
+			units[unit][submission.Labeler.ID] = r
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return AgreementReport{}, err
+	}
+	for _, n := range taskLabelers {
+		if n >= 2 {
+			report.Tasks++
+		}
+	}
+	report.Labels, report.Project = labelAgreements(labels)
+	report.Pairs = pairAgreements(labels)
+	userMap := s.svc.userNickNames(ctx, labelerIDs(labels))
+	for i := range report.Pairs {
+		for j := range report.Pairs[i].Labelers {
+			report.Pairs[i].Labelers[j].NickName = userMap[report.Pairs[i].Labelers[j].ID]
+		}
+	}
+	return report, nil
+}
+
+func labelerIDs(labels map[string]map[string]map[string]rating) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, units := range labels {
+		for _, ratings := range units {
+			for id := range ratings {
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func labelAgreements(labels map[string]map[string]map[string]rating) ([]LabelAgreement, ProjectAgreement) {
+	res := make([]LabelAgreement, 0, len(labels))
+	var pooled []map[string]int
+	var alphaSum, alphaUnits float64
+	for label, units := range labels {
+		item := LabelAgreement{Label: label}
+		var counts []map[string]int
+		var values [][]string
+		var scores [][]float64
+		for _, ratings := range units {
+			if len(ratings) >= 2 {
+				item.Units++
+			}
+			count := make(map[string]int)
+			var unitValues []string
+			var unitScores []float64
+			for _, r := range ratings {
+				item.Numeric = r.Numeric
+				count[r.Value]++
+				unitValues = append(unitValues, r.Value)
+				unitScores = append(unitScores, r.Score)
+			}
+			counts = append(counts, count)
+			values = append(values, unitValues)
+			scores = append(scores, unitScores)
+			pooledCount := make(map[string]int, len(count))
+			for v, c := range count {
+				pooledCount[label+"\x00"+v] = c
+			}
+			if !item.Numeric {
+				pooled = append(pooled, pooledCount)
+			}
+		}
+		if item.Numeric {
+			item.Alpha = alphaInterval(scores)
+			if item.Alpha != nil {
+				alphaSum += *item.Alpha * float64(item.Units)
+				alphaUnits += float64(item.Units)
+			}
+		} else {
+			item.Kappa = fleissKappa(counts)
+			item.Alpha = alphaNominal(values)
+		}
+		res = append(res, item)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Label < res[j].Label })
+	project := ProjectAgreement{Kappa: fleissKappa(pooled)}
+	if alphaUnits > 0 {
+		project.Alpha = ratio(alphaSum / alphaUnits)
+	}
+	return res, project
+}
+
+func pairAgreements(labels map[string]map[string]map[string]rating) []PairAgreement {
+	type pairData struct {
+		a, b     []string
+		units    int
+		scores   map[string][2][]float64
+		spearman float64
+		weight   float64
+	}
+	pairs := make(map[[2]string]*pairData)
+	for label, units := range labels {
+		for _, ratings := range units {
+			ids := make([]string, 0, len(ratings))
+			for id := range ratings {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for i := range ids {
+				for j := i + 1; j < len(ids); j++ {
+					key := [2]string{ids[i], ids[j]}
+					p, ok := pairs[key]
+					if !ok {
+						p = &pairData{scores: make(map[string][2][]float64)}
+						pairs[key] = p
+					}
+					p.units++
+					ra, rb := ratings[ids[i]], ratings[ids[j]]
+					if ra.Numeric {
+						s := p.scores[label]
+						s[0] = append(s[0], ra.Score)
+						s[1] = append(s[1], rb.Score)
+						p.scores[label] = s
+					} else {
+						p.a = append(p.a, label+"\x00"+ra.Value)
+						p.b = append(p.b, label+"\x00"+rb.Value)
+					}
+				}
+			}
+		}
+	}
+	res := make([]PairAgreement, 0, len(pairs))
+	for key, p := range pairs {
+		item := PairAgreement{
+			Labelers: []model.Person{{ID: key[0]}, {ID: key[1]}},
+			Units:    p.units,
+			Kappa:    cohenKappa(p.a, p.b),
+		}
+		for _, s := range p.scores {
+			if rho := spearman(s[0], s[1]); rho != nil {
+				p.spearman += *rho * float64(len(s[0]))
+				p.weight += float64(len(s[0]))
+			}
+		}
+		if p.weight > 0 {
+			item.Spearman = ratio(p.spearman / p.weight)
+		}
+		res = append(res, item)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Labelers[0].ID != res[j].Labelers[0].ID {
+			return res[i].Labelers[0].ID < res[j].Labelers[0].ID
+		}
+		return res[i].Labelers[1].ID < res[j].Labelers[1].ID
+	})
+	return res
+}
+
+type SearchAdjudicationsReq struct {
+	ProjectID string `form:"projectId"`
+	dto.Pagination
+}
+
+type AdjudicationResp struct {
+	Task        any              `json:"task"`
+	Submissions []SubmissionResp `json:"submissions"`
+	// Disagreements 标注员之间不一致的标注项
+	Disagreements []string `json:"disagreements"`
+}
+
+// adjudications 待裁决的任务：已提交的标注数达到项目的标注人数且还没有裁决
+func (s *overlapStore[T]) adjudications(ctx context.Context, req SearchAdjudicationsReq) ([]AdjudicationResp, int, error) {
+	projectID, err := primitive.ObjectIDFromHex(req.ProjectID)
+	if err != nil {
+		return nil, 0, err
+	}
+	overlap, err := s.store.projectOverlap(ctx, projectID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if overlap < 2 {
+		return nil, 0, errors.New("项目没有开启多人标注")
+	}
+	pipe := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: notDeleted(bson.M{
+			"taskType":  s.store.Name,
+			"projectId": projectID,
+			"status":    model.TaskStatusSubmit,
+		})}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$taskId", "count": bson.M{"$sum": 1}}}},
+		bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gte": overlap}}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         s.store.Tasks.Name(),
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "task",
+		}}},
+		bson.D{{Key: "$unwind", Value: "$task"}},
+		bson.D{{Key: "$match", Value: bson.M{
+			"task.adjudication": bson.M{"$exists": false},
+			"task.deletedAt":    bson.M{"$exists": false},
+		}}},
+	}
+	var counts []struct {
+		Count int `bson:"count"`
+	}
+	if err := aggregateAll(ctx, s.svc.CollectionSubmission, append(pipe[:len(pipe):len(pipe)], bson.D{{Key: "$count", Value: "count"}}), &counts); err != nil {
+		return nil, 0, err
+	}
+	if len(counts) == 0 {
+		return []AdjudicationResp{}, 0, nil
+	}
+	page := append(pipe[:len(pipe):len(pipe)],
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		bson.D{{Key: "$skip", Value: (req.GetPageIndex() - 1) * req.GetPageSize()}},
+		bson.D{{Key: "$limit", Value: req.GetPageSize()}},
+		bson.D{{Key: "$project", Value: bson.M{"_id": 1}}},
+	)
+	var ids []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := aggregateAll(ctx, s.svc.CollectionSubmission, page, &ids); err != nil {
+		return nil, 0, err
+	}
+	res := make([]AdjudicationResp, 0, len(ids))
+	for _, v := range ids {
+		item, err := s.adjudication(ctx, v.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		res = append(res, item)
+	}
+	return res, counts[0].Count, nil
+}
+
+// adjudication 任务和它已提交的标注，以及标注员之间不一致的标注项
+func (s *overlapStore[T]) adjudication(ctx context.Context, taskID primitive.ObjectID) (AdjudicationResp, error) {
+	task, err := s.store.Get(ctx, taskID)
+	if err != nil {
+		return AdjudicationResp{}, err
+	}
+	filter := bson.M{"taskId": taskID, "status": model.TaskStatusSubmit}
+	cursor, err := s.svc.CollectionSubmission.Find(ctx, notDeleted(filter), options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return AdjudicationResp{}, err
+	}
+	var submissions []model.Submission
+	if err := cursor.All(ctx, &submissions); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return AdjudicationResp{}, err
+	}
+	resps, err := s.newSubmissionResps(ctx, submissions)
+	if err != nil {
+		return AdjudicationResp{}, err
+	}
+	values := make(map[string]map[string]bool)
+	var keys []string
+	for _, v := range resps {
+		for _, r := range s.spec.ratings(v.Answer.(T)) {
+			key := r.Label + r.Unit
+			if values[key] == nil {
+				values[key] = make(map[string]bool)
+				keys = append(keys, key)
+			}
+			value := r.Value
+			if r.Numeric {
+				value = fmt.Sprint(r.Score)
+			}
+			values[key][value] = true
+		}
+	}
+	disagreements := make([]string, 0)
+	for _, key := range keys {
+		if len(values[key]) > 1 {
+			disagreements = append(disagreements, key)
+		}
+	}
+	return AdjudicationResp{Task: task, Submissions: resps, Disagreements: disagreements}, nil
+}
+
+type AdjudicateReq struct {
+	TaskID  primitive.ObjectID `json:"taskId"`
+	Version int                `json:"version"`
+	// SubmissionID 采用的标注，为空时使用 Answer 作为裁决结果
+	SubmissionID *primitive.ObjectID `json:"submissionId"`
+	Answer       json.RawMessage     `json:"answer"`
+}
+
+// checkAdjudicable 只有开启多人标注的项目中、已提交的标注达到每个任务的标注人数时才能裁决
+func checkAdjudicable(overlap, submitted int) error {
+	if overlap < 2 {
+		return errors.New("项目没有开启多人标注")
+	}
+	if submitted < overlap {
+		return fmt.Errorf("已提交的标注数为%d，需要%d人提交后才能裁决", submitted, overlap)
+	}
+	return nil
+}
+
+// adjudicate 把裁决结果写回任务，任务状态改为已提交，之后按项目流程审核
+func (s *overlapStore[T]) adjudicate(ctx context.Context, req AdjudicateReq) error {
+	task, err := s.store.Get(ctx, req.TaskID)
+	if err != nil {
+		return err
+	}
+	metas, err := findMeta(ctx, s.store.Tasks, bson.M{"_id": req.TaskID})
+	if err != nil {
+		return err
+	}
+	if len(metas) == 0 {
+		return ErrNoDoc
+	}
+	meta := metas[0]
+	// 多人标注的任务在裁决前保持未分配
+	if meta.Status != model.TaskStatusAllocate {
+		return fmt.Errorf("当前任务状态为:%s,无法裁决", meta.Status)
+	}
+	wf, err := s.store.Workflow(ctx, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := wf.Find(meta.Status, model.TaskStatusSubmit, []string{PermissionTypeAdmin}); !ok || !wf.HasState(model.TaskStatusSubmit) {
+		return fmt.Errorf("当前任务状态为:%s,无法修改为:%s", meta.Status, model.TaskStatusSubmit)
+	}
+	overlap, err := s.store.projectOverlap(ctx, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	submitted, err := s.svc.CollectionSubmission.CountDocuments(ctx, notDeleted(bson.M{"taskId": meta.ID, "status": model.TaskStatusSubmit}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if err := checkAdjudicable(overlap, int(submitted)); err != nil {
+		return err
+	}
+
+	userID, _ := operator(ctx)
+	// 裁决结果的标注员为采用的标注的标注员，自己填写时为裁决人，审核时不会分给标注员
+	labeler := model.Person{ID: userID}
+	var answer T
+	switch {
+	case req.SubmissionID != nil:
+		submission, err := s.findSubmission(ctx, *req.SubmissionID)
+		if err != nil {
+			return err
+		}
+		if submission.TaskID != req.TaskID || submission.Status != model.TaskStatusSubmit {
+			return errors.New("只能采用该任务已提交的标注")
+		}
+		if answer, err = s.decodeAnswer(submission); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return err
+		}
+		labeler = submission.Labeler
+	case len(req.Answer) > 0:
+		if err := json.Unmarshal(req.Answer, &answer); err != nil {
+			return fmt.Errorf("裁决结果格式不正确：%w", err)
+		}
+	default:
+		return errors.New("请选择采用的标注或填写裁决结果")
+	}
+
+	now := util.Datetime(time.Now())
+	set := s.spec.merge(task, answer)
+	set["adjudication"] = model.Adjudication{
+		SubmissionID: req.SubmissionID,
+		Adjudicator:  userID,
+		CreateTime:   now,
+	}
+	set["permissions.labeler"] = labeler
+	for k, v := range s.store.statusSet(model.TaskStatusSubmit, now) {
+		set[k] = v
+	}
+	filter := versionFilter(bson.M{
+		"_id":          req.TaskID,
+		"status":       meta.Status,
+		"adjudication": bson.M{"$exists": false},
+	}, req.Version)
+	matched, err := s.store.updateOne(ctx, filter, bson.M{"$set": set}, model.ActivityAdjudicate)
+	if err != nil && !errors.Is(err, ErrVersionConflict) {
+		return ErrDatabase
+	}
+	if !matched {
+		return ErrVersionConflict
+	}
+	record := s.store.newTransition(meta, model.TaskStatusSubmit)
+	record.Actor = userID
+	record.Role = PermissionTypeAdmin
+	record.Reason = model.ActivityAdjudicate
+	record.CreateTime = now
+	return s.store.recordTransitions(ctx, []model.TaskTransition{record})
+}
+
+// aggregateAll 执行聚合并读取全部结果
+func aggregateAll(ctx context.Context, collection *mongo.Collection, pipe mongo.Pipeline, res any, opts ...*options.AggregateOptions) error {
+	cursor, err := collection.Aggregate(ctx, pipe, opts...)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if err := cursor.All(ctx, res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (svc *LabelerService) AllocSubmissions(ctx context.Context, taskType string, req BatchAllocReq) (int64, error) {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return 0, err
+	}
+	return o.allocate(ctx, req)
+}
+
+func (svc *LabelerService) SearchSubmissions(ctx context.Context, taskType string, req SearchSubmissionsReq) ([]SubmissionResp, int, error) {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return nil, 0, err
+	}
+	return o.search(ctx, req)
+}
+
+func (svc *LabelerService) GetSubmission(ctx context.Context, taskType string, id primitive.ObjectID) (SubmissionResp, error) {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return SubmissionResp{}, err
+	}
+	return o.get(ctx, id)
+}
+
+func (svc *LabelerService) SaveSubmission(ctx context.Context, taskType string, req SaveSubmissionReq) (SubmissionResp, error) {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return SubmissionResp{}, err
+	}
+	return o.save(ctx, req)
+}
+
+func (svc *LabelerService) Agreement(ctx context.Context, taskType string, projectID primitive.ObjectID) (AgreementReport, error) {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return AgreementReport{}, err
+	}
+	return o.agreement(ctx, projectID)
+}
+
+func (svc *LabelerService) SearchAdjudications(ctx context.Context, taskType string, req SearchAdjudicationsReq) ([]AdjudicationResp, int, error) {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return nil, 0, err
+	}
+	return o.adjudications(ctx, req)
+}
+
+func (svc *LabelerService) Adjudicate(ctx context.Context, taskType string, req AdjudicateReq) error {
+	o, err := svc.overlap(taskType)
+	if err != nil {
+		return err
+	}
+	return o.adjudicate(ctx, req)
+}
+
+var task2Overlap = overlapSpec[model.Task2]{
+	answer: func(t model.Task2) bson.M {
+		return bson.M{"labels": t.Labels}
+	},
+	merge: func(_, answer model.Task2) bson.M {
+		return bson.M{"labels": answer.Labels}
+	},
+	ratings: func(t model.Task2) []rating {
+		var res []rating
+		for _, l := range t.Labels {
+			if l.Value != "" {
+				res = append(res, rating{Label: l.Name, Value: l.Value})
+			}
+		}
+		return res
+	},
+}
+
+var task3Overlap = overlapSpec[model.Task3]{
+	answer: func(t model.Task3) bson.M {
+		output := make([]model.Task3OutputItem, len(t.Output))
+		for i, v := range t.Output {
+			v.Content = ""
+			output[i] = v
+		}
+		return bson.M{
+			"command": model.Task3CommandItem{Result: t.Command.Result},
+			"output":  output,
+		}
+	},
+	merge: func(task, answer model.Task3) bson.M {
+		set := bson.M{"command.result": answer.Command.Result}
+		for i := range task.Output {
+			if i >= len(answer.Output) {
+				break
+			}
+			set[fmt.Sprintf("output.%d.result", i)] = answer.Output[i].Result
+			set[fmt.Sprintf("output.%d.skip", i)] = answer.Output[i].Skip
+			set[fmt.Sprintf("output.%d.sort", i)] = answer.Output[i].Sort
+		}
+		return set
+	},
+	ratings: func(t model.Task3) []rating {
+		var res []rating
+		for _, l := range t.Command.Result.Labels {
+			if l.Value != "" {
+				res = append(res, rating{Label: "指令标签：" + l.Name, Value: l.Value})
+			}
+		}
+		res = append(res, judgmentRatings("指令判断：", "", t.Command.Result.Judgment)...)
+		for i, v := range t.Output {
+			if v.Skip {
+				continue
+			}
+			unit := fmt.Sprintf("#%d", i+1)
+			res = append(res, judgmentRatings("输出判断：", unit, v.Result.Judgment)...)
+			if v.Result.Score > 0 {
+				res = append(res, rating{Label: "输出评分", Unit: unit, Score: float64(v.Result.Score), Numeric: true})
+			}
+			if v.Sort > 0 {
+				res = append(res, rating{Label: "输出排序", Unit: unit, Score: float64(v.Sort), Numeric: true})
+			}
+		}
+		return res
+	},
+}
+
+var task4Overlap = overlapSpec[model.Task4]{
+	answer: func(t model.Task4) bson.M {
+		output := make([]model.Task4OutputItem, len(t.Output))
+		for i, v := range t.Output {
+			v.Content = ""
+			output[i] = v
+		}
+		return bson.M{"output": output}
+	},
+	merge: func(task, answer model.Task4) bson.M {
+		set := bson.M{}
+		for i := range task.Output {
+			if i >= len(answer.Output) {
+				break
+			}
+			set[fmt.Sprintf("output.%d.result", i)] = answer.Output[i].Result
+			set[fmt.Sprintf("output.%d.sort", i)] = answer.Output[i].Sort
+		}
+		return set
+	},
+	ratings: func(t model.Task4) []rating {
+		var res []rating
+		for i, v := range t.Output {
+			unit := fmt.Sprintf("#%d", i+1)
+			res = append(res, judgmentRatings("输出判断：", unit, v.Result.Judgment)...)
+			for _, g := range v.Result.ScoreGroups {
+				for _, score := range g.Scores {
+					res = append(res, rating{Label: "评分：" + g.Name + "/" + score.Name, Unit: unit, Score: float64(score.Score), Numeric: true})
+				}
+			}
+			if v.Sort > 0 {
+				res = append(res, rating{Label: "输出排序", Unit: unit, Score: float64(v.Sort), Numeric: true})
+			}
+		}
+		return res
+	},
+}
+
+// judgmentRatings 已选择的判断
+func judgmentRatings(prefix, unit string, judgments []model.Judgment) []rating {
+	var res []rating
+	for _, j := range judgments {
+		if j.Value != "" && j.Value != "未选择" {
+			res = append(res, rating{Label: prefix + j.Name, Unit: unit, Value: j.Value})
+		}
+	}
+	return res
+}
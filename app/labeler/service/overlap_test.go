@@ -0,0 +1,22 @@
+package service
+
+import "testing"
+
+func TestCheckAdjudicable(t *testing.T) {
+	cases := []struct {
+		overlap, submitted int
+		ok                 bool
+	}{
+		{0, 0, false},
+		{1, 1, false},
+		{2, 1, false},
+		{3, 2, false},
+		{2, 2, true},
+		{3, 4, true},
+	}
+	for _, c := range cases {
+		if err := checkAdjudicable(c.overlap, c.submitted); (err == nil) != c.ok {
+			t.Errorf("overlap %d submitted %d: %v", c.overlap, c.submitted, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/common/dto"
+)
+
+// 总数的统计方式
+const (
+	CountExact     = ""          // 精确统计，默认
+	CountEstimated = "estimated" // 最多统计 estimatedCountLimit 条，达到上限时 Estimated 为 true
+	CountNone      = "none"      // 不统计，Count 为 -1
+)
+
+const estimatedCountLimit = 10000
+
+// PageQuery 分页参数。After 为上一页返回的 next 时按 _id 游标翻页，忽略 pageIndex；
+// 为空时仍按 pageIndex/pageSize 跳页，深分页时建议使用游标
+type PageQuery struct {
+	dto.Pagination
+	After primitive.ObjectID `json:"after"`
+	Count string             `json:"count"`
+}
+
+// Page 分页结果，Next 为下一页的游标，没有更多数据时为空
+type Page struct {
+	Count     int    `json:"count"`
+	Estimated bool   `json:"estimated"`
+	Next      string `json:"next"`
+}
+
+func (q *PageQuery) validate() error {
+	switch q.Count {
+	case CountExact, CountEstimated, CountNone:
+		return nil
+	}
+	return fmt.Errorf("不支持的统计方式：%s", q.Count)
+}
+
+// findOptions 按 _id 升序，游标翻页时不跳过
+func (q *PageQuery) findOptions() *options.FindOptions {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(q.GetPageSize()))
+	if q.After.IsZero() {
+		opts.SetSkip(int64((q.GetPageIndex() - 1) * q.GetPageSize()))
+	}
+	return opts
+}
+
+// pageFilter 游标翻页时在 filter 上加 _id > After
+func (q *PageQuery) pageFilter(filter bson.M) bson.M {
+	if q.After.IsZero() {
+		return filter
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": q.After}}}}
+}
+
+// countPage 按 q.Count 统计 filter 匹配的任务数
+func countPage(ctx context.Context, collection *mongo.Collection, filter bson.M, q *PageQuery) (Page, error) {
+	switch q.Count {
+	case CountNone:
+		return Page{Count: -1}, nil
+	case CountEstimated:
+		count, err := collection.CountDocuments(ctx, notDeleted(filter), options.Count().SetLimit(estimatedCountLimit))
+		if err != nil {
+			return Page{}, err
+		}
+		return Page{Count: int(count), Estimated: count >= estimatedCountLimit}, nil
+	}
+	count, err := collection.CountDocuments(ctx, notDeleted(filter))
+	if err != nil {
+		return Page{}, err
+	}
+	return Page{Count: int(count)}, nil
+}
+
+// nextCursor 取满一页时返回最后一条的 _id 作为下一页的游标
+func nextCursor[T any](tasks []T, pageSize int) string {
+	if len(tasks) == 0 || len(tasks) < pageSize {
+		return ""
+	}
+	raw, err := bson.Marshal(tasks[len(tasks)-1])
+	if err != nil {
+		return ""
+	}
+	id, ok := bson.Raw(raw).Lookup("_id").ObjectIDOK()
+	if !ok {
+		return ""
+	}
+	return id.Hex()
+}
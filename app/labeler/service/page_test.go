@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+)
+
+func TestPageQuery(t *testing.T) {
+	q := PageQuery{Pagination: dto.Pagination{PageIndex: 3, PageSize: 20}}
+	if opts := q.findOptions(); *opts.Skip != 40 || *opts.Limit != 20 {
+		t.Errorf("skip %d limit %d", *opts.Skip, *opts.Limit)
+	}
+	q.After = primitive.NewObjectID()
+	if opts := q.findOptions(); opts.Skip != nil {
+		t.Errorf("cursor page should not skip, got %d", *opts.Skip)
+	}
+	if err := (&PageQuery{Count: "all"}).validate(); err == nil {
+		t.Error("want error for unknown count mode")
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	tasks := []model.Task2{{ID: primitive.NewObjectID()}, {ID: primitive.NewObjectID()}}
+	if got := nextCursor(tasks, 2); got != tasks[1].ID.Hex() {
+		t.Errorf("want %s got %s", tasks[1].ID.Hex(), got)
+	}
+	if got := nextCursor(tasks, 3); got != "" {
+		t.Errorf("want no cursor for last page, got %s", got)
+	}
+}
@@ -0,0 +1,456 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+const (
+	preAnnotatePollInterval = 3 * time.Second
+	// preAnnotateStaleAfter 预标注中的任务超过该时间没有更新进度，认为进程已经退出，继续预标注
+	preAnnotateStaleAfter = 10 * time.Minute
+	// preAnnotateBatchSize 每次请求模型预测的任务数
+	preAnnotateBatchSize = 20
+)
+
+// PreAnnotateFunc 一种任务类型的预标注：count 检查项目并统计需要预标注的任务数，run 逐批预测并修改任务
+type PreAnnotateFunc struct {
+	count func(ctx context.Context, job model.PreAnnotateJob) (int64, error)
+	run   func(ctx context.Context, job *model.PreAnnotateJob, progress func()) error
+}
+
+func (svc *LabelerService) registerPreAnnotators() {
+	svc.PreAnnotators = map[string]PreAnnotateFunc{
+		"t2": preAnnotator(svc, svc.StoreTask2, svc.StoreProject2,
+			func(p model.Project2) any { return p.Schema }, applyTask2Prediction),
+		"t3": preAnnotator(svc, svc.StoreTask3, svc.StoreProject3,
+			func(p model.Project3) any { return p.Schema }, applyTask3Prediction),
+		"t4": preAnnotator(svc, svc.StoreTask4, svc.StoreProject4,
+			func(p model.Project4) any { return p.Schema }, applyTask4Prediction),
+	}
+}
+
+// preAnnotateFilter 项目中需要预标注的任务：未分配，没有预标注过或者需要覆盖且不是本次预标注的
+func preAnnotateFilter(job model.PreAnnotateJob) bson.M {
+	filter := bson.M{
+		"projectId": job.ProjectID,
+		"status":    model.TaskStatusAllocate,
+	}
+	if job.Overwrite {
+		filter["preAnnotation.jobId"] = bson.M{"$ne": job.ID}
+	} else {
+		filter["preAnnotation"] = bson.M{"$exists": false}
+	}
+	return notDeleted(filter).(bson.M)
+}
+
+// preAnnotator 生成任务类型的 PreAnnotateFunc，apply 把预测结果转为任务要修改的字段，没有可修改的字段时返回空
+func preAnnotator[T, P any](
+	svc *LabelerService,
+	store *TaskStore[T],
+	projects *ProjectStore[P],
+	schema func(P) any,
+	apply func(P, T, Prediction) bson.M,
+) PreAnnotateFunc {
+	count := func(ctx context.Context, job model.PreAnnotateJob) (int64, error) {
+		if _, err := projects.Get(ctx, job.ProjectID); err != nil {
+			return 0, err
+		}
+		count, err := store.Tasks.CountDocuments(ctx, preAnnotateFilter(job))
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+		}
+		return count, err
+	}
+	run := func(ctx context.Context, job *model.PreAnnotateJob, progress func()) error {
+		project, err := projects.Get(ctx, job.ProjectID)
+		if err != nil {
+			return err
+		}
+		cursor, err := store.Tasks.Find(ctx, preAnnotateFilter(*job), options.Find().SetSort(bson.M{"_id": 1}))
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		var tasks []T
+		var metas []model.TaskMeta
+		flush := func() error {
+			if len(tasks) == 0 {
+				return nil
+			}
+			req := PredictReq{
+				TaskType: store.Name,
+				Schema:   schema(project),
+				Tasks:    make([]PredictTask, len(tasks)),
+			}
+			for i := range tasks {
+				req.Tasks[i] = PredictTask{ID: metas[i].ID, Input: tasks[i]}
+			}
+			resp, err := svc.ModelClient.Predict(ctx, req)
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			if len(resp.Predictions) != len(tasks) {
+				return fmt.Errorf("模型返回的预测数量不正确：%d 个任务，%d 个预测", len(tasks), len(resp.Predictions))
+			}
+			job.ModelVersion = resp.ModelVersion
+			now := util.Datetime(time.Now())
+			for i, p := range resp.Predictions {
+				set := apply(project, tasks[i], p)
+				if len(set) == 0 {
+					job.Skipped++
+					continue
+				}
+				set["preAnnotation"] = model.PreAnnotation{
+					JobID:        job.ID,
+					ModelVersion: resp.ModelVersion,
+					CreateTime:   now,
+				}
+				set["updateTime"] = now
+				// 只修改仍未分配且没有被修改过的任务
+				filter := versionFilter(bson.M{"_id": metas[i].ID, "status": model.TaskStatusAllocate}, metas[i].Version)
+				matched, err := store.updateOne(ctx, filter, bson.M{"$set": set}, model.ActivityPreAnnotate)
+				if err != nil && !errors.Is(err, ErrVersionConflict) {
+					return err
+				}
+				if matched {
+					job.Done++
+				} else {
+					job.Skipped++
+				}
+			}
+			tasks, metas = tasks[:0], metas[:0]
+			progress()
+			return nil
+		}
+		for cursor.Next(ctx) {
+			var task T
+			var meta model.TaskMeta
+			if err := cursor.Decode(&task); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			if err := cursor.Decode(&meta); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			tasks = append(tasks, task)
+			metas = append(metas, meta)
+			if len(tasks) == preAnnotateBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return err
+		}
+		return flush()
+	}
+	return PreAnnotateFunc{count: count, run: run}
+}
+
+// applyTask2Prediction 按项目配置填充标签，不在选项中的预测值忽略
+func applyTask2Prediction(project model.Project2, task model.Task2, p Prediction) bson.M {
+	labels := make([]model.Task2LabelItem, len(project.Schema.Labels))
+	changed := false
+	for i, l := range project.Schema.Labels {
+		labels[i].Name = l.Name
+		for _, v := range task.Labels {
+			if v.Name == l.Name {
+				labels[i].Value = v.Value
+			}
+		}
+		v, ok := p.Labels[l.Name]
+		if !ok {
+			continue
+		}
+		for _, option := range l.Values {
+			if option == v {
+				labels[i].Value = v
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return bson.M{"labels": labels}
+}
+
+// applyJudgments 按配置的判断名称填充判断，没有预测的保持原值
+func applyJudgments(names []string, current []model.Judgment, predicted map[string]string) ([]model.Judgment, bool) {
+	res := make([]model.Judgment, len(names))
+	changed := false
+	for i, name := range names {
+		res[i] = model.Judgment{Name: name, Value: "未选择"}
+		for _, j := range current {
+			if j.Name == name {
+				res[i].Value = j.Value
+			}
+		}
+		if v, ok := predicted[name]; ok && v != "" {
+			res[i].Value = v
+			changed = true
+		}
+	}
+	return res, changed
+}
+
+// applyTask3Prediction 填充指令和每个输出的判断
+func applyTask3Prediction(project model.Project3, task model.Task3, p Prediction) bson.M {
+	set := bson.M{}
+	if judgment, ok := applyJudgments(project.Schema.CommandJudgment, task.Command.Result.Judgment, p.Labels); ok {
+		set["command.result.judgment"] = judgment
+	}
+	for i, output := range task.Output {
+		if i >= len(p.Outputs) {
+			break
+		}
+		if judgment, ok := applyJudgments(project.Schema.OutputJudgment, output.Result.Judgment, p.Outputs[i].Judgment); ok {
+			set[fmt.Sprintf("output.%d.result.judgment", i)] = judgment
+		}
+	}
+	return set
+}
+
+// applyTask4Prediction 按项目配置的评分组填充每个输出的分数，分数限制在 0 到评分组的最高分之间
+func applyTask4Prediction(project model.Project4, task model.Task4, p Prediction) bson.M {
+	set := bson.M{}
+	for i, output := range task.Output {
+		if i >= len(p.Outputs) || len(p.Outputs[i].Scores) == 0 {
+			continue
+		}
+		groups := make([]model.ScoreGroup, len(project.Schema.ScoreGroups))
+		changed := false
+		for gi, g := range project.Schema.ScoreGroups {
+			groups[gi] = model.ScoreGroup{Name: g.Name, Max: g.Max, Scores: make([]model.Score, len(g.Scores))}
+			predicted := p.Outputs[i].Scores[g.Name]
+			for si, name := range g.Scores {
+				groups[gi].Scores[si] = model.Score{Name: name, Score: currentScore(output.Result.ScoreGroups, g.Name, name)}
+				score, ok := predicted[name]
+				if !ok {
+					continue
+				}
+				if score < 0 {
+					score = 0
+				}
+				if g.Max > 0 && score > g.Max {
+					score = g.Max
+				}
+				groups[gi].Scores[si].Score = score
+				changed = true
+			}
+		}
+		if changed {
+			set[fmt.Sprintf("output.%d.result.scoreGroups", i)] = groups
+		}
+	}
+	return set
+}
+
+func currentScore(groups []model.ScoreGroup, group, name string) int64 {
+	for _, g := range groups {
+		if g.Name != group {
+			continue
+		}
+		for _, s := range g.Scores {
+			if s.Name == name {
+				return s.Score
+			}
+		}
+	}
+	return 0
+}
+
+type CreatePreAnnotateReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Overwrite bool               `json:"overwrite"`
+}
+
+// CreatePreAnnotate 创建项目的后台预标注任务，由 RunPreAnnotations 执行。项目已有未完成的预标注时返回错误
+func (svc *LabelerService) CreatePreAnnotate(ctx context.Context, taskType string, req CreatePreAnnotateReq) (model.PreAnnotateJob, error) {
+	if svc.ModelClient == nil {
+		return model.PreAnnotateJob{}, ErrModelNotConfigured
+	}
+	annotator, ok := svc.PreAnnotators[taskType]
+	if !ok {
+		return model.PreAnnotateJob{}, fmt.Errorf("该任务类型不支持预标注：%s", taskType)
+	}
+	running, err := svc.CollectionPreAnnotateJob.CountDocuments(ctx, bson.M{
+		"taskType":  taskType,
+		"projectId": req.ProjectID,
+		"status":    bson.M{"$in": bson.A{model.PreAnnotateStatusWaiting, model.PreAnnotateStatusRunning}},
+	})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.PreAnnotateJob{}, err
+	}
+	if running > 0 {
+		return model.PreAnnotateJob{}, errors.New("项目正在预标注中，请稍候")
+	}
+	userID, _ := operator(ctx)
+	now := util.Datetime(time.Now())
+	job := model.PreAnnotateJob{
+		ID:         primitive.NewObjectID(),
+		TaskType:   taskType,
+		ProjectID:  req.ProjectID,
+		Overwrite:  req.Overwrite,
+		Status:     model.PreAnnotateStatusWaiting,
+		Creator:    userID,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if job.Total, err = annotator.count(ctx, job); err != nil {
+		return model.PreAnnotateJob{}, err
+	}
+	if _, err := svc.CollectionPreAnnotateJob.InsertOne(ctx, job); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.PreAnnotateJob{}, err
+	}
+	return job, nil
+}
+
+// RunPreAnnotations 依次执行等待中的预标注任务，需要在单独的 goroutine 中运行
+func (svc *LabelerService) RunPreAnnotations() {
+	for {
+		found := false
+		_ = log.WithTracer(context.Background(), PackageName, "Labeler PreAnnotate", func(ctx context.Context) error {
+			job, err := svc.claimPreAnnotate(ctx)
+			if err != nil {
+				if !errors.Is(err, mongo.ErrNoDocuments) {
+					log.Logger().WithContext(ctx).Error("claim pre-annotate: ", err.Error())
+				}
+				return err
+			}
+			found = true
+			svc.runPreAnnotate(ctx, job)
+			return nil
+		})
+		if !found {
+			time.Sleep(preAnnotatePollInterval)
+		}
+	}
+}
+
+// claimPreAnnotate 领取一个等待中或者进度长时间没有更新的预标注任务，已经预标注的任务不会重复预标注
+func (svc *LabelerService) claimPreAnnotate(ctx context.Context) (model.PreAnnotateJob, error) {
+	now := time.Now()
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"status": model.PreAnnotateStatusWaiting},
+			bson.M{
+				"status":     model.PreAnnotateStatusRunning,
+				"updateTime": bson.M{"$lt": now.Add(-preAnnotateStaleAfter)},
+			},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     model.PreAnnotateStatusRunning,
+			"updateTime": util.Datetime(now),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After)
+	var job model.PreAnnotateJob
+	err := svc.CollectionPreAnnotateJob.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+func (svc *LabelerService) runPreAnnotate(ctx context.Context, job model.PreAnnotateJob) {
+	saveProgress := func(set bson.M) {
+		set["modelVersion"] = job.ModelVersion
+		set["done"] = job.Done
+		set["skipped"] = job.Skipped
+		set["updateTime"] = util.Datetime(time.Now())
+		if _, err := svc.CollectionPreAnnotateJob.UpdateByID(ctx, job.ID, bson.M{"$set": set}); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+		}
+	}
+	err := svc.preAnnotate(ctx, &job, func() { saveProgress(bson.M{}) })
+	set := bson.M{}
+	if err != nil {
+		log.Logger().WithContext(ctx).Error("pre-annotate ", job.ID.Hex(), ": ", err.Error())
+		set["status"] = model.PreAnnotateStatusFailed
+		set["error"] = err.Error()
+	} else {
+		set["status"] = model.PreAnnotateStatusDone
+		set["finishTime"] = util.Datetime(time.Now())
+	}
+	saveProgress(set)
+}
+
+func (svc *LabelerService) preAnnotate(ctx context.Context, job *model.PreAnnotateJob, progress func()) error {
+	if svc.ModelClient == nil {
+		return ErrModelNotConfigured
+	}
+	annotator, ok := svc.PreAnnotators[job.TaskType]
+	if !ok {
+		return fmt.Errorf("该任务类型不支持预标注：%s", job.TaskType)
+	}
+	return annotator.run(ctx, job, progress)
+}
+
+type SearchPreAnnotateReq struct {
+	ProjectID string `form:"projectId"`
+	dto.Pagination
+}
+
+// SearchPreAnnotate 查询任务类型的预标注任务，可以按项目筛选
+func (svc *LabelerService) SearchPreAnnotate(ctx context.Context, taskType string, req SearchPreAnnotateReq) ([]model.PreAnnotateJob, int, error) {
+	filter := bson.M{"taskType": taskType}
+	if req.ProjectID != "" {
+		projectID, err := primitive.ObjectIDFromHex(req.ProjectID)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter["projectId"] = projectID
+	}
+	count, err := svc.CollectionPreAnnotateJob.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	opts := pageOptions(req.Pagination).SetSort(bson.D{{Key: "_id", Value: -1}})
+	cursor, err := svc.CollectionPreAnnotateJob.Find(ctx, filter, opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	res := make([]model.PreAnnotateJob, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	return res, int(count), nil
+}
+
+// GetPreAnnotate 查询预标注任务的状态和进度
+func (svc *LabelerService) GetPreAnnotate(ctx context.Context, taskType string, id primitive.ObjectID) (model.PreAnnotateJob, error) {
+	var job model.PreAnnotateJob
+	err := svc.CollectionPreAnnotateJob.FindOne(ctx, bson.M{"_id": id, "taskType": taskType}).Decode(&job)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.PreAnnotateJob{}, errors.New("预标注任务不存在")
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.PreAnnotateJob{}, err
+	}
+	return job, nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+)
+
+const (
+	ExportTypeTask3Preference = "t3preference"
+	ExportTypeTask4Preference = "t4preference"
+)
+
+// 偏好数据的导出方式
+const (
+	PreferenceModePairs    = "pairs"    // 每两个排名不同的输出生成一条 chosen/rejected
+	PreferenceModeListwise = "listwise" // 每个任务一条，输出按排名从好到差
+)
+
+// 偏好的排序依据
+const (
+	PreferenceRankBySort  = "sort"  // 按标注的排序，1 最好，默认
+	PreferenceRankByScore = "score" // 按分数，分数高的更好
+)
+
+type DownloadPreferenceReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Status    []string           `json:"status"`
+	Mode      string             `json:"mode"`
+	RankBy    string             `json:"rankBy"`
+	// SkipTies 排名相同的两个输出不生成偏好对，为 false 时生成 tie 为 true 的记录
+	SkipTies bool `json:"skipTies"`
+	// MinScoreGap chosen 的分数至少比 rejected 高多少，0 表示不限制
+	MinScoreGap float64 `json:"minScoreGap"`
+	// ExcludeSkip 不导出标注为跳过的输出，只对 t3 有效
+	ExcludeSkip bool `json:"excludeSkip"`
+}
+
+type DownloadPreferenceResp = model.ExportJob
+
+// preferenceOutput 一个模型输出的排名和分数，Rank 为 0 表示没有排序
+type preferenceOutput struct {
+	Index   int              `json:"index"`
+	Content string           `json:"content"`
+	Rank    int              `json:"rank"`
+	Score   float64          `json:"score"`
+	Scores  map[string]int64 `json:"scores,omitempty"`
+	Skip    bool             `json:"-"`
+}
+
+// preferenceTask 导出偏好数据需要的任务内容，prompt 为 t3 的指令或 t4 的文本
+type preferenceTask struct {
+	ID      primitive.ObjectID
+	Name    string
+	Prompt  string
+	Outputs []preferenceOutput
+}
+
+type PreferencePair struct {
+	TaskID        primitive.ObjectID `json:"taskId"`
+	TaskName      string             `json:"taskName"`
+	Prompt        string             `json:"prompt"`
+	Chosen        string             `json:"chosen"`
+	Rejected      string             `json:"rejected"`
+	ChosenRank    int                `json:"chosenRank"`
+	RejectedRank  int                `json:"rejectedRank"`
+	ChosenScore   float64            `json:"chosenScore"`
+	RejectedScore float64            `json:"rejectedScore"`
+	Tie           bool               `json:"tie,omitempty"`
+}
+
+type PreferenceList struct {
+	TaskID    primitive.ObjectID `json:"taskId"`
+	TaskName  string             `json:"taskName"`
+	Prompt    string             `json:"prompt"`
+	Responses []preferenceOutput `json:"responses"`
+}
+
+func task3Preference(task model.Task3) preferenceTask {
+	outputs := make([]preferenceOutput, len(task.Output))
+	for i, v := range task.Output {
+		outputs[i] = preferenceOutput{Index: i, Content: v.Content, Rank: v.Sort, Score: float64(v.Result.Score), Skip: v.Skip}
+	}
+	return preferenceTask{ID: task.ID, Name: task.Name, Prompt: task.Command.Content, Outputs: outputs}
+}
+
+// task4Preference t4 的分数为各打分组所有维度的总分
+func task4Preference(task model.Task4) preferenceTask {
+	outputs := make([]preferenceOutput, len(task.Output))
+	for i, v := range task.Output {
+		var total int64
+		scores := make(map[string]int64)
+		for _, g := range v.Result.ScoreGroups {
+			for _, s := range g.Scores {
+				total += s.Score
+				scores[g.Name+"/"+s.Name] = s.Score
+			}
+		}
+		outputs[i] = preferenceOutput{Index: i, Content: v.Content, Rank: v.Sort, Score: float64(total), Scores: scores}
+	}
+	return preferenceTask{ID: task.ID, Name: task.Name, Prompt: task.Text, Outputs: outputs}
+}
+
+// better a 是否比 b 好，返回 0 表示两者相同
+func (req DownloadPreferenceReq) better(a, b preferenceOutput) int {
+	if req.RankBy == PreferenceRankByScore {
+		switch {
+		case a.Score > b.Score:
+			return 1
+		case a.Score < b.Score:
+			return -1
+		}
+		return 0
+	}
+	switch {
+	case a.Rank < b.Rank:
+		return 1
+	case a.Rank > b.Rank:
+		return -1
+	}
+	return 0
+}
+
+// candidates 参与比较的输出：按排序比较时没有排序的输出不参与，ExcludeSkip 时跳过的输出不参与
+func (req DownloadPreferenceReq) candidates(task preferenceTask) []preferenceOutput {
+	var res []preferenceOutput
+	for _, o := range task.Outputs {
+		if o.Content == "" || (req.ExcludeSkip && o.Skip) {
+			continue
+		}
+		if req.RankBy != PreferenceRankByScore && o.Rank <= 0 {
+			continue
+		}
+		res = append(res, o)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return req.better(res[i], res[j]) > 0 })
+	return res
+}
+
+func (req DownloadPreferenceReq) pairs(task preferenceTask) []PreferencePair {
+	outputs := req.candidates(task)
+	var res []PreferencePair
+	for i := 0; i < len(outputs); i++ {
+		for j := i + 1; j < len(outputs); j++ {
+			chosen, rejected := outputs[i], outputs[j]
+			tie := req.better(chosen, rejected) == 0
+			if tie && req.SkipTies {
+				continue
+			}
+			if !tie && req.MinScoreGap > 0 && chosen.Score-rejected.Score < req.MinScoreGap {
+				continue
+			}
+			res = append(res, PreferencePair{
+				TaskID:        task.ID,
+				TaskName:      task.Name,
+				Prompt:        task.Prompt,
+				Chosen:        chosen.Content,
+				Rejected:      rejected.Content,
+				ChosenRank:    chosen.Rank,
+				RejectedRank:  rejected.Rank,
+				ChosenScore:   chosen.Score,
+				RejectedScore: rejected.Score,
+				Tie:           tie,
+			})
+		}
+	}
+	return res
+}
+
+// listwise 输出按排名从好到差，少于两个输出时没有排序意义，不导出
+func (req DownloadPreferenceReq) listwise(task preferenceTask) (PreferenceList, bool) {
+	outputs := req.candidates(task)
+	if len(outputs) < 2 {
+		return PreferenceList{}, false
+	}
+	return PreferenceList{TaskID: task.ID, TaskName: task.Name, Prompt: task.Prompt, Responses: outputs}, true
+}
+
+func (req DownloadPreferenceReq) validate() error {
+	if req.Mode != PreferenceModePairs && req.Mode != PreferenceModeListwise {
+		return fmt.Errorf("不支持的导出方式：%s", req.Mode)
+	}
+	if req.RankBy != "" && req.RankBy != PreferenceRankBySort && req.RankBy != PreferenceRankByScore {
+		return fmt.Errorf("不支持的排序依据：%s", req.RankBy)
+	}
+	if req.MinScoreGap < 0 {
+		return fmt.Errorf("最小分差不能小于 0")
+	}
+	return nil
+}
+
+// exportPreference 把排序或打分的输出导出为偏好数据的 JSONL，用于训练奖励模型
+func exportPreference[T any](ctx context.Context, collection *mongo.Collection, req DownloadPreferenceReq, convert func(T) preferenceTask) (ExportPlan, error) {
+	if err := req.validate(); err != nil {
+		return ExportPlan{}, err
+	}
+	// 金标准的副本和原任务内容相同，不重复导出
+	filter := bson.M{
+		"projectId": req.ProjectID,
+		"status": bson.M{
+			"$in": req.Status,
+		},
+		"goldSource": bson.M{"$exists": false},
+	}
+	total, err := collection.CountDocuments(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return ExportPlan{}, err
+	}
+	return ExportPlan{
+		FileName: time.Now().Format("2006-01-02 15-04-05") + "偏好数据-" + req.Mode + ".jsonl",
+		Total:    total,
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			cursor, err := collection.Find(ctx, notDeleted(filter))
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			defer func() {
+				_ = cursor.Close(ctx)
+			}()
+			out := bufio.NewWriter(w)
+			for cursor.Next(ctx) {
+				var task T
+				if err := cursor.Decode(&task); err != nil {
+					log.Logger().WithContext(ctx).Error(err.Error())
+					return err
+				}
+				pt := convert(task)
+				if req.Mode == PreferenceModePairs {
+					for _, pair := range req.pairs(pt) {
+						if err := writeJSONLine(out, pair); err != nil {
+							return err
+						}
+					}
+				} else if list, ok := req.listwise(pt); ok {
+					if err := writeJSONLine(out, list); err != nil {
+						return err
+					}
+				}
+				progress()
+			}
+			if err := cursor.Err(); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			return out.Flush()
+		},
+	}, nil
+}
+
+func (svc *LabelerService) exportTask3Preference(ctx context.Context, req DownloadPreferenceReq) (ExportPlan, error) {
+	return exportPreference(ctx, svc.CollectionTask3, req, task3Preference)
+}
+
+func (svc *LabelerService) exportTask4Preference(ctx context.Context, req DownloadPreferenceReq) (ExportPlan, error) {
+	return exportPreference(ctx, svc.CollectionTask4, req, task4Preference)
+}
+
+// DownloadTask3Preference 创建后台导出，把 t3 的输出排序导出为偏好对或列表排序
+func (svc *LabelerService) DownloadTask3Preference(ctx context.Context, req DownloadPreferenceReq) (DownloadPreferenceResp, error) {
+	return svc.CreateExport(ctx, ExportTypeTask3Preference, req)
+}
+
+// DownloadTask4Preference 创建后台导出，把 t4 的输出排序导出为偏好对或列表排序
+func (svc *LabelerService) DownloadTask4Preference(ctx context.Context, req DownloadPreferenceReq) (DownloadPreferenceResp, error) {
+	return svc.CreateExport(ctx, ExportTypeTask4Preference, req)
+}
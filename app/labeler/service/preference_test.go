@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"go-admin/app/labeler/model"
+)
+
+func TestPreferencePairs(t *testing.T) {
+	task := task3Preference(model.Task3{
+		Command: model.Task3CommandItem{Content: "q"},
+		Output: []model.Task3OutputItem{
+			{Content: "c", Sort: 3, Result: model.OutputRes{Score: 2}},
+			{Content: "a", Sort: 1, Result: model.OutputRes{Score: 6}},
+			{Content: "b", Sort: 1, Result: model.OutputRes{Score: 5}},
+			{Content: "d", Sort: 2, Skip: true},
+		},
+	})
+
+	pairs := DownloadPreferenceReq{Mode: PreferenceModePairs}.pairs(task)
+	if len(pairs) != 6 || pairs[0].Chosen != "a" || pairs[0].Rejected != "b" || !pairs[0].Tie {
+		t.Errorf("pairs %+v", pairs)
+	}
+
+	pairs = DownloadPreferenceReq{Mode: PreferenceModePairs, SkipTies: true, ExcludeSkip: true, MinScoreGap: 3.5}.pairs(task)
+	if len(pairs) != 1 || pairs[0].Chosen != "a" || pairs[0].Rejected != "c" {
+		t.Errorf("filtered pairs %+v", pairs)
+	}
+
+	list, ok := DownloadPreferenceReq{Mode: PreferenceModeListwise, RankBy: PreferenceRankByScore, ExcludeSkip: true}.listwise(task)
+	if !ok || len(list.Responses) != 3 || list.Responses[0].Content != "a" || list.Responses[2].Content != "c" {
+		t.Errorf("listwise %+v", list)
+	}
+}
@@ -2,19 +2,16 @@ package service
 
 import (
 	"context"
-	"go-admin/app/labeler/model"
-	"go-admin/common/log"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
 )
 
 func (svc *LabelerService) CreateProject(ctx context.Context, req model.Project) (model.Project, error) {
 	InitObjectID(&req.ID)
-	_, err := svc.CollectionProject.InsertOne(ctx, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if err := svc.StoreProject.Insert(ctx, &req); err != nil {
 		return model.Project{}, err
 	}
 	return req, nil
@@ -26,19 +23,8 @@ type SearchProjectReq struct {
 }
 
 func (svc *LabelerService) SearchProject(ctx context.Context, req SearchProjectReq) ([]model.Project, int, error) {
-	cursor, err := svc.CollectionProject.
-		Find(
-			ctx,
-			bson.M{"folderId": req.FolderID},
-			options.Find().SetSort(bson.D{{"_id", -1}}),
-		)
+	projects, err := svc.StoreProject.SearchByFolder(ctx, req.FolderID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	var projects []model.Project
-	if err := cursor.All(ctx, &projects); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return nil, 0, err
 	}
 	return projects, len(projects), nil
@@ -49,19 +35,11 @@ type ProjectDetailReq struct {
 }
 
 func (svc *LabelerService) ProjectDetail(ctx context.Context, req ProjectDetailReq) (model.Project, error) {
-	var project model.Project
-	err := svc.CollectionProject.FindOne(ctx, bson.D{{"_id", req.ID}}).Decode(&project)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return model.Project{}, err
-	}
-	return project, nil
+	return svc.StoreProject.Get(ctx, req.ID)
 }
 
 func (svc *LabelerService) UpdateProject(ctx context.Context, req model.Project) (model.Project, error) {
-	_, err := svc.CollectionProject.ReplaceOne(ctx, bson.D{{"_id", req.ID}}, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if err := svc.StoreProject.Replace(ctx, req.ID, &req); err != nil {
 		return model.Project{}, err
 	}
 	return req, nil
@@ -76,12 +54,11 @@ type DeleteProjectResp struct {
 }
 
 func (svc *LabelerService) DeleteProject(ctx context.Context, req DeleteProjectReq) (DeleteProjectResp, error) {
-	result, err := svc.CollectionProject.DeleteOne(ctx, bson.D{{"_id", req.ID}})
+	count, err := svc.StoreProject.Delete(ctx, req.ID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return DeleteProjectResp{}, err
 	}
-	return DeleteProjectResp{DeletedCount: result.DeletedCount}, nil
+	return DeleteProjectResp{DeletedCount: count}, nil
 }
 
 type ProjectCountReq struct {
@@ -102,59 +79,9 @@ type ProjectCountResp struct {
 }
 
 func (svc *LabelerService) ProjectCount(ctx context.Context, req ProjectCountReq) (ProjectCountResp, error) {
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				bson.D{{"projectId", req.ID}},
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask.CountByStatus(ctx, notGold(bson.M{"projectId": req.ID}))
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return ProjectCountResp{}, err
-	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return ProjectCountResp{}, err
 	}
-
-	var resp ProjectCountResp
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusAllocate:
-			resp.UnallocatedLabel = count
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		case model.TaskStatusChecking:
-			resp.Checking = count
-		case model.TaskStatusPassed:
-			resp.Passed = count
-		case model.TaskStatusFailed:
-			resp.Failed = count
-		}
-		resp.Total += count
-	}
-	resp.AllocatedCheck = resp.Checking + resp.Passed + resp.Failed
-	resp.UnallocatedCheck = resp.Submit
-	resp.AllocatedLabel = resp.Total - resp.UnallocatedLabel
-	return resp, nil
+	return newProjectCountResp(counts), nil
 }
@@ -5,27 +5,32 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go-admin/app/labeler/model"
-	"go-admin/common/log"
 )
 
 func (svc *LabelerService) CreateProject3(ctx context.Context, req model.Project3) (model.Project3, error) {
+	if err := checkOverlap(req.Overlap); err != nil {
+		return model.Project3{}, err
+	}
+	if err := checkGold(req.Gold); err != nil {
+		return model.Project3{}, err
+	}
 	InitObjectID(&req.ID)
-	_, err := svc.CollectionProject3.InsertOne(ctx, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if err := svc.StoreProject3.Insert(ctx, &req); err != nil {
 		return model.Project3{}, err
 	}
 	return req, nil
 }
 
 func (svc *LabelerService) UpdateProject3(ctx context.Context, req model.Project3) (model.Project3, error) {
-	_, err := svc.CollectionProject3.ReplaceOne(ctx, bson.D{{"_id", req.ID}}, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if err := checkOverlap(req.Overlap); err != nil {
+		return model.Project3{}, err
+	}
+	if err := checkGold(req.Gold); err != nil {
+		return model.Project3{}, err
+	}
+	if err := svc.StoreProject3.Replace(ctx, req.ID, &req); err != nil {
 		return model.Project3{}, err
 	}
 	return req, nil
@@ -40,12 +45,11 @@ type DeleteProject3Resp struct {
 }
 
 func (svc *LabelerService) DeleteProject3(ctx context.Context, req DeleteProject3Req) (DeleteProject3Resp, error) {
-	result, err := svc.CollectionProject3.DeleteOne(ctx, bson.D{{"_id", req.ID}})
+	count, err := svc.StoreProject3.Delete(ctx, req.ID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return DeleteProject3Resp{}, err
 	}
-	return DeleteProject3Resp{DeletedCount: result.DeletedCount}, nil
+	return DeleteProject3Resp{DeletedCount: count}, nil
 }
 
 type SearchProject3Req struct {
@@ -53,19 +57,8 @@ type SearchProject3Req struct {
 }
 
 func (svc *LabelerService) SearchProject3(ctx context.Context, req SearchProject3Req) ([]model.Project3, int, error) {
-	cursor, err := svc.CollectionProject3.
-		Find(
-			ctx,
-			bson.M{"folderId": req.FolderID},
-			options.Find().SetSort(bson.D{{"_id", -1}}),
-		)
+	projects, err := svc.StoreProject3.SearchByFolder(ctx, req.FolderID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	var projects []model.Project3
-	if err := cursor.All(ctx, &projects); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return nil, 0, err
 	}
 	return projects, len(projects), nil
@@ -84,51 +77,16 @@ type Project3CountResp struct {
 }
 
 func (svc *LabelerService) Project3Count(ctx context.Context, req Project3CountReq) (Project3CountResp, error) {
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				bson.D{{"projectId", req.ID}},
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask3.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask3.CountByStatus(ctx, notGold(bson.M{"projectId": req.ID}))
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project3CountResp{}, err
 	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return Project3CountResp{}, err
-	}
-
-	var resp Project3CountResp
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusAllocate:
-			resp.UnallocatedLabel = count
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		}
-		resp.Total += count
-	}
-	resp.AllocatedLabel = resp.Total - resp.UnallocatedLabel
-	return resp, nil
+	resp := newProjectCountResp(counts)
+	return Project3CountResp{
+		Total:            resp.Total,
+		UnallocatedLabel: resp.UnallocatedLabel,
+		AllocatedLabel:   resp.AllocatedLabel,
+		Labeling:         resp.Labeling,
+		Submit:           resp.Submit,
+	}, nil
 }
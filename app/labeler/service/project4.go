@@ -6,32 +6,38 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go-admin/app/labeler/model"
 	"go-admin/common/log"
 )
 
 func (svc *LabelerService) CreateProject4(ctx context.Context, req model.Project4) (model.Project4, error) {
+	if err := checkOverlap(req.Overlap); err != nil {
+		return model.Project4{}, err
+	}
+	if err := checkGold(req.Gold); err != nil {
+		return model.Project4{}, err
+	}
 	InitObjectID(&req.ID)
 	for _, v := range req.Schema.ScoreGroups {
 		if v.Max > 5 {
 			return model.Project4{}, errors.New("分数最大值为5")
 		}
 	}
-	_, err := svc.CollectionProject4.InsertOne(ctx, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if err := svc.StoreProject4.Insert(ctx, &req); err != nil {
 		return model.Project4{}, err
 	}
 	return req, nil
 }
 
 func (svc *LabelerService) UpdateProject4(ctx context.Context, req model.Project4) (model.Project4, error) {
-	_, err := svc.CollectionProject4.ReplaceOne(ctx, bson.D{{"_id", req.ID}}, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if err := checkOverlap(req.Overlap); err != nil {
+		return model.Project4{}, err
+	}
+	if err := checkGold(req.Gold); err != nil {
+		return model.Project4{}, err
+	}
+	if err := svc.StoreProject4.Replace(ctx, req.ID, &req); err != nil {
 		return model.Project4{}, err
 	}
 	return req, nil
@@ -46,12 +52,11 @@ type DeleteProject4Resp struct {
 }
 
 func (svc *LabelerService) DeleteProject4(ctx context.Context, req DeleteProject4Req) (DeleteProject4Resp, error) {
-	result, err := svc.CollectionProject4.DeleteOne(ctx, bson.D{{"_id", req.ID}})
+	count, err := svc.StoreProject4.Delete(ctx, req.ID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return DeleteProject4Resp{}, err
 	}
-	return DeleteProject4Resp{DeletedCount: result.DeletedCount}, nil
+	return DeleteProject4Resp{DeletedCount: count}, nil
 }
 
 type SearchProject4Req struct {
@@ -59,19 +64,8 @@ type SearchProject4Req struct {
 }
 
 func (svc *LabelerService) SearchProject4(ctx context.Context, req SearchProject4Req) ([]model.Project4, int, error) {
-	cursor, err := svc.CollectionProject4.
-		Find(
-			ctx,
-			bson.M{"folderId": req.FolderID},
-			options.Find().SetSort(bson.D{{"_id", -1}}),
-		)
+	projects, err := svc.StoreProject4.SearchByFolder(ctx, req.FolderID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	var projects []model.Project4
-	if err := cursor.All(ctx, &projects); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return nil, 0, err
 	}
 	return projects, len(projects), nil
@@ -81,71 +75,14 @@ type Project4CountReq struct {
 	ID primitive.ObjectID
 }
 
-type Project4CountResp struct {
-	Total            int64 `json:"total"`
-	UnallocatedLabel int64 `json:"unallocatedLabel"`
-	AllocatedLabel   int64 `json:"allocatedLabel"`
-	Labeling         int64 `json:"labeling"`
-	Submit           int64 `json:"submit"`
-	UnallocatedCheck int64 `json:"unallocatedCheck"`
-	AllocatedCheck   int64 `json:"allocatedCheck"`
-	Checking         int64 `json:"checking"`
-	Passed           int64 `json:"passed"`
-	Failed           int64 `json:"failed"`
-}
+type Project4CountResp = ProjectCountResp
 
 func (svc *LabelerService) Project4Count(ctx context.Context, req Project4CountReq) (Project4CountResp, error) {
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				bson.D{{"projectId", req.ID}},
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask4.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask4.CountByStatus(ctx, notGold(bson.M{"projectId": req.ID}))
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project4CountResp{}, err
 	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return Project4CountResp{}, err
-	}
-
-	var resp Project4CountResp
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusAllocate:
-			resp.UnallocatedLabel = count
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		case model.TaskStatusChecking:
-			resp.Checking = count
-		case model.TaskStatusPassed:
-			resp.Passed = count
-		case model.TaskStatusFailed:
-			resp.Failed = count
-		}
-		resp.Total += count
-	}
+	resp := newProjectCountResp(counts)
 	allocatedLabelFilter := bson.M{
 		"projectId": req.ID,
 		"status": bson.M{
@@ -164,20 +101,18 @@ func (svc *LabelerService) Project4Count(ctx context.Context, req Project4CountR
 			"$exists": true,
 		},
 	}
-	count, err := svc.CollectionTask4.CountDocuments(ctx, allocatedLabelFilter)
+	count, err := svc.CollectionTask4.CountDocuments(ctx, notDeleted(allocatedLabelFilter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project4CountResp{}, err
 	}
 	resp.AllocatedLabel = resp.Labeling + count
 
-	count, err = svc.CollectionTask4.CountDocuments(ctx, allocatedCheckFilter)
+	count, err = svc.CollectionTask4.CountDocuments(ctx, notDeleted(allocatedCheckFilter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project4CountResp{}, err
 	}
 	resp.AllocatedCheck = resp.Checking + count
-
-	resp.UnallocatedCheck = resp.Submit
 	return resp, nil
 }
@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"go-admin/app/labeler/model"
@@ -14,18 +16,20 @@ import (
 
 func (svc *LabelerService) CreateProject6(ctx context.Context, req model.Project6) (model.Project6, error) {
 	InitObjectID(&req.ID)
-	_, err := svc.CollectionProject6.InsertOne(ctx, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if _, err := project6Schema(req); err != nil {
+		return model.Project6{}, err
+	}
+	if err := svc.StoreProject6.Insert(ctx, &req); err != nil {
 		return model.Project6{}, err
 	}
 	return req, nil
 }
 
 func (svc *LabelerService) UpdateProject6(ctx context.Context, req model.Project6) (model.Project6, error) {
-	_, err := svc.CollectionProject6.ReplaceOne(ctx, bson.D{{"_id", req.ID}}, &req)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if _, err := project6Schema(req); err != nil {
+		return model.Project6{}, err
+	}
+	if err := svc.StoreProject6.Replace(ctx, req.ID, &req); err != nil {
 		return model.Project6{}, err
 	}
 	return req, nil
@@ -40,12 +44,11 @@ type DeleteProject6Resp struct {
 }
 
 func (svc *LabelerService) DeleteProject6(ctx context.Context, req DeleteProject6Req) (DeleteProject6Resp, error) {
-	result, err := svc.CollectionProject6.DeleteOne(ctx, bson.D{{"_id", req.ID}})
+	count, err := svc.StoreProject6.Delete(ctx, req.ID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return DeleteProject6Resp{}, err
 	}
-	return DeleteProject6Resp{DeletedCount: result.DeletedCount}, nil
+	return DeleteProject6Resp{DeletedCount: count}, nil
 }
 
 type SearchProject6Req struct {
@@ -53,19 +56,8 @@ type SearchProject6Req struct {
 }
 
 func (svc *LabelerService) SearchProject6(ctx context.Context, req SearchProject6Req) ([]model.Project6, int, error) {
-	cursor, err := svc.CollectionProject6.
-		Find(
-			ctx,
-			bson.M{"folderId": req.FolderID},
-			options.Find().SetSort(bson.D{{"_id", -1}}),
-		)
+	projects, err := svc.StoreProject6.SearchByFolder(ctx, req.FolderID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	var projects []model.Project6
-	if err := cursor.All(ctx, &projects); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return nil, 0, err
 	}
 	return projects, len(projects), nil
@@ -75,71 +67,14 @@ type Project6CountReq struct {
 	ID primitive.ObjectID
 }
 
-type Project6CountResp struct {
-	Total            int64 `json:"total"`
-	UnallocatedLabel int64 `json:"unallocatedLabel"`
-	AllocatedLabel   int64 `json:"allocatedLabel"`
-	Labeling         int64 `json:"labeling"`
-	Submit           int64 `json:"submit"`
-	UnallocatedCheck int64 `json:"unallocatedCheck"`
-	AllocatedCheck   int64 `json:"allocatedCheck"`
-	Checking         int64 `json:"checking"`
-	Passed           int64 `json:"passed"`
-	Failed           int64 `json:"failed"`
-}
+type Project6CountResp = ProjectCountResp
 
 func (svc *LabelerService) Project6Count(ctx context.Context, req Project6CountReq) (Project6CountResp, error) {
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				bson.D{{"projectId", req.ID}},
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask6.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask6.CountByStatus(ctx, notGold(bson.M{"projectId": req.ID}))
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return Project6CountResp{}, err
-	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project6CountResp{}, err
 	}
-
-	var resp Project6CountResp
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusAllocate:
-			resp.UnallocatedLabel = count
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		case model.TaskStatusChecking:
-			resp.Checking = count
-		case model.TaskStatusPassed:
-			resp.Passed = count
-		case model.TaskStatusFailed:
-			resp.Failed = count
-		}
-		resp.Total += count
-	}
+	resp := newProjectCountResp(counts)
 	allocatedLabelFilter := bson.M{
 		"projectId": req.ID,
 		"status": bson.M{
@@ -158,20 +93,94 @@ func (svc *LabelerService) Project6Count(ctx context.Context, req Project6CountR
 			"$exists": true,
 		},
 	}
-	count, err := svc.CollectionTask6.CountDocuments(ctx, allocatedLabelFilter)
+	count, err := svc.CollectionTask6.CountDocuments(ctx, notDeleted(allocatedLabelFilter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project6CountResp{}, err
 	}
 	resp.AllocatedLabel = resp.Labeling + count
 
-	count, err = svc.CollectionTask6.CountDocuments(ctx, allocatedCheckFilter)
+	count, err = svc.CollectionTask6.CountDocuments(ctx, notDeleted(allocatedCheckFilter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return Project6CountResp{}, err
 	}
 	resp.AllocatedCheck = resp.Checking + count
+	return resp, nil
+}
+
+// project6Schema 编译项目配置的 JSON Schema，没有配置时返回 nil
+func project6Schema(project model.Project6) (*jsonschema.Schema, error) {
+	if len(project.JSONSchema) == 0 || string(project.JSONSchema) == "null" {
+		return nil, nil
+	}
+	return compileJSONSchema(project.JSONSchema)
+}
+
+type RevalidateProject6Req struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+}
 
-	resp.UnallocatedCheck = resp.Submit
+type Task6SchemaViolation struct {
+	ID     primitive.ObjectID `json:"id"`
+	Name   string             `json:"name"`
+	Status string             `json:"status"`
+	Errors SchemaErrors       `json:"errors"`
+}
+
+type RevalidateProject6Resp struct {
+	Checked    int                    `json:"checked"`
+	Violations []Task6SchemaViolation `json:"violations"`
+}
+
+// RevalidateProject6 按项目当前的 JSON Schema 校验项目下所有任务，返回不符合的任务
+func (svc *LabelerService) RevalidateProject6(ctx context.Context, req RevalidateProject6Req) (RevalidateProject6Resp, error) {
+	project, err := svc.StoreProject6.Get(ctx, req.ProjectID)
+	if err != nil {
+		return RevalidateProject6Resp{}, err
+	}
+	schema, err := project6Schema(project)
+	if err != nil {
+		return RevalidateProject6Resp{}, err
+	}
+	if schema == nil {
+		return RevalidateProject6Resp{}, errors.New("项目没有配置 JSON Schema")
+	}
+	opts := options.Find().SetProjection(bson.M{"name": 1, "status": 1, "rpg": 1})
+	cursor, err := svc.CollectionTask6.Find(ctx, notDeleted(bson.M{"projectId": req.ProjectID}), opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return RevalidateProject6Resp{}, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+	resp := RevalidateProject6Resp{Violations: make([]Task6SchemaViolation, 0)}
+	for cursor.Next(ctx) {
+		var task model.Task6
+		if err := cursor.Decode(&task); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return RevalidateProject6Resp{}, err
+		}
+		resp.Checked++
+		err := validateJSON(schema, task.Rpg)
+		if err == nil {
+			continue
+		}
+		var errs SchemaErrors
+		if !errors.As(err, &errs) {
+			return RevalidateProject6Resp{}, err
+		}
+		resp.Violations = append(resp.Violations, Task6SchemaViolation{
+			ID:     task.ID,
+			Name:   task.Name,
+			Status: task.Status,
+			Errors: errs,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return RevalidateProject6Resp{}, err
+	}
 	return resp, nil
 }
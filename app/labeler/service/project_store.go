@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+)
+
+var ErrProjectNotFound = errors.New("项目不存在")
+
+// ProjectStore 任务类型项目的通用存储，P 为该类型的项目文档
+type ProjectStore[P any] struct {
+	*TaskType
+}
+
+func NewProjectStore[P any](t *TaskType) *ProjectStore[P] {
+	return &ProjectStore[P]{TaskType: t}
+}
+
+func (s *ProjectStore[P]) Insert(ctx context.Context, project *P) error {
+	if _, err := s.Projects.InsertOne(ctx, project); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *ProjectStore[P]) Replace(ctx context.Context, id primitive.ObjectID, project *P) error {
+	if _, err := s.Projects.ReplaceOne(ctx, notDeleted(bson.D{{Key: "_id", Value: id}}), project); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Delete 将项目以及其下的任务移入回收站
+func (s *ProjectStore[P]) Delete(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	return s.deleteProject(ctx, id)
+}
+
+func (s *ProjectStore[P]) Get(ctx context.Context, id primitive.ObjectID) (P, error) {
+	var project P
+	if err := s.Projects.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return project, ErrProjectNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return project, err
+	}
+	return project, nil
+}
+
+// SearchByFolder 查询文件夹下的项目，新建的在前
+func (s *ProjectStore[P]) SearchByFolder(ctx context.Context, folderID primitive.ObjectID) ([]P, error) {
+	cursor, err := s.Projects.Find(
+		ctx,
+		notDeleted(bson.M{"folderId": folderID}),
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}),
+	)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	var projects []P
+	if err := cursor.All(ctx, &projects); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return projects, nil
+}
+
+// newProjectCountResp 由按状态的任务数计算项目进度
+func newProjectCountResp(counts map[string]int64) ProjectCountResp {
+	var resp ProjectCountResp
+	for status, count := range counts {
+		switch status {
+		case model.TaskStatusAllocate:
+			resp.UnallocatedLabel = count
+		case model.TaskStatusLabeling:
+			resp.Labeling = count
+		case model.TaskStatusSubmit:
+			resp.Submit = count
+		case model.TaskStatusChecking:
+			resp.Checking = count
+		case model.TaskStatusPassed:
+			resp.Passed = count
+		case model.TaskStatusFailed:
+			resp.Failed = count
+		}
+		resp.Total += count
+	}
+	resp.AllocatedCheck = resp.Checking + resp.Passed + resp.Failed
+	resp.UnallocatedCheck = resp.Submit
+	resp.AllocatedLabel = resp.Total - resp.UnallocatedLabel
+	return resp
+}
@@ -0,0 +1,572 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+// 质检抽样的分层方式
+const (
+	QAStratifyNone    = ""        // 不分层，所有任务一起抽样
+	QAStratifyLabeler = "labeler" // 按标注员
+	QAStratifyBatch   = "batch"   // 按上传批次，没有批次的旧任务按上传日期
+	QAStratifyLabel   = "label"   // 按 Field 字段的标注值
+)
+
+// qaDefaultLevel 错误率置信区间默认的置信水平
+const qaDefaultLevel = 0.95
+
+var ErrQABatchNotFound = errors.New("质检批次不存在")
+
+type CreateQABatchReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	// Rate 每层的抽样比例，向上取整，每层至少抽一个
+	Rate     float64 `json:"rate"`
+	Stratify string  `json:"stratify"`
+	// Field 按标注值分层时的字段，用 . 分隔，数组用下标，如 output.0.result.tag
+	Field         string `json:"field"`
+	MinPerLabeler int    `json:"minPerLabeler"`
+	// Status 参与抽样的任务状态，为空时抽已提交的任务
+	Status []string `json:"status"`
+}
+
+type CreateQABatchResp = model.QABatch
+
+type AllocateQAReq struct {
+	BatchID   primitive.ObjectID `json:"batchId"`
+	Reviewers []string           `json:"reviewers"`
+	// Number 每个质检员最多分配几个，为 0 时平均分配所有未分配的任务
+	Number int `json:"number"`
+}
+
+type SearchQAItemsReq struct {
+	BatchID string `form:"batchId"`
+	Status  string `form:"status"`
+	dto.Pagination
+}
+
+type QAItemResp struct {
+	model.QAItem `bson:",inline"`
+	LabelerName  string `json:"labelerName"`
+	ReviewerName string `json:"reviewerName"`
+}
+
+type ReviewQAReq struct {
+	ID       primitive.ObjectID `json:"id"`
+	HasError bool               `json:"hasError"`
+	Note     string             `json:"note"`
+}
+
+// QAStratumReport 一层的质检结果，错误率的置信区间为 Wilson 区间
+type QAStratumReport struct {
+	model.QAStratum `bson:",inline"`
+	Reviewed        int64    `json:"reviewed"`
+	Errors          int64    `json:"errors"`
+	ErrorRate       *float64 `json:"errorRate"`
+	Lower           *float64 `json:"lower"`
+	Upper           *float64 `json:"upper"`
+}
+
+// QAReport 质检批次的错误率估计。ErrorRate 为各层错误率按任务数加权，置信区间按分层抽样的方差做正态近似并做有限总体校正；
+// Coverage 为有质检结果的层的任务数占比，没有质检结果的层不参与估计
+type QAReport struct {
+	Batch     model.QABatch     `json:"batch"`
+	Level     float64           `json:"level"`
+	Reviewed  int64             `json:"reviewed"`
+	Errors    int64             `json:"errors"`
+	ErrorRate *float64          `json:"errorRate"`
+	Lower     *float64          `json:"lower"`
+	Upper     *float64          `json:"upper"`
+	Coverage  *float64          `json:"coverage"`
+	Strata    []QAStratumReport `json:"strata"`
+}
+
+func (req CreateQABatchReq) validate() error {
+	if req.Rate <= 0 || req.Rate > 1 {
+		return errors.New("抽样比例必须大于0小于等于1")
+	}
+	switch req.Stratify {
+	case QAStratifyNone, QAStratifyLabeler, QAStratifyBatch:
+	case QAStratifyLabel:
+		if req.Field == "" {
+			return errors.New("按标注值分层时字段不能为空")
+		}
+	default:
+		return fmt.Errorf("不支持的分层方式：%s", req.Stratify)
+	}
+	if req.MinPerLabeler < 0 {
+		return errors.New("每个标注员的最少抽样数不能小于0")
+	}
+	return nil
+}
+
+// qaCandidate 参与抽样的任务
+type qaCandidate struct {
+	ID      primitive.ObjectID
+	Name    string
+	Labeler string
+	Stratum string
+}
+
+// qaStratum 任务所在的层
+func qaStratum(doc bson.Raw, stratify, field string) string {
+	switch stratify {
+	case QAStratifyLabeler:
+		var meta model.TaskMeta
+		_ = bson.Unmarshal(doc, &meta)
+		return meta.Permissions.LabelerID()
+	case QAStratifyBatch:
+		if batch, ok := doc.Lookup("uploadBatch").ObjectIDOK(); ok {
+			return batch.Hex()
+		}
+		id, _ := doc.Lookup("_id").ObjectIDOK()
+		return id.Timestamp().Format("2006-01-02")
+	case QAStratifyLabel:
+		value, err := doc.LookupErr(strings.Split(field, ".")...)
+		if err != nil {
+			return ""
+		}
+		if value.Type == bsontype.String {
+			return value.StringValue()
+		}
+		if v := rawInterface(value); v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// qaSample 打乱后每层抽 rate 比例的任务，再给抽中数不足 minPerLabeler 的标注员补抽。
+// 补抽会使这些标注员在层内的占比偏高，按标注员分层时不受影响
+func qaSample(candidates []qaCandidate, rate float64, minPerLabeler int, rnd *rand.Rand) ([]qaCandidate, []model.QAStratum) {
+	shuffled := append([]qaCandidate(nil), candidates...)
+	rnd.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	population := make(map[string]int64)
+	for _, c := range shuffled {
+		population[c.Stratum]++
+	}
+	quota := make(map[string]int64, len(population))
+	for key, n := range population {
+		quota[key] = int64(math.Ceil(float64(n)*rate - 1e-9))
+	}
+
+	picked := make([]bool, len(shuffled))
+	sampled := make(map[string]int64)
+	perLabeler := make(map[string]int)
+	for i, c := range shuffled {
+		if sampled[c.Stratum] < quota[c.Stratum] {
+			picked[i] = true
+			sampled[c.Stratum]++
+			perLabeler[c.Labeler]++
+		}
+	}
+	if minPerLabeler > 0 {
+		for i, c := range shuffled {
+			if !picked[i] && c.Labeler != "" && perLabeler[c.Labeler] < minPerLabeler {
+				picked[i] = true
+				sampled[c.Stratum]++
+				perLabeler[c.Labeler]++
+			}
+		}
+	}
+
+	res := make([]qaCandidate, 0)
+	for i, c := range shuffled {
+		if picked[i] {
+			res = append(res, c)
+		}
+	}
+	strata := make([]model.QAStratum, 0, len(population))
+	for key, n := range population {
+		strata = append(strata, model.QAStratum{Key: key, Population: n, Sampled: sampled[key]})
+	}
+	sort.Slice(strata, func(i, j int) bool { return strata[i].Key < strata[j].Key })
+	return res, strata
+}
+
+// CreateQABatch 按比例分层抽取任务进入质检队列，已经被抽中过的任务不再参与抽样
+func (svc *LabelerService) CreateQABatch(ctx context.Context, taskType string, req CreateQABatchReq) (CreateQABatchResp, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return CreateQABatchResp{}, err
+	}
+	if err := req.validate(); err != nil {
+		return CreateQABatchResp{}, err
+	}
+	if len(req.Status) == 0 {
+		req.Status = []string{model.TaskStatusSubmit}
+	}
+	if req.Stratify != QAStratifyLabel {
+		req.Field = ""
+	}
+
+	filter := notGold(bson.M{
+		"projectId": req.ProjectID,
+		"status":    bson.M{"$in": req.Status},
+	})
+	reviewed, err := svc.CollectionQAItem.Distinct(ctx, "taskId", bson.M{"taskType": t.Name, "projectId": req.ProjectID})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return CreateQABatchResp{}, err
+	}
+	if len(reviewed) > 0 {
+		filter["_id"] = bson.M{"$nin": reviewed}
+	}
+	projection := bson.M{"_id": 1, "name": 1, "permissions": 1, "uploadBatch": 1}
+	// 数组下标不能用于投影，取整个顶层字段
+	if req.Field != "" {
+		projection[strings.SplitN(req.Field, ".", 2)[0]] = 1
+	}
+	docs, err := findRaw(ctx, t.Tasks, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return CreateQABatchResp{}, err
+	}
+	candidates := make([]qaCandidate, 0, len(docs))
+	for _, doc := range docs {
+		var meta model.TaskMeta
+		if err := bson.Unmarshal(doc, &meta); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return CreateQABatchResp{}, err
+		}
+		candidates = append(candidates, qaCandidate{
+			ID:      meta.ID,
+			Name:    meta.Name,
+			Labeler: meta.Permissions.LabelerID(),
+			Stratum: qaStratum(doc, req.Stratify, req.Field),
+		})
+	}
+	samples, strata := qaSample(candidates, req.Rate, req.MinPerLabeler, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if len(samples) == 0 {
+		return CreateQABatchResp{}, errors.New("没有可以抽样的任务")
+	}
+
+	userID, _ := operator(ctx)
+	now := util.Datetime(time.Now())
+	batch := model.QABatch{
+		ID:            primitive.NewObjectID(),
+		TaskType:      t.Name,
+		ProjectID:     req.ProjectID,
+		Rate:          req.Rate,
+		Stratify:      req.Stratify,
+		Field:         req.Field,
+		MinPerLabeler: req.MinPerLabeler,
+		Status:        req.Status,
+		Population:    int64(len(candidates)),
+		Sampled:       int64(len(samples)),
+		Strata:        strata,
+		Creator:       userID,
+		CreateTime:    now,
+	}
+	items := util.Map(samples, func(v qaCandidate) any {
+		return model.QAItem{
+			ID:         primitive.NewObjectID(),
+			BatchID:    batch.ID,
+			TaskType:   t.Name,
+			ProjectID:  req.ProjectID,
+			TaskID:     v.ID,
+			TaskName:   v.Name,
+			Stratum:    v.Stratum,
+			Labeler:    v.Labeler,
+			Status:     model.QAStatusAllocate,
+			CreateTime: now,
+		}
+	})
+	if _, err := svc.CollectionQABatch.InsertOne(ctx, batch); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return CreateQABatchResp{}, err
+	}
+	if _, err := svc.CollectionQAItem.InsertMany(ctx, items); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return CreateQABatchResp{}, err
+	}
+	return batch, nil
+}
+
+// SearchQABatches 项目的质检批次，新的在前
+func (svc *LabelerService) SearchQABatches(ctx context.Context, taskType string, projectID primitive.ObjectID) ([]model.QABatch, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := svc.CollectionQABatch.Find(ctx, bson.M{"taskType": t.Name, "projectId": projectID}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	res := make([]model.QABatch, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return res, nil
+}
+
+func (svc *LabelerService) findQABatch(ctx context.Context, id primitive.ObjectID) (model.QABatch, error) {
+	var batch model.QABatch
+	if err := svc.CollectionQABatch.FindOne(ctx, bson.M{"_id": id}).Decode(&batch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return batch, ErrQABatchNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return batch, err
+	}
+	return batch, nil
+}
+
+// AllocateQA 把未分配的质检任务轮流分配给质检员，任务不会分配给它的标注员
+func (svc *LabelerService) AllocateQA(ctx context.Context, req AllocateQAReq) (int64, error) {
+	if len(req.Reviewers) == 0 {
+		return 0, errors.New("分配人员数量不能为0")
+	}
+	if req.Number < 0 {
+		return 0, errors.New("分配数量不能小于0")
+	}
+	if _, err := svc.findQABatch(ctx, req.BatchID); err != nil {
+		return 0, err
+	}
+	filter := bson.M{"batchId": req.BatchID, "status": model.QAStatusAllocate}
+	cursor, err := svc.CollectionQAItem.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	var items []model.QAItem
+	if err := cursor.All(ctx, &items); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+
+	var total int64
+	next := 0
+	counts := make(map[string]int, len(req.Reviewers))
+	now := util.Datetime(time.Now())
+	for _, item := range items {
+		reviewer := ""
+		for i := 0; i < len(req.Reviewers); i++ {
+			id := req.Reviewers[(next+i)%len(req.Reviewers)]
+			if id == item.Labeler || (req.Number > 0 && counts[id] >= req.Number) {
+				continue
+			}
+			reviewer = id
+			next = (next + i + 1) % len(req.Reviewers)
+			break
+		}
+		if reviewer == "" {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"reviewer": reviewer, "status": model.QAStatusChecking, "allocateTime": now}}
+		result, err := svc.CollectionQAItem.UpdateOne(ctx, bson.M{"_id": item.ID, "status": model.QAStatusAllocate}, update)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		if result.ModifiedCount > 0 {
+			counts[reviewer]++
+			total++
+		}
+	}
+	return total, nil
+}
+
+// SearchQAItems 质检队列，质检员只能查看分配给自己的任务
+func (svc *LabelerService) SearchQAItems(ctx context.Context, req SearchQAItemsReq) ([]QAItemResp, int, error) {
+	filter := bson.M{}
+	if userID, admin := operator(ctx); !admin {
+		filter["reviewer"] = userID
+	}
+	if req.BatchID != "" {
+		id, err := primitive.ObjectIDFromHex(req.BatchID)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter["batchId"] = id
+	}
+	if req.Status != "" {
+		filter["status"] = req.Status
+	}
+	count, err := svc.CollectionQAItem.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	cursor, err := svc.CollectionQAItem.Find(ctx, filter, pageOptions(req.Pagination).SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	res := make([]QAItemResp, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	users := make([]string, 0, len(res)*2)
+	for _, v := range res {
+		users = append(users, v.Labeler, v.Reviewer)
+	}
+	userMap := svc.userNickNames(ctx, users)
+	for i := range res {
+		res[i].LabelerName = userMap[res[i].Labeler]
+		res[i].ReviewerName = userMap[res[i].Reviewer]
+	}
+	return res, int(count), nil
+}
+
+// ReviewQA 提交质检结果，已质检的任务可以修改结果
+func (svc *LabelerService) ReviewQA(ctx context.Context, req ReviewQAReq) error {
+	filter := bson.M{
+		"_id":    req.ID,
+		"status": bson.M{"$in": []string{model.QAStatusChecking, model.QAStatusDone}},
+	}
+	if userID, admin := operator(ctx); !admin {
+		filter["reviewer"] = userID
+	}
+	update := bson.M{"$set": bson.M{
+		"status":     model.QAStatusDone,
+		"hasError":   req.HasError,
+		"note":       req.Note,
+		"reviewTime": util.Datetime(time.Now()),
+	}}
+	result, err := svc.CollectionQAItem.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("质检任务不存在或没有分配给你")
+	}
+	return nil
+}
+
+// wilson 错误数 e、样本数 n 的 Wilson 置信区间
+func wilson(e, n int64, z float64) (float64, float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	p := float64(e) / float64(n)
+	nf := float64(n)
+	denominator := 1 + z*z/nf
+	center := (p + z*z/(2*nf)) / denominator
+	half := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denominator
+	return math.Max(0, center-half), math.Min(1, center+half)
+}
+
+// qaEstimate 计算各层和整体的错误率，z 为置信水平对应的正态分位数
+func qaEstimate(report *QAReport, z float64) {
+	var covered, total float64
+	for i := range report.Strata {
+		s := &report.Strata[i]
+		total += float64(s.Population)
+		report.Reviewed += s.Reviewed
+		report.Errors += s.Errors
+		if s.Reviewed == 0 {
+			continue
+		}
+		covered += float64(s.Population)
+		s.ErrorRate = ratio(float64(s.Errors) / float64(s.Reviewed))
+		lower, upper := wilson(s.Errors, s.Reviewed, z)
+		s.Lower, s.Upper = ratio(lower), ratio(upper)
+	}
+	if covered == 0 {
+		return
+	}
+	report.Coverage = ratio(covered / total)
+
+	var rate, variance float64
+	census := true
+	for _, s := range report.Strata {
+		if s.Reviewed == 0 {
+			continue
+		}
+		w := float64(s.Population) / covered
+		n := float64(s.Reviewed)
+		p := float64(s.Errors) / n
+		rate += w * p
+		fpc := math.Max(0, 1-n/float64(s.Population))
+		if fpc > 0 {
+			census = false
+		}
+		if s.Reviewed > 1 {
+			variance += w * w * p * (1 - p) / (n - 1) * fpc
+		}
+	}
+	report.ErrorRate = ratio(rate)
+	switch {
+	case census:
+		report.Lower, report.Upper = ratio(rate), ratio(rate)
+	case variance > 0:
+		half := z * math.Sqrt(variance)
+		report.Lower, report.Upper = ratio(math.Max(0, rate-half)), ratio(math.Min(1, rate+half))
+	default:
+		// 各层错误率都为 0 或 1 时方差为 0，用合并后的 Wilson 区间
+		lower, upper := wilson(report.Errors, report.Reviewed, z)
+		report.Lower, report.Upper = ratio(lower), ratio(upper)
+	}
+}
+
+// QAReport 按质检结果估计项目的错误率，level 为置信水平，为 0 时使用 95%
+func (svc *LabelerService) QAReport(ctx context.Context, batchID primitive.ObjectID, level float64) (QAReport, error) {
+	if level == 0 {
+		level = qaDefaultLevel
+	}
+	if level <= 0 || level >= 1 {
+		return QAReport{}, errors.New("置信水平必须大于0小于1")
+	}
+	batch, err := svc.findQABatch(ctx, batchID)
+	if err != nil {
+		return QAReport{}, err
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"batchId": batchID, "status": model.QAStatusDone}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$stratum",
+			"reviewed": bson.M{"$sum": 1},
+			"errors":   bson.M{"$sum": bson.M{"$cond": bson.A{"$hasError", 1, 0}}},
+		}}},
+	}
+	cursor, err := svc.CollectionQAItem.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return QAReport{}, err
+	}
+	var groups []struct {
+		Stratum  string `bson:"_id"`
+		Reviewed int64  `bson:"reviewed"`
+		Errors   int64  `bson:"errors"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return QAReport{}, err
+	}
+	report := QAReport{Batch: batch, Level: level, Strata: make([]QAStratumReport, len(batch.Strata))}
+	index := make(map[string]int, len(batch.Strata))
+	for i, s := range batch.Strata {
+		report.Strata[i] = QAStratumReport{QAStratum: s}
+		index[s.Key] = i
+	}
+	for _, g := range groups {
+		if i, ok := index[g.Stratum]; ok {
+			report.Strata[i].Reviewed = g.Reviewed
+			report.Strata[i].Errors = g.Errors
+		}
+	}
+	qaEstimate(&report, math.Sqrt2*math.Erfinv(level))
+	return report, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"go-admin/app/labeler/model"
+)
+
+func TestQASample(t *testing.T) {
+	var candidates []qaCandidate
+	for i := 0; i < 20; i++ {
+		candidates = append(candidates, qaCandidate{Labeler: "a", Stratum: "x"})
+	}
+	for i := 0; i < 5; i++ {
+		candidates = append(candidates, qaCandidate{Labeler: "b", Stratum: "y"})
+	}
+	candidates = append(candidates, qaCandidate{Labeler: "c", Stratum: "x"})
+
+	samples, strata := qaSample(candidates, 0.1, 0, rand.New(rand.NewSource(1)))
+	if len(strata) != 2 || strata[0].Key != "x" || strata[0].Population != 21 || strata[0].Sampled != 3 || strata[1].Sampled != 1 {
+		t.Fatalf("strata %+v", strata)
+	}
+	if len(samples) != 4 {
+		t.Errorf("samples %d", len(samples))
+	}
+
+	samples, _ = qaSample(candidates, 0.1, 2, rand.New(rand.NewSource(1)))
+	perLabeler := make(map[string]int)
+	for _, s := range samples {
+		perLabeler[s.Labeler]++
+	}
+	if perLabeler["a"] < 2 || perLabeler["b"] < 2 || perLabeler["c"] != 1 {
+		t.Errorf("per labeler %v", perLabeler)
+	}
+}
+
+func TestQAEstimate(t *testing.T) {
+	report := QAReport{Strata: []QAStratumReport{
+		{QAStratum: model.QAStratum{Key: "a", Population: 800}, Reviewed: 80, Errors: 8},
+		{QAStratum: model.QAStratum{Key: "b", Population: 200}, Reviewed: 20, Errors: 6},
+		{QAStratum: model.QAStratum{Key: "c", Population: 100}},
+	}}
+	qaEstimate(&report, 1.96)
+	// (800*0.1 + 200*0.3) / 1000
+	if report.ErrorRate == nil || math.Abs(*report.ErrorRate-0.14) > 1e-9 {
+		t.Fatalf("rate %v", report.ErrorRate)
+	}
+	if *report.Lower >= 0.14 || *report.Upper <= 0.14 || *report.Lower < 0 {
+		t.Errorf("interval %v %v", *report.Lower, *report.Upper)
+	}
+	if math.Abs(*report.Coverage-0.9091) > 1e-9 || report.Reviewed != 100 || report.Errors != 14 {
+		t.Errorf("report %+v", report)
+	}
+	if report.Strata[2].ErrorRate != nil {
+		t.Error("stratum without reviews should have no rate")
+	}
+
+	zero := QAReport{Strata: []QAStratumReport{{QAStratum: model.QAStratum{Population: 100}, Reviewed: 10}}}
+	qaEstimate(&zero, 1.96)
+	if *zero.ErrorRate != 0 || *zero.Lower != 0 || *zero.Upper <= 0 {
+		t.Errorf("zero errors %v %v %v", *zero.ErrorRate, *zero.Lower, *zero.Upper)
+	}
+}
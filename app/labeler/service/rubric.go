@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+func validateRubric(dimensions []model.ScoreDimension) error {
+	if len(dimensions) == 0 {
+		return errors.New("打分模板至少需要一个维度")
+	}
+	keys := make(map[string]bool, len(dimensions))
+	for _, d := range dimensions {
+		if d.Key == "" || d.Label == "" {
+			return errors.New("维度的键和名称不能为空")
+		}
+		if keys[d.Key] {
+			return fmt.Errorf("维度重复：%s", d.Key)
+		}
+		keys[d.Key] = true
+		if d.Min >= d.Max {
+			return fmt.Errorf("维度%s的最低分必须小于最高分", d.Label)
+		}
+		if d.Weight < 0 {
+			return fmt.Errorf("维度%s的权重不能为负数", d.Label)
+		}
+	}
+	return nil
+}
+
+// checkScores 按打分模板校验分数，complete 为 true 时必填的维度都要有分数
+func checkScores(rubric model.ScoreRubric, scores model.Scores, complete bool) error {
+	dimensions := make(map[string]model.ScoreDimension, len(rubric.Dimensions))
+	for _, d := range rubric.Dimensions {
+		dimensions[d.Key] = d
+	}
+	for key, score := range scores {
+		d, ok := dimensions[key]
+		if !ok {
+			return fmt.Errorf("打分模板中没有维度：%s", key)
+		}
+		if score < d.Min || score > d.Max {
+			return fmt.Errorf("%s的分数必须在%d到%d之间", d.Label, d.Min, d.Max)
+		}
+	}
+	if complete {
+		for _, d := range rubric.Dimensions {
+			if _, ok := scores[d.Key]; d.Required && !ok {
+				return fmt.Errorf("未打分：%s", d.Label)
+			}
+		}
+	}
+	return nil
+}
+
+// scoreTotal 按维度权重计算加权总分
+func scoreTotal(rubric model.ScoreRubric, scores model.Scores) float64 {
+	var total float64
+	for _, d := range rubric.Dimensions {
+		total += float64(scores[d.Key]) * d.Weight
+	}
+	return total
+}
+
+type SaveRubric5Req struct {
+	ProjectID  primitive.ObjectID     `json:"projectId"`
+	Dimensions []model.ScoreDimension `json:"dimensions"`
+}
+
+// SaveRubric5 给项目保存新版本的打分模板，已有的打分仍按原来的版本解释
+func (svc *LabelerService) SaveRubric5(ctx context.Context, req SaveRubric5Req) (model.ScoreRubric, error) {
+	if err := validateRubric(req.Dimensions); err != nil {
+		return model.ScoreRubric{}, err
+	}
+	project, err := svc.StoreProject5.Get(ctx, req.ProjectID)
+	if err != nil {
+		return model.ScoreRubric{}, err
+	}
+	rubric := model.ScoreRubric{
+		Version:    project.CurrentRubric().Version + 1,
+		Dimensions: req.Dimensions,
+		CreateTime: util.Datetime(time.Now()),
+	}
+	// 按版本数量做条件，同时保存时只有一个能成功
+	filter := bson.M{"_id": req.ProjectID}
+	filter[fmt.Sprintf("rubrics.%d", len(project.Rubrics))] = bson.M{"$exists": false}
+	result, err := svc.CollectionProject5.UpdateOne(ctx, notDeleted(filter), bson.M{"$push": bson.M{"rubrics": rubric}})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.ScoreRubric{}, err
+	}
+	if result.MatchedCount == 0 {
+		return model.ScoreRubric{}, errors.New("打分模板已被其他人修改，请刷新后重试")
+	}
+	return rubric, nil
+}
+
+// task5Rubric 任务打分使用的模板：已打过分或抽样时指定了版本的按任务上的版本，否则用项目当前的版本
+func (svc *LabelerService) task5Rubric(ctx context.Context, task model.Task5) (model.ScoreRubric, error) {
+	project, err := svc.StoreProject5.Get(ctx, task.ProjectID)
+	if err != nil {
+		return model.ScoreRubric{}, err
+	}
+	if task.ScoreVersion == 0 && !task.HasScore {
+		return project.CurrentRubric(), nil
+	}
+	rubric, ok := project.Rubric(task.ScoreVersion)
+	if !ok {
+		return model.ScoreRubric{}, fmt.Errorf("打分模板版本不存在：%d", task.ScoreVersion)
+	}
+	return rubric, nil
+}
@@ -35,7 +35,7 @@ func (svc *LabelerService) CreateSchema(ctx context.Context, req model.Schema) (
 }
 
 func (svc *LabelerService) UpdateSchema(ctx context.Context, req model.Schema) (model.Schema, error) {
-	if _, err := svc.CollectionSchema.ReplaceOne(ctx, bson.D{{"_id", req.ID}}, &req); err != nil {
+	if _, err := svc.CollectionSchema.ReplaceOne(ctx, bson.D{{Key: "_id", Value: req.ID}}, &req); err != nil {
 		log.Logger().WithContext(ctx).Error("update schema: ", err.Error())
 		return model.Schema{}, ErrDatabase
 	}
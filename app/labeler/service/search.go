@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/common/log"
+)
+
+const (
+	// searchSnippetContext 摘要中匹配内容前后保留的字数
+	searchSnippetContext = 20
+	// searchMaxHighlights 每个任务最多返回的摘要数
+	searchMaxHighlights  = 3
+	searchIndexBatchSize = 200
+)
+
+var ErrSearchUnsupported = errors.New("该任务类型不支持内容搜索")
+
+// Highlight 内容搜索命中的字段和摘要，摘要已转义，匹配的内容用 <em> 标出
+type Highlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+// searchGrams 文本中相邻两个字组成的词，忽略大小写和空白，中文没有分词，用二元组建立索引
+func searchGrams(texts ...string) []string {
+	seen := make(map[string]bool)
+	grams := make([]string, 0)
+	for _, text := range texts {
+		runes := []rune(strings.ToLower(text))
+		for i := 0; i+1 < len(runes); i++ {
+			if unicode.IsSpace(runes[i]) || unicode.IsSpace(runes[i+1]) {
+				continue
+			}
+			gram := string(runes[i : i+2])
+			if !seen[gram] {
+				seen[gram] = true
+				grams = append(grams, gram)
+			}
+		}
+	}
+	sort.Strings(grams)
+	return grams
+}
+
+// lookupStrings 按 . 分隔的路径取出文档中的字符串，路径上的数组逐个展开
+func lookupStrings(doc bson.Raw, path []string) []string {
+	value, err := doc.LookupErr(path[0])
+	if err != nil {
+		return nil
+	}
+	return rawStrings(value, path[1:])
+}
+
+func rawStrings(value bson.RawValue, path []string) []string {
+	if arr, ok := value.ArrayOK(); ok {
+		values, _ := arr.Values()
+		var res []string
+		for _, v := range values {
+			res = append(res, rawStrings(v, path)...)
+		}
+		return res
+	}
+	if len(path) == 0 {
+		if s, ok := value.StringValueOK(); ok {
+			return []string{s}
+		}
+		return nil
+	}
+	if doc, ok := value.DocumentOK(); ok {
+		return lookupStrings(doc, path)
+	}
+	return nil
+}
+
+// searchTexts 任务中参与内容搜索的字段的文本，按字段返回
+func (t *TaskType) searchTexts(doc bson.Raw) map[string][]string {
+	res := make(map[string][]string, len(t.SearchFields))
+	for _, field := range t.SearchFields {
+		res[field] = lookupStrings(doc, strings.Split(field, "."))
+	}
+	return res
+}
+
+func (t *TaskType) docSearchGrams(doc bson.Raw) []string {
+	var texts []string
+	for _, field := range t.SearchFields {
+		texts = append(texts, lookupStrings(doc, strings.Split(field, "."))...)
+	}
+	return searchGrams(texts...)
+}
+
+// withSearchGrams 插入任务前写入 searchGrams，不支持内容搜索的类型原样返回
+func (t *TaskType) withSearchGrams(doc any) any {
+	if len(t.SearchFields) == 0 {
+		return doc
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return doc
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return doc
+	}
+	return append(d, bson.E{Key: "searchGrams", Value: t.docSearchGrams(raw)})
+}
+
+// refreshSearchGrams 任务修改后重新计算 searchGrams，内容没有变化时不更新
+func (t *TaskType) refreshSearchGrams(ctx context.Context, doc bson.Raw) error {
+	if len(t.SearchFields) == 0 {
+		return nil
+	}
+	grams := t.docSearchGrams(doc)
+	var old []string
+	if value, err := doc.LookupErr("searchGrams"); err == nil {
+		_ = value.Unmarshal(&old)
+	}
+	if old != nil && strings.Join(old, "\x00") == strings.Join(grams, "\x00") {
+		return nil
+	}
+	id := doc.Lookup("_id").ObjectID()
+	if _, err := t.Tasks.UpdateByID(ctx, id, bson.M{"$set": bson.M{"searchGrams": grams}}); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// contentFilter 内容搜索的条件，先用 searchGrams 索引缩小范围，再用正则匹配连续的内容
+func (t *TaskType) contentFilter(content string) (bson.M, error) {
+	if len(t.SearchFields) == 0 {
+		return nil, ErrSearchUnsupported
+	}
+	pattern := primitive.Regex{Pattern: regexp.QuoteMeta(content), Options: "i"}
+	or := make(bson.A, len(t.SearchFields))
+	for i, field := range t.SearchFields {
+		or[i] = bson.M{field: pattern}
+	}
+	filter := bson.M{"$or": or}
+	if grams := searchGrams(content); len(grams) > 0 {
+		filter["searchGrams"] = bson.M{"$all": grams}
+	}
+	return filter, nil
+}
+
+// withContent 在查询条件上增加内容搜索，content 为空时不做任何事
+func (t *TaskType) withContent(filter bson.M, content string) error {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil
+	}
+	cf, err := t.contentFilter(content)
+	if err != nil {
+		return err
+	}
+	filter["$and"] = bson.A{cf}
+	return nil
+}
+
+// highlights 任务中匹配 content 的字段和摘要
+func (t *TaskType) highlights(task any, content string) []Highlight {
+	content = strings.TrimSpace(content)
+	if content == "" || len(t.SearchFields) == 0 {
+		return nil
+	}
+	raw, err := bson.Marshal(task)
+	if err != nil {
+		return nil
+	}
+	texts := t.searchTexts(raw)
+	var res []Highlight
+	for _, field := range t.SearchFields {
+		for _, text := range texts[field] {
+			if snippet, ok := highlightSnippet(text, content, searchSnippetContext); ok {
+				res = append(res, Highlight{Field: field, Snippet: snippet})
+				if len(res) == searchMaxHighlights {
+					return res
+				}
+			}
+		}
+	}
+	return res
+}
+
+// highlightSnippet 截取第一处匹配前后 width 个字作为摘要，摘要内的匹配都用 <em> 标出，忽略大小写
+func highlightSnippet(text, query string, width int) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	q := []rune(strings.ToLower(query))
+	index := func(from int) int {
+		for i := from; i+len(q) <= len(lower); i++ {
+			if string(lower[i:i+len(q)]) == string(q) {
+				return i
+			}
+		}
+		return -1
+	}
+	first := index(0)
+	if first < 0 {
+		return "", false
+	}
+	start, end := first-width, first+len(q)+width
+	if start < 0 {
+		start = 0
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for pos := start; pos < end; {
+		i := index(pos)
+		if i < 0 || i+len(q) > end {
+			b.WriteString(html.EscapeString(string(runes[pos:end])))
+			break
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:i])))
+		b.WriteString("<em>" + html.EscapeString(string(runes[i:i+len(q)])) + "</em>")
+		pos = i + len(q)
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// BackfillSearchGrams 为集合中没有 searchGrams 的任务（升级前的数据）按 fields 建立内容搜索索引，由 Mongo 迁移调用
+func BackfillSearchGrams(ctx context.Context, collection *mongo.Collection, fields []string) (int, error) {
+	t := &TaskType{Tasks: collection, SearchFields: fields}
+	return t.indexSearchGrams(ctx)
+}
+
+func (t *TaskType) indexSearchGrams(ctx context.Context) (int, error) {
+	if len(t.SearchFields) == 0 {
+		return 0, nil
+	}
+	projection := bson.M{"_id": 1}
+	for _, field := range t.SearchFields {
+		projection[field] = 1
+	}
+	count := 0
+	for {
+		opts := options.Find().SetProjection(projection).SetLimit(searchIndexBatchSize)
+		cursor, err := t.Tasks.Find(ctx, bson.M{"searchGrams": bson.M{"$exists": false}}, opts)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return count, err
+		}
+		var docs []bson.Raw
+		if err := cursor.All(ctx, &docs); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return count, err
+		}
+		for _, doc := range docs {
+			update := bson.M{"$set": bson.M{"searchGrams": t.docSearchGrams(doc)}}
+			if _, err := t.Tasks.UpdateByID(ctx, doc.Lookup("_id").ObjectID(), update); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return count, err
+			}
+		}
+		count += len(docs)
+		if len(docs) < searchIndexBatchSize {
+			return count, nil
+		}
+	}
+}
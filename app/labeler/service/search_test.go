@@ -0,0 +1,33 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchGrams(t *testing.T) {
+	got := searchGrams("退款申请", "Ab c")
+	want := []string{"ab", "款申", "申请", "退款"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	cases := []struct {
+		text, query string
+		width       int
+		want        string
+		ok          bool
+	}{
+		{"我想申请退款，退款到账要多久", "退款", 3, "…想申请<em>退款</em>，<em>退款</em>…", true},
+		{"Refund <now>", "refund", 3, "<em>Refund</em> &lt;n…", true},
+		{"没有匹配", "退款", 2, "", false},
+	}
+	for _, c := range cases {
+		got, ok := highlightSnippet(c.text, c.query, c.width)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%q %q: want %q %v got %q %v", c.text, c.query, c.want, c.ok, got, ok)
+		}
+	}
+}
@@ -2,11 +2,14 @@ package service
 
 import (
 	"errors"
+	"time"
 
+	"github.com/minio/minio-go/v7"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"gorm.io/gorm"
 
+	"go-admin/app/labeler/model"
 	ext "go-admin/config"
 )
 
@@ -17,37 +20,82 @@ var (
 )
 
 type LabelerService struct {
-	MongodbClient          *mongo.Client
-	MongodbDB              *mongo.Database
-	CollectionProject      *mongo.Collection
-	CollectionFolder       *mongo.Collection
-	CollectionSchema       *mongo.Collection
-	CollectionTask         *mongo.Collection
-	CollectionProject2     *mongo.Collection
-	CollectionTask2        *mongo.Collection
-	CollectionFolder2      *mongo.Collection
-	CollectionTask3        *mongo.Collection
-	CollectionProject3     *mongo.Collection
-	CollectionFolder3      *mongo.Collection
-	CollectionTask4        *mongo.Collection
-	CollectionProject4     *mongo.Collection
-	CollectionFolder4      *mongo.Collection
-	CollectionTask5        *mongo.Collection
-	CollectionLabeledTask5 *mongo.Collection
-	CollectionProject5     *mongo.Collection
-	CollectionFolder5      *mongo.Collection
-	CollectionTask6        *mongo.Collection
-	CollectionProject6     *mongo.Collection
-	CollectionFolder6      *mongo.Collection
-	GormDB                 *gorm.DB
+	MongodbClient               *mongo.Client
+	MongodbDB                   *mongo.Database
+	CollectionProject           *mongo.Collection
+	CollectionFolder            *mongo.Collection
+	CollectionSchema            *mongo.Collection
+	CollectionTask              *mongo.Collection
+	CollectionProject2          *mongo.Collection
+	CollectionTask2             *mongo.Collection
+	CollectionFolder2           *mongo.Collection
+	CollectionTask3             *mongo.Collection
+	CollectionProject3          *mongo.Collection
+	CollectionFolder3           *mongo.Collection
+	CollectionTask4             *mongo.Collection
+	CollectionProject4          *mongo.Collection
+	CollectionFolder4           *mongo.Collection
+	CollectionTask5             *mongo.Collection
+	CollectionLabeledTask5      *mongo.Collection
+	CollectionProject5          *mongo.Collection
+	CollectionFolder5           *mongo.Collection
+	CollectionTask6             *mongo.Collection
+	CollectionProject6          *mongo.Collection
+	CollectionFolder6           *mongo.Collection
+	CollectionWorkflow          *mongo.Collection
+	CollectionTaskTransition    *mongo.Collection
+	CollectionTaskActivity      *mongo.Collection
+	CollectionExportJob         *mongo.Collection
+	CollectionTrash             *mongo.Collection
+	CollectionPreAnnotateJob    *mongo.Collection
+	CollectionSubmission        *mongo.Collection
+	CollectionGoldResult        *mongo.Collection
+	CollectionAllocationSetting *mongo.Collection
+	CollectionTaskComment       *mongo.Collection
+	CollectionTaskSnapshot      *mongo.Collection
+	CollectionQABatch           *mongo.Collection
+	CollectionQAItem            *mongo.Collection
+	GormDB                      *gorm.DB
+	MinIOClient                 *minio.Client
+
+	TaskTypes  map[string]*TaskType
+	StoreTask  *TaskStore[model.Task]
+	StoreTask2 *TaskStore[model.Task2]
+	StoreTask3 *TaskStore[model.Task3]
+	StoreTask4 *TaskStore[model.Task4]
+	StoreTask5 *TaskStore[model.Task5]
+	StoreTask6 *TaskStore[model.Task6]
+
+	StoreProject  *ProjectStore[model.Project]
+	StoreProject2 *ProjectStore[model.Project2]
+	StoreProject3 *ProjectStore[model.Project3]
+	StoreProject4 *ProjectStore[model.Project4]
+	StoreProject5 *ProjectStore[model.Project5]
+	StoreProject6 *ProjectStore[model.Project6]
+
+	// Exporters 后台导出的类型
+	Exporters map[string]ExportFunc
+	// ModelClient 预标注和解析使用的模型，没有配置模型服务时为 nil
+	ModelClient ModelClient
+	// PreAnnotators 支持预标注的任务类型
+	PreAnnotators map[string]PreAnnotateFunc
+	// Overlaps 支持多人标注的任务类型
+	Overlaps map[string]overlapper
+	// TaskLease t5 领取的对话的租约时长
+	TaskLease time.Duration
 }
 
-func NewLabelerService(mongodbClient *mongo.Client, gormDB *gorm.DB) *LabelerService {
+func NewLabelerService(mongodbClient *mongo.Client, gormDB *gorm.DB, minioClient *minio.Client) *LabelerService {
 	cfg := ext.ExtConfig.Mongodb
 	svc := &LabelerService{
 		MongodbClient: mongodbClient,
 		MongodbDB:     mongodbClient.Database(cfg.LabelerDB),
 		GormDB:        gormDB,
+		MinIOClient:   minioClient,
+		TaskLease:     DefaultTaskLease,
+	}
+	if ext.ExtConfig.TaskLeaseMinutes > 0 {
+		svc.TaskLease = time.Duration(ext.ExtConfig.TaskLeaseMinutes) * time.Minute
 	}
 	svc.CollectionProject = svc.MongodbDB.Collection("project")
 	svc.CollectionFolder = svc.MongodbDB.Collection("folder")
@@ -69,6 +117,85 @@ func NewLabelerService(mongodbClient *mongo.Client, gormDB *gorm.DB) *LabelerSer
 	svc.CollectionTask6 = svc.MongodbDB.Collection("task6")
 	svc.CollectionProject6 = svc.MongodbDB.Collection("project6")
 	svc.CollectionFolder6 = svc.MongodbDB.Collection("folder6")
+	svc.CollectionWorkflow = svc.MongodbDB.Collection("workflow")
+	svc.CollectionTaskTransition = svc.MongodbDB.Collection("task_transition")
+	svc.CollectionTaskActivity = svc.MongodbDB.Collection("task_activity")
+	svc.CollectionExportJob = svc.MongodbDB.Collection("export_job")
+	svc.CollectionTrash = svc.MongodbDB.Collection("trash")
+	svc.CollectionPreAnnotateJob = svc.MongodbDB.Collection("pre_annotate_job")
+	svc.CollectionSubmission = svc.MongodbDB.Collection("task_submission")
+	svc.CollectionGoldResult = svc.MongodbDB.Collection("gold_result")
+	svc.CollectionAllocationSetting = svc.MongodbDB.Collection("allocation_setting")
+	svc.CollectionTaskComment = svc.MongodbDB.Collection("task_comment")
+	svc.CollectionTaskSnapshot = svc.MongodbDB.Collection("task_snapshot")
+	svc.CollectionQABatch = svc.MongodbDB.Collection("qa_batch")
+	svc.CollectionQAItem = svc.MongodbDB.Collection("qa_item")
+
+	svc.StoreTask = NewTaskStore[model.Task](svc.registerTaskType(&TaskType{
+		Name:              "t",
+		Tasks:             svc.CollectionTask,
+		Projects:          svc.CollectionProject,
+		Folders:           svc.CollectionFolder,
+		ResetMatchChecker: true,
+		DefaultWorkflow:   workflowFromRoleMaps(Labeler, Checker, taskAdminStatusMap),
+		SearchFields:      []string{"contents.raw.groups.entities.sentences.text"},
+	}))
+	svc.StoreTask2 = NewTaskStore[model.Task2](svc.registerTaskType(&TaskType{
+		Name:              "t2",
+		Tasks:             svc.CollectionTask2,
+		Projects:          svc.CollectionProject2,
+		Folders:           svc.CollectionFolder2,
+		ResetMatchChecker: true,
+		DefaultWorkflow:   task2Workflow,
+		SearchFields:      []string{"contents.value"},
+	}))
+	svc.StoreTask3 = NewTaskStore[model.Task3](svc.registerTaskType(&TaskType{
+		Name:     "t3",
+		Tasks:    svc.CollectionTask3,
+		Projects: svc.CollectionProject3,
+		Folders:  svc.CollectionFolder3,
+		// t3 不限制状态流转
+		DefaultWorkflow: task3Workflow,
+		SearchFields:    []string{"command.content"},
+	}))
+	svc.StoreTask4 = NewTaskStore[model.Task4](svc.registerTaskType(&TaskType{
+		Name:            "t4",
+		Tasks:           svc.CollectionTask4,
+		Projects:        svc.CollectionProject4,
+		Folders:         svc.CollectionFolder4,
+		DefaultWorkflow: task4Workflow,
+		SearchFields:    []string{"text"},
+	}))
+	// task5 中是待领取的对话，领取后复制到 labeledtask5 进行标注和审核
+	svc.StoreTask5 = NewTaskStore[model.Task5](svc.registerTaskType(&TaskType{
+		Name:            "t5",
+		Tasks:           svc.CollectionLabeledTask5,
+		Pool:            svc.CollectionTask5,
+		Projects:        svc.CollectionProject5,
+		Folders:         svc.CollectionFolder5,
+		DefaultWorkflow: task5Workflow,
+		SearchFields:    []string{"dialog.userContent", "dialog.botResponse"},
+	}))
+	svc.StoreTask6 = NewTaskStore[model.Task6](svc.registerTaskType(&TaskType{
+		Name:            "t6",
+		Tasks:           svc.CollectionTask6,
+		Projects:        svc.CollectionProject6,
+		Folders:         svc.CollectionFolder6,
+		DefaultWorkflow: task6Workflow,
+		// rpg 压缩后保存，不能按内容查询，只搜索任务名称和文件名
+		SearchFields: []string{"name", "fullName"},
+	}))
+	svc.StoreProject = NewProjectStore[model.Project](svc.TaskTypes["t"])
+	svc.StoreProject2 = NewProjectStore[model.Project2](svc.TaskTypes["t2"])
+	svc.StoreProject3 = NewProjectStore[model.Project3](svc.TaskTypes["t3"])
+	svc.StoreProject4 = NewProjectStore[model.Project4](svc.TaskTypes["t4"])
+	svc.StoreProject5 = NewProjectStore[model.Project5](svc.TaskTypes["t5"])
+	svc.StoreProject6 = NewProjectStore[model.Project6](svc.TaskTypes["t6"])
+	svc.registerExporters()
+	svc.ModelClient = newModelClient(ext.ExtConfig.ModelServerURL, ext.ExtConfig.ModelStub)
+	svc.registerPreAnnotators()
+	svc.registerOverlaps()
+	svc.registerGolds()
 	return svc
 }
 
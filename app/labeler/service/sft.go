@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+)
+
+const ExportTypeTask5SFT = "t5sft"
+
+type DownloadTask5SFTReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Status    []string           `json:"status"`
+	// Version 对话的 Ubot 版本，为空时不限制
+	Version []int `json:"version"`
+	// MinScore 加权总分不低于该值的对话才导出，为 0 时不限制，设置后没有打分的对话不导出
+	MinScore float64 `json:"minScore"`
+	// SystemPrompt 不为空时作为每条数据的第一条 system 消息
+	SystemPrompt string `json:"systemPrompt"`
+	// WithActions 在 metadata 中附带每轮的动作标签
+	WithActions bool `json:"withActions"`
+	// WithScores 在 metadata 中附带打分
+	WithScores bool `json:"withScores"`
+}
+
+type DownloadTask5SFTResp = model.ExportJob
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// SFTTurn 一轮对话的标注信息，Edited 表示回复使用了标注员修改后的内容
+type SFTTurn struct {
+	TurnID  int            `json:"turnId"`
+	Edited  bool           `json:"edited"`
+	Actions []model.Action `json:"actions,omitempty"`
+}
+
+type SFTMetadata struct {
+	TaskID       primitive.ObjectID `json:"taskId"`
+	Name         string             `json:"name"`
+	SessionID    string             `json:"sessionId"`
+	Version      int                `json:"version"`
+	Turns        []SFTTurn          `json:"turns,omitempty"`
+	Score        model.Scores       `json:"score,omitempty"`
+	ScoreVersion *int               `json:"scoreVersion,omitempty"`
+	ScoreTotal   *float64           `json:"scoreTotal,omitempty"`
+}
+
+// SFTRecord OpenAI 微调格式的一条数据
+type SFTRecord struct {
+	Messages []ChatMessage `json:"messages"`
+	Metadata SFTMetadata   `json:"metadata"`
+}
+
+// DownloadTask5SFT 创建后台导出，把对话导出为 messages 格式的 JSONL，回复优先使用标注员修改后的内容
+func (svc *LabelerService) DownloadTask5SFT(ctx context.Context, req DownloadTask5SFTReq) (DownloadTask5SFTResp, error) {
+	return svc.CreateExport(ctx, ExportTypeTask5SFT, req)
+}
+
+func (svc *LabelerService) exportTask5SFT(ctx context.Context, req DownloadTask5SFTReq) (ExportPlan, error) {
+	project, err := svc.StoreProject5.Get(ctx, req.ProjectID)
+	if err != nil {
+		return ExportPlan{}, err
+	}
+	// 金标准的副本和原对话内容相同，不重复导出
+	filter := bson.M{
+		"projectId": req.ProjectID,
+		"status": bson.M{
+			"$in": req.Status,
+		},
+		"goldSource": bson.M{"$exists": false},
+	}
+	if len(req.Version) > 0 {
+		filter["dialog.0.version"] = bson.M{"$in": req.Version}
+	}
+	if req.MinScore > 0 {
+		filter["hasScore"] = true
+	}
+	total, err := svc.CollectionLabeledTask5.CountDocuments(ctx, notDeleted(filter))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return ExportPlan{}, err
+	}
+	return ExportPlan{
+		FileName: time.Now().Format("2006-01-02 15-04-05") + "对话微调数据.jsonl",
+		Total:    total,
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			cursor, err := svc.CollectionLabeledTask5.Find(ctx, notDeleted(filter))
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			defer func() {
+				_ = cursor.Close(ctx)
+			}()
+			out := bufio.NewWriter(w)
+			for cursor.Next(ctx) {
+				var task model.Task5
+				if err := cursor.Decode(&task); err != nil {
+					log.Logger().WithContext(ctx).Error(err.Error())
+					return err
+				}
+				progress()
+				rubric, _ := project.Rubric(task.ScoreVersion)
+				total := scoreTotal(rubric, task.Score)
+				if req.MinScore > 0 && total < req.MinScore {
+					continue
+				}
+				record, ok := req.record(task)
+				if !ok {
+					continue
+				}
+				if req.WithScores && task.HasScore {
+					record.Metadata.Score = task.Score
+					record.Metadata.ScoreVersion = &task.ScoreVersion
+					record.Metadata.ScoreTotal = &total
+				}
+				if err := writeJSONLine(out, record); err != nil {
+					return err
+				}
+			}
+			if err := cursor.Err(); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			return out.Flush()
+		},
+	}, nil
+}
+
+// record 每轮对话生成 user 和 assistant 消息，没有回复的对话不导出
+func (req DownloadTask5SFTReq) record(task model.Task5) (SFTRecord, bool) {
+	record := SFTRecord{Metadata: SFTMetadata{TaskID: task.ID, Name: task.Name, SessionID: task.SessionID}}
+	if len(task.Dialog) > 0 {
+		record.Metadata.Version = task.Dialog[0].Version
+		if record.Metadata.SessionID == "" {
+			record.Metadata.SessionID = task.Dialog[0].SessionID
+		}
+	}
+	if req.SystemPrompt != "" {
+		record.Messages = append(record.Messages, ChatMessage{Role: "system", Content: req.SystemPrompt})
+	}
+	replies := 0
+	for _, turn := range task.Dialog {
+		if turn.UserContent != "" {
+			record.Messages = append(record.Messages, ChatMessage{Role: "user", Content: turn.UserContent})
+		}
+		reply, edited := assistantReply(turn)
+		if reply == "" {
+			continue
+		}
+		replies++
+		record.Messages = append(record.Messages, ChatMessage{Role: "assistant", Content: reply})
+		t := SFTTurn{TurnID: turn.TurnID, Edited: edited}
+		if req.WithActions {
+			t.Actions = turn.Actions
+			if edited && len(turn.NewAction) > 0 {
+				t.Actions = turn.NewAction
+			}
+		}
+		record.Metadata.Turns = append(record.Metadata.Turns, t)
+	}
+	return record, replies > 0
+}
+
+// assistantReply 标注员修改过的回复用 NewOutputs，否则用模型的输出，都没有时用线上的回复
+func assistantReply(turn model.ContentText) (string, bool) {
+	if reply := joinOutputs(turn.NewOutputs); reply != "" {
+		return reply, true
+	}
+	if reply := joinOutputs(turn.ModelOutputs); reply != "" {
+		return reply, false
+	}
+	return turn.BotResponse, false
+}
+
+func joinOutputs(outputs []model.ModelOutput) string {
+	contents := make([]string, 0, len(outputs))
+	for _, o := range outputs {
+		if c := strings.TrimSpace(o.Content); c != "" {
+			contents = append(contents, c)
+		}
+	}
+	return strings.Join(contents, "\n")
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"go-admin/app/labeler/model"
+)
+
+func TestSFTRecord(t *testing.T) {
+	task := model.Task5{Dialog: []model.ContentText{
+		{
+			TurnID:       1,
+			UserContent:  "你好",
+			ModelOutputs: []model.ModelOutput{{Content: "你好，有什么可以帮你"}},
+			Actions:      []model.Action{{ActionName: "问候"}},
+		},
+		{
+			TurnID:       2,
+			UserContent:  "我想退款",
+			ModelOutputs: []model.ModelOutput{{Content: "不行"}},
+			NewOutputs:   []model.ModelOutput{{Content: "好的"}, {Content: "请提供订单号"}},
+			Actions:      []model.Action{{ActionName: "拒绝"}},
+			NewAction:    []model.Action{{ActionName: "询问订单"}},
+		},
+	}}
+	record, ok := DownloadTask5SFTReq{SystemPrompt: "sys", WithActions: true}.record(task)
+	if !ok {
+		t.Fatal("want record")
+	}
+	want := []ChatMessage{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "你好"},
+		{Role: "assistant", Content: "你好，有什么可以帮你"},
+		{Role: "user", Content: "我想退款"},
+		{Role: "assistant", Content: "好的\n请提供订单号"},
+	}
+	if !reflect.DeepEqual(record.Messages, want) {
+		t.Errorf("messages %+v", record.Messages)
+	}
+	turns := record.Metadata.Turns
+	if len(turns) != 2 || turns[0].Edited || !turns[1].Edited || turns[1].Actions[0].ActionName != "询问订单" {
+		t.Errorf("turns %+v", turns)
+	}
+
+	if _, ok := (DownloadTask5SFTReq{}).record(model.Task5{Dialog: []model.ContentText{{UserContent: "hi"}}}); ok {
+		t.Error("dialog without reply should be skipped")
+	}
+}
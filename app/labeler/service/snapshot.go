@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+var ErrSnapshotNotFound = errors.New("快照不存在")
+
+// 快照差异的类型
+const (
+	SnapshotChangeAdded    = "added"
+	SnapshotChangeRemoved  = "removed"
+	SnapshotChangeModified = "modified"
+)
+
+// workflowFields 流程写入的字段，比较快照时默认不返回
+var workflowFields = map[string]bool{
+	"status":          true,
+	"permissions":     true,
+	"submittedTime":   true,
+	"approvedTime":    true,
+	"unsanctionTime":  true,
+	"leaseExpireTime": true,
+}
+
+// snapshotAction 提交、审核和裁决后记录快照
+func snapshotAction(action string) bool {
+	switch action {
+	case model.ActivitySubmit, model.ActivityPass, model.ActivityFail, model.ActivityAdjudicate:
+		return true
+	}
+	return false
+}
+
+// snapshotDocument 去掉不需要比较的字段
+func snapshotDocument(doc bson.Raw) (bson.Raw, error) {
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	res := make(bson.D, 0, len(d))
+	for _, e := range d {
+		if e.Key != "searchGrams" {
+			res = append(res, e)
+		}
+	}
+	return bson.Marshal(res)
+}
+
+// recordSnapshot 动态需要快照时保存修改后的任务
+func (t *TaskType) recordSnapshot(ctx context.Context, activity model.TaskActivity, after bson.Raw) error {
+	if !snapshotAction(activity.Action) {
+		return nil
+	}
+	var meta model.TaskMeta
+	if err := bson.Unmarshal(after, &meta); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	doc, err := snapshotDocument(after)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	snapshot := model.TaskSnapshot{
+		ID:         primitive.NewObjectID(),
+		TaskType:   t.Name,
+		ProjectID:  meta.ProjectID,
+		TaskID:     meta.ID,
+		ActivityID: activity.ID,
+		Activity:   activity.Activity,
+		Version:    meta.Version,
+		Status:     meta.Status,
+		Document:   doc,
+		CreateTime: util.Datetime(time.Now()),
+	}
+	if _, err := t.Snapshots.InsertOne(ctx, snapshot); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+type SnapshotResp = model.TaskSnapshot
+
+// SnapshotDetailResp 快照和其中的任务文档
+type SnapshotDetailResp struct {
+	SnapshotResp
+	Document bson.M `json:"document"`
+}
+
+type SnapshotDiffReq struct {
+	From primitive.ObjectID
+	// To 为空时和任务当前的内容比较
+	To primitive.ObjectID
+	// All 同时返回状态、人员等流程字段的差异
+	All bool
+}
+
+// SnapshotChange 一个字段的差异，Field 用 . 分隔，数组用下标
+type SnapshotChange struct {
+	Field string      `json:"field"`
+	Kind  string      `json:"kind"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// SnapshotDiffResp To 为空表示和任务当前的内容比较
+type SnapshotDiffResp struct {
+	From    SnapshotResp     `json:"from"`
+	To      *SnapshotResp    `json:"to"`
+	Changes []SnapshotChange `json:"changes"`
+}
+
+// snapshotChanges 比较两个任务文档，all 为 false 时不返回流程字段
+func snapshotChanges(a, b bson.Raw, all bool) []SnapshotChange {
+	res := make([]SnapshotChange, 0)
+	for _, c := range diffDocument("", a, b) {
+		if !all && workflowFields[strings.SplitN(c.Field, ".", 2)[0]] {
+			continue
+		}
+		kind := SnapshotChangeModified
+		switch {
+		case c.Old == nil:
+			kind = SnapshotChangeAdded
+		case c.New == nil:
+			kind = SnapshotChangeRemoved
+		}
+		res = append(res, SnapshotChange{Field: c.Field, Kind: kind, Old: c.Old, New: c.New})
+	}
+	return res
+}
+
+func (svc *LabelerService) findSnapshot(ctx context.Context, id primitive.ObjectID) (model.TaskSnapshot, error) {
+	var snapshot model.TaskSnapshot
+	if err := svc.CollectionTaskSnapshot.FindOne(ctx, bson.M{"_id": id}).Decode(&snapshot); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return snapshot, ErrSnapshotNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// TaskSnapshots 任务的快照，按时间顺序，不包含任务文档
+func (svc *LabelerService) TaskSnapshots(ctx context.Context, taskID primitive.ObjectID) ([]SnapshotResp, error) {
+	if err := svc.checkTaskViewer(ctx, "", taskID); err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetProjection(bson.M{"document": 0})
+	cursor, err := svc.CollectionTaskSnapshot.Find(ctx, bson.M{"taskId": taskID}, opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	res := make([]SnapshotResp, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	userMap := svc.userNickNames(ctx, util.Map(res, func(v SnapshotResp) string { return v.User }))
+	for i := range res {
+		res[i].NickName = userMap[res[i].User]
+	}
+	return res, nil
+}
+
+// GetSnapshot 快照和其中的任务文档
+func (svc *LabelerService) GetSnapshot(ctx context.Context, id primitive.ObjectID) (SnapshotDetailResp, error) {
+	snapshot, err := svc.findSnapshot(ctx, id)
+	if err != nil {
+		return SnapshotDetailResp{}, err
+	}
+	if err := svc.checkTaskViewer(ctx, snapshot.TaskType, snapshot.TaskID); err != nil {
+		return SnapshotDetailResp{}, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(snapshot.Document, &doc); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return SnapshotDetailResp{}, err
+	}
+	snapshot.NickName = svc.userNickNames(ctx, []string{snapshot.User})[snapshot.User]
+	return SnapshotDetailResp{SnapshotResp: snapshot, Document: doc}, nil
+}
+
+// DiffSnapshots 比较同一任务的两个快照，如标注员提交的快照和审核后的快照，To 为空时和任务当前的内容比较
+func (svc *LabelerService) DiffSnapshots(ctx context.Context, req SnapshotDiffReq) (SnapshotDiffResp, error) {
+	from, err := svc.findSnapshot(ctx, req.From)
+	if err != nil {
+		return SnapshotDiffResp{}, err
+	}
+	if err := svc.checkTaskViewer(ctx, from.TaskType, from.TaskID); err != nil {
+		return SnapshotDiffResp{}, err
+	}
+	resp := SnapshotDiffResp{From: from}
+	var doc bson.Raw
+	if req.To.IsZero() {
+		t, err := svc.TaskType(from.TaskType)
+		if err != nil {
+			return SnapshotDiffResp{}, err
+		}
+		current, err := t.Tasks.FindOne(ctx, notDeleted(bson.M{"_id": from.TaskID})).DecodeBytes()
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return SnapshotDiffResp{}, ErrTaskNotFound
+			}
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return SnapshotDiffResp{}, err
+		}
+		if doc, err = snapshotDocument(current); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return SnapshotDiffResp{}, err
+		}
+	} else {
+		to, err := svc.findSnapshot(ctx, req.To)
+		if err != nil {
+			return SnapshotDiffResp{}, err
+		}
+		if to.TaskID != from.TaskID {
+			return SnapshotDiffResp{}, errors.New("只能比较同一任务的快照")
+		}
+		doc = to.Document
+		resp.To = &to
+	}
+
+	// version 在 diffDocument 中被忽略，快照的版本号在 From 和 To 中返回
+	resp.Changes = snapshotChanges(from.Document, doc, req.All)
+	users := []string{resp.From.User}
+	if resp.To != nil {
+		users = append(users, resp.To.User)
+	}
+	userMap := svc.userNickNames(ctx, users)
+	resp.From.NickName = userMap[resp.From.User]
+	if resp.To != nil {
+		resp.To.NickName = userMap[resp.To.User]
+	}
+	return resp, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSnapshotChanges(t *testing.T) {
+	a, _ := bson.Marshal(bson.M{
+		"status": "已提交",
+		"output": bson.A{bson.M{"sort": 1}, bson.M{"sort": 2}},
+		"remark": "x",
+	})
+	b, _ := bson.Marshal(bson.M{
+		"status": "已审核",
+		"output": bson.A{bson.M{"sort": 2}, bson.M{"sort": 1}, bson.M{"sort": 3}},
+		"note":   "y",
+	})
+	kinds := make(map[string]string)
+	for _, c := range snapshotChanges(a, b, false) {
+		kinds[c.Field] = c.Kind
+	}
+	want := map[string]string{
+		"output.0.sort": SnapshotChangeModified,
+		"output.1.sort": SnapshotChangeModified,
+		"output.2":      SnapshotChangeAdded,
+		"remark":        SnapshotChangeRemoved,
+		"note":          SnapshotChangeAdded,
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("changes %v", kinds)
+	}
+	for k, v := range want {
+		if kinds[k] != v {
+			t.Errorf("%s: want %s got %s", k, v, kinds[k])
+		}
+	}
+	if len(snapshotChanges(a, b, true)) != len(want)+1 {
+		t.Error("all should include status")
+	}
+}
@@ -1,27 +1,16 @@
 package service
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
-	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"go-admin/app/admin/models"
 	"go-admin/app/labeler/model"
-	"go-admin/common/dto"
 	"go-admin/common/log"
 	"go-admin/common/util"
 )
@@ -29,6 +18,7 @@ import (
 const (
 	PermissionTypeLabeler = "标注"
 	PermissionTypeChecker = "审核"
+	PermissionTypeAdmin   = "管理员"
 )
 
 type UploadTaskResp struct {
@@ -36,16 +26,11 @@ type UploadTaskResp struct {
 }
 
 func (svc *LabelerService) UploadTask(ctx context.Context, req []model.Task) (UploadTaskResp, error) {
-	data := make([]interface{}, len(req))
-	for i, task := range req {
-		data[i] = task
-	}
-	result, err := svc.CollectionTask.InsertMany(ctx, data)
+	count, err := svc.StoreTask.Insert(ctx, req)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return UploadTaskResp{}, err
 	}
-	return UploadTaskResp{UploadCount: len(result.InsertedIDs)}, err
+	return UploadTaskResp{UploadCount: count}, nil
 }
 
 func (svc *LabelerService) LabelTask(ctx context.Context, req model.Task, userID int) (model.Task, error) {
@@ -53,26 +38,25 @@ func (svc *LabelerService) LabelTask(ctx context.Context, req model.Task, userID
 	if err != nil {
 		return model.Task{}, err
 	}
-	if req.Permissions.Labeler.ID != strconv.Itoa(userID) {
+	if !task.Permissions.IsLabeler(strconv.Itoa(userID)) {
 		return model.Task{}, errors.New("无权限修改")
 	}
-	if !TaskStatusCheck(true, task.Status, req.Status) {
-		return model.Task{}, errors.New("当前状态无法修改")
-	}
-
-	data := bson.M{
-		"$set": bson.M{
-			"contents":   req.Contents,
-			"status":     req.Status,
-			"updateTime": util.Datetime(time.Now()),
-		},
+	err = svc.StoreTask.Transit(ctx, TransitReq{
+		ID:      task.ID,
+		Status:  req.Status,
+		UserID:  strconv.Itoa(userID),
+		Roles:   []string{PermissionTypeLabeler},
+		Version: req.Version,
+		Set:     bson.M{"contents": req.Contents},
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		task, _ = svc.GetTask(ctx, req.ID)
+		return task, err
 	}
-	if _, err := svc.CollectionTask.UpdateByID(ctx, req.ID, data); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
-		return model.Task{}, ErrDatabase
+	if err != nil {
+		return model.Task{}, err
 	}
-
-	return req, nil
+	return svc.GetTask(ctx, req.ID)
 }
 
 type SearchTaskReq struct {
@@ -85,10 +69,10 @@ type SearchTaskReq struct {
 	UpdateTimeStart string             `json:"updateTimeStart"`
 	UpdateTimeEnd   string             `json:"updateTimeEnd"`
 	PType           string             `json:"pType"`
-	Version         []int              `json:"version"`
+	Content         string             `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
 	UserID          int
 	DataScope       string
-	dto.Pagination
+	PageQuery
 }
 
 type SearchTaskResp struct {
@@ -98,58 +82,32 @@ type SearchTaskResp struct {
 	Labeler    string             `json:"labeler"`
 	Checker    string             `json:"checker"`
 	UpdateTime util.Datetime      `json:"updateTime"`
+	Highlights []Highlight        `json:"highlights,omitempty"`
 }
 
-func (svc *LabelerService) SearchTask(ctx context.Context, req SearchTaskReq) ([]SearchTaskResp, int, error) {
+func (svc *LabelerService) SearchTask(ctx context.Context, req SearchTaskReq) ([]SearchTaskResp, Page, error) {
 	filter, err := buildFilter(req)
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	cursor, err := svc.CollectionTask.Find(ctx, filter, buildOptions(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	var tasks []model.Task
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	if err := svc.StoreTask.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
 	}
-	results := svc.tasksToSearchTaskResp(ctx, tasks)
 
-	count, err := svc.CollectionTask.CountDocuments(ctx, filter)
+	tasks, page, err := svc.StoreTask.Search(ctx, notGold(filter), req.PageQuery)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	return results, int(count), nil
-}
-
-func buildOptions(req SearchTaskReq) *options.FindOptions {
-	if req.PageIndex < 1 {
-		req.PageIndex = 1
+	res := svc.tasksToSearchTaskResp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask.highlights(tasks[i], req.Content)
 	}
-	if req.PageSize < 1 {
-		req.PageSize = 10
-	}
-	opts := options.Find().
-		SetLimit(int64(req.PageSize)).
-		SetSkip(int64((req.PageIndex - 1) * req.PageSize)).
-		SetSort(bson.D{{"_id", 1}})
-	return opts
+	return res, page, nil
 }
 
 func buildFilter(req SearchTaskReq) (bson.M, error) {
 	filter := bson.M{}
-	if len(req.Version) > 0 {
-		filter["version"] = bson.M{
-			"$in": req.Version,
-		}
-	}
 	if !req.ID.IsZero() {
 		filter["_id"] = req.ID
 	}
@@ -220,29 +178,8 @@ func buildFilter(req SearchTaskReq) (bson.M, error) {
 }
 
 func (svc *LabelerService) tasksToSearchTaskResp(ctx context.Context, tasks []model.Task) []SearchTaskResp {
-	ids := make([]string, 0)
-	for _, task := range tasks {
-		if task.Permissions.Labeler != nil {
-			ids = append(ids, task.Permissions.Labeler.ID)
-		}
-		if task.Permissions.Checker != nil {
-			ids = append(ids, task.Permissions.Checker.ID)
-		}
-	}
-
+	userMap := svc.nickNames(ctx, util.Map(tasks, func(v model.Task) model.Permissions { return v.Permissions }))
 	res := make([]SearchTaskResp, len(tasks))
-
-	var users []models.SysUser
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
 	for i, task := range tasks {
 		var labeler, checker string
 		if task.Permissions.Labeler != nil {
@@ -265,150 +202,25 @@ func (svc *LabelerService) tasksToSearchTaskResp(ctx context.Context, tasks []mo
 }
 
 func (svc *LabelerService) GetTask(ctx context.Context, id primitive.ObjectID) (model.Task, error) {
-	var task model.Task
-	var users []models.SysUser
-	ids := make([]string, 0)
-	if err := svc.CollectionTask.FindOne(ctx, bson.D{{"_id", id}}).Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return model.Task{}, ErrNoDoc
-		}
-		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+	task, err := svc.StoreTask.Get(ctx, id)
+	if err != nil {
 		return model.Task{}, err
 	}
-
-	if task.Permissions.Labeler != nil {
-		ids = append(ids, task.Permissions.Labeler.ID)
-	}
-	if task.Permissions.Checker != nil {
-		ids = append(ids, task.Permissions.Checker.ID)
-	}
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
-	if task.Permissions.Labeler != nil {
-		task.Permissions.Labeler.NickName = userMap[task.Permissions.Labeler.ID]
-	}
-	if task.Permissions.Checker != nil {
-		task.Permissions.Checker.NickName = userMap[task.Permissions.Checker.ID]
-	}
+	svc.fillNickNames(ctx, &task.Permissions)
 	return task, nil
 }
 
-type AllocateTasksReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Number    int64              `json:"number"`
-	Persons   []string           `json:"persons"`
-}
+type AllocateTasksReq = BatchAllocReq
 
 func (svc *LabelerService) AllocateTasks(ctx context.Context, req AllocateTasksReq) error {
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"permissions.labeler": bson.M{
-			"$exists": false,
-		},
-	}
-	count, err := svc.CollectionTask.CountDocuments(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-
-	if count > req.Number {
-		count = req.Number
-	}
-	maxCount := count / int64(len(req.Persons))
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	for _, id := range req.Persons {
-		opts := options.Find().SetProjection(bson.D{{"_id", 1}}).SetLimit(maxCount)
-		result, err := svc.CollectionTask.Find(ctx, filter, opts)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return err
-		}
-
-		var tasks []model.Task
-		if err = result.All(ctx, &tasks); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return err
-		}
-
-		idArray := []primitive.ObjectID{}
-		for _, t := range tasks {
-			idArray = append(idArray, t.ID)
-		}
-
-		ft := bson.M{
-			"_id": bson.M{
-				"$in": idArray,
-			},
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.labeler": model.Person{ID: fmt.Sprint(id)},
-				"status":              model.TaskStatusLabeling,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		if _, err := svc.CollectionTask.UpdateMany(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return err
-		}
-	}
-
-	return nil
-}
-
-type ResetTasksReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Statuses  []string           `json:"statuses"`
+	_, err := svc.StoreTask.AllocLabeler(ctx, req)
+	return err
 }
 
 func (svc *LabelerService) ResetTasks(ctx context.Context, req ResetTasksReq) error {
-	filter := bson.M{}
-	if !req.ProjectID.IsZero() {
-		filter["projectId"] = req.ProjectID
-	}
-	if len(req.Persons) > 0 {
-		filter["$or"] = bson.A{
-			bson.M{
-				"permissions.labeler.id": bson.M{
-					"$in": req.Persons,
-				},
-			},
-			bson.M{
-				"permissions.checker.id": bson.M{
-					"$in": req.Persons,
-				},
-			},
-		}
-	}
-	if len(req.Statuses) > 0 {
-		filter["status"] = bson.M{
-			"$in": req.Statuses,
-		}
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"permissions": model.Permissions{},
-			"status":      model.TaskStatusAllocate,
-			"updateTime":  util.Datetime(time.Now()),
-		},
-	}
-	if _, err := svc.CollectionTask.UpdateMany(ctx, filter, update); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	return nil
+	req.ResetType = 0
+	_, err := svc.StoreTask.Reset(ctx, req)
+	return err
 }
 
 func (svc *LabelerService) CheckTask(ctx context.Context, req model.Task, userID int) (model.Task, error) {
@@ -419,23 +231,22 @@ func (svc *LabelerService) CheckTask(ctx context.Context, req model.Task, userID
 	if task.Permissions.Checker == nil || task.Permissions.Checker.ID != strconv.Itoa(userID) {
 		return model.Task{}, errors.New("当前用户无权限审核")
 	}
-	if !TaskStatusCheck(false, task.Status, req.Status) {
-		return model.Task{}, errors.New(fmt.Sprintf("当前任务状态为:%s,无法修改为:%s", task.Status, req.Status))
+	err = svc.StoreTask.Transit(ctx, TransitReq{
+		ID:      task.ID,
+		Status:  req.Status,
+		UserID:  strconv.Itoa(userID),
+		Roles:   []string{PermissionTypeChecker},
+		Version: req.Version,
+		Set:     bson.M{"contents": req.Contents},
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		task, _ = svc.GetTask(ctx, req.ID)
+		return task, err
 	}
-
-	data := bson.M{
-		"$set": bson.M{
-			"contents":   req.Contents,
-			"status":     req.Status,
-			"updateTime": util.Datetime(time.Now()),
-		},
-	}
-	if _, err := svc.CollectionTask.UpdateByID(ctx, req.ID, data); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
-		return model.Task{}, ErrDatabase
+	if err != nil {
+		return model.Task{}, err
 	}
-
-	return req, nil
+	return svc.GetTask(ctx, req.ID)
 }
 
 type CommentTaskReq struct {
@@ -466,8 +277,7 @@ func (svc *LabelerService) CommentTask(ctx context.Context, req CommentTaskReq)
 			"comments": comment,
 		},
 	}
-	if _, err := svc.CollectionTask.UpdateByID(ctx, req.ID, data); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
+	if _, err := svc.StoreTask.updateOne(ctx, bson.M{"_id": req.ID}, data, model.ActivityComment); err != nil {
 		return ErrDatabase
 	}
 	return nil
@@ -478,49 +288,19 @@ type ModelParseReq struct {
 	ModelURL string      `json:"modelURL"`
 }
 
+// ModelParse 调用请求中指定的模型地址解析，没有指定时使用配置的模型服务
 func (svc *LabelerService) ModelParse(ctx context.Context, req ModelParseReq) ([]model.Tuple, error) {
-	buf, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
-	}
-
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, req.ModelURL, bytes.NewBuffer(buf))
-	if err != nil {
-		return nil, err
-	}
-	httpRequest.Header.Set("Content-Type", "application/json;charset=utf-8")
-
-	client := &http.Client{
-		Timeout: 5 * time.Minute,
-	}
-	resp, err := client.Do(httpRequest)
-	if err != nil {
-		return nil, err
+	client := svc.ModelClient
+	if req.ModelURL != "" {
+		client = &HTTPModelClient{ParseURL: req.ModelURL}
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	var respBody struct {
-		Code int    `json:"code"`
-		Msg  string `json:"error_msg"`
-		Data struct {
-			Results []model.Tuple `json:"results"`
-		} `json:"data"`
-	}
-	if err = json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-		return nil, err
-	}
-	if respBody.Msg != "" {
-		return nil, fmt.Errorf("解析出错: %s", respBody.Msg)
+	if client == nil {
+		return nil, ErrModelNotConfigured
 	}
-	if len(respBody.Data.Results) == 0 {
-		return nil, errors.New("解析失败")
-	}
-
-	return respBody.Data.Results, nil
+	return client.Parse(ctx, req.Raw)
 }
 
+// Labeler、Checker 为 t 类型任务的默认流程：源状态 -> 允许的目标状态
 var Labeler = map[string]map[string]bool{
 	model.TaskStatusLabeling: {model.TaskStatusLabeling: true, model.TaskStatusSubmit: true},
 	model.TaskStatusSubmit:   {model.TaskStatusSubmit: true},
@@ -533,112 +313,27 @@ var Checker = map[string]map[string]bool{
 	model.TaskStatusFailed:   {model.TaskStatusChecking: true, model.TaskStatusPassed: true, model.TaskStatusFailed: true},
 }
 
-func TaskStatusCheck(isLabeler bool, src string, dst string) (result bool) {
-	if isLabeler {
-		if value, ok := Labeler[src]; ok {
-			if value[dst] {
-				result = true
+// taskAdminStatusMap 管理员可以执行标注员和审核员能执行的所有状态修改
+var taskAdminStatusMap = func() map[string]map[string]bool {
+	res := make(map[string]map[string]bool)
+	for _, rules := range []map[string]map[string]bool{Labeler, Checker} {
+		for from, to := range rules {
+			if res[from] == nil {
+				res[from] = make(map[string]bool)
+			}
+			for status, ok := range to {
+				res[from][status] = res[from][status] || ok
 			}
-		}
-		return
-	}
-	if value, ok := Checker[src]; ok {
-		if value[dst] {
-			result = true
 		}
 	}
-	return
-}
+	return res
+}()
 
-type AllocateCheckTasksReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Number    int64              `json:"number"`
-}
+type AllocateCheckTasksReq = BatchAllocReq
 
 func (svc *LabelerService) AllocateCheckTasks(ctx context.Context, req AllocateCheckTasksReq) error {
-	if req.Number <= 0 {
-		return errors.New("分配任务数量不合法")
-	}
-	if len(req.Persons) == 0 {
-		return errors.New("分配人员数量不能为0")
-	}
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"status":    model.TaskStatusSubmit,
-		"permissions.labeler": bson.M{
-			"$exists": true,
-		},
-		"permissions.checker": bson.M{
-			"$exists": false,
-		},
-	}
-	maxCount := int(req.Number) / len(req.Persons)
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	personMap := make(map[string]int, len(req.Persons))
-	for _, id := range req.Persons {
-		personMap[id] = 0
-	}
-
-	result, err := svc.CollectionTask.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	var tasks []model.Task
-	if err = result.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	if len(tasks) == 0 {
-		return errors.New("当前无可分配任务")
-	}
-	nowTime := util.Datetime(time.Now())
-	var totalCount int
-	for _, task := range tasks {
-		var minCount = math.MaxInt
-		var minID string
-		for i, v := range personMap {
-			if i == task.Permissions.Labeler.ID {
-				continue
-			}
-			if v == maxCount {
-				continue
-			}
-			if v < minCount {
-				minCount = v
-				minID = i
-			}
-		}
-		if minID == "" {
-			continue
-		}
-		personMap[minID]++
-		ft := bson.M{
-			"_id": task.ID,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.checker": model.Person{ID: minID},
-				"status":              model.TaskStatusChecking,
-				"updateTime":          nowTime,
-			},
-		}
-		if _, err := svc.CollectionTask.UpdateOne(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return err
-		}
-		totalCount++
-		if totalCount == int(req.Number) {
-			break
-		}
-	}
-	if totalCount == 0 {
-		return errors.New("分配失败：标注员和审核员不能是同一人")
-	}
-	return nil
+	_, err := svc.StoreTask.AllocChecker(ctx, req)
+	return err
 }
 
 type SearchMyTaskReq struct {
@@ -646,48 +341,27 @@ type SearchMyTaskReq struct {
 	UserID   string
 	TaskType string   `json:"taskType"`
 	Status   []string `json:"status"`
+	Content  string   `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
+	PageQuery
 }
 
-func (svc *LabelerService) SearchMyTask(ctx context.Context, req SearchMyTaskReq) ([]SearchTaskResp, int, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if len(req.Status) != 0 {
-		filter["status"] = bson.M{
-			"$in": req.Status,
-		}
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else if req.TaskType == "审核" {
-		filter["permissions.checker.id"] = req.UserID
-	} else {
-		filter["$or"] = []bson.M{
-			{"permissions.labeler.id": req.UserID},
-			{"permissions.checker.id": req.UserID},
-		}
-	}
-
-	cursor, err := svc.CollectionTask.Find(ctx, filter)
+func (svc *LabelerService) SearchMyTask(ctx context.Context, req SearchMyTaskReq) ([]SearchTaskResp, Page, error) {
+	tasks, page, err := svc.StoreTask.SearchMy(ctx, SearchMyTasksReq{
+		ProjectID: req.ID,
+		UserID:    req.UserID,
+		TaskType:  req.TaskType,
+		Status:    req.Status,
+		Content:   req.Content,
+		PageQuery: req.PageQuery,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	var tasks []model.Task
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-	results := svc.tasksToSearchTaskResp(ctx, tasks)
-
-	count, err := svc.CollectionTask.CountDocuments(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	res := svc.tasksToSearchTaskResp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask.highlights(tasks[i], req.Content)
 	}
-
-	return results, int(count), nil
+	return res, page, nil
 }
 
 type DownloadTaskReq struct {
@@ -695,66 +369,23 @@ type DownloadTaskReq struct {
 	Status    []string           `json:"status"`
 }
 
-type DownloadTaskResp struct {
-	File     *string `json:"file"`
-	FileName string  `json:"filename"`
-}
+type DownloadTaskResp = model.ExportJob
 
+// DownloadTask 创建后台导出，任务逐个导出为 zip 中的 json 文件
 func (svc *LabelerService) DownloadTask(ctx context.Context, req DownloadTaskReq) (DownloadTaskResp, error) {
-	filter := bson.M{
+	return svc.CreateExport(ctx, ExportTypeTask, req)
+}
+
+func (svc *LabelerService) exportTask(ctx context.Context, req DownloadTaskReq) (ExportPlan, error) {
+	filter := notGold(bson.M{
 		"projectId": req.ProjectID,
 		"status": bson.M{
 			"$in": req.Status,
 		},
-	}
-	cursor, err := svc.CollectionTask.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTaskResp{}, err
-	}
-
-	var tasks []model.Task
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTaskResp{}, err
-	}
-
-	nameStr := time.Now().Format("2006-01-02 15-04-05") + "下载文件.zip"
-	buf := new(bytes.Buffer)
-
-	zipWriter := zip.NewWriter(buf)
-
-	for _, task := range tasks {
-		data, err := json.Marshal(task)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTaskResp{}, err
-		}
-		taskName := strings.Split(task.Name, ".")
-		w1, err := zipWriter.Create(taskName[0] + ".json")
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTaskResp{}, err
-		}
-		_, err = w1.Write(data)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTaskResp{}, err
-		}
-	}
-	if err = zipWriter.Close(); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTaskResp{}, err
-	}
-
-	res := base64.StdEncoding.EncodeToString(buf.Bytes())
-	return DownloadTaskResp{File: &res, FileName: nameStr}, nil
+	})
+	return exportZipJSON(ctx, svc.CollectionTask, filter, func(v model.Task) string { return v.Name })
 }
 
 func (svc *LabelerService) DeleteTask(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionTask.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete task: ", err.Error())
-		return err
-	}
-	return nil
+	return svc.StoreTask.Delete(ctx, id)
 }
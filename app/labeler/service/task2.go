@@ -4,19 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"io"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"go-admin/app/admin/models"
 	"go-admin/app/labeler/model"
-	"go-admin/common/counter"
-	"go-admin/common/dto"
 	"go-admin/common/log"
 	"go-admin/common/util"
 )
@@ -36,25 +31,15 @@ type Task2FileRow struct {
 }
 
 func (svc *LabelerService) UploadTask2(ctx context.Context, req UploadTask2Req) (UploadTask2Resp, error) {
-	var project model.Project2
-	if err := svc.CollectionProject2.FindOne(ctx, bson.M{"_id": req.ProjectID}).Decode(&project); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return UploadTask2Resp{}, errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	project, err := svc.StoreProject2.Get(ctx, req.ProjectID)
+	if err != nil {
 		return UploadTask2Resp{}, err
 	}
 	if len(project.Schema.ContentTypes) == 0 {
 		return UploadTask2Resp{}, errors.New("项目没有配置数据规则")
 	}
-	labels := make([]model.Task2LabelItem, len(project.Schema.Labels))
-	for i, l := range project.Schema.Labels {
-		labels[i] = model.Task2LabelItem{
-			Name:  l.Name,
-			Value: "",
-		}
-	}
-	tasks := make([]any, len(req.Rows))
+	labels := task2Labels(project.Schema)
+	tasks := make([]model.Task2, len(req.Rows))
 	now := util.Datetime(time.Now())
 	for i, row := range req.Rows {
 		data := util.DefaultSlice[string](row.Data)
@@ -76,12 +61,84 @@ func (svc *LabelerService) UploadTask2(ctx context.Context, req UploadTask2Req)
 			Labels:      labels,
 		}
 	}
-	result, err := svc.CollectionTask2.InsertMany(ctx, tasks)
+	count, err := svc.StoreTask2.Insert(ctx, tasks)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return UploadTask2Resp{}, err
 	}
-	return UploadTask2Resp{UploadCount: len(result.InsertedIDs)}, err
+	return UploadTask2Resp{UploadCount: count}, nil
+}
+
+func task2Labels(schema model.Schema2) []model.Task2LabelItem {
+	labels := make([]model.Task2LabelItem, len(schema.Labels))
+	for i, l := range schema.Labels {
+		labels[i] = model.Task2LabelItem{
+			Name:  l.Name,
+			Value: "",
+		}
+	}
+	return labels
+}
+
+// importLabelPrefix 预填标签的字段为 label:标签名，值必须是项目配置的选项之一
+const importLabelPrefix = "label:"
+
+type ImportTask2Req = ImportTaskReq
+
+type ImportTask2Resp = ImportTaskResp
+
+// ImportTask2 导入 CSV/JSONL，字段为 name、项目配置的内容类型和 label:标签名
+func (svc *LabelerService) ImportTask2(ctx context.Context, req ImportTask2Req) (ImportTask2Resp, error) {
+	project, err := svc.StoreProject2.Get(ctx, req.ProjectID)
+	if err != nil {
+		return ImportTask2Resp{}, err
+	}
+	if len(project.Schema.ContentTypes) == 0 {
+		return ImportTask2Resp{}, errors.New("项目没有配置数据规则")
+	}
+	fields := append([]string{importFieldName}, project.Schema.ContentTypes...)
+	labelOptions := make(map[string][]string, len(project.Schema.Labels))
+	for _, l := range project.Schema.Labels {
+		fields = append(fields, importLabelPrefix+l.Name)
+		labelOptions[l.Name] = l.Values
+	}
+	now := util.Datetime(time.Now())
+	return runImport(ctx, svc.StoreTask2, req, fields, func(row int, values map[string][]string) (model.Task2, []ImportRowError) {
+		var errs []ImportRowError
+		contents := make([]model.Task2ContentItem, len(project.Schema.ContentTypes))
+		empty := true
+		for i, contentType := range project.Schema.ContentTypes {
+			if len(values[contentType]) > 1 {
+				errs = append(errs, ImportRowError{Row: row, Field: contentType, Message: "只能有一个值"})
+			}
+			v := firstValue(values[contentType])
+			if v != "" {
+				empty = false
+			}
+			contents[i] = model.Task2ContentItem{Name: contentType, Value: v}
+		}
+		if empty {
+			errs = append(errs, ImportRowError{Row: row, Message: "内容为空"})
+		}
+		labels := task2Labels(project.Schema)
+		for i := range labels {
+			field := importLabelPrefix + labels[i].Name
+			v := firstValue(values[field])
+			if v != "" && !importOption(labelOptions[labels[i].Name], v) {
+				errs = append(errs, ImportRowError{Row: row, Field: field, Message: fmt.Sprintf("%s 不是可选的标签值", v)})
+			}
+			labels[i].Value = v
+		}
+		return model.Task2{
+			ID:          primitive.NewObjectID(),
+			Name:        firstValue(values[importFieldName]),
+			ProjectID:   req.ProjectID,
+			Status:      model.TaskStatusAllocate,
+			Permissions: model.Permissions{},
+			UpdateTime:  now,
+			Contents:    contents,
+			Labels:      labels,
+		}, errs
+	})
 }
 
 type SearchTask2Req = SearchTaskReq
@@ -96,61 +153,33 @@ type SearchTask2Resp struct {
 	UpdateTime util.Datetime            `json:"updateTime"`
 	Contents   []model.Task2ContentItem `json:"contents"`
 	Labels     []model.Task2LabelItem   `json:"labels"`
+	Highlights []Highlight              `json:"highlights,omitempty"`
 }
 
-func (svc *LabelerService) SearchTask2(ctx context.Context, req SearchTask2Req) ([]SearchTask2Resp, int, error) {
+func (svc *LabelerService) SearchTask2(ctx context.Context, req SearchTask2Req) ([]SearchTask2Resp, Page, error) {
 	filter, err := buildFilter(req)
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	cursor, err := svc.CollectionTask2.Find(ctx, filter, buildOptions(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	var tasks []model.Task2
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	if err := svc.StoreTask2.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
 	}
-	results := svc.tasksToSearchTask2Resp(ctx, tasks)
 
-	count, err := svc.CollectionTask2.CountDocuments(ctx, filter)
+	tasks, page, err := svc.StoreTask2.Search(ctx, notGold(filter), req.PageQuery)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	return results, int(count), nil
+	res := svc.tasksToSearchTask2Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask2.highlights(tasks[i], req.Content)
+	}
+	return res, page, nil
 }
 
 func (svc *LabelerService) tasksToSearchTask2Resp(ctx context.Context, tasks []model.Task2) []SearchTask2Resp {
-	ids := make([]string, 0)
-	for _, task := range tasks {
-		if task.Permissions.Labeler != nil {
-			ids = append(ids, task.Permissions.Labeler.ID)
-		}
-		if task.Permissions.Checker != nil {
-			ids = append(ids, task.Permissions.Checker.ID)
-		}
-	}
-
+	userMap := svc.nickNames(ctx, util.Map(tasks, func(v model.Task2) model.Permissions { return v.Permissions }))
 	res := make([]SearchTask2Resp, len(tasks))
-
-	var users []models.SysUser
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
 	for i, task := range tasks {
 		var labeler, checker string
 		if task.Permissions.Labeler != nil {
@@ -175,241 +204,65 @@ func (svc *LabelerService) tasksToSearchTask2Resp(ctx context.Context, tasks []m
 	return res
 }
 
-type Task2BatchAllocLabelerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Number    int64              `json:"number"`
-	Persons   []string           `json:"persons"`
-}
+type Task2BatchAllocLabelerReq = BatchAllocReq
 
-type Task2BatchAllocLabelerResp struct {
-	Count int64 `json:"count"`
-}
+type Task2BatchAllocLabelerResp = BatchAllocResp
 
 func (svc *LabelerService) Task2BatchAllocLabeler(ctx context.Context, req Task2BatchAllocLabelerReq) (Task2BatchAllocLabelerResp, error) {
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"permissions.labeler": bson.M{
-			"$exists": false,
-		},
-	}
-	count, err := svc.CollectionTask2.CountDocuments(ctx, filter)
+	count, err := svc.StoreTask2.AllocLabeler(ctx, req)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Task2BatchAllocLabelerResp{}, err
 	}
-
-	if count > req.Number {
-		count = req.Number
-	}
-	maxCount := count / int64(len(req.Persons))
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	for _, id := range req.Persons {
-		opts := options.Find().SetProjection(bson.D{{"_id", 1}}).SetLimit(maxCount)
-		result, err := svc.CollectionTask2.Find(ctx, filter, opts)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task2BatchAllocLabelerResp{}, err
-		}
-
-		var tasks []model.Task2
-		if err = result.All(ctx, &tasks); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task2BatchAllocLabelerResp{}, err
-		}
-
-		ft := bson.M{
-			"_id": bson.M{
-				"$in": util.Map(tasks, func(v model.Task2) primitive.ObjectID { return v.ID }),
-			},
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.labeler": model.Person{ID: fmt.Sprint(id)},
-				"status":              model.TaskStatusLabeling,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		if _, err := svc.CollectionTask2.UpdateMany(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task2BatchAllocLabelerResp{}, err
-		}
-	}
-
 	return Task2BatchAllocLabelerResp{Count: count}, nil
 }
 
-type Task2BatchAllocCheckerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Number    int64              `json:"number"`
-}
+type Task2BatchAllocCheckerReq = BatchAllocReq
 
-type Task2BatchAllocCheckerResp struct {
-	Count int64 `json:"count"`
-}
+type Task2BatchAllocCheckerResp = BatchAllocResp
 
 func (svc *LabelerService) Task2BatchAllocChecker(ctx context.Context, req Task2BatchAllocCheckerReq) (Task2BatchAllocCheckerResp, error) {
-	if req.Number <= 0 {
-		return Task2BatchAllocCheckerResp{}, errors.New("分配任务数量不合法")
-	}
-	if len(req.Persons) == 0 {
-		return Task2BatchAllocCheckerResp{}, errors.New("分配人员数量不能为0")
-	}
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"status":    model.TaskStatusSubmit,
-		"permissions.labeler": bson.M{
-			"$exists": true,
-		},
-		"permissions.checker": bson.M{
-			"$exists": false,
-		},
-	}
-	maxCount := int(req.Number) / len(req.Persons)
-	if maxCount < 1 {
-		maxCount = 1
-	}
-
-	result, err := svc.CollectionTask2.Find(ctx, filter, options.Find().SetProjection(bson.M{
-		"_id":                 1,
-		"permissions.labeler": 1,
-	}))
+	count, err := svc.StoreTask2.AllocChecker(ctx, req)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Task2BatchAllocCheckerResp{}, err
 	}
-	var tasks []model.Task2
-	if err = result.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return Task2BatchAllocCheckerResp{}, err
-	}
-	if len(tasks) == 0 {
-		return Task2BatchAllocCheckerResp{}, errors.New("当前无可分配任务")
-	}
-
-	checkerTaskCounter := make(counter.Counter[string], len(req.Persons))
-	for _, person := range req.Persons {
-		checkerTaskCounter[person] = 0
-	}
-	for _, task := range tasks {
-		checkerTaskCounter.IncIfExists(task.Permissions.Labeler.ID, 1)
-	}
-	var totalCount int64
-	personTasks := make(map[string][]primitive.ObjectID, len(req.Persons))
-OuterLoop:
-	for len(checkerTaskCounter) > 0 {
-		labeler, _ := checkerTaskCounter.PopMax()
-		for i := len(tasks) - 1; i >= 0; i-- {
-			if totalCount == req.Number {
-				break OuterLoop
-			}
-			if len(personTasks[labeler]) == maxCount {
-				break
-			}
-			if labeler == tasks[i].Permissions.Labeler.ID {
-				continue
-			}
-			personTasks[labeler] = append(personTasks[labeler], tasks[i].ID)
-			totalCount++
-			//减少标注数量
-			checkerTaskCounter.IncIfExists(tasks[i].Permissions.Labeler.ID, -1)
-			// 从 tasks 切片中删除任务
-			tasks[i] = tasks[len(tasks)-1]
-			tasks = tasks[:len(tasks)-1]
-		}
-	}
-	//保存此次分配分任务
-	for labeler, checkTasks := range personTasks {
-		if _, err := svc.CollectionTask2.UpdateMany(
-			ctx,
-			bson.M{
-				"_id": bson.M{"$in": checkTasks},
-			},
-			bson.M{
-				"$set": bson.M{
-					"permissions.checker": model.Person{ID: labeler},
-					"status":              model.TaskStatusChecking,
-					"updateTime":          util.Datetime(time.Now()),
-				},
-			},
-		); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task2BatchAllocCheckerResp{}, err
-		}
-	}
-
-	if totalCount == 0 {
-		return Task2BatchAllocCheckerResp{}, errors.New("分配失败：标注员和审核员不能是同一人")
-	}
-	return Task2BatchAllocCheckerResp{Count: totalCount}, nil
+	return Task2BatchAllocCheckerResp{Count: count}, nil
 }
 
 type ResetTasks2Req struct {
 	ProjectID primitive.ObjectID `json:"projectId"`
 	Persons   []string           `json:"persons"`
 	Statuses  []string           `json:"statuses"`
+	Actor     string             `json:"-"`
 }
 
-type ResetTasks2Resp struct {
-	Count int64 `json:"count"`
-}
+type ResetTasks2Resp = ResetTasksResp
 
 func (svc *LabelerService) ResetTasks2(ctx context.Context, req ResetTasks2Req) (ResetTasks2Resp, error) {
-	filter := bson.M{}
-	if !req.ProjectID.IsZero() {
-		filter["projectId"] = req.ProjectID
-	}
-	if len(req.Persons) > 0 {
-		filter["$or"] = bson.A{
-			bson.M{
-				"permissions.labeler.id": bson.M{
-					"$in": req.Persons,
-				},
-			},
-			bson.M{
-				"permissions.checker.id": bson.M{
-					"$in": req.Persons,
-				},
-			},
-		}
-	}
-	if len(req.Statuses) > 0 {
-		filter["status"] = bson.M{
-			"$in": req.Statuses,
-		}
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"permissions": model.Permissions{},
-			"status":      model.TaskStatusAllocate,
-			"updateTime":  util.Datetime(time.Now()),
-		},
-	}
-	result, err := svc.CollectionTask2.UpdateMany(ctx, filter, update)
+	count, err := svc.StoreTask2.Reset(ctx, ResetTasksReq{
+		ProjectID: req.ProjectID,
+		Persons:   req.Persons,
+		Statuses:  req.Statuses,
+		Actor:     req.Actor,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return ResetTasks2Resp{}, err
 	}
-	return ResetTasks2Resp{Count: result.ModifiedCount}, nil
+	return ResetTasks2Resp{Count: count}, nil
 }
 
 type UpdateTask2Req struct {
-	UserID        string                   `json:"-"`
-	UserDataScope string                   `json:"-"`
-	ID            primitive.ObjectID       `json:"id"`
-	Contents      []model.Task2ContentItem `json:"contents"`
-	Labels        []model.Task2LabelItem   `json:"labels"`
+	UserID        string             `json:"-"`
+	UserDataScope string             `json:"-"`
+	ID            primitive.ObjectID `json:"id"`
+	// Version 读取到的任务版本号
+	Version  int                      `json:"version"`
+	Contents []model.Task2ContentItem `json:"contents"`
+	Labels   []model.Task2LabelItem   `json:"labels"`
 }
 
 func (svc *LabelerService) UpdateTask2(ctx context.Context, req UpdateTask2Req) (model.Task2, error) {
-	var task model.Task2
-	if err := svc.CollectionTask2.FindOne(ctx, bson.M{"_id": req.ID}).Decode(&task); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return model.Task2{}, errors.New("任务不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	task, err := svc.StoreTask2.Get(ctx, req.ID)
+	if err != nil {
 		return model.Task2{}, err
 	}
 	if req.UserDataScope != "1" && req.UserDataScope != "2" && !task.Permissions.IsLabeler(req.UserID) && !task.Permissions.IsChecker(req.UserID) {
@@ -425,11 +278,7 @@ func (svc *LabelerService) UpdateTask2(ctx context.Context, req UpdateTask2Req)
 			"updateTime": task.UpdateTime,
 		},
 	}
-	if _, err := svc.CollectionTask2.UpdateByID(ctx, req.ID, update); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
-		return model.Task2{}, err
-	}
-	return task, nil
+	return svc.StoreTask2.Update(ctx, req.ID, req.Version, update)
 }
 
 var ResponseMap = map[string]string{
@@ -441,61 +290,45 @@ var ResponseMap = map[string]string{
 	"审核不通过": "更新成功",
 }
 
+var task2Workflow = workflowFromRules(task2StatusMap, task2AdminStatusMap)
+
+var task2StatusMap = map[string][]string{
+	model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
+	model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
+	model.TaskStatusChecking: {model.TaskStatusSubmit},
+	model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusSubmit},
+}
+
+// task2AdminStatusMap 管理员还可以把裁决后的多人标注任务由未分配改为已提交
+var task2AdminStatusMap = map[string][]string{
+	model.TaskStatusFailed:   task2StatusMap[model.TaskStatusFailed],
+	model.TaskStatusPassed:   task2StatusMap[model.TaskStatusPassed],
+	model.TaskStatusChecking: task2StatusMap[model.TaskStatusChecking],
+	model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusSubmit, model.TaskStatusAllocate},
+}
+
 type BatchSetTask2StatusReq struct {
 	UserID        string               `json:"-"`
 	UserDataScope string               `json:"-"`
 	IDs           []primitive.ObjectID `json:"ids"`
 	Status        string               `json:"status"`
+	Reason        string               `json:"reason"`
 }
 
-type BatchSetTask2StatusResp struct {
-	Count int64 `json:"count"`
-}
+type BatchSetTask2StatusResp = BatchSetStatusResp
 
 func (svc *LabelerService) BatchSetTask2Status(ctx context.Context, req BatchSetTask2StatusReq) (BatchSetTask2StatusResp, error) {
-	if len(req.IDs) == 0 {
-		return BatchSetTask2StatusResp{}, errors.New("什么也没有发生")
-	}
-	filter := bson.M{
-		"_id": bson.M{
-			"$in": req.IDs,
-		},
-	}
-	if req.UserDataScope != "1" && req.UserDataScope != "2" {
-		filter["$or"] = bson.A{
-			bson.M{"permissions.labeler.id": req.UserID},
-			bson.M{"permissions.checker.id": req.UserID},
-		}
-	}
-	statusMap := map[string][]string{
-		model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
-		model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
-		model.TaskStatusChecking: {model.TaskStatusSubmit},
-		model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusSubmit},
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"status":     req.Status,
-			"updateTime": util.Datetime(time.Now()),
-		},
-	}
-	if validSourceStatus := statusMap[req.Status]; validSourceStatus != nil {
-		filter["status"] = bson.M{
-			"$in": validSourceStatus,
-		}
-	}
-	result, err := svc.CollectionTask2.UpdateMany(ctx, filter, update)
+	count, err := svc.StoreTask2.SetStatus(ctx, BatchSetStatusReq{
+		UserID: req.UserID,
+		Admin:  req.UserDataScope == "1" || req.UserDataScope == "2",
+		IDs:    req.IDs,
+		Status: req.Status,
+		Reason: req.Reason,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return BatchSetTask2StatusResp{}, err
 	}
-	if int(result.ModifiedCount) < len(req.IDs) {
-		if req.Status == model.TaskStatusSubmit {
-			return BatchSetTask2StatusResp{}, errors.New("提交失败：任务已被分配审核")
-		}
-		return BatchSetTask2StatusResp{}, errors.New("部分任务状态没有修改")
-	}
-	return BatchSetTask2StatusResp{Count: result.ModifiedCount}, err
+	return BatchSetTask2StatusResp{Count: count}, nil
 }
 
 type SearchMyTask2Req struct {
@@ -503,70 +336,31 @@ type SearchMyTask2Req struct {
 	UserID   string
 	TaskType string   `json:"taskType"`
 	Status   []string `json:"status"`
-	dto.Pagination
+	Content  string   `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
+	PageQuery
 }
 
-func (svc *LabelerService) SearchMyTask2(ctx context.Context, req SearchMyTask2Req) ([]SearchTask2Resp, int, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if len(req.Status) != 0 {
-		filter["status"] = bson.M{
-			"$in": req.Status,
-		}
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else if req.TaskType == "审核" {
-		filter["permissions.checker.id"] = req.UserID
-	} else {
-		filter["$or"] = []bson.M{
-			{"permissions.labeler.id": req.UserID},
-			{"permissions.checker.id": req.UserID},
-		}
-	}
-
-	cursor, err := svc.CollectionTask2.Find(ctx, filter, buildOptions2(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	var tasks []model.Task2
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	results := svc.tasksToSearchTask2Resp(ctx, tasks)
-
-	count, err := svc.CollectionTask2.CountDocuments(ctx, filter)
+func (svc *LabelerService) SearchMyTask2(ctx context.Context, req SearchMyTask2Req) ([]SearchTask2Resp, Page, error) {
+	tasks, page, err := svc.StoreTask2.SearchMy(ctx, SearchMyTasksReq{
+		ProjectID: req.ID,
+		UserID:    req.UserID,
+		TaskType:  req.TaskType,
+		Status:    req.Status,
+		Content:   req.Content,
+		PageQuery: req.PageQuery,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	return results, int(count), nil
-}
-
-func buildOptions2(req SearchMyTask2Req) *options.FindOptions {
-	if req.PageIndex < 1 {
-		req.PageIndex = 1
+		return nil, Page{}, err
 	}
-	if req.PageSize < 1 {
-		req.PageSize = 10
+	res := svc.tasksToSearchTask2Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask2.highlights(tasks[i], req.Content)
 	}
-	opts := options.Find().
-		SetLimit(int64(req.PageSize)).
-		SetSkip(int64((req.PageIndex - 1) * req.PageSize))
-	return opts
+	return res, page, nil
 }
 
 func (svc *LabelerService) DeleteTask2(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionTask2.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete task: ", err.Error())
-		return err
-	}
-	return nil
+	return svc.StoreTask2.Delete(ctx, id)
 }
 
 type DownloadTask2Req struct {
@@ -574,35 +368,23 @@ type DownloadTask2Req struct {
 	Status    []string           `json:"status"`
 }
 
-type DownloadTask2Resp struct {
-	File     *string `json:"file"`
-	FileName string  `json:"filename"`
-}
+type DownloadTask2Resp = model.ExportJob
 
+// DownloadTask2 创建后台导出，导出为 Excel，每个任务一行
 func (svc *LabelerService) DownloadTask2(ctx context.Context, req DownloadTask2Req) (DownloadTask2Resp, error) {
-	filter := bson.M{
+	return svc.CreateExport(ctx, ExportTypeTask2, req)
+}
+
+func (svc *LabelerService) exportTask2(ctx context.Context, req DownloadTask2Req) (ExportPlan, error) {
+	filter := notGold(bson.M{
 		"projectId": req.ProjectID,
 		"status": bson.M{
 			"$in": req.Status,
 		},
-	}
-	cursor, err := svc.CollectionTask2.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
-	}
-
-	var tasks []*model.Task2
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
-	}
-
-	var project model.Project2
-	err = svc.CollectionProject2.FindOne(ctx, bson.D{{"_id", req.ProjectID}}).Decode(&project)
+	})
+	project, err := svc.StoreProject2.Get(ctx, req.ProjectID)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
+		return ExportPlan{}, err
 	}
 	columns := []string{"序号", "任务id", "任务名", "状态"}
 	for _, v := range project.Schema.ContentTypes {
@@ -611,34 +393,38 @@ func (svc *LabelerService) DownloadTask2(ctx context.Context, req DownloadTask2R
 	for _, v := range project.Schema.Labels {
 		columns = append(columns, v.Name)
 	}
-	nameStr := project.Name + " " + strings.Join(req.Status, "/") + " "
-	data, filename, err := util.CreateExcelFile(
-		task2ToSlice(tasks),
-		columns,
-		nameStr,
-	)
+	total, err := svc.CollectionTask2.CountDocuments(ctx, notDeleted(filter))
 	if err != nil {
-		return DownloadTask2Resp{}, err
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return ExportPlan{}, err
 	}
-	return DownloadTask2Resp{File: data, FileName: filename}, nil
+	nameStr := project.Name + " " + strings.Join(req.Status, "/") + " "
+	return ExportPlan{
+		FileName: util.GetExcelFileName(nameStr),
+		Total:    total,
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			cursor, err := svc.CollectionTask2.Find(ctx, notDeleted(filter))
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			return writeExcel(ctx, cursor, w, columns, task2Row, progress)
+		},
+	}, nil
 }
 
-func task2ToSlice(tasks []*model.Task2) [][]interface{} {
-	var res [][]interface{}
-	for index, task := range tasks {
-		s := []interface{}{
-			index + 1,
-			task.ID.Hex(),
-			task.Name,
-			task.Status,
-		}
-		for _, v := range task.Contents {
-			s = append(s, v.Value)
-		}
-		for _, v := range task.Labels {
-			s = append(s, v.Value)
-		}
-		res = append(res, s)
+func task2Row(index int, task model.Task2) []interface{} {
+	s := []interface{}{
+		index + 1,
+		task.ID.Hex(),
+		task.Name,
+		task.Status,
 	}
-	return res
+	for _, v := range task.Contents {
+		s = append(s, v.Value)
+	}
+	for _, v := range task.Labels {
+		s = append(s, v.Value)
+	}
+	return s
 }
@@ -1,25 +1,15 @@
 package service
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"go-admin/app/admin/models"
 	"go-admin/app/labeler/model"
-	"go-admin/common/dto"
 	"go-admin/common/log"
 	"go-admin/common/util"
 )
@@ -39,40 +29,12 @@ type Task3FileRow struct {
 }
 
 func (svc *LabelerService) UploadTask3(ctx context.Context, req UploadTask3Req) (UploadTask3Resp, error) {
-	var project model.Project3
-	if err := svc.CollectionProject3.FindOne(ctx, bson.M{"_id": req.ProjectID}).Decode(&project); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return UploadTask3Resp{}, errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	project, err := svc.StoreProject3.Get(ctx, req.ProjectID)
+	if err != nil {
 		return UploadTask3Resp{}, err
 	}
-	commandLabels := make([]model.Label, len(project.Schema.CommandLabels))
-	for i, v := range project.Schema.CommandLabels {
-		commandLabels[i] = model.Label{
-			Name:    v.Name,
-			Value:   "",
-			Options: v.Values,
-		}
-	}
-	commandTags := model.Tag{
-		Options: project.Schema.CommandTags,
-	}
-	commandJudgment := make([]model.Judgment, len(project.Schema.CommandJudgment))
-	for i, v := range project.Schema.CommandJudgment {
-		commandJudgment[i] = model.Judgment{
-			Name:  v,
-			Value: "未选择",
-		}
-	}
-	outputJudgment := make([]model.Judgment, len(project.Schema.OutputJudgment))
-	for i, v := range project.Schema.OutputJudgment {
-		outputJudgment[i] = model.Judgment{
-			Name:  v,
-			Value: "未选择",
-		}
-	}
-	tasks := make([]any, len(req.Rows))
+	commandResult, outputJudgment := task3Results(project.Schema)
+	tasks := make([]model.Task3, len(req.Rows))
 	now := util.Datetime(time.Now())
 	for i, row := range req.Rows {
 		var outputs []model.Task3OutputItem
@@ -94,9 +56,7 @@ func (svc *LabelerService) UploadTask3(ctx context.Context, req UploadTask3Req)
 				outputs = append(outputs, output)
 			}
 		}
-		command.Result.Labels = commandLabels
-		command.Result.Judgment = commandJudgment
-		command.Result.Tags = commandTags
+		command.Result = commandResult
 
 		tasks[i] = model.Task3{
 			ID:          primitive.NewObjectID(),
@@ -109,12 +69,116 @@ func (svc *LabelerService) UploadTask3(ctx context.Context, req UploadTask3Req)
 			Output:      outputs,
 		}
 	}
-	result, err := svc.CollectionTask3.InsertMany(ctx, tasks)
+	count, err := svc.StoreTask3.Insert(ctx, tasks)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return UploadTask3Resp{}, err
 	}
-	return UploadTask3Resp{UploadCount: len(result.InsertedIDs)}, err
+	return UploadTask3Resp{UploadCount: count}, nil
+}
+
+// task3Results 按项目配置生成指令和回复的空白标注结果
+func task3Results(schema model.Schema3) (model.CommandRes, []model.Judgment) {
+	commandLabels := make([]model.Label, len(schema.CommandLabels))
+	for i, v := range schema.CommandLabels {
+		commandLabels[i] = model.Label{
+			Name:    v.Name,
+			Value:   "",
+			Options: v.Values,
+		}
+	}
+	commandTags := model.Tag{
+		Options: schema.CommandTags,
+	}
+	commandJudgment := make([]model.Judgment, len(schema.CommandJudgment))
+	for i, v := range schema.CommandJudgment {
+		commandJudgment[i] = model.Judgment{
+			Name:  v,
+			Value: "未选择",
+		}
+	}
+	outputJudgment := make([]model.Judgment, len(schema.OutputJudgment))
+	for i, v := range schema.OutputJudgment {
+		outputJudgment[i] = model.Judgment{
+			Name:  v,
+			Value: "未选择",
+		}
+	}
+	return model.CommandRes{
+		Labels:   commandLabels,
+		Tags:     commandTags,
+		Judgment: commandJudgment,
+	}, outputJudgment
+}
+
+type ImportTask3Req = ImportTaskReq
+
+type ImportTask3Resp = ImportTaskResp
+
+// ImportTask3 导入 CSV/JSONL，字段为 name、command、output（可以多列或 JSON 数组）、tag 和 label:标签名
+func (svc *LabelerService) ImportTask3(ctx context.Context, req ImportTask3Req) (ImportTask3Resp, error) {
+	project, err := svc.StoreProject3.Get(ctx, req.ProjectID)
+	if err != nil {
+		return ImportTask3Resp{}, err
+	}
+	const (
+		fieldCommand = "command"
+		fieldOutput  = "output"
+		fieldTag     = "tag"
+	)
+	fields := []string{importFieldName, fieldCommand, fieldOutput, fieldTag}
+	labelOptions := make(map[string][]string, len(project.Schema.CommandLabels))
+	for _, l := range project.Schema.CommandLabels {
+		fields = append(fields, importLabelPrefix+l.Name)
+		labelOptions[l.Name] = l.Values
+	}
+	now := util.Datetime(time.Now())
+	return runImport(ctx, svc.StoreTask3, req, fields, func(row int, values map[string][]string) (model.Task3, []ImportRowError) {
+		var errs []ImportRowError
+		commandResult, outputJudgment := task3Results(project.Schema)
+		command := model.Task3CommandItem{Content: firstValue(values[fieldCommand]), Result: commandResult}
+		if command.Content == "" {
+			errs = append(errs, ImportRowError{Row: row, Field: fieldCommand, Message: "指令为空"})
+		} else if len(values[fieldCommand]) > 1 {
+			errs = append(errs, ImportRowError{Row: row, Field: fieldCommand, Message: "只能有一个值"})
+		}
+		for i := range command.Result.Labels {
+			field := importLabelPrefix + command.Result.Labels[i].Name
+			v := firstValue(values[field])
+			if v != "" && !importOption(labelOptions[command.Result.Labels[i].Name], v) {
+				errs = append(errs, ImportRowError{Row: row, Field: field, Message: fmt.Sprintf("%s 不是可选的标签值", v)})
+			}
+			command.Result.Labels[i].Value = v
+		}
+		for _, v := range values[fieldTag] {
+			if v == "" {
+				continue
+			}
+			if !importOption(project.Schema.CommandTags, v) {
+				errs = append(errs, ImportRowError{Row: row, Field: fieldTag, Message: fmt.Sprintf("%s 不是可选的标签", v)})
+			}
+			command.Result.Tags.Values = append(command.Result.Tags.Values, v)
+		}
+		var outputs []model.Task3OutputItem
+		for _, v := range values[fieldOutput] {
+			if v == "" {
+				continue
+			}
+			outputs = append(outputs, model.Task3OutputItem{
+				Content: v,
+				Result:  model.OutputRes{Judgment: outputJudgment},
+			})
+		}
+		return model.Task3{
+			ID:          primitive.NewObjectID(),
+			Name:        firstValue(values[importFieldName]),
+			ProjectID:   req.ProjectID,
+			Status:      model.TaskStatusAllocate,
+			Permissions: model.Permissions{},
+			UpdateTime:  now,
+			Command:     command,
+			Output:      outputs,
+		}, errs
+	})
 }
 
 type SearchTask3Req = SearchTaskReq
@@ -129,58 +193,33 @@ type SearchTask3Resp struct {
 	Sort       []int                   `json:"sort"`
 	Command    model.Task3CommandItem  `json:"command"`
 	Output     []model.Task3OutputItem ` json:"output"`
+	Highlights []Highlight             `json:"highlights,omitempty"`
 }
 
-func (svc *LabelerService) SearchTask3(ctx context.Context, req SearchTask3Req) ([]SearchTask3Resp, int, error) {
+func (svc *LabelerService) SearchTask3(ctx context.Context, req SearchTask3Req) ([]SearchTask3Resp, Page, error) {
 	filter, err := buildFilter(req)
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	cursor, err := svc.CollectionTask3.Find(ctx, filter, buildOptions(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	var tasks []model.Task3
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	if err := svc.StoreTask3.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
 	}
-	results := svc.tasksToSearchTask3Resp(ctx, tasks)
 
-	count, err := svc.CollectionTask3.CountDocuments(ctx, filter)
+	tasks, page, err := svc.StoreTask3.Search(ctx, notGold(filter), req.PageQuery)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	return results, int(count), nil
+	res := svc.tasksToSearchTask3Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask3.highlights(tasks[i], req.Content)
+	}
+	return res, page, nil
 }
 
 func (svc *LabelerService) tasksToSearchTask3Resp(ctx context.Context, tasks []model.Task3) []SearchTask3Resp {
-	ids := make([]string, 0)
-	for _, task := range tasks {
-		if task.Permissions.Labeler != nil {
-			ids = append(ids, task.Permissions.Labeler.ID)
-		}
-	}
-
+	userMap := svc.nickNames(ctx, util.Map(tasks, func(v model.Task3) model.Permissions { return v.Permissions }))
 	res := make([]SearchTask3Resp, len(tasks))
-
-	var users []models.SysUser
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
 	for i, task := range tasks {
 		var labeler string
 		if task.Permissions.Labeler != nil {
@@ -201,68 +240,15 @@ func (svc *LabelerService) tasksToSearchTask3Resp(ctx context.Context, tasks []m
 	return res
 }
 
-type Task3BatchAllocLabelerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Number    int64              `json:"number"`
-	Persons   []string           `json:"persons"`
-}
+type Task3BatchAllocLabelerReq = BatchAllocReq
 
-type Task3BatchAllocLabelerResp struct {
-	Count int64 `json:"count"`
-}
+type Task3BatchAllocLabelerResp = BatchAllocResp
 
 func (svc *LabelerService) Task3BatchAllocLabeler(ctx context.Context, req Task3BatchAllocLabelerReq) (Task3BatchAllocLabelerResp, error) {
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"permissions.labeler": bson.M{
-			"$exists": false,
-		},
-	}
-	count, err := svc.CollectionTask3.CountDocuments(ctx, filter)
+	count, err := svc.StoreTask3.AllocLabeler(ctx, req)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Task3BatchAllocLabelerResp{}, err
 	}
-
-	if count > req.Number {
-		count = req.Number
-	}
-	maxCount := count / int64(len(req.Persons))
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	for _, id := range req.Persons {
-		opts := options.Find().SetProjection(bson.D{{"_id", 1}}).SetLimit(maxCount)
-		result, err := svc.CollectionTask3.Find(ctx, filter, opts)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task3BatchAllocLabelerResp{}, err
-		}
-
-		var tasks []model.Task3
-		if err = result.All(ctx, &tasks); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task3BatchAllocLabelerResp{}, err
-		}
-
-		ft := bson.M{
-			"_id": bson.M{
-				"$in": util.Map(tasks, func(v model.Task3) primitive.ObjectID { return v.ID }),
-			},
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.labeler": model.Person{ID: fmt.Sprint(id)},
-				"status":              model.TaskStatusLabeling,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		if _, err := svc.CollectionTask3.UpdateMany(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task3BatchAllocLabelerResp{}, err
-		}
-	}
-
 	return Task3BatchAllocLabelerResp{Count: count}, nil
 }
 
@@ -270,57 +256,37 @@ type ResetTasks3Req struct {
 	ProjectID primitive.ObjectID `json:"projectId"`
 	Persons   []string           `json:"persons"`
 	Statuses  []string           `json:"statuses"`
+	Actor     string             `json:"-"`
 }
 
-type ResetTasks3Resp struct {
-	Count int64 `json:"count"`
-}
+type ResetTasks3Resp = ResetTasksResp
 
 func (svc *LabelerService) ResetTasks3(ctx context.Context, req ResetTasks3Req) (ResetTasks3Resp, error) {
-	filter := bson.M{}
-	if !req.ProjectID.IsZero() {
-		filter["projectId"] = req.ProjectID
-	}
-	if len(req.Persons) > 0 {
-		filter["permissions.labeler.id"] = bson.M{
-			"$in": req.Persons,
-		}
-	}
-	if len(req.Statuses) > 0 {
-		filter["status"] = bson.M{
-			"$in": req.Statuses,
-		}
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"permissions": model.Permissions{},
-			"status":      model.TaskStatusAllocate,
-			"updateTime":  util.Datetime(time.Now()),
-		},
-	}
-	result, err := svc.CollectionTask3.UpdateMany(ctx, filter, update)
+	count, err := svc.StoreTask3.Reset(ctx, ResetTasksReq{
+		ProjectID: req.ProjectID,
+		Persons:   req.Persons,
+		Statuses:  req.Statuses,
+		Actor:     req.Actor,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return ResetTasks3Resp{}, err
 	}
-	return ResetTasks3Resp{Count: result.ModifiedCount}, nil
+	return ResetTasks3Resp{Count: count}, nil
 }
 
 type UpdateTask3Req struct {
-	UserID        string                  `json:"-"`
-	UserDataScope string                  `json:"-"`
-	ID            primitive.ObjectID      `json:"id"`
-	Command       model.Task3CommandItem  `json:"command"`
-	Output        []model.Task3OutputItem `json:"output"`
+	UserID        string             `json:"-"`
+	UserDataScope string             `json:"-"`
+	ID            primitive.ObjectID `json:"id"`
+	// Version 读取到的任务版本号
+	Version int                     `json:"version"`
+	Command model.Task3CommandItem  `json:"command"`
+	Output  []model.Task3OutputItem `json:"output"`
 }
 
 func (svc *LabelerService) UpdateTask3(ctx context.Context, req UpdateTask3Req) (model.Task3, error) {
-	var task model.Task3
-	if err := svc.CollectionTask3.FindOne(ctx, bson.M{"_id": req.ID}).Decode(&task); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return model.Task3{}, errors.New("任务不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	task, err := svc.StoreTask3.Get(ctx, req.ID)
+	if err != nil {
 		return model.Task3{}, err
 	}
 	if req.UserDataScope != "1" && req.UserDataScope != "2" && !task.Permissions.IsLabeler(req.UserID) {
@@ -339,20 +305,11 @@ func (svc *LabelerService) UpdateTask3(ctx context.Context, req UpdateTask3Req)
 			"updateTime": task.UpdateTime,
 		},
 	}
-	if _, err := svc.CollectionTask3.UpdateByID(ctx, req.ID, update); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
-		return model.Task3{}, err
-	}
-	return task, nil
+	return svc.StoreTask3.Update(ctx, req.ID, req.Version, update)
 }
 
 func (svc *LabelerService) CheckTask3(ctx context.Context, task model.Task3, req UpdateTask3Req) error {
-	var project model.Project3
-	if err := svc.CollectionProject3.FindOne(ctx, bson.M{"_id": task.ProjectID}).Decode(&project); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if _, err := svc.StoreProject3.Get(ctx, task.ProjectID); err != nil {
 		return err
 	}
 	for _, v := range req.Command.Result.Labels {
@@ -386,105 +343,65 @@ func (svc *LabelerService) CheckTask3(ctx context.Context, task model.Task3, req
 	return nil
 }
 
+// task3Workflow 标注员和管理员可以把任务改为任意状态，审核员不能修改状态
+var task3Workflow = model.Workflow{
+	States:      model.TaskStatuses,
+	Transitions: ruleTransitions(nil, PermissionTypeLabeler, PermissionTypeAdmin),
+}
+
 type BatchSetTask3StatusReq struct {
 	UserID        string               `json:"-"`
 	UserDataScope string               `json:"-"`
 	IDs           []primitive.ObjectID `json:"ids"`
 	Status        string               `json:"status"`
+	Reason        string               `json:"reason"`
 }
 
-type BatchSetTask3StatusResp struct {
-	Count int64 `json:"count"`
-}
+type BatchSetTask3StatusResp = BatchSetStatusResp
 
 func (svc *LabelerService) BatchSetTask3Status(ctx context.Context, req BatchSetTask3StatusReq) (BatchSetTask3StatusResp, error) {
-	if len(req.IDs) == 0 {
-		return BatchSetTask3StatusResp{}, errors.New("什么也没有发生")
-	}
-	filter := bson.M{
-		"_id": bson.M{
-			"$in": req.IDs,
-		},
-	}
-	if req.UserDataScope != "1" && req.UserDataScope != "2" {
-		filter["permissions.labeler.id"] = req.UserID
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"status":     req.Status,
-			"updateTime": util.Datetime(time.Now()),
-		},
-	}
-	result, err := svc.CollectionTask3.UpdateMany(ctx, filter, update)
+	count, err := svc.StoreTask3.SetStatus(ctx, BatchSetStatusReq{
+		UserID: req.UserID,
+		Admin:  req.UserDataScope == "1" || req.UserDataScope == "2",
+		IDs:    req.IDs,
+		Status: req.Status,
+		Reason: req.Reason,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return BatchSetTask3StatusResp{}, err
 	}
-	if result.ModifiedCount == 0 {
-		return BatchSetTask3StatusResp{}, errors.New("权限不足")
-	}
-	return BatchSetTask3StatusResp{Count: result.ModifiedCount}, err
+	return BatchSetTask3StatusResp{Count: count}, nil
 }
 
 type SearchMyTask3Req struct {
-	ID     primitive.ObjectID `json:"id"`
-	UserID string
-	Status []string `json:"status"`
-	dto.Pagination
+	ID      primitive.ObjectID `json:"id"`
+	UserID  string
+	Status  []string `json:"status"`
+	Content string   `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
+	PageQuery
 }
 
-func (svc *LabelerService) SearchMyTask3(ctx context.Context, req SearchMyTask3Req) ([]SearchTask3Resp, int, error) {
-	filter := bson.M{
-		"projectId":              req.ID,
-		"permissions.labeler.id": req.UserID,
-	}
-	if len(req.Status) != 0 {
-		filter["status"] = bson.M{
-			"$in": req.Status,
-		}
-	}
-
-	cursor, err := svc.CollectionTask3.Find(ctx, filter, buildOptions3(req))
+func (svc *LabelerService) SearchMyTask3(ctx context.Context, req SearchMyTask3Req) ([]SearchTask3Resp, Page, error) {
+	tasks, page, err := svc.StoreTask3.SearchMy(ctx, SearchMyTasksReq{
+		ProjectID: req.ID,
+		UserID:    req.UserID,
+		TaskType:  PermissionTypeLabeler,
+		Status:    req.Status,
+		Content:   req.Content,
+		PageQuery: req.PageQuery,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	var tasks []model.Task3
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-	results := svc.tasksToSearchTask3Resp(ctx, tasks)
-
-	count, err := svc.CollectionTask3.CountDocuments(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	res := svc.tasksToSearchTask3Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask3.highlights(tasks[i], req.Content)
 	}
-
-	return results, int(count), nil
-}
-
-func buildOptions3(req SearchMyTask3Req) *options.FindOptions {
-	if req.PageIndex < 1 {
-		req.PageIndex = 1
-	}
-	if req.PageSize < 1 {
-		req.PageSize = 10
-	}
-	opts := options.Find().
-		SetLimit(int64(req.PageSize)).
-		SetSkip(int64((req.PageIndex - 1) * req.PageSize))
-	return opts
+	return res, page, nil
 }
 
 func (svc *LabelerService) DeleteTask3(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionTask3.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete task: ", err.Error())
-		return err
-	}
-	return nil
+	return svc.StoreTask3.Delete(ctx, id)
 }
 
 type DownloadTask3Req struct {
@@ -492,95 +409,28 @@ type DownloadTask3Req struct {
 	Status    []string           `json:"status"`
 }
 
-type DownloadTask3Resp struct {
-	File     *string `json:"file"`
-	FileName string  `json:"filename"`
-}
+type DownloadTask3Resp = model.ExportJob
 
+// DownloadTask3 创建后台导出，任务逐个导出为 zip 中的 json 文件
 func (svc *LabelerService) DownloadTask3(ctx context.Context, req DownloadTask3Req) (DownloadTask3Resp, error) {
-	filter := bson.M{
+	return svc.CreateExport(ctx, ExportTypeTask3, req)
+}
+
+func (svc *LabelerService) exportTask3(ctx context.Context, req DownloadTask3Req) (ExportPlan, error) {
+	filter := notGold(bson.M{
 		"projectId": req.ProjectID,
 		"status": bson.M{
 			"$in": req.Status,
 		},
-	}
-	cursor, err := svc.CollectionTask3.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask3Resp{}, err
-	}
-
-	var tasks []*model.Task3
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask3Resp{}, err
-	}
-
-	nameStr := time.Now().Format("2006-01-02 15-04-05") + "下载文件.zip"
-	buf := new(bytes.Buffer)
-
-	zipWriter := zip.NewWriter(buf)
-
-	for _, task := range tasks {
-		data, err := json.Marshal(task)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask3Resp{}, err
-		}
-		taskName := strings.Split(task.Name, ".")
-		w1, err := zipWriter.Create(taskName[0] + ".json")
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask3Resp{}, err
-		}
-		_, err = w1.Write(data)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask3Resp{}, err
-		}
-	}
-	if err = zipWriter.Close(); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask3Resp{}, err
-	}
-
-	res := base64.StdEncoding.EncodeToString(buf.Bytes())
-	return DownloadTask3Resp{File: &res, FileName: nameStr}, nil
+	})
+	return exportZipJSON(ctx, svc.CollectionTask3, filter, func(v model.Task3) string { return v.Name })
 }
 
 func (svc *LabelerService) GetTask3(ctx context.Context, id primitive.ObjectID) (model.Task3, error) {
-	var task model.Task3
-	var users []models.SysUser
-	ids := make([]string, 0)
-	if err := svc.CollectionTask3.FindOne(ctx, bson.D{{"_id", id}}).Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return model.Task3{}, ErrNoDoc
-		}
-		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+	task, err := svc.StoreTask3.Get(ctx, id)
+	if err != nil {
 		return model.Task3{}, err
 	}
-
-	if task.Permissions.Labeler != nil {
-		ids = append(ids, task.Permissions.Labeler.ID)
-	}
-	if task.Permissions.Checker != nil {
-		ids = append(ids, task.Permissions.Checker.ID)
-	}
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
-	if task.Permissions.Labeler != nil {
-		task.Permissions.Labeler.NickName = userMap[task.Permissions.Labeler.ID]
-	}
-	if task.Permissions.Checker != nil {
-		task.Permissions.Checker.NickName = userMap[task.Permissions.Checker.ID]
-	}
+	svc.fillNickNames(ctx, &task.Permissions)
 	return task, nil
 }
@@ -1,27 +1,17 @@
 package service
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"strconv"
-	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"go-admin/app/admin/models"
 	"go-admin/app/labeler/model"
 	"go-admin/common/actions"
-	"go-admin/common/dto"
 	"go-admin/common/log"
 	"go-admin/common/util"
 )
@@ -41,12 +31,8 @@ type Task4FileRow struct {
 }
 
 func (svc *LabelerService) UploadTask4(ctx context.Context, req UploadTask4Req) (UploadTask4Resp, error) {
-	var project model.Project4
-	if err := svc.CollectionProject4.FindOne(ctx, bson.M{"_id": req.ProjectID}).Decode(&project); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return UploadTask4Resp{}, errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	project, err := svc.StoreProject4.Get(ctx, req.ProjectID)
+	if err != nil {
 		return UploadTask4Resp{}, err
 	}
 
@@ -69,7 +55,7 @@ func (svc *LabelerService) UploadTask4(ctx context.Context, req UploadTask4Req)
 			Max:    v.Max,
 		}
 	}
-	tasks := make([]any, len(req.Rows))
+	tasks := make([]model.Task4, len(req.Rows))
 	now := util.Datetime(time.Now())
 	for i, row := range req.Rows {
 		var outputs []model.Task4OutputItem
@@ -104,12 +90,11 @@ func (svc *LabelerService) UploadTask4(ctx context.Context, req UploadTask4Req)
 			Output:      outputs,
 		}
 	}
-	result, err := svc.CollectionTask4.InsertMany(ctx, tasks)
+	count, err := svc.StoreTask4.Insert(ctx, tasks)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return UploadTask4Resp{}, err
 	}
-	return UploadTask4Resp{UploadCount: len(result.InsertedIDs)}, err
+	return UploadTask4Resp{UploadCount: count}, nil
 }
 
 type SearchTask4Req = SearchTaskReq
@@ -125,61 +110,33 @@ type SearchTask4Resp struct {
 	Sort       []int                   `json:"sort"`
 	Text       string                  `json:"text"`
 	Output     []model.Task4OutputItem ` json:"output"`
+	Highlights []Highlight             `json:"highlights,omitempty"`
 }
 
-func (svc *LabelerService) SearchTask4(ctx context.Context, req SearchTask4Req) ([]SearchTask4Resp, int, error) {
+func (svc *LabelerService) SearchTask4(ctx context.Context, req SearchTask4Req) ([]SearchTask4Resp, Page, error) {
 	filter, err := buildFilter(req)
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	cursor, err := svc.CollectionTask4.Find(ctx, filter, buildOptions(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	if err := svc.StoreTask4.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
 	}
 
-	var tasks []model.Task4
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	results := svc.tasksToSearchTask4Resp(ctx, tasks)
-
-	count, err := svc.CollectionTask4.CountDocuments(ctx, filter)
+	tasks, page, err := svc.StoreTask4.Search(ctx, notGold(filter), req.PageQuery)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	return results, int(count), nil
+	res := svc.tasksToSearchTask4Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask4.highlights(tasks[i], req.Content)
+	}
+	return res, page, nil
 }
 
 func (svc *LabelerService) tasksToSearchTask4Resp(ctx context.Context, tasks []model.Task4) []SearchTask4Resp {
-	ids := make([]string, 0)
-	for _, task := range tasks {
-		if task.Permissions.Labeler != nil {
-			ids = append(ids, task.Permissions.Labeler.ID)
-		}
-		if task.Permissions.Checker != nil {
-			ids = append(ids, task.Permissions.Checker.ID)
-		}
-	}
-
+	userMap := svc.nickNames(ctx, util.Map(tasks, func(v model.Task4) model.Permissions { return v.Permissions }))
 	res := make([]SearchTask4Resp, len(tasks))
-
-	var users []models.SysUser
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
 	for i, task := range tasks {
 		var labeler, checker string
 		if task.Permissions.Labeler != nil {
@@ -204,141 +161,42 @@ func (svc *LabelerService) tasksToSearchTask4Resp(ctx context.Context, tasks []m
 	return res
 }
 
-type Task4BatchAllocLabelerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Number    int64              `json:"number"`
-	Persons   []string           `json:"persons"`
-}
+type Task4BatchAllocLabelerReq = BatchAllocReq
 
-type Task4BatchAllocLabelerResp struct {
-	Count int64 `json:"count"`
-}
+type Task4BatchAllocLabelerResp = BatchAllocResp
 
 func (svc *LabelerService) Task4BatchAllocLabeler(ctx context.Context, req Task4BatchAllocLabelerReq) (Task4BatchAllocLabelerResp, error) {
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"status":    model.TaskStatusAllocate,
-		"permissions.labeler": bson.M{
-			"$exists": false,
-		},
-	}
-	count, err := svc.CollectionTask4.CountDocuments(ctx, filter)
+	count, err := svc.StoreTask4.AllocLabeler(ctx, req)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Task4BatchAllocLabelerResp{}, err
 	}
-
-	if count > req.Number {
-		count = req.Number
-	}
-	maxCount := count / int64(len(req.Persons))
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	for _, id := range req.Persons {
-		opts := options.Find().SetProjection(bson.D{{"_id", 1}}).SetLimit(maxCount)
-		result, err := svc.CollectionTask4.Find(ctx, filter, opts)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task4BatchAllocLabelerResp{}, err
-		}
-
-		var tasks []model.Task4
-		if err = result.All(ctx, &tasks); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task4BatchAllocLabelerResp{}, err
-		}
-
-		ft := bson.M{
-			"_id": bson.M{
-				"$in": util.Map(tasks, func(v model.Task4) primitive.ObjectID { return v.ID }),
-			},
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.labeler": model.Person{ID: fmt.Sprint(id)},
-				"status":              model.TaskStatusLabeling,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		if _, err := svc.CollectionTask4.UpdateMany(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task4BatchAllocLabelerResp{}, err
-		}
-	}
-
 	return Task4BatchAllocLabelerResp{Count: count}, nil
 }
 
-type ResetTasks4Req struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Statuses  []string           `json:"statuses"`
-	ResetType int64              `json:"resetType"`
-}
+type ResetTasks4Req = ResetTasksReq
 
-type ResetTasks4Resp struct {
-	Count int64 `json:"count"`
-}
+type ResetTasks4Resp = ResetTasksResp
 
 func (svc *LabelerService) ResetTasks4(ctx context.Context, req ResetTasks4Req) (ResetTasks4Resp, error) {
-	filter := bson.M{}
-	filter["projectId"] = req.ProjectID
-	filter["status"] = bson.M{
-		"$in": req.Statuses,
-	}
-
-	if req.ResetType == 0 {
-		filter["permissions.labeler.id"] = bson.M{
-			"$in": req.Persons,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions": model.Permissions{},
-				"status":      model.TaskStatusAllocate,
-				"updateTime":  util.Datetime(time.Now()),
-			},
-		}
-		result, err := svc.CollectionTask4.UpdateMany(ctx, filter, update)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return ResetTasks4Resp{}, err
-		}
-		return ResetTasks4Resp{Count: result.ModifiedCount}, nil
-	} else {
-		filter["permissions.checker.id"] = bson.M{
-			"$in": req.Persons,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.checker": model.Person{},
-				"status":              model.TaskStatusSubmit,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		result, err := svc.CollectionTask4.UpdateMany(ctx, filter, update)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return ResetTasks4Resp{}, err
-		}
-		return ResetTasks4Resp{Count: result.ModifiedCount}, nil
+	count, err := svc.StoreTask4.Reset(ctx, req)
+	if err != nil {
+		return ResetTasks4Resp{}, err
 	}
+	return ResetTasks4Resp{Count: count}, nil
 }
 
 type UpdateTask4Req struct {
-	UserID        string                  `json:"-"`
-	UserDataScope string                  `json:"-"`
-	ID            primitive.ObjectID      `json:"id"`
-	Output        []model.Task4OutputItem `json:"output"`
+	UserID        string             `json:"-"`
+	UserDataScope string             `json:"-"`
+	ID            primitive.ObjectID `json:"id"`
+	// Version 读取到的任务版本号
+	Version int                     `json:"version"`
+	Output  []model.Task4OutputItem `json:"output"`
 }
 
 func (svc *LabelerService) UpdateTask4(ctx context.Context, req UpdateTask4Req) (model.Task4, error) {
-	var task model.Task4
-	if err := svc.CollectionTask4.FindOne(ctx, bson.M{"_id": req.ID}).Decode(&task); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return model.Task4{}, errors.New("任务不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	task, err := svc.StoreTask4.Get(ctx, req.ID)
+	if err != nil {
 		return model.Task4{}, err
 	}
 	if req.UserDataScope != "1" && req.UserDataScope != "2" && !task.Permissions.IsLabeler(req.UserID) && !task.Permissions.IsChecker(req.UserID) {
@@ -355,20 +213,11 @@ func (svc *LabelerService) UpdateTask4(ctx context.Context, req UpdateTask4Req)
 			"updateTime": task.UpdateTime,
 		},
 	}
-	if _, err := svc.CollectionTask4.UpdateByID(ctx, req.ID, update); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
-		return model.Task4{}, err
-	}
-	return task, nil
+	return svc.StoreTask4.Update(ctx, req.ID, req.Version, update)
 }
 
 func (svc *LabelerService) CheckTask4(ctx context.Context, task model.Task4, req UpdateTask4Req) error {
-	var project model.Project4
-	if err := svc.CollectionProject4.FindOne(ctx, bson.M{"_id": task.ProjectID}).Decode(&project); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	if _, err := svc.StoreProject4.Get(ctx, task.ProjectID); err != nil {
 		return err
 	}
 	for i, v := range req.Output {
@@ -386,46 +235,13 @@ func (svc *LabelerService) CheckTask4(ctx context.Context, task model.Task4, req
 	return nil
 }
 
-type BatchSetTask4StatusReq struct {
-	UserID        string               `json:"-"`
-	UserDataScope string               `json:"-"`
-	IDs           []primitive.ObjectID `json:"ids"`
-	Status        string               `json:"status"`
-	WorkType      int64                `json:"workType"`
-}
-
-type BatchSetTask4StatusResp struct {
-	Count int64 `json:"count"`
-}
-
-func (svc *LabelerService) BatchSetTask4Status(ctx context.Context, req BatchSetTask4StatusReq) (BatchSetTask4StatusResp, error) {
-	if len(req.IDs) == 0 {
-		return BatchSetTask4StatusResp{}, errors.New("什么也没有发生")
-	}
-	filter := bson.M{
-		"_id": bson.M{
-			"$in": req.IDs,
-		},
-	}
-	if req.WorkType != 0 {
-		filter["$or"] = bson.A{
-			bson.M{"permissions.labeler.id": req.UserID},
-			bson.M{"permissions.checker.id": req.UserID},
-		}
-	}
-	normalStatusMap := map[string][]string{
+var task4Workflow = workflowFromRules(
+	map[string][]string{
 		model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		model.TaskStatusChecking: {model.TaskStatusSubmit, model.TaskStatusFailed},
 		model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusSubmit, model.TaskStatusFailed},
-	}
-	specialStatusMap := map[string][]string{
-		model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
-		model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
-		model.TaskStatusChecking: {model.TaskStatusFailed},
-		model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusAllocate, model.TaskStatusFailed},
-	}
-
+	},
 	//任务状态为{未分配}，管理员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
 	//
 	//任务状态为{待标注}，管理员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
@@ -437,38 +253,37 @@ func (svc *LabelerService) BatchSetTask4Status(ctx context.Context, req BatchSet
 	//任务状态为{待审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
 	//
 	//任务状态为{已审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	update := bson.M{
-		"$set": bson.M{
-			"status":     req.Status,
-			"updateTime": util.Datetime(time.Now()),
-		},
-	}
-	if req.WorkType != 0 {
-		if validSourceStatus := normalStatusMap[req.Status]; validSourceStatus != nil {
-			filter["status"] = bson.M{
-				"$in": validSourceStatus,
-			}
-		}
-	} else {
-		if validSourceStatus := specialStatusMap[req.Status]; validSourceStatus != nil {
-			filter["status"] = bson.M{
-				"$in": validSourceStatus,
-			}
-		}
-	}
+	map[string][]string{
+		model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
+		model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
+		model.TaskStatusChecking: {model.TaskStatusFailed},
+		model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusAllocate, model.TaskStatusFailed},
+	},
+)
 
-	result, err := svc.CollectionTask4.UpdateMany(ctx, filter, update)
+type BatchSetTask4StatusReq struct {
+	UserID        string               `json:"-"`
+	UserDataScope string               `json:"-"`
+	IDs           []primitive.ObjectID `json:"ids"`
+	Status        string               `json:"status"`
+	WorkType      int64                `json:"workType"`
+	Reason        string               `json:"reason"`
+}
+
+type BatchSetTask4StatusResp = BatchSetStatusResp
+
+func (svc *LabelerService) BatchSetTask4Status(ctx context.Context, req BatchSetTask4StatusReq) (BatchSetTask4StatusResp, error) {
+	count, err := svc.StoreTask4.SetStatus(ctx, BatchSetStatusReq{
+		UserID: req.UserID,
+		Admin:  req.WorkType == 0,
+		IDs:    req.IDs,
+		Status: req.Status,
+		Reason: req.Reason,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return BatchSetTask4StatusResp{}, err
 	}
-	if int(result.ModifiedCount) < len(req.IDs) {
-		if req.Status == model.TaskStatusSubmit {
-			return BatchSetTask4StatusResp{}, errors.New("提交失败：任务已被分配审核")
-		}
-		return BatchSetTask4StatusResp{}, errors.New("部分任务状态没有修改")
-	}
-	return BatchSetTask4StatusResp{Count: result.ModifiedCount}, err
+	return BatchSetTask4StatusResp{Count: count}, nil
 }
 
 type SearchMyTask4Req struct {
@@ -476,69 +291,31 @@ type SearchMyTask4Req struct {
 	UserID   string
 	Status   []string `json:"status"`
 	TaskType string   `json:"taskType"`
-	dto.Pagination
-}
-
-func (svc *LabelerService) SearchMyTask4(ctx context.Context, req SearchMyTask4Req) ([]SearchTask4Resp, int, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if len(req.Status) != 0 {
-		filter["status"] = bson.M{
-			"$in": req.Status,
-		}
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else if req.TaskType == "审核" {
-		filter["permissions.checker.id"] = req.UserID
-	} else {
-		filter["$or"] = []bson.M{
-			{"permissions.labeler.id": req.UserID},
-			{"permissions.checker.id": req.UserID},
-		}
-	}
-	cursor, err := svc.CollectionTask4.Find(ctx, filter, buildOptions4(req))
+	Content  string   `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
+	PageQuery
+}
+
+func (svc *LabelerService) SearchMyTask4(ctx context.Context, req SearchMyTask4Req) ([]SearchTask4Resp, Page, error) {
+	tasks, page, err := svc.StoreTask4.SearchMy(ctx, SearchMyTasksReq{
+		ProjectID: req.ID,
+		UserID:    req.UserID,
+		TaskType:  req.TaskType,
+		Status:    req.Status,
+		Content:   req.Content,
+		PageQuery: req.PageQuery,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	var tasks []model.Task4
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	results := svc.tasksToSearchTask4Resp(ctx, tasks)
-
-	count, err := svc.CollectionTask4.CountDocuments(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	return results, int(count), nil
-}
-
-func buildOptions4(req SearchMyTask4Req) *options.FindOptions {
-	if req.PageIndex < 1 {
-		req.PageIndex = 1
+		return nil, Page{}, err
 	}
-	if req.PageSize < 1 {
-		req.PageSize = 10
+	res := svc.tasksToSearchTask4Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask4.highlights(tasks[i], req.Content)
 	}
-	opts := options.Find().
-		SetLimit(int64(req.PageSize)).
-		SetSkip(int64((req.PageIndex - 1) * req.PageSize))
-	return opts
+	return res, page, nil
 }
 
 func (svc *LabelerService) DeleteTask4(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionTask4.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete task: ", err.Error())
-		return err
-	}
-	return nil
+	return svc.StoreTask4.Delete(ctx, id)
 }
 
 type DownloadTask4Req struct {
@@ -548,76 +325,24 @@ type DownloadTask4Req struct {
 	UpdateTimeEnd   string             `json:"updateTimeEnd"`
 }
 
-type DownloadTask4Resp struct {
-	File     *string `json:"file"`
-	FileName string  `json:"filename"`
-}
+type DownloadTask4Resp = model.ExportJob
 
+// DownloadTask4 创建后台导出，任务逐个导出为 zip 中的 json 文件
 func (svc *LabelerService) DownloadTask4(ctx context.Context, req DownloadTask4Req) (DownloadTask4Resp, error) {
-	filter := bson.M{
+	return svc.CreateExport(ctx, ExportTypeTask4, req)
+}
+
+func (svc *LabelerService) exportTask4(ctx context.Context, req DownloadTask4Req) (ExportPlan, error) {
+	filter := notGold(bson.M{
 		"projectId": req.ProjectID,
 		"status": bson.M{
 			"$in": req.Status,
 		},
+	})
+	if err := timeRange(filter, "updateTime", req.UpdateTimeStart, req.UpdateTimeEnd); err != nil {
+		return ExportPlan{}, err
 	}
-
-	if len(req.UpdateTimeStart) > 0 && len(req.UpdateTimeEnd) > 0 {
-		startTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeStart)
-		if err != nil {
-			return DownloadTask4Resp{}, ErrTimeParse
-		}
-		endTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeEnd)
-		if err != nil {
-			return DownloadTask4Resp{}, ErrTimeParse
-		}
-		filter["updateTime"] = bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
-		}
-	}
-
-	cursor, err := svc.CollectionTask4.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask4Resp{}, err
-	}
-
-	var tasks []*model.Task4
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask4Resp{}, err
-	}
-
-	nameStr := time.Now().Format("2006-01-02 15-04-05") + "下载文件.zip"
-	buf := new(bytes.Buffer)
-
-	zipWriter := zip.NewWriter(buf)
-
-	for _, task := range tasks {
-		data, err := json.Marshal(task)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask4Resp{}, err
-		}
-		taskName := strings.Split(task.Name, ".")
-		w1, err := zipWriter.Create(taskName[0] + ".json")
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask4Resp{}, err
-		}
-		_, err = w1.Write(data)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask4Resp{}, err
-		}
-	}
-	if err = zipWriter.Close(); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask4Resp{}, err
-	}
-
-	res := base64.StdEncoding.EncodeToString(buf.Bytes())
-	return DownloadTask4Resp{File: &res, FileName: nameStr}, nil
+	return exportZipJSON(ctx, svc.CollectionTask4, filter, func(v model.Task4) string { return v.Name })
 }
 
 type GetTask4Req struct {
@@ -638,93 +363,23 @@ type GetTask4Resp struct {
 }
 
 func (svc *LabelerService) GetTask4(ctx context.Context, req GetTask4Req, p *actions.DataPermission) (GetTask4Resp, error) {
-	var task model.Task4
-	var users []models.SysUser
-	filter := bson.M{}
-	ids := make([]string, 0)
-	userID := strconv.Itoa(p.UserId)
-	if err := svc.CollectionTask4.FindOne(ctx, bson.D{{"_id", req.ID}}).Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return GetTask4Resp{}, ErrNoDoc
-		}
-		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+	detail, err := svc.StoreTask4.Detail(ctx, TaskDetailReq{
+		ID:       req.ID,
+		UserID:   strconv.Itoa(p.UserId),
+		WorkType: req.WorkType,
+		Status:   req.Status,
+		Filter:   buildTask4DetailFilter(req),
+	})
+	if err != nil {
 		return GetTask4Resp{}, err
 	}
-	if req.WorkType == 1 {
-		if !task.Permissions.IsLabeler(userID) {
-			return GetTask4Resp{}, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
-		}
-		filter = bson.M{
-			"projectId":              task.ProjectID,
-			"permissions.labeler.id": userID,
-			"status": bson.M{
-				"$in": req.Status,
-			},
-		}
-	}
-	if req.WorkType == 2 {
-		if !task.Permissions.IsChecker(userID) {
-			return GetTask4Resp{}, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
-		}
-		filter = bson.M{
-			"projectId":              task.ProjectID,
-			"permissions.checker.id": userID,
-			"status": bson.M{
-				"$in": req.Status,
-			},
-		}
-	}
-	if req.WorkType == 0 {
-		filter = buildTask4DetailFilter(req)
-		filter["projectId"] = task.ProjectID
-	}
-	if task.Permissions.Labeler != nil {
-		ids = append(ids, task.Permissions.Labeler.ID)
-	}
-	if task.Permissions.Checker != nil {
-		ids = append(ids, task.Permissions.Checker.ID)
-	}
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
-	if task.Permissions.Labeler != nil {
-		task.Permissions.Labeler.NickName = userMap[task.Permissions.Labeler.ID]
-	}
-	if task.Permissions.Checker != nil {
-		task.Permissions.Checker.NickName = userMap[task.Permissions.Checker.ID]
-	}
-
-	var nextTask model.Task4
-	var lastTask model.Task4
-	filter["_id"] = bson.M{"$gt": task.ID}
-	if err := svc.CollectionTask4.FindOne(ctx, filter).Decode(&nextTask); err != nil {
-		if err != mongo.ErrNoDocuments {
-			log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-			return GetTask4Resp{}, err
-		}
-	}
-
-	filter["_id"] = bson.M{"$lt": task.ID}
-	option := options.FindOne().SetSort(bson.M{"_id": -1})
-	if err := svc.CollectionTask4.FindOne(ctx, filter, option).Decode(&lastTask); err != nil {
-		if err != mongo.ErrNoDocuments {
-			log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-			return GetTask4Resp{}, err
-		}
-	}
-	res := GetTask4Resp{
+	task := detail.Task
+	svc.fillNickNames(ctx, &task.Permissions)
+	return GetTask4Resp{
+		Last:  detail.Last,
+		Next:  detail.Next,
 		Task4: task,
-	}
-	res.Last = lastTask.ID
-	res.Next = nextTask.ID
-	return res, nil
+	}, nil
 }
 
 func buildTask4DetailFilter(req GetTask4Req) bson.M {
@@ -768,95 +423,13 @@ func buildTask4DetailFilter(req GetTask4Req) bson.M {
 	return filter
 }
 
-type Task4BatchAllocCheckerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Number    int64              `json:"number"`
-}
+type Task4BatchAllocCheckerReq = BatchAllocReq
 
-type Task4BatchAllocCheckerResp struct {
-	Count int64 `json:"count"`
-}
+type Task4BatchAllocCheckerResp = BatchAllocResp
 
 func (svc *LabelerService) Task4BatchAllocChecker(ctx context.Context, req Task4BatchAllocCheckerReq) error {
-	if req.Number <= 0 {
-		return errors.New("分配任务数量不合法")
-	}
-	if len(req.Persons) == 0 {
-		return errors.New("分配人员数量不能为0")
-	}
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"status":    model.TaskStatusSubmit,
-	}
-	maxCount := int(req.Number) / len(req.Persons)
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	personMap := make(map[string]int, len(req.Persons))
-	for _, id := range req.Persons {
-		personMap[id] = 0
-	}
-
-	result, err := svc.CollectionTask4.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	var tasks []model.Task
-	if err = result.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	if len(tasks) == 0 {
-		return errors.New("当前无可分配任务")
-	}
-	nowTime := util.Datetime(time.Now())
-	var totalCount int
-	for _, task := range tasks {
-		var minCount = math.MaxInt
-		var minID string
-		for i, v := range personMap {
-			if task.Permissions.Labeler != nil {
-				if i == task.Permissions.Labeler.ID {
-					continue
-				}
-			}
-			if v == maxCount {
-				continue
-			}
-			if v < minCount {
-				minCount = v
-				minID = i
-			}
-		}
-		if minID == "" {
-			continue
-		}
-		personMap[minID]++
-		ft := bson.M{
-			"_id": task.ID,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.checker": model.Person{ID: minID},
-				"status":              model.TaskStatusChecking,
-				"updateTime":          nowTime,
-			},
-		}
-		if _, err := svc.CollectionTask4.UpdateOne(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return err
-		}
-		totalCount++
-		if totalCount == int(req.Number) {
-			break
-		}
-	}
-	if totalCount == 0 {
-		return errors.New("分配失败：标注员和审核员不能是同一人")
-	}
-	return nil
+	_, err := svc.StoreTask4.AllocChecker(ctx, req)
+	return err
 }
 
 type SearchMyTask4CountReq struct {
@@ -874,61 +447,15 @@ type SearchMyTask4CountRes struct {
 }
 
 func (svc *LabelerService) SearchMyTask4Count(ctx context.Context, req SearchMyTask4CountReq) (SearchMyTask4CountRes, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else {
-		filter["permissions.checker.id"] = req.UserID
-	}
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				filter,
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask4.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask4.CountMy(ctx, req.ID, req.UserID, req.TaskType)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return SearchMyTask4CountRes{}, err
 	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return SearchMyTask4CountRes{}, err
-	}
-
-	var resp SearchMyTask4CountRes
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		case model.TaskStatusChecking:
-			resp.Checking = count
-		case model.TaskStatusPassed:
-			resp.Passed = count
-		case model.TaskStatusFailed:
-			resp.Failed = count
-		}
-	}
-	return resp, nil
+	return SearchMyTask4CountRes{
+		Labeling: counts[model.TaskStatusLabeling],
+		Submit:   counts[model.TaskStatusSubmit],
+		Checking: counts[model.TaskStatusChecking],
+		Passed:   counts[model.TaskStatusPassed],
+		Failed:   counts[model.TaskStatusFailed],
+	}, nil
 }
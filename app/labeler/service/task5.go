@@ -1,14 +1,9 @@
 package service
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"math"
-	"reflect"
+	"io"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,7 +18,6 @@ import (
 	"go-admin/app/admin/models"
 	"go-admin/app/labeler/model"
 	"go-admin/common/actions"
-	"go-admin/common/dto"
 	"go-admin/common/log"
 	"go-admin/common/util"
 )
@@ -40,7 +34,7 @@ type UploadTask5Resp struct {
 
 func (svc *LabelerService) UploadTask5(ctx context.Context, req UploadTask5Req) (UploadTask5Resp, error) {
 	var project5 model.Project5
-	if err := svc.CollectionProject5.FindOne(ctx, bson.M{"_id": req.ProjectID}).Decode(&project5); err != nil {
+	if err := svc.CollectionProject5.FindOne(ctx, notDeleted(bson.M{"_id": req.ProjectID})).Decode(&project5); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return UploadTask5Resp{}, errors.New("项目不存在")
 		}
@@ -48,7 +42,7 @@ func (svc *LabelerService) UploadTask5(ctx context.Context, req UploadTask5Req)
 		return UploadTask5Resp{}, err
 	}
 	var folder5 model.Folder
-	if err := svc.CollectionFolder5.FindOne(ctx, bson.M{"_id": project5.FolderID}).Decode(&folder5); err != nil {
+	if err := svc.CollectionFolder5.FindOne(ctx, notDeleted(bson.M{"_id": project5.FolderID})).Decode(&folder5); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return UploadTask5Resp{}, errors.New("文件夹不存在")
 		}
@@ -185,60 +179,33 @@ type SearchTask5Resp struct {
 	EditQuantity   int                 `bson:"editQuantity" json:"editQuantity"`
 	WorkQuantity   int                 `bson:"workQuantity" json:"workQuantity"`
 	Dialog         []model.ContentText `json:"dialog"`
+	Highlights     []Highlight         `json:"highlights,omitempty"`
 }
 
-func (svc *LabelerService) SearchTask5(ctx context.Context, req SearchTask5Req) ([]SearchTask5Resp, int, error) {
+func (svc *LabelerService) SearchTask5(ctx context.Context, req SearchTask5Req) ([]SearchTask5Resp, Page, error) {
 	filter, err := buildFilter(req)
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	cursor, err := svc.CollectionLabeledTask5.Find(ctx, filter, buildOptions(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	var tasks []model.Task5
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	if err := svc.StoreTask5.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
 	}
-	results := svc.tasksToSearchTask5Resp(ctx, tasks)
 
-	count, err := svc.CollectionLabeledTask5.CountDocuments(ctx, filter)
+	tasks, page, err := svc.StoreTask5.Search(ctx, notGold(filter), req.PageQuery)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-	return results, int(count), nil
+	res := svc.tasksToSearchTask5Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask5.highlights(tasks[i], req.Content)
+	}
+	return res, page, nil
 }
 
 func (svc *LabelerService) tasksToSearchTask5Resp(ctx context.Context, tasks []model.Task5) []SearchTask5Resp {
-	ids := make([]string, 0)
-	for _, task := range tasks {
-		if task.Permissions.Labeler != nil {
-			ids = append(ids, task.Permissions.Labeler.ID)
-		}
-		if task.Permissions.Checker != nil {
-			ids = append(ids, task.Permissions.Checker.ID)
-		}
-	}
-
+	userMap := svc.nickNames(ctx, util.Map(tasks, func(v model.Task5) model.Permissions { return v.Permissions }))
 	res := make([]SearchTask5Resp, len(tasks))
-
-	var users []models.SysUser
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
 	for i, task := range tasks {
 		var labeler, checker string
 		if task.Permissions.Labeler != nil {
@@ -304,7 +271,7 @@ func (svc *LabelerService) AllocOneTask5(ctx context.Context, req AllocOneTaskRe
 		"permissions.labeler.id": req.UserId,
 	}
 	var oneLabelingTask5 model.Task5
-	err := svc.CollectionLabeledTask5.FindOne(ctx, fileLabeling).Decode(&oneLabelingTask5)
+	err := svc.CollectionLabeledTask5.FindOne(ctx, notDeleted(fileLabeling)).Decode(&oneLabelingTask5)
 	if err == nil {
 		// 存在待标注任务，只能有一个待标注任务，所以返回这个存在的待标注任务
 		return oneLabelingTask5, errors.New("存在未标注任务")
@@ -317,7 +284,7 @@ func (svc *LabelerService) AllocOneTask5(ctx context.Context, req AllocOneTaskRe
 	//不存在待标注任务，err==mongo.ErrNoDocuments
 	//查询所有存活
 	var project5List []model.Project5
-	cursor, err := svc.CollectionProject5.Find(ctx, bson.M{})
+	cursor, err := svc.CollectionProject5.Find(ctx, notDeleted(bson.M{}))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return model.Task5{}, err
@@ -334,12 +301,12 @@ func (svc *LabelerService) AllocOneTask5(ctx context.Context, req AllocOneTaskRe
 	//当前项目下不存在待标注的，进行新的任务分配
 	filterLabeledTask5 := bson.M{
 		"permissions.labeler.id": req.UserId,
-		//删除project时没有删除project下的task，所以过滤只在存在的project下的task
+		//已彻底删除的历史project下的task还在，所以过滤只在存在的project下的task
 		"projectId": bson.M{
 			"$in": project5Ids,
 		},
 	}
-	cursor, err = svc.CollectionLabeledTask5.Find(ctx, filterLabeledTask5)
+	cursor, err = svc.CollectionLabeledTask5.Find(ctx, notDeleted(filterLabeledTask5))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return model.Task5{}, err
@@ -355,49 +322,47 @@ func (svc *LabelerService) AllocOneTask5(ctx context.Context, req AllocOneTaskRe
 		personSessionID = append(personSessionID, oneTask5.Dialog[0].SessionID)
 	}
 
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"dialog.0.sessionId": bson.M{
-			"$nin": personSessionID,
-		},
-		"dialog.0.priority": bson.M{
-			"$gt": 0,
-		},
-	}
-	//priority优先级字段最大的排在最前面
-	sortTask := bson.D{{"dialog.0.priority", -1}}
-
-	var resp model.Task5
-	optionsTask := options.FindOne().SetSort(sortTask)
-
-	err = svc.CollectionTask5.FindOne(ctx, filter, optionsTask).Decode(&resp)
-	if err != mongo.ErrNoDocuments && err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
+	// 按项目的金标准比例混入金标准对话，金标准对话不扣减优先级
+	resp, isGold, err := svc.claimGoldTask5(ctx, req.ProjectID, personSessionID)
+	if err != nil {
 		return model.Task5{}, err
-	} else if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return model.Task5{}, errors.New("当前没有可领取的新任务")
-	}
-
-	// 更新优先级 更新RequireScore字段
-	var newDialog []model.ContentText
-	for _, dialog := range resp.Dialog {
-		dialog.Priority = dialog.Priority - 1
-		newDialog = append(newDialog, dialog)
 	}
-	updateFilter := bson.M{"_id": resp.ID}
-	var update bson.M
+	if !isGold {
+		filter := bson.M{
+			"projectId": req.ProjectID,
+			"dialog.0.sessionId": bson.M{
+				"$nin": personSessionID,
+			},
+			"dialog.0.priority": bson.M{
+				"$gt": 0,
+			},
+			"gold": bson.M{
+				"$exists": false,
+			},
+		}
+		//priority优先级字段最大的排在最前面
+		sortTask := bson.D{{Key: "dialog.0.priority", Value: -1}}
 
-	if resp.RequireScore == 1 {
-		update = bson.M{"$set": bson.M{"dialog": newDialog, "requireScore": 2}}
-	} else {
-		update = bson.M{"$set": bson.M{"dialog": newDialog}}
+		// 领取和扣减优先级在一次 FindOneAndUpdate 中完成，filter 中的 priority > 0 保证并发领取时不会扣成负数
+		claim := bson.M{"$inc": bson.M{"dialog.$[].priority": -1}}
+		optionsTask := options.FindOneAndUpdate().SetSort(sortTask).SetReturnDocument(options.Before)
+		err = svc.CollectionTask5.FindOneAndUpdate(ctx, notDeleted(filter), claim, optionsTask).Decode(&resp)
+		if err != mongo.ErrNoDocuments && err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return model.Task5{}, err
+		} else if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return model.Task5{}, errors.New("当前没有可领取的新任务")
+		}
 	}
 
-	_, err = svc.CollectionTask5.UpdateOne(ctx, updateFilter, update)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return model.Task5{}, err
+	// 更新RequireScore字段
+	if !isGold && resp.RequireScore == 1 {
+		_, err = svc.CollectionTask5.UpdateOne(ctx, bson.M{"_id": resp.ID, "requireScore": 1}, bson.M{"$set": bson.M{"requireScore": 2}})
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return model.Task5{}, err
+		}
 	}
 
 	//将分配人员信息插入allocTask5
@@ -410,17 +375,56 @@ func (svc *LabelerService) AllocOneTask5(ctx context.Context, req AllocOneTaskRe
 	}
 
 	//为分配出来的task5创建新的ID，以便insert进新表
+	poolID := resp.ID
 	resp.ID = primitive.NewObjectID()
+	if isGold {
+		resp.GoldSource = &poolID
+	}
 	resp.Status = model.TaskStatusLabeling
+	resp.SessionID = resp.Dialog[0].SessionID
+	resp.AllocatedTime = util.Datetime(time.Now())
+	resp.LeaseExpireTime = svc.StoreTask5.leaseExpireTime(time.Now())
 	for i := range resp.Dialog {
 		resp.Dialog[i].UserMessages.UserWant = "无相关信息"
 		resp.Dialog[i].UserMessages.UserImportant = "无相关信息"
 		resp.Dialog[i].UserMessages.UserAbility = "无相关信息"
 	}
 
-	_, err = svc.CollectionLabeledTask5.InsertOne(ctx, resp)
+	// labeledtask5 上 (sessionId, labeler) 唯一，插入失败时归还扣减的优先级
+	_, err = svc.CollectionLabeledTask5.InsertOne(ctx, svc.StoreTask5.withSearchGrams(resp))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
+		if !isGold {
+			if _, err := svc.CollectionTask5.UpdateOne(ctx, bson.M{"_id": poolID}, bson.M{"$inc": bson.M{"dialog.$[].priority": 1}}); err != nil {
+				log.Logger().WithContext(ctx).Error("restore task priority: ", err.Error())
+			}
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return model.Task5{}, errors.New("该会话已经领取过，请重新领取")
+		}
+		return model.Task5{}, err
+	}
+
+	record := svc.StoreTask5.newTransition(model.TaskMeta{
+		ID:        resp.ID,
+		ProjectID: resp.ProjectID,
+		Status:    model.TaskStatusAllocate,
+	}, model.TaskStatusLabeling)
+	record.Actor = req.UserId
+	record.Role = PermissionTypeLabeler
+	record.Reason = "领取任务"
+	if err := svc.StoreTask5.recordTransitions(ctx, []model.TaskTransition{record}); err != nil {
+		return model.Task5{}, err
+	}
+	activity := svc.StoreTask5.newActivity(ctx, model.TaskMeta{
+		ID:          resp.ID,
+		ProjectID:   resp.ProjectID,
+		Permissions: resp.Permissions,
+	}, model.ActivityClaim, []model.FieldChange{
+		{Field: "status", Old: model.TaskStatusAllocate, New: model.TaskStatusLabeling},
+		{Field: "permissions.labeler.id", New: req.UserId},
+	})
+	if err := svc.StoreTask5.recordActivities(ctx, []model.TaskActivity{activity}); err != nil {
 		return model.Task5{}, err
 	}
 
@@ -428,65 +432,24 @@ func (svc *LabelerService) AllocOneTask5(ctx context.Context, req AllocOneTaskRe
 	return resp, nil
 }
 
-type ResetTasks5Req struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Statuses  []string           `json:"statuses"`
-	ResetType int64              `json:"resetType"`
-}
+type ResetTasks5Req = ResetTasksReq
 
-type ResetTasks5Resp struct {
-	Count int64 `json:"count"`
-}
+type ResetTasks5Resp = ResetTasksResp
 
 func (svc *LabelerService) ResetTasks5(ctx context.Context, req ResetTasks5Req) (ResetTasks5Resp, error) {
-	filter := bson.M{}
-	filter["projectId"] = req.ProjectID
-	filter["status"] = bson.M{
-		"$in": req.Statuses,
-	}
-
-	if req.ResetType == 0 {
-		filter["permissions.labeler.id"] = bson.M{
-			"$in": req.Persons,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions": model.Permissions{},
-				"status":      model.TaskStatusAllocate,
-				"updateTime":  util.Datetime(time.Now()),
-			},
-		}
-		result, err := svc.CollectionTask5.UpdateMany(ctx, filter, update)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return ResetTasks5Resp{}, err
-		}
-		return ResetTasks5Resp{Count: result.ModifiedCount}, nil
-	} else {
-		filter["permissions.checker.id"] = bson.M{
-			"$in": req.Persons,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.checker": model.Person{},
-				"status":              model.TaskStatusSubmit,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		result, err := svc.CollectionTask5.UpdateMany(ctx, filter, update)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return ResetTasks5Resp{}, err
-		}
-		return ResetTasks5Resp{Count: result.ModifiedCount}, nil
+	count, err := svc.StoreTask5.Reset(ctx, req)
+	if err != nil {
+		return ResetTasks5Resp{}, err
 	}
+	return ResetTasks5Resp{Count: count}, nil
 }
 
 type UpdateTask5Req struct {
-	UserID        string              `json:"-"`
-	UserDataScope string              `json:"-"`
-	ID            primitive.ObjectID  `json:"id"`
+	UserID        string             `json:"-"`
+	UserDataScope string             `json:"-"`
+	ID            primitive.ObjectID `json:"id"`
+	// Version 读取到的任务版本号
+	Version       int                 `json:"version"`
 	Remark        string              `json:"remark"`
 	RemarkOptions int                 `bson:"remarkOptions" json:"remarkOptions"`
 	Dialog        []model.ContentText `json:"dialog"`
@@ -496,22 +459,7 @@ type UpdateTask5Req struct {
 
 func (svc *LabelerService) UpdateTask5(ctx context.Context, req UpdateTask5Req) (model.Task5, error) {
 	var task model.Task5
-
-	//req.Score大于5或小于0不合法
-	socreType := reflect.TypeOf(req.Score)
-	scoreValue := reflect.ValueOf(req.Score)
-
-	for i := 0; i < socreType.NumField(); i++ {
-		scoreValue := scoreValue.Field(i).Int()
-
-		if scoreValue > 5 || scoreValue < 0 {
-			err := errors.New("评分不合法")
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return model.Task5{}, err
-		}
-	}
-
-	if err := svc.CollectionLabeledTask5.FindOne(ctx, bson.M{"_id": req.ID}).Decode(&task); err != nil {
+	if err := svc.CollectionLabeledTask5.FindOne(ctx, notDeleted(bson.M{"_id": req.ID})).Decode(&task); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return model.Task5{}, errors.New("任务不存在")
 		}
@@ -521,6 +469,13 @@ func (svc *LabelerService) UpdateTask5(ctx context.Context, req UpdateTask5Req)
 	if req.UserDataScope != "1" && req.UserDataScope != "2" && !task.Permissions.IsLabeler(req.UserID) && !task.Permissions.IsChecker(req.UserID) {
 		return model.Task5{}, errors.New("权限不足")
 	}
+	rubric, err := svc.task5Rubric(ctx, task)
+	if err != nil {
+		return model.Task5{}, err
+	}
+	if err := checkScores(rubric, req.Score, req.HasScore); err != nil {
+		return model.Task5{}, err
+	}
 	var editQuantity int
 	for i, oneDialog := range req.Dialog {
 		for j, action := range oneDialog.NewAction {
@@ -559,24 +514,15 @@ func (svc *LabelerService) UpdateTask5(ctx context.Context, req UpdateTask5Req)
 			"remarkLen":     remarkLen,
 			"remarkOptions": req.RemarkOptions,
 			"score":         req.Score,
+			"scoreVersion":  rubric.Version,
+			"scoreTotal":    scoreTotal(rubric, req.Score),
 			"dialog":        task.Dialog,
 			"updateTime":    task.UpdateTime,
 			"hasScore":      req.HasScore,
 			"workQuantity":  workQuantity,
 		},
 	}
-	if _, err := svc.CollectionLabeledTask5.UpdateByID(ctx, req.ID, update); err != nil {
-		log.Logger().WithContext(ctx).Error("update task: ", err.Error())
-		return model.Task5{}, err
-	}
-	if err := svc.CollectionLabeledTask5.FindOne(ctx, bson.M{"_id": req.ID}).Decode(&task); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return model.Task5{}, errors.New("任务不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return model.Task5{}, err
-	}
-	return task, nil
+	return svc.StoreTask5.Update(ctx, req.ID, req.Version, update)
 }
 
 func in(target string, strArray []string) bool {
@@ -594,121 +540,59 @@ var specialNodesList = []string{
 	"花道", "生命意义、人生价值", "香道", "陶艺", "自我暗示", "亲密关系支持", "兴趣爱好小组", "专业性支持", "其他社会性支持", "模拟练习",
 	"其他提供思路、心理作业", "现实类问题", "过往经历思考类", "对未来", "当下发生", "过往经历书写类"}
 
-type BatchSetTask5StatusReq struct {
-	UserID        string               `json:"-"`
-	UserDataScope string               `json:"-"`
-	IDs           []primitive.ObjectID `json:"ids"`
-	Status        string               `json:"status"`
-	WorkType      int64                `json:"workType"`
-}
-
-type BatchSetTask5StatusResp struct {
-	Count int64 `json:"count"`
-}
-
-func (svc *LabelerService) BatchSetTask5Status(ctx context.Context, req BatchSetTask5StatusReq) (BatchSetTask5StatusResp, error) {
-	if len(req.IDs) == 0 {
-		return BatchSetTask5StatusResp{}, errors.New("什么也没有发生")
-	}
-	filter := bson.M{
-		"_id": bson.M{
-			"$in": req.IDs,
-		},
-	}
-	if req.WorkType != 0 {
-		filter["$or"] = bson.A{
-			bson.M{"permissions.labeler.id": req.UserID},
-			bson.M{"permissions.checker.id": req.UserID},
-		}
-	}
-	normalStatusMap := map[string][]string{
+var task5Workflow = workflowFromRules(
+	map[string][]string{
 		model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		model.TaskStatusChecking: {model.TaskStatusSubmit, model.TaskStatusFailed},
 		model.TaskStatusSubmit:   {model.TaskStatusLabeling, model.TaskStatusSubmit},
-	}
-	specialStatusMap := map[string][]string{
+	},
+	map[string][]string{
 		model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		model.TaskStatusChecking: {},
 		model.TaskStatusSubmit:   {},
-	}
+	},
+)
 
-	//任务状态为{待标注}，管理员点击进入之后为标注页面
-	//任务状态为{已提交}，管理员点击进入之后为标注页面
+//任务状态为{待标注}，管理员点击进入之后为标注页面
+//任务状态为{已提交}，管理员点击进入之后为标注页面
 
-	//任务状态为{待审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	//任务状态为{已审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	//任务状态为{审核不通过}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	////////////////////////////////////////////////////////////////////////////////////////////////////////////
-	//任务状态为{待标注}，标注员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
-	//任务状态为{已提交}，标注员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
+//任务状态为{待审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
+//任务状态为{已审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
+//任务状态为{审核不通过}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+//任务状态为{待标注}，标注员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
+//任务状态为{已提交}，标注员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
 
-	//任务状态为{待审核}，审核员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	//任务状态为{已审核}，审核员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	//任务状态为{审核不通过}，审核员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	//                    标注员点击进入之后为标注页面，点击提交之后任务状态变更为待审核
+//任务状态为{待审核}，审核员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
+//任务状态为{已审核}，审核员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
+//任务状态为{审核不通过}，审核员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
+//                    标注员点击进入之后为标注页面，点击提交之后任务状态变更为待审核
 
-	update := bson.M{}
-	if req.Status == model.TaskStatusSubmit {
-		update = bson.M{
-			"$set": bson.M{
-				"status":        req.Status,
-				"updateTime":    util.Datetime(time.Now()),
-				"submittedTime": util.Datetime(time.Now()),
-			},
-		}
-	} else if req.Status == model.TaskStatusFailed {
-		update = bson.M{
-			"$set": bson.M{
-				"status":         req.Status,
-				"updateTime":     util.Datetime(time.Now()),
-				"unsanctionTime": util.Datetime(time.Now()),
-			},
-		}
-	} else if req.Status == model.TaskStatusPassed {
-		update = bson.M{
-			"$set": bson.M{
-				"status":       req.Status,
-				"updateTime":   util.Datetime(time.Now()),
-				"approvedTime": util.Datetime(time.Now()),
-			},
-		}
-	} else {
-		update = bson.M{
-			"$set": bson.M{
-				"status":     req.Status,
-				"updateTime": util.Datetime(time.Now()),
-			},
-		}
-	}
+type BatchSetTask5StatusReq struct {
+	UserID        string               `json:"-"`
+	UserDataScope string               `json:"-"`
+	IDs           []primitive.ObjectID `json:"ids"`
+	Status        string               `json:"status"`
+	WorkType      int64                `json:"workType"`
+	Reason        string               `json:"reason"`
+}
 
-	if req.WorkType != 0 {
-		if validSourceStatus := normalStatusMap[req.Status]; validSourceStatus != nil {
-			filter["status"] = bson.M{
-				"$in": validSourceStatus,
-			}
-		}
-	} else {
-		if validSourceStatus := specialStatusMap[req.Status]; validSourceStatus != nil {
-			filter["status"] = bson.M{
-				"$in": validSourceStatus,
-			}
-		}
-	}
+type BatchSetTask5StatusResp = BatchSetStatusResp
 
-	result, err := svc.CollectionLabeledTask5.UpdateMany(ctx, filter, update)
+func (svc *LabelerService) BatchSetTask5Status(ctx context.Context, req BatchSetTask5StatusReq) (BatchSetTask5StatusResp, error) {
+	count, err := svc.StoreTask5.SetStatus(ctx, BatchSetStatusReq{
+		UserID: req.UserID,
+		Admin:  req.WorkType == 0,
+		IDs:    req.IDs,
+		Status: req.Status,
+		Reason: req.Reason,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return BatchSetTask5StatusResp{}, err
 	}
-	if int(result.ModifiedCount) < len(req.IDs) {
-		if req.Status == model.TaskStatusSubmit {
-			return BatchSetTask5StatusResp{}, errors.New("提交失败：任务已被分配审核")
-		}
-		return BatchSetTask5StatusResp{}, errors.New("部分任务状态没有修改")
-	}
-	return BatchSetTask5StatusResp{Count: result.ModifiedCount}, err
+	return BatchSetTask5StatusResp{Count: count}, nil
 }
 
 type SearchMyTask5Req struct {
@@ -716,69 +600,32 @@ type SearchMyTask5Req struct {
 	UserID   string
 	Status   []string `json:"status"`
 	TaskType string   `json:"taskType"`
-	dto.Pagination
+	Content  string   `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
+	PageQuery
 }
 
-func (svc *LabelerService) SearchMyTask5(ctx context.Context, req SearchMyTask5Req) ([]SearchTask5Resp, int, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if len(req.Status) != 0 {
-		filter["status"] = bson.M{
-			"$in": req.Status,
-		}
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else if req.TaskType == "审核" {
-		filter["permissions.checker.id"] = req.UserID
-	} else {
-		filter["$or"] = []bson.M{
-			{"permissions.labeler.id": req.UserID},
-			{"permissions.checker.id": req.UserID},
-		}
-	}
-	cursor, err := svc.CollectionLabeledTask5.Find(ctx, filter, buildOptions5(req))
+func (svc *LabelerService) SearchMyTask5(ctx context.Context, req SearchMyTask5Req) ([]SearchTask5Resp, Page, error) {
+	tasks, page, err := svc.StoreTask5.SearchMy(ctx, SearchMyTasksReq{
+		ProjectID: req.ID,
+		UserID:    req.UserID,
+		TaskType:  req.TaskType,
+		Status:    req.Status,
+		Content:   req.Content,
+		PageQuery: req.PageQuery,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	var tasks []model.Task5
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	res := svc.tasksToSearchTask5Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask5.highlights(tasks[i], req.Content)
 	}
-	results := svc.tasksToSearchTask5Resp(ctx, tasks)
-
-	count, err := svc.CollectionLabeledTask5.CountDocuments(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	return results, int(count), nil
-}
-
-func buildOptions5(req SearchMyTask5Req) *options.FindOptions {
-	if req.PageIndex < 1 {
-		req.PageIndex = 1
-	}
-	if req.PageSize < 1 {
-		req.PageSize = 10
-	}
-	opts := options.Find().
-		SetLimit(int64(req.PageSize)).
-		SetSkip(int64((req.PageIndex - 1) * req.PageSize))
-	return opts
+	return res, page, nil
 }
 
 func (svc *LabelerService) DeleteTask5(ctx context.Context, id primitive.ObjectID) error {
-
-	var delTask5 model.Task5
-	err := svc.CollectionLabeledTask5.FindOne(ctx, bson.M{"_id": id}).Decode(&delTask5)
+	delTask5, err := svc.StoreTask5.Get(ctx, id)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error("find delete task: ", err.Error())
 		return err
 	}
 	if delTask5.Status == model.TaskStatusLabeling {
@@ -805,8 +652,22 @@ func (svc *LabelerService) DeleteTask5(ctx context.Context, id primitive.ObjectI
 			return err
 		}
 	}
-	if _, err := svc.CollectionLabeledTask5.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete task: ", err.Error())
+	return svc.StoreTask5.Delete(ctx, id)
+}
+
+// restoreTask5Priority 删除待标注任务时归还了对话的优先级，从回收站恢复时重新扣减
+func (svc *LabelerService) restoreTask5Priority(ctx context.Context, id primitive.ObjectID) error {
+	task, err := svc.StoreTask5.Get(ctx, id)
+	if err != nil || task.Status != model.TaskStatusLabeling {
+		return err
+	}
+	filter := notDeleted(bson.M{
+		"projectId":          task.ProjectID,
+		"dialog.0.sessionId": task.Dialog[0].SessionID,
+		"dialog.0.priority":  bson.M{"$gt": 0},
+	})
+	if _, err := svc.CollectionTask5.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"dialog.$[].priority": -1}}); err != nil {
+		log.Logger().WithContext(ctx).Error("update task priority: ", err.Error())
 		return err
 	}
 	return nil
@@ -821,91 +682,27 @@ type DownloadTask5Req struct {
 	SubmittedTimeEnd   string             `json:"submittedTimeEnd"`
 }
 
-type DownloadTask5Resp struct {
-	File     *string `json:"file"`
-	FileName string  `json:"filename"`
-}
+type DownloadTask5Resp = model.ExportJob
 
+// DownloadTask5 创建后台导出，任务逐个导出为 zip 中的 json 文件
 func (svc *LabelerService) DownloadTask5(ctx context.Context, req DownloadTask5Req) (DownloadTask5Resp, error) {
-	filter := bson.M{
+	return svc.CreateExport(ctx, ExportTypeTask5, req)
+}
+
+func (svc *LabelerService) exportTask5(ctx context.Context, req DownloadTask5Req) (ExportPlan, error) {
+	filter := notGold(bson.M{
 		"projectId": req.ProjectID,
 		"status": bson.M{
 			"$in": req.Status,
 		},
+	})
+	if err := timeRange(filter, "updateTime", req.UpdateTimeStart, req.UpdateTimeEnd); err != nil {
+		return ExportPlan{}, err
 	}
-
-	if len(req.UpdateTimeStart) > 0 && len(req.UpdateTimeEnd) > 0 {
-		startTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeStart)
-		if err != nil {
-			return DownloadTask5Resp{}, ErrTimeParse
-		}
-		endTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeEnd)
-		if err != nil {
-			return DownloadTask5Resp{}, ErrTimeParse
-		}
-		filter["updateTime"] = bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
-		}
-	}
-
-	if len(req.SubmittedTimeStart) > 0 && len(req.SubmittedTimeEnd) > 0 {
-		startTime, err := time.Parse(util.TimeLayoutDatetime, req.SubmittedTimeStart)
-		if err != nil {
-			return DownloadTask5Resp{}, ErrTimeParse
-		}
-		endTime, err := time.Parse(util.TimeLayoutDatetime, req.SubmittedTimeEnd)
-		if err != nil {
-			return DownloadTask5Resp{}, ErrTimeParse
-		}
-		filter["submittedTime"] = bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
-		}
-	}
-
-	cursor, err := svc.CollectionLabeledTask5.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask5Resp{}, err
+	if err := timeRange(filter, "submittedTime", req.SubmittedTimeStart, req.SubmittedTimeEnd); err != nil {
+		return ExportPlan{}, err
 	}
-
-	var tasks []*model.Task5
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask5Resp{}, err
-	}
-
-	nameStr := time.Now().Format("2006-01-02 15-04-05") + "下载文件.zip"
-	buf := new(bytes.Buffer)
-
-	zipWriter := zip.NewWriter(buf)
-
-	for _, task := range tasks {
-		data, err := json.Marshal(task)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask5Resp{}, err
-		}
-		taskName := strings.Split(task.Name, ".")
-		w1, err := zipWriter.Create(taskName[0] + ".json")
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask5Resp{}, err
-		}
-		_, err = w1.Write(data)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask5Resp{}, err
-		}
-	}
-	if err = zipWriter.Close(); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask5Resp{}, err
-	}
-
-	res := base64.StdEncoding.EncodeToString(buf.Bytes())
-	return DownloadTask5Resp{File: &res, FileName: nameStr}, nil
+	return exportZipJSON(ctx, svc.CollectionLabeledTask5, filter, func(v model.Task5) string { return v.Name })
 }
 
 type GetTask5Req struct {
@@ -926,94 +723,23 @@ type GetTask5Resp struct {
 }
 
 func (svc *LabelerService) GetTask5(ctx context.Context, req GetTask5Req, p *actions.DataPermission) (GetTask5Resp, error) {
-	var task model.Task5
-	var users []models.SysUser
-	filter := bson.M{}
-	ids := make([]string, 0)
-	userID := strconv.Itoa(p.UserId)
-	if err := svc.CollectionLabeledTask5.FindOne(ctx, bson.D{{"_id", req.ID}}).Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return GetTask5Resp{}, ErrNoDoc
-		}
-		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+	detail, err := svc.StoreTask5.Detail(ctx, TaskDetailReq{
+		ID:       req.ID,
+		UserID:   strconv.Itoa(p.UserId),
+		WorkType: req.WorkType,
+		Status:   req.Status,
+		Filter:   buildTask5DetailFilter(req),
+	})
+	if err != nil {
 		return GetTask5Resp{}, err
 	}
-	if req.WorkType == 1 {
-		if !task.Permissions.IsLabeler(userID) {
-			return GetTask5Resp{}, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
-		}
-		filter = bson.M{
-			"projectId":              task.ProjectID,
-			"permissions.labeler.id": userID,
-			"status": bson.M{
-				"$in": req.Status,
-			},
-		}
-	}
-	if req.WorkType == 2 {
-		if !task.Permissions.IsChecker(userID) {
-			return GetTask5Resp{}, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
-		}
-		filter = bson.M{
-			"projectId":              task.ProjectID,
-			"permissions.checker.id": userID,
-			"status": bson.M{
-				"$in": req.Status,
-			},
-		}
-	}
-	if req.WorkType == 0 {
-
-		filter = buildTask5DetailFilter(req)
-		filter["projectId"] = task.ProjectID
-	}
-	if task.Permissions.Labeler != nil {
-		ids = append(ids, task.Permissions.Labeler.ID)
-	}
-	if task.Permissions.Checker != nil {
-		ids = append(ids, task.Permissions.Checker.ID)
-	}
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
-	if task.Permissions.Labeler != nil {
-		task.Permissions.Labeler.NickName = userMap[task.Permissions.Labeler.ID]
-	}
-	if task.Permissions.Checker != nil {
-		task.Permissions.Checker.NickName = userMap[task.Permissions.Checker.ID]
-	}
-
-	var nextTask model.Task5
-	var lastTask model.Task5
-	filter["_id"] = bson.M{"$gt": task.ID}
-	if err := svc.CollectionLabeledTask5.FindOne(ctx, filter).Decode(&nextTask); err != nil {
-		if err != mongo.ErrNoDocuments {
-			log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-			return GetTask5Resp{}, err
-		}
-	}
-
-	filter["_id"] = bson.M{"$lt": task.ID}
-	option := options.FindOne().SetSort(bson.M{"_id": -1})
-	if err := svc.CollectionLabeledTask5.FindOne(ctx, filter, option).Decode(&lastTask); err != nil {
-		if err != mongo.ErrNoDocuments {
-			log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-			return GetTask5Resp{}, err
-		}
-	}
-	res := GetTask5Resp{
+	task := detail.Task
+	svc.fillNickNames(ctx, &task.Permissions)
+	return GetTask5Resp{
+		Last:  detail.Last,
+		Next:  detail.Next,
 		Task5: task,
-	}
-	res.Last = lastTask.ID
-	res.Next = nextTask.ID
-	return res, nil
+	}, nil
 }
 
 func buildTask5DetailFilter(req GetTask5Req) bson.M {
@@ -1074,63 +800,17 @@ type SearchMyTask5CountRes struct {
 }
 
 func (svc *LabelerService) SearchMyTask5Count(ctx context.Context, req SearchMyTask5CountReq) (SearchMyTask5CountRes, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else {
-		filter["permissions.checker.id"] = req.UserID
-	}
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				filter,
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask5.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask5.CountMy(ctx, req.ID, req.UserID, req.TaskType)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return SearchMyTask5CountRes{}, err
-	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return SearchMyTask5CountRes{}, err
 	}
-
-	var resp SearchMyTask5CountRes
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		case model.TaskStatusChecking:
-			resp.Checking = count
-		case model.TaskStatusPassed:
-			resp.Passed = count
-		case model.TaskStatusFailed:
-			resp.Failed = count
-		}
-	}
-	return resp, nil
+	return SearchMyTask5CountRes{
+		Labeling: counts[model.TaskStatusLabeling],
+		Submit:   counts[model.TaskStatusSubmit],
+		Checking: counts[model.TaskStatusChecking],
+		Passed:   counts[model.TaskStatusPassed],
+		Failed:   counts[model.TaskStatusFailed],
+	}, nil
 }
 
 type DownloadScoreReq struct {
@@ -1138,8 +818,16 @@ type DownloadScoreReq struct {
 	ProjectID primitive.ObjectID `json:"projectId"`
 }
 
-func (svc *LabelerService) DownloadScore(ctx context.Context, req DownloadScoreReq) (DownloadTask2Resp, error) {
+// DownloadScore 创建后台导出，按打分模板导出打分情况
+func (svc *LabelerService) DownloadScore(ctx context.Context, req DownloadScoreReq) (model.ExportJob, error) {
+	return svc.CreateExport(ctx, ExportTypeScore, req)
+}
 
+func (svc *LabelerService) exportScore(ctx context.Context, req DownloadScoreReq) (ExportPlan, error) {
+	project, err := svc.StoreProject5.Get(ctx, req.ProjectID)
+	if err != nil {
+		return ExportPlan{}, err
+	}
 	filter := bson.M{}
 	if len(req.Version) == 0 {
 		filter = bson.M{
@@ -1155,21 +843,16 @@ func (svc *LabelerService) DownloadScore(ctx context.Context, req DownloadScoreR
 			"hasScore": true,
 		}
 	}
-
-	cursor, err := svc.CollectionLabeledTask5.Find(ctx, filter)
+	total, err := svc.CollectionLabeledTask5.CountDocuments(ctx, notDeleted(filter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
-	}
-	var task5 []model.Task5
-	if err := cursor.All(ctx, &task5); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
+		return ExportPlan{}, err
 	}
+
 	loc, err := time.LoadLocation("Asia/Shanghai")
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
+		return ExportPlan{}, err
 	}
 	currentTime := time.Now().In(loc)
 	currentTimeString := currentTime.Format("2006-01-02 15:04:05")
@@ -1182,35 +865,42 @@ func (svc *LabelerService) DownloadScore(ctx context.Context, req DownloadScoreR
 	}
 	nameStr := currentTimeString + "-Ubot:" + ubotVsersion + "-" + "打分情况"
 
-	idList := make([]string, len(task5))
-	for _, task := range task5 {
-		idList = append(idList, task.Permissions.Labeler.ID)
-	}
-
-	var users []models.SysUser
-	db := svc.GormDB.WithContext(ctx).Where("user_id IN (?)", idList).
-		Find(&users)
-
-	nicknameList := make(map[string]string, len(users))
-	for _, user := range users {
-		nicknameList[strconv.Itoa(user.UserId)] = user.NickName
-	}
-
-	if err := db.Error; err != nil {
-		return DownloadTask2Resp{}, err
-	}
-
-	excleData := getTask5ScoreExcle(task5, nicknameList)
-	data, filename, err := util.EmbedExcelData(
-		nameStr,
-		excleData,
-		ctx,
-	)
-	if err != nil {
-		return DownloadTask2Resp{}, err
-	}
-	return DownloadTask2Resp{File: data, FileName: filename}, nil
-
+	return ExportPlan{
+		FileName: nameStr + ".xlsx",
+		Total:    total,
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			columns, dimensions, err := svc.scoreColumns(ctx, project, filter)
+			if err != nil {
+				return err
+			}
+			labelers, err := svc.CollectionLabeledTask5.Distinct(ctx, "permissions.labeler.id", notDeleted(filter))
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			nicknameList := svc.userNickNames(ctx, util.Map(labelers, func(v interface{}) string {
+				id, _ := v.(string)
+				return id
+			}))
+			// 只读取打分需要的字段，对话内容不读出来
+			opts := options.Find().SetProjection(bson.M{
+				"name":           1,
+				"dialog.version": 1,
+				"permissions":    1,
+				"score":          1,
+				"scoreVersion":   1,
+				"remarkOptions":  1,
+			})
+			cursor, err := svc.CollectionLabeledTask5.Find(ctx, notDeleted(filter), opts)
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			return writeExcel(ctx, cursor, w, columns, func(_ int, task model.Task5) []interface{} {
+				return task5ScoreRow(task, project, dimensions, nicknameList)
+			}, progress)
+		},
+	}, nil
 }
 
 type DownloadWorkloadReq struct {
@@ -1227,7 +917,12 @@ type DownloadWorkloadReq struct {
 	SubmittedTimeEnd   string             `json:"submittedTimeEnd"`
 }
 
-func (svc *LabelerService) DownloadWorkload(ctx context.Context, req DownloadWorkloadReq) (DownloadTask2Resp, error) {
+// DownloadWorkload 创建后台导出，按标注员统计工作量
+func (svc *LabelerService) DownloadWorkload(ctx context.Context, req DownloadWorkloadReq) (model.ExportJob, error) {
+	return svc.CreateExport(ctx, ExportTypeWorkload, req)
+}
+
+func (svc *LabelerService) exportWorkload(ctx context.Context, req DownloadWorkloadReq) (ExportPlan, error) {
 
 	//req.bool全为false时变为全为true
 	if req.RemarkQuantity == false && req.WordCount == false && req.EditQuantity == false && req.WorkQuantity == false {
@@ -1237,18 +932,6 @@ func (svc *LabelerService) DownloadWorkload(ctx context.Context, req DownloadWor
 		req.WorkQuantity = true
 	}
 
-	var users []models.SysUser
-	db := svc.GormDB.WithContext(ctx).Where("user_id IN (?)", req.PersonList).
-		Find(&users)
-	if err := db.Error; err != nil {
-		return DownloadTask2Resp{}, err
-	}
-
-	var userMap = make(map[int]string, len(users))
-	for _, user := range users {
-		userMap[user.UserId] = user.NickName
-	}
-
 	filter := bson.M{
 		"status": req.TaskStatus,
 		"permissions.labeler.id": bson.M{
@@ -1256,74 +939,28 @@ func (svc *LabelerService) DownloadWorkload(ctx context.Context, req DownloadWor
 		},
 		"projectId": req.ProjectID,
 	}
-
-	if len(req.UpdateTimeStart) > 0 && len(req.UpdateTimeEnd) > 0 {
-		startTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeStart)
-		if err != nil {
-			return DownloadTask2Resp{}, ErrTimeParse
-		}
-		endTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeEnd)
-		if err != nil {
-			return DownloadTask2Resp{}, ErrTimeParse
-		}
-		filter["updateTime"] = bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
-		}
+	if err := timeRange(filter, "updateTime", req.UpdateTimeStart, req.UpdateTimeEnd); err != nil {
+		return ExportPlan{}, err
 	}
-
-	if len(req.SubmittedTimeStart) > 0 && len(req.SubmittedTimeEnd) > 0 {
-		startTime, err := time.Parse(util.TimeLayoutDatetime, req.SubmittedTimeStart)
-		if err != nil {
-			return DownloadTask2Resp{}, ErrTimeParse
-		}
-		endTime, err := time.Parse(util.TimeLayoutDatetime, req.SubmittedTimeEnd)
-		if err != nil {
-			return DownloadTask2Resp{}, ErrTimeParse
-		}
-		filter["submittedTime"] = bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
-		}
+	if err := timeRange(filter, "submittedTime", req.SubmittedTimeStart, req.SubmittedTimeEnd); err != nil {
+		return ExportPlan{}, err
 	}
 
 	pipe := mongo.Pipeline{
 		bson.D{
-			{
-				"$match",
-				filter,
-			},
+			{Key: "$match", Value: notDeleted(filter)},
 		},
 		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$permissions.labeler.id"},
-					//{"permissions_labeler_id", bson.D{{"$first", "$permissions.labeler.id"}}},
-					{"remarkLen", bson.D{{"$sum", "$remarkLen"}}},
-					{"wordCount", bson.D{{"$sum", "$wordCount"}}},
-					{"editQuantity", bson.D{{"$sum", "$editQuantity"}}},
-					{"workQuantity", bson.D{{"$sum", "$workQuantity"}}},
-				},
-			},
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$permissions.labeler.id"},
+				{Key: "remarkLen", Value: bson.D{{Key: "$sum", Value: "$remarkLen"}}},
+				{Key: "wordCount", Value: bson.D{{Key: "$sum", Value: "$wordCount"}}},
+				{Key: "editQuantity", Value: bson.D{{Key: "$sum", Value: "$editQuantity"}}},
+				{Key: "workQuantity", Value: bson.D{{Key: "$sum", Value: "$workQuantity"}}},
+			}},
 		},
 	}
 
-	cursor, err := svc.CollectionLabeledTask5.Aggregate(ctx, pipe)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
-	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask2Resp{}, err
-	}
-
 	nameStr := ""
 	if len(req.UpdateTimeStart) > 0 {
 		nameStr += "StartTime:" + req.UpdateTimeStart
@@ -1333,18 +970,54 @@ func (svc *LabelerService) DownloadWorkload(ctx context.Context, req DownloadWor
 	}
 	nameStr += "DownloadTime:"
 
-	columns := []string{"咨询师", "阅读量", "修改量", "点评量", "工作量"}
-	excelData := getTask5WorkExcle(results, userMap, req)
+	return ExportPlan{
+		FileName: util.GetExcelFileName(nameStr),
+		Write: func(ctx context.Context, w io.Writer, progress func()) error {
+			var users []models.SysUser
+			db := svc.GormDB.WithContext(ctx).Where("user_id IN (?)", req.PersonList).
+				Find(&users)
+			if err := db.Error; err != nil {
+				return err
+			}
+			var userMap = make(map[int]string, len(users))
+			for _, user := range users {
+				userMap[user.UserId] = user.NickName
+			}
 
-	data, filename, err := util.CreateExcelFile(
-		excelData,
-		columns,
-		nameStr,
-	)
-	if err != nil {
-		return DownloadTask2Resp{}, err
-	}
-	return DownloadTask2Resp{File: data, FileName: filename}, nil
+			cursor, err := svc.CollectionLabeledTask5.Aggregate(ctx, pipe)
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+			defer func() {
+				_ = cursor.Close(ctx)
+			}()
+			var results []bson.M
+			for cursor.Next(ctx) {
+				var result bson.M
+				if err := cursor.Decode(&result); err != nil {
+					log.Logger().WithContext(ctx).Error(err.Error())
+					return err
+				}
+				results = append(results, result)
+				progress()
+			}
+			if err := cursor.Err(); err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return err
+			}
+
+			// 金标准准确率低于项目阈值的标注员在导出中标记
+			accuracies, _, err := svc.StoreTask5.labelerAccuracies(ctx, req.ProjectID)
+			if err != nil {
+				return err
+			}
+
+			columns := []string{"咨询师", "阅读量", "修改量", "点评量", "工作量", "金标准数", "金标准准确率", "准确率低于阈值"}
+			excelData := getTask5WorkExcle(results, userMap, accuracies, req)
+			return util.MakeExcelFromData(excelData, columns).Write(w)
+		},
+	}, nil
 }
 
 type ProportionalScoringReq struct {
@@ -1366,6 +1039,12 @@ func (svc *LabelerService) ProportionalScoring(ctx context.Context, req Proporti
 
 	var resp ProportionalScoringResp
 
+	// 抽中的对话按当前的打分模板打分，模板之后修改也不影响
+	project, err := svc.StoreProject5.Get(ctx, req.ProjectID)
+	if err != nil {
+		return ProportionalScoringResp{}, err
+	}
+
 	filter := bson.M{
 		"projectId": req.ProjectID,
 		"dialog.0.version": bson.M{
@@ -1374,8 +1053,7 @@ func (svc *LabelerService) ProportionalScoring(ctx context.Context, req Proporti
 		"requireScore": 0,
 	}
 
-	var err error
-	resp.MatchedCount, err = svc.CollectionTask5.CountDocuments(ctx, filter)
+	resp.MatchedCount, err = svc.CollectionTask5.CountDocuments(ctx, notDeleted(filter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return ProportionalScoringResp{}, err
@@ -1385,18 +1063,12 @@ func (svc *LabelerService) ProportionalScoring(ctx context.Context, req Proporti
 
 	pipeline := mongo.Pipeline{
 		bson.D{
-			{
-				"$match",
-				filter,
-			},
+			{Key: "$match", Value: notDeleted(filter)},
 		},
 		bson.D{
-			{
-				"$sample",
-				bson.D{
-					{"size", resp.ModifiedCount},
-				},
-			},
+			{Key: "$sample", Value: bson.D{
+				{Key: "size", Value: resp.ModifiedCount},
+			}},
 		},
 	}
 	var modifyTask []model.Task5
@@ -1422,8 +1094,9 @@ func (svc *LabelerService) ProportionalScoring(ctx context.Context, req Proporti
 	}
 
 	update := bson.D{
-		{"$set", bson.D{
-			{"requireScore", 1},
+		{Key: "$set", Value: bson.D{
+			{Key: "requireScore", Value: 1},
+			{Key: "scoreVersion", Value: project.CurrentRubric().Version},
 		}},
 	}
 	_, err = svc.CollectionTask5.UpdateMany(context.Background(), modifyFilter, update)
@@ -1435,7 +1108,7 @@ func (svc *LabelerService) ProportionalScoring(ctx context.Context, req Proporti
 
 }
 
-func getTask5WorkExcle(results []bson.M, user map[int]string, req DownloadWorkloadReq) [][]interface{} {
+func getTask5WorkExcle(results []bson.M, user map[int]string, accuracies map[string]*LabelerAccuracy, req DownloadWorkloadReq) [][]interface{} {
 	var data [][]interface{}
 	for _, result := range results {
 		s := []interface{}{}
@@ -1465,38 +1138,82 @@ func getTask5WorkExcle(results []bson.M, user map[int]string, req DownloadWorklo
 		} else {
 			s = append(s, "")
 		}
+		if accuracy, ok := accuracies[result["_id"].(string)]; ok && accuracy.Accuracy != nil {
+			s = append(s, accuracy.Graded, *accuracy.Accuracy)
+			if accuracy.Flagged {
+				s = append(s, "是")
+			} else {
+				s = append(s, "否")
+			}
+		} else {
+			s = append(s, 0, "", "")
+		}
 		data = append(data, s)
 	}
 	return data
 }
 
-func getTask5ScoreExcle(task5 []model.Task5, nicknameList map[string]string) [][]interface{} {
-	var data [][]interface{}
-	for _, task := range task5 {
-
-		s := []interface{}{}
-
-		s = append(s, task.Dialog[0].Version)
-		s = append(s, task.Name)
-		s = append(s, nicknameList[task.Permissions.Labeler.ID])
-		s = append(s, task.Score.IdentifyRisk)
-		s = append(s, task.Score.UnderstandingVisitor)
-		s = append(s, task.Score.ExpressingCare)
-		s = append(s, task.Score.AcceptFeedback)
-		s = append(s, task.Score.AdvanceProcess)
-		s = append(s, task.Score.PromoteProcess)
-		s = append(s, task.Score.InspirationAssistance)
-		s = append(s, task.Score.RelieveEmotions)
-		s = append(s, task.Score.VisitorFeedback)
-		if task.RemarkOptions == 1 {
-			s = append(s, "及格")
+// scoreColumns 导出打分的表头，导出范围内用到的各版本打分模板的维度按键合并，名称取最新版本
+func (svc *LabelerService) scoreColumns(ctx context.Context, project model.Project5, filter bson.M) ([]string, []string, error) {
+	pipe := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: notDeleted(filter)}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$scoreVersion", 0}}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: -1}}}},
+	}
+	cursor, err := svc.CollectionLabeledTask5.Aggregate(ctx, pipe)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, nil, err
+	}
+	var versions []struct {
+		Version int `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &versions); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, nil, err
+	}
+	columns := []string{"版本", "任务名", "咨询师", "打分模板版本"}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, v := range versions {
+		rubric, _ := project.Rubric(v.Version)
+		for _, d := range rubric.Dimensions {
+			if !seen[d.Key] {
+				seen[d.Key] = true
+				keys = append(keys, d.Key)
+				columns = append(columns, d.Label)
+			}
 		}
-		if task.RemarkOptions == 2 {
-			s = append(s, "不及格")
+	}
+	return append(columns, "加权总分", "评价"), keys, nil
+}
+
+func task5ScoreRow(task model.Task5, project model.Project5, keys []string, nicknameList map[string]string) []interface{} {
+	var labeler string
+	if task.Permissions.Labeler != nil {
+		labeler = nicknameList[task.Permissions.Labeler.ID]
+	}
+	var version int
+	if len(task.Dialog) > 0 {
+		version = task.Dialog[0].Version
+	}
+	s := []interface{}{version, task.Name, labeler, task.ScoreVersion}
+	for _, key := range keys {
+		if score, ok := task.Score[key]; ok {
+			s = append(s, score)
+		} else {
+			s = append(s, "")
 		}
-		data = append(data, s)
 	}
-	return data
+	rubric, _ := project.Rubric(task.ScoreVersion)
+	s = append(s, scoreTotal(rubric, task.Score))
+	switch task.RemarkOptions {
+	case 1:
+		s = append(s, "及格")
+	case 2:
+		s = append(s, "不及格")
+	}
+	return s
 }
 
 type Node struct {
@@ -1997,7 +1714,7 @@ func (svc *LabelerService) SearchTask5Count(ctx context.Context, req Req) (int,
 		"projectId": req.ProjectID,
 	}
 
-	cursor, err := svc.CollectionLabeledTask5.Find(ctx, filter)
+	cursor, err := svc.CollectionLabeledTask5.Find(ctx, notDeleted(filter))
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
 		return 0, err
@@ -2038,93 +1755,11 @@ func (svc *LabelerService) SearchTask5Count(ctx context.Context, req Req) (int,
 	return updateCount, nil
 }
 
-type Task5BatchAllocCheckerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Number    int64              `json:"number"`
-}
+type Task5BatchAllocCheckerReq = BatchAllocReq
 
-type Task5BatchAllocCheckerResp struct {
-	Count int64 `json:"count"`
-}
+type Task5BatchAllocCheckerResp = BatchAllocResp
 
 func (svc *LabelerService) Task5BatchAllocChecker(ctx context.Context, req Task5BatchAllocCheckerReq) error {
-	if req.Number <= 0 {
-		return errors.New("分配任务数量不合法")
-	}
-	if len(req.Persons) == 0 {
-		return errors.New("分配人员数量不能为0")
-	}
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"status":    model.TaskStatusSubmit,
-	}
-	maxCount := int(req.Number) / len(req.Persons)
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	personMap := make(map[string]int, len(req.Persons))
-	for _, id := range req.Persons {
-		personMap[id] = 0
-	}
-
-	result, err := svc.CollectionLabeledTask5.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	var tasks []model.Task5
-	if err = result.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return err
-	}
-	if len(tasks) == 0 {
-		return errors.New("当前无可分配任务")
-	}
-	nowTime := util.Datetime(time.Now())
-	var totalCount int
-	for _, task := range tasks {
-		var minCount = math.MaxInt
-		var minID string
-		for i, v := range personMap {
-			if task.Permissions.Labeler != nil {
-				if i == task.Permissions.Labeler.ID {
-					continue
-				}
-			}
-			if v == maxCount {
-				continue
-			}
-			if v < minCount {
-				minCount = v
-				minID = i
-			}
-		}
-		if minID == "" {
-			continue
-		}
-		personMap[minID]++
-		ft := bson.M{
-			"_id": task.ID,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.checker": model.Person{ID: minID},
-				"status":              model.TaskStatusChecking,
-				"updateTime":          nowTime,
-			},
-		}
-		if _, err := svc.CollectionLabeledTask5.UpdateOne(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return err
-		}
-		totalCount++
-		if totalCount == int(req.Number) {
-			break
-		}
-	}
-	if totalCount == 0 {
-		return errors.New("分配失败：标注员和审核员不能是同一人")
-	}
-	return nil
+	_, err := svc.StoreTask5.AllocChecker(ctx, req)
+	return err
 }
@@ -1,26 +1,18 @@
 package service
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"go-admin/app/admin/models"
 	"go-admin/app/labeler/model"
 	"go-admin/common/actions"
-	"go-admin/common/dto"
 	"go-admin/common/log"
 	"go-admin/common/util"
 )
@@ -36,26 +28,22 @@ type UploadTask6Resp struct {
 }
 
 func (svc *LabelerService) UploadTask6(ctx context.Context, req UploadTask6Req) (UploadTask6Resp, error) {
-	var project6 model.Project6
-	if err := svc.CollectionProject6.FindOne(ctx, bson.M{"_id": req.ProjectID}).Decode(&project6); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return UploadTask6Resp{}, errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	project6, folder6, err := svc.project6WithFolder(ctx, req.ProjectID)
+	if err != nil {
 		return UploadTask6Resp{}, err
 	}
-	var folder6 model.Folder
-	if err := svc.CollectionFolder6.FindOne(ctx, bson.M{"_id": project6.FolderID}).Decode(&folder6); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return UploadTask6Resp{}, errors.New("文件夹不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	schema, err := project6Schema(project6)
+	if err != nil {
 		return UploadTask6Resp{}, err
 	}
-	insertTasks := make([]any, len(req.Tasks6))
-
+	tasks := make([]model.Task6, len(req.Tasks6))
 	for i, oneTask6 := range req.Tasks6 {
-		insertTasks[i] = model.Task6{
+		if schema != nil {
+			if err := validateJSON(schema, oneTask6.Rpg); err != nil {
+				return UploadTask6Resp{}, fmt.Errorf("%s 不符合项目的 JSON Schema：%w", req.Name[i], err)
+			}
+		}
+		tasks[i] = model.Task6{
 			ID:          primitive.NewObjectID(),
 			Name:        req.Name[i],
 			FullName:    folder6.Name + "/" + project6.Name + "/" + req.Name[i],
@@ -66,12 +54,28 @@ func (svc *LabelerService) UploadTask6(ctx context.Context, req UploadTask6Req)
 			Rpg:         oneTask6.Rpg,
 		}
 	}
-	result, err := svc.CollectionTask6.InsertMany(ctx, insertTasks)
+	count, err := svc.StoreTask6.Insert(ctx, tasks)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return UploadTask6Resp{}, err
 	}
-	return UploadTask6Resp{UploadCount: len(result.InsertedIDs)}, err
+	return UploadTask6Resp{UploadCount: count}, nil
+}
+
+// project6WithFolder 查询项目及其所在文件夹，用于拼接任务全名
+func (svc *LabelerService) project6WithFolder(ctx context.Context, projectID primitive.ObjectID) (model.Project6, model.Folder, error) {
+	project6, err := svc.StoreProject6.Get(ctx, projectID)
+	if err != nil {
+		return model.Project6{}, model.Folder{}, err
+	}
+	var folder6 model.Folder
+	if err := svc.CollectionFolder6.FindOne(ctx, notDeleted(bson.M{"_id": project6.FolderID})).Decode(&folder6); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return model.Project6{}, model.Folder{}, errors.New("文件夹不存在")
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.Project6{}, model.Folder{}, err
+	}
+	return project6, folder6, nil
 }
 
 type SearchTask6Req = SearchTaskReq
@@ -84,57 +88,33 @@ type SearchTask6Resp struct {
 	Labeler    string             `json:"labeler"`
 	Checker    string             `json:"checker"`
 	UpdateTime util.Datetime      `json:"updateTime"`
+	Highlights []Highlight        `json:"highlights,omitempty"`
 }
 
-func (svc *LabelerService) SearchTask6(ctx context.Context, req SearchTask6Req) ([]SearchTask6Resp, int, error) {
+func (svc *LabelerService) SearchTask6(ctx context.Context, req SearchTask6Req) ([]SearchTask6Resp, Page, error) {
 	filter, err := buildFilter(req)
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	cursor, err := svc.CollectionTask6.Find(ctx, filter, buildOptions(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+	if err := svc.StoreTask6.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
 	}
 
-	var tasks []model.Task6
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	results := svc.tasksToSearchTask6Resp(ctx, tasks)
-
-	count, err := svc.CollectionTask6.CountDocuments(ctx, filter)
+	tasks, page, err := svc.StoreTask6.Search(ctx, notGold(filter), req.PageQuery)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
+	}
+	res := svc.tasksToSearchTask6Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask6.highlights(tasks[i], req.Content)
 	}
-	return results, int(count), nil
+	return res, page, nil
 }
 
 func (svc *LabelerService) tasksToSearchTask6Resp(ctx context.Context, tasks []model.Task6) []SearchTask6Resp {
-	ids := make([]string, 0)
-	for _, task := range tasks {
-		if task.Permissions.Labeler != nil {
-			ids = append(ids, task.Permissions.Labeler.ID)
-		}
-	}
-
+	userMap := svc.nickNames(ctx, util.Map(tasks, func(v model.Task6) model.Permissions { return v.Permissions }))
 	res := make([]SearchTask6Resp, len(tasks))
-
-	var users []models.SysUser
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
 	for i, task := range tasks {
 		var labeler string
 		if task.Permissions.Labeler != nil {
@@ -153,125 +133,28 @@ func (svc *LabelerService) tasksToSearchTask6Resp(ctx context.Context, tasks []m
 	return res
 }
 
-type Task6BatchAllocLabelerReq struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Number    int64              `json:"number"`
-	Persons   []string           `json:"persons"`
-}
+type Task6BatchAllocLabelerReq = BatchAllocReq
 
-type Task6BatchAllocLabelerResp struct {
-	Count int64 `json:"count"`
-}
+type Task6BatchAllocLabelerResp = BatchAllocResp
 
 func (svc *LabelerService) Task6BatchAllocLabeler(ctx context.Context, req Task6BatchAllocLabelerReq) (Task6BatchAllocLabelerResp, error) {
-	filter := bson.M{
-		"projectId": req.ProjectID,
-		"status":    model.TaskStatusAllocate,
-		"permissions.labeler": bson.M{
-			"$exists": false,
-		},
-	}
-	count, err := svc.CollectionTask6.CountDocuments(ctx, filter)
+	count, err := svc.StoreTask6.AllocLabeler(ctx, req)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return Task6BatchAllocLabelerResp{}, err
 	}
-
-	if count > req.Number {
-		count = req.Number
-	}
-	maxCount := count / int64(len(req.Persons))
-	if maxCount < 1 {
-		maxCount = 1
-	}
-	for _, id := range req.Persons {
-		opts := options.Find().SetProjection(bson.D{{"_id", 1}}).SetLimit(maxCount)
-		result, err := svc.CollectionTask6.Find(ctx, filter, opts)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task6BatchAllocLabelerResp{}, err
-		}
-
-		var tasks []model.Task6
-		if err = result.All(ctx, &tasks); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task6BatchAllocLabelerResp{}, err
-		}
-
-		ft := bson.M{
-			"_id": bson.M{
-				"$in": util.Map(tasks, func(v model.Task6) primitive.ObjectID { return v.ID }),
-			},
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.labeler": model.Person{ID: fmt.Sprint(id)},
-				"status":              model.TaskStatusLabeling,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		if _, err := svc.CollectionTask6.UpdateMany(ctx, ft, update); err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return Task6BatchAllocLabelerResp{}, err
-		}
-	}
-
 	return Task6BatchAllocLabelerResp{Count: count}, nil
 }
 
-type ResetTasks6Req struct {
-	ProjectID primitive.ObjectID `json:"projectId"`
-	Persons   []string           `json:"persons"`
-	Statuses  []string           `json:"statuses"`
-	ResetType int64              `json:"resetType"`
-}
+type ResetTasks6Req = ResetTasksReq
 
-type ResetTasks6Resp struct {
-	Count int64 `json:"count"`
-}
+type ResetTasks6Resp = ResetTasksResp
 
 func (svc *LabelerService) ResetTasks6(ctx context.Context, req ResetTasks6Req) (ResetTasks6Resp, error) {
-	filter := bson.M{}
-	filter["projectId"] = req.ProjectID
-	filter["status"] = bson.M{
-		"$in": req.Statuses,
-	}
-
-	if req.ResetType == 0 {
-		filter["permissions.labeler.id"] = bson.M{
-			"$in": req.Persons,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions": model.Permissions{},
-				"status":      model.TaskStatusAllocate,
-				"updateTime":  util.Datetime(time.Now()),
-			},
-		}
-		result, err := svc.CollectionTask6.UpdateMany(ctx, filter, update)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return ResetTasks6Resp{}, err
-		}
-		return ResetTasks6Resp{Count: result.ModifiedCount}, nil
-	} else {
-		filter["permissions.checker.id"] = bson.M{
-			"$in": req.Persons,
-		}
-		update := bson.M{
-			"$set": bson.M{
-				"permissions.checker": model.Person{},
-				"status":              model.TaskStatusSubmit,
-				"updateTime":          util.Datetime(time.Now()),
-			},
-		}
-		result, err := svc.CollectionTask6.UpdateMany(ctx, filter, update)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return ResetTasks6Resp{}, err
-		}
-		return ResetTasks6Resp{Count: result.ModifiedCount}, nil
+	count, err := svc.StoreTask6.Reset(ctx, req)
+	if err != nil {
+		return ResetTasks6Resp{}, err
 	}
+	return ResetTasks6Resp{Count: count}, nil
 }
 
 type UpdateTask6Req struct {
@@ -279,16 +162,13 @@ type UpdateTask6Req struct {
 	UserDataScope string             `json:"-"`
 	ID            primitive.ObjectID `json:"id"`
 	Rpg           util.GzipJSON      `json:"rpg"`
-	Version       int                `json:"version"`
+	// Version 读取到的任务版本号
+	Version int `json:"version"`
 }
 
 func (svc *LabelerService) UpdateTask6(ctx context.Context, req UpdateTask6Req) (model.Task6, error) {
-	var task model.Task6
-	if err := svc.CollectionTask6.FindOne(ctx, bson.M{"_id": req.ID}).Decode(&task); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return model.Task6{}, errors.New("任务不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	task, err := svc.StoreTask6.Get(ctx, req.ID)
+	if err != nil {
 		return model.Task6{}, err
 	}
 
@@ -296,84 +176,38 @@ func (svc *LabelerService) UpdateTask6(ctx context.Context, req UpdateTask6Req)
 		return model.Task6{}, errors.New("权限不足")
 	}
 
+	project, err := svc.StoreProject6.Get(ctx, task.ProjectID)
+	if err != nil {
+		return model.Task6{}, err
+	}
+	schema, err := project6Schema(project)
+	if err != nil {
+		return model.Task6{}, err
+	}
+	if schema != nil {
+		if err := validateJSON(schema, req.Rpg); err != nil {
+			return model.Task6{}, fmt.Errorf("不符合项目的 JSON Schema：%w", err)
+		}
+	}
+
 	task.Rpg = req.Rpg
 	task.UpdateTime = util.Datetime(time.Now())
 	update := bson.M{
 		"$set": bson.M{
 			"rpg":        task.Rpg,
 			"updateTime": task.UpdateTime,
-			"version":    req.Version,
 		},
 	}
-
-	filter := bson.M{}
-	if req.Version == 1 {
-		filter = bson.M{
-			"_id": req.ID,
-			"$or": bson.A{
-				bson.M{"version": 0},
-				bson.M{"version": bson.M{"$exists": false}},
-			},
-		}
-	} else {
-		filter = bson.M{
-			"_id":     req.ID,
-			"version": req.Version - 1,
-		}
-	}
-	updateResult, err := svc.CollectionTask6.UpdateOne(ctx, filter, update)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return model.Task6{}, err
-	}
-	if updateResult.MatchedCount == 0 {
-		log.Logger().WithContext(ctx).Warn("查询的文档不存在或版本过旧,请刷新重试,version=", req.Version)
-		return model.Task6{}, errors.New("查询的文档不存在或版本过旧,请刷新重试")
-	} else {
-		return model.Task6{}, nil
-	}
+	return svc.StoreTask6.Update(ctx, req.ID, req.Version, update)
 }
 
-type BatchSetTask6StatusReq struct {
-	UserID        string               `json:"-"`
-	UserDataScope string               `json:"-"`
-	IDs           []primitive.ObjectID `json:"ids"`
-	Status        string               `json:"status"`
-	WorkType      int64                `json:"workType"`
-}
-
-type BatchSetTask6StatusResp struct {
-	Count int64 `json:"count"`
-}
-
-func (svc *LabelerService) BatchSetTask6Status(ctx context.Context, req BatchSetTask6StatusReq) (BatchSetTask6StatusResp, error) {
-	if len(req.IDs) == 0 {
-		return BatchSetTask6StatusResp{}, errors.New("什么也没有发生")
-	}
-	filter := bson.M{
-		"_id": bson.M{
-			"$in": req.IDs,
-		},
-	}
-	if req.WorkType != 0 {
-		filter["$or"] = bson.A{
-			bson.M{"permissions.labeler.id": req.UserID},
-			bson.M{"permissions.checker.id": req.UserID},
-		}
-	}
-	normalStatusMap := map[string][]string{
+var task6Workflow = workflowFromRules(
+	map[string][]string{
 		//model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		//model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusFailed},
 		//model.TaskStatusChecking: {model.TaskStatusSubmit, model.TaskStatusFailed},
 		model.TaskStatusSubmit: {model.TaskStatusLabeling, model.TaskStatusSubmit /*, model.TaskStatusFailed*/},
-	}
-	specialStatusMap := map[string][]string{
-		//model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
-		//model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
-		//model.TaskStatusChecking: {model.TaskStatusFailed},
-		model.TaskStatusSubmit: {model.TaskStatusLabeling, model.TaskStatusAllocate, model.TaskStatusSubmit /*, model.TaskStatusFailed*/},
-	}
-
+	},
 	//任务状态为{未分配}，管理员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
 	//
 	//任务状态为{待标注}，管理员点击进入之后为标注页面，点击提交之后任务状态变更为已提交
@@ -385,38 +219,37 @@ func (svc *LabelerService) BatchSetTask6Status(ctx context.Context, req BatchSet
 	//任务状态为{待审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
 	//
 	//任务状态为{已审核}，管理员点击进入之后为审核页面，点击审核通过之后任务状态变更为已审核，点击审核不通过之后任务状态变更为审核不通过
-	update := bson.M{
-		"$set": bson.M{
-			"status":     req.Status,
-			"updateTime": util.Datetime(time.Now()),
-		},
-	}
-	if req.WorkType != 0 {
-		if validSourceStatus := normalStatusMap[req.Status]; validSourceStatus != nil {
-			filter["status"] = bson.M{
-				"$in": validSourceStatus,
-			}
-		}
-	} else {
-		if validSourceStatus := specialStatusMap[req.Status]; validSourceStatus != nil {
-			filter["status"] = bson.M{
-				"$in": validSourceStatus,
-			}
-		}
-	}
+	map[string][]string{
+		//model.TaskStatusFailed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
+		//model.TaskStatusPassed:   {model.TaskStatusChecking, model.TaskStatusPassed, model.TaskStatusSubmit},
+		//model.TaskStatusChecking: {model.TaskStatusFailed},
+		model.TaskStatusSubmit: {model.TaskStatusLabeling, model.TaskStatusAllocate, model.TaskStatusSubmit /*, model.TaskStatusFailed*/},
+	},
+)
+
+type BatchSetTask6StatusReq struct {
+	UserID        string               `json:"-"`
+	UserDataScope string               `json:"-"`
+	IDs           []primitive.ObjectID `json:"ids"`
+	Status        string               `json:"status"`
+	WorkType      int64                `json:"workType"`
+	Reason        string               `json:"reason"`
+}
 
-	result, err := svc.CollectionTask6.UpdateMany(ctx, filter, update)
+type BatchSetTask6StatusResp = BatchSetStatusResp
+
+func (svc *LabelerService) BatchSetTask6Status(ctx context.Context, req BatchSetTask6StatusReq) (BatchSetTask6StatusResp, error) {
+	count, err := svc.StoreTask6.SetStatus(ctx, BatchSetStatusReq{
+		UserID: req.UserID,
+		Admin:  req.WorkType == 0,
+		IDs:    req.IDs,
+		Status: req.Status,
+		Reason: req.Reason,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return BatchSetTask6StatusResp{}, err
 	}
-	if int(result.ModifiedCount) < len(req.IDs) {
-		if req.Status == model.TaskStatusSubmit {
-			return BatchSetTask6StatusResp{}, errors.New("提交失败：任务已被分配审核")
-		}
-		return BatchSetTask6StatusResp{}, errors.New("部分任务状态没有修改")
-	}
-	return BatchSetTask6StatusResp{Count: result.ModifiedCount}, err
+	return BatchSetTask6StatusResp{Count: count}, nil
 }
 
 type SearchMyTask6Req struct {
@@ -424,69 +257,31 @@ type SearchMyTask6Req struct {
 	UserID   string
 	Status   []string `json:"status"`
 	TaskType string   `json:"taskType"`
-	dto.Pagination
+	Content  string   `json:"content"` // 搜索任务内容，返回结果中带有匹配的摘要
+	PageQuery
 }
 
-func (svc *LabelerService) SearchMyTask6(ctx context.Context, req SearchMyTask6Req) ([]SearchTask6Resp, int, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if len(req.Status) != 0 {
-		filter["status"] = bson.M{
-			"$in": req.Status,
-		}
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else if req.TaskType == "审核" {
-		filter["permissions.checker.id"] = req.UserID
-	} else {
-		filter["$or"] = []bson.M{
-			{"permissions.labeler.id": req.UserID},
-			{"permissions.checker.id": req.UserID},
-		}
-	}
-	cursor, err := svc.CollectionTask6.Find(ctx, filter, buildOptions6(req))
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-
-	var tasks []model.Task6
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
-	}
-	results := svc.tasksToSearchTask6Resp(ctx, tasks)
-
-	count, err := svc.CollectionTask6.CountDocuments(ctx, filter)
+func (svc *LabelerService) SearchMyTask6(ctx context.Context, req SearchMyTask6Req) ([]SearchTask6Resp, Page, error) {
+	tasks, page, err := svc.StoreTask6.SearchMy(ctx, SearchMyTasksReq{
+		ProjectID: req.ID,
+		UserID:    req.UserID,
+		TaskType:  req.TaskType,
+		Status:    req.Status,
+		Content:   req.Content,
+		PageQuery: req.PageQuery,
+	})
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return nil, 0, err
+		return nil, Page{}, err
 	}
-
-	return results, int(count), nil
-}
-
-func buildOptions6(req SearchMyTask6Req) *options.FindOptions {
-	if req.PageIndex < 1 {
-		req.PageIndex = 1
+	res := svc.tasksToSearchTask6Resp(ctx, tasks)
+	for i := range res {
+		res[i].Highlights = svc.StoreTask6.highlights(tasks[i], req.Content)
 	}
-	if req.PageSize < 1 {
-		req.PageSize = 10
-	}
-	opts := options.Find().
-		SetLimit(int64(req.PageSize)).
-		SetSkip(int64((req.PageIndex - 1) * req.PageSize))
-	return opts
+	return res, page, nil
 }
 
 func (svc *LabelerService) DeleteTask6(ctx context.Context, id primitive.ObjectID) error {
-	if _, err := svc.CollectionTask6.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
-		log.Logger().WithContext(ctx).Error("delete task: ", err.Error())
-		return err
-	}
-	return nil
+	return svc.StoreTask6.Delete(ctx, id)
 }
 
 type DownloadTask6Req struct {
@@ -496,76 +291,24 @@ type DownloadTask6Req struct {
 	UpdateTimeEnd   string             `json:"updateTimeEnd"`
 }
 
-type DownloadTask6Resp struct {
-	File     *string `json:"file"`
-	FileName string  `json:"filename"`
-}
+type DownloadTask6Resp = model.ExportJob
 
+// DownloadTask6 创建后台导出，任务逐个导出为 zip 中的 json 文件
 func (svc *LabelerService) DownloadTask6(ctx context.Context, req DownloadTask6Req) (DownloadTask6Resp, error) {
-	filter := bson.M{
+	return svc.CreateExport(ctx, ExportTypeTask6, req)
+}
+
+func (svc *LabelerService) exportTask6(ctx context.Context, req DownloadTask6Req) (ExportPlan, error) {
+	filter := notGold(bson.M{
 		"projectId": req.ProjectID,
 		"status": bson.M{
 			"$in": req.Status,
 		},
+	})
+	if err := timeRange(filter, "updateTime", req.UpdateTimeStart, req.UpdateTimeEnd); err != nil {
+		return ExportPlan{}, err
 	}
-
-	if len(req.UpdateTimeStart) > 0 && len(req.UpdateTimeEnd) > 0 {
-		startTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeStart)
-		if err != nil {
-			return DownloadTask6Resp{}, ErrTimeParse
-		}
-		endTime, err := time.Parse(util.TimeLayoutDatetime, req.UpdateTimeEnd)
-		if err != nil {
-			return DownloadTask6Resp{}, ErrTimeParse
-		}
-		filter["updateTime"] = bson.M{
-			"$gte": startTime,
-			"$lte": endTime,
-		}
-	}
-
-	cursor, err := svc.CollectionTask6.Find(ctx, filter)
-	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask6Resp{}, err
-	}
-
-	var tasks []*model.Task6
-	if err := cursor.All(ctx, &tasks); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask6Resp{}, err
-	}
-
-	nameStr := time.Now().Format("2006-01-02 15-04-05") + "下载文件.zip"
-	buf := new(bytes.Buffer)
-
-	zipWriter := zip.NewWriter(buf)
-
-	for _, task := range tasks {
-		data, err := json.Marshal(task)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask6Resp{}, err
-		}
-		taskName := strings.Split(task.Name, ".")
-		w1, err := zipWriter.Create(taskName[0] + ".json")
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask6Resp{}, err
-		}
-		_, err = w1.Write(data)
-		if err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-			return DownloadTask6Resp{}, err
-		}
-	}
-	if err = zipWriter.Close(); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return DownloadTask6Resp{}, err
-	}
-
-	res := base64.StdEncoding.EncodeToString(buf.Bytes())
-	return DownloadTask6Resp{File: &res, FileName: nameStr}, nil
+	return exportZipJSON(ctx, svc.CollectionTask6, filter, func(v model.Task6) string { return v.Name })
 }
 
 type GetTask6Req struct {
@@ -586,110 +329,28 @@ type GetTask6Resp struct {
 }
 
 func (svc *LabelerService) GetTask6(ctx context.Context, req GetTask6Req, p *actions.DataPermission) (GetTask6Resp, error) {
-	var task model.Task6
-	var users []models.SysUser
-	filter := bson.M{}
-	ids := make([]string, 0)
-	userID := strconv.Itoa(p.UserId)
-	if err := svc.CollectionTask6.FindOne(ctx, bson.D{{"_id", req.ID}}).Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return GetTask6Resp{}, ErrNoDoc
-		}
-		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-		return GetTask6Resp{}, err
-	}
-	if req.WorkType == 1 {
-		if !task.Permissions.IsLabeler(userID) {
-			return GetTask6Resp{}, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
-		}
-		filter = bson.M{
-			"projectId":              task.ProjectID,
-			"permissions.labeler.id": userID,
-			"status": bson.M{
-				"$in": req.Status,
-			},
-		}
-	}
-	if req.WorkType == 2 {
-		if !task.Permissions.IsChecker(userID) {
-			return GetTask6Resp{}, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
-		}
-		filter = bson.M{
-			"projectId":              task.ProjectID,
-			"permissions.checker.id": userID,
-			"status": bson.M{
-				"$in": req.Status,
-			},
-		}
-	}
-	if req.WorkType == 0 {
-		filter = buildTask6DetailFilter(req)
-		filter["projectId"] = task.ProjectID
-	}
-	if task.Permissions.Labeler != nil {
-		ids = append(ids, task.Permissions.Labeler.ID)
-	}
-	if task.Permissions.Checker != nil {
-		ids = append(ids, task.Permissions.Checker.ID)
-	}
-	if len(ids) > 0 {
-		db := svc.GormDB.WithContext(ctx).Find(&users).Select("user_id, nick_name").Where("user_id in ?", ids)
-		if err := db.Error; err != nil {
-			log.Logger().WithContext(ctx).Error(err.Error())
-		}
-	}
-	userMap := make(map[string]string)
-	for _, v := range users {
-		userMap[strconv.Itoa(v.UserId)] = v.NickName
-	}
-	if task.Permissions.Labeler != nil {
-		task.Permissions.Labeler.NickName = userMap[task.Permissions.Labeler.ID]
-	}
-	if task.Permissions.Checker != nil {
-		task.Permissions.Checker.NickName = userMap[task.Permissions.Checker.ID]
-	}
-
-	var nextTask model.Task6
-	var lastTask model.Task6
-	filter["_id"] = bson.M{"$gt": task.ID}
-	if err := svc.CollectionTask6.FindOne(ctx, filter).Decode(&nextTask); err != nil {
-		if err != mongo.ErrNoDocuments {
-			log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-			return GetTask6Resp{}, err
-		}
-	}
-
-	filter["_id"] = bson.M{"$lt": task.ID}
-	option := options.FindOne().SetSort(bson.M{"_id": -1})
-	if err := svc.CollectionTask6.FindOne(ctx, filter, option).Decode(&lastTask); err != nil {
-		if err != mongo.ErrNoDocuments {
-			log.Logger().WithContext(ctx).Error("get task: ", err.Error())
-			return GetTask6Resp{}, err
-		}
-	}
-	var project6 model.Project6
-	if err := svc.CollectionProject6.FindOne(ctx, bson.M{"_id": task.ProjectID}).Decode(&project6); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return GetTask6Resp{}, errors.New("项目不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	detail, err := svc.StoreTask6.Detail(ctx, TaskDetailReq{
+		ID:       req.ID,
+		UserID:   strconv.Itoa(p.UserId),
+		WorkType: req.WorkType,
+		Status:   req.Status,
+		Filter:   buildTask6DetailFilter(req),
+	})
+	if err != nil {
 		return GetTask6Resp{}, err
 	}
-	var folder6 model.Folder
-	if err := svc.CollectionFolder6.FindOne(ctx, bson.M{"_id": project6.FolderID}).Decode(&folder6); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return GetTask6Resp{}, errors.New("文件夹不存在")
-		}
-		log.Logger().WithContext(ctx).Error(err.Error())
+	task := detail.Task
+	svc.fillNickNames(ctx, &task.Permissions)
+	project6, folder6, err := svc.project6WithFolder(ctx, task.ProjectID)
+	if err != nil {
 		return GetTask6Resp{}, err
 	}
 	task.FullName = folder6.Name + "/" + project6.Name + "/" + task.Name
-	res := GetTask6Resp{
+	return GetTask6Resp{
+		Last:  detail.Last,
+		Next:  detail.Next,
 		Task6: task,
-	}
-	res.Last = lastTask.ID
-	res.Next = nextTask.ID
-	return res, nil
+	}, nil
 }
 
 func buildTask6DetailFilter(req GetTask6Req) bson.M {
@@ -750,61 +411,15 @@ type SearchMyTask6CountRes struct {
 }
 
 func (svc *LabelerService) SearchMyTask6Count(ctx context.Context, req SearchMyTask6CountReq) (SearchMyTask6CountRes, error) {
-	filter := bson.M{
-		"projectId": req.ID,
-	}
-	if req.TaskType == "标注" {
-		filter["permissions.labeler.id"] = req.UserID
-	} else {
-		filter["permissions.checker.id"] = req.UserID
-	}
-	pipe := mongo.Pipeline{
-		bson.D{
-			{
-				"$match",
-				filter,
-			},
-		},
-		bson.D{
-			{
-				"$group",
-				bson.D{
-					{"_id", "$status"},
-					{"count", bson.D{{"$sum", 1}}},
-				},
-			},
-		},
-	}
-	cursor, err := svc.CollectionTask6.Aggregate(ctx, pipe)
+	counts, err := svc.StoreTask6.CountMy(ctx, req.ID, req.UserID, req.TaskType)
 	if err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
 		return SearchMyTask6CountRes{}, err
 	}
-	defer func() {
-		_ = cursor.Close(ctx)
-	}()
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		log.Logger().WithContext(ctx).Error(err.Error())
-		return SearchMyTask6CountRes{}, err
-	}
-
-	var resp SearchMyTask6CountRes
-	for _, result := range results {
-		count := int64(result["count"].(int32))
-		switch result["_id"] {
-		case model.TaskStatusLabeling:
-			resp.Labeling = count
-		case model.TaskStatusSubmit:
-			resp.Submit = count
-		case model.TaskStatusChecking:
-			resp.Checking = count
-		case model.TaskStatusPassed:
-			resp.Passed = count
-		case model.TaskStatusFailed:
-			resp.Failed = count
-		}
-	}
-	return resp, nil
+	return SearchMyTask6CountRes{
+		Labeling: counts[model.TaskStatusLabeling],
+		Submit:   counts[model.TaskStatusSubmit],
+		Checking: counts[model.TaskStatusChecking],
+		Passed:   counts[model.TaskStatusPassed],
+		Failed:   counts[model.TaskStatusFailed],
+	}, nil
 }
@@ -0,0 +1,917 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+var (
+	ErrTaskNotFound = errors.New("任务不存在")
+	// ErrVersionConflict 任务已被其他人修改，返回该错误时同时返回服务器上的任务
+	ErrVersionConflict = errors.New("任务已被其他人修改，请刷新或合并后重试")
+)
+
+// TaskStore 任务类型的通用存储，T 为该类型的任务文档。
+// 查询、分配、重置、状态流转、删除和统计只在这里实现一次，各类型只保留自己的上传、修改和导出逻辑。
+type TaskStore[T any] struct {
+	*TaskType
+}
+
+func NewTaskStore[T any](t *TaskType) *TaskStore[T] {
+	return &TaskStore[T]{TaskType: t}
+}
+
+func (s *TaskStore[T]) Insert(ctx context.Context, tasks []T) (int, error) {
+	return s.InsertBatch(ctx, tasks, primitive.NewObjectID())
+}
+
+// InsertBatch 插入任务并写入上传批次 uploadBatch，分多次插入的同一次上传使用相同的批次
+func (s *TaskStore[T]) InsertBatch(ctx context.Context, tasks []T, batch primitive.ObjectID) (int, error) {
+	if len(tasks) == 0 {
+		return 0, nil
+	}
+	docs := make([]any, len(tasks))
+	for i := range tasks {
+		doc, err := withUploadBatch(s.withSearchGrams(tasks[i]), batch)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return 0, err
+		}
+		docs[i] = doc
+	}
+	result, err := s.Tasks.InsertMany(ctx, docs)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	activities := make([]model.TaskActivity, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return len(result.InsertedIDs), err
+		}
+		var meta model.TaskMeta
+		if err := bson.Unmarshal(raw, &meta); err != nil {
+			return len(result.InsertedIDs), err
+		}
+		activities = append(activities, s.newActivity(ctx, meta, model.ActivityUpload, nil))
+	}
+	if err := s.recordActivities(ctx, activities); err != nil {
+		return len(result.InsertedIDs), err
+	}
+	return len(result.InsertedIDs), nil
+}
+
+func withUploadBatch(doc any, batch primitive.ObjectID) (bson.D, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	return append(d, bson.E{Key: "uploadBatch", Value: batch}), nil
+}
+
+func (s *TaskStore[T]) Get(ctx context.Context, id primitive.ObjectID) (T, error) {
+	var task T
+	if err := s.Tasks.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&task); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return task, ErrTaskNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return task, err
+	}
+	return task, nil
+}
+
+func (s *TaskStore[T]) Find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := s.Tasks.Find(ctx, notDeleted(filter), opts...)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	var tasks []T
+	if err := cursor.All(ctx, &tasks); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Search 分页查询，按 _id 排序；总数按 q.Count 统计，和分页查询并发执行
+func (s *TaskStore[T]) Search(ctx context.Context, filter bson.M, q PageQuery) ([]T, Page, error) {
+	if err := q.validate(); err != nil {
+		return nil, Page{}, err
+	}
+	var page Page
+	var countErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		page, countErr = countPage(ctx, s.Tasks, filter, &q)
+	}()
+	tasks, err := s.Find(ctx, q.pageFilter(filter), q.findOptions())
+	<-done
+	if err != nil {
+		return nil, Page{}, err
+	}
+	if countErr != nil {
+		log.Logger().WithContext(ctx).Error(countErr.Error())
+		return nil, Page{}, countErr
+	}
+	page.Next = nextCursor(tasks, q.GetPageSize())
+	return tasks, page, nil
+}
+
+type SearchMyTasksReq struct {
+	ProjectID primitive.ObjectID
+	UserID    string
+	TaskType  string
+	Status    []string
+	Content   string
+	PageQuery
+}
+
+// SearchMy 查询分配给当前用户的任务，Content 不为空时按内容搜索
+func (s *TaskStore[T]) SearchMy(ctx context.Context, req SearchMyTasksReq) ([]T, Page, error) {
+	filter := myTasksFilter(req.ProjectID, req.UserID, req.TaskType, req.Status)
+	if err := s.withContent(filter, req.Content); err != nil {
+		return nil, Page{}, err
+	}
+	return s.Search(ctx, filter, req.PageQuery)
+}
+
+// myTasksFilter taskType 为"标注"/"审核"时只匹配对应角色，否则匹配任一角色
+func myTasksFilter(projectID primitive.ObjectID, userID string, taskType string, status []string) bson.M {
+	filter := bson.M{
+		"projectId": projectID,
+	}
+	if len(status) != 0 {
+		filter["status"] = bson.M{
+			"$in": status,
+		}
+	}
+	if taskType == PermissionTypeLabeler {
+		filter["permissions.labeler.id"] = userID
+	} else if taskType == PermissionTypeChecker {
+		filter["permissions.checker.id"] = userID
+	} else {
+		filter["$or"] = []bson.M{
+			{"permissions.labeler.id": userID},
+			{"permissions.checker.id": userID},
+		}
+	}
+	return filter
+}
+
+func pageOptions(p dto.Pagination) *options.FindOptions {
+	return options.Find().
+		SetLimit(int64(p.GetPageSize())).
+		SetSkip(int64((p.GetPageIndex() - 1) * p.GetPageSize()))
+}
+
+type BatchAllocReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Number    int64              `json:"number"`
+	Persons   []string           `json:"persons"`
+	// Strategy 本次使用的分配策略，为空时使用项目配置的策略
+	Strategy string `json:"strategy"`
+	Actor    string `json:"-"`
+}
+
+type BatchAllocResp struct {
+	Count int64 `json:"count"`
+}
+
+// planLabeler 按分配策略为未分配的任务选择标注员，金标准任务不直接分配
+func (t *TaskType) planLabeler(ctx context.Context, req BatchAllocReq) (allocPlan, error) {
+	if req.Number <= 0 {
+		return allocPlan{}, errors.New("分配任务数量不合法")
+	}
+	if len(req.Persons) == 0 {
+		return allocPlan{}, errors.New("分配人员数量不能为0")
+	}
+	overlap, err := t.projectOverlap(ctx, req.ProjectID)
+	if err != nil {
+		return allocPlan{}, err
+	}
+	if overlap > 1 {
+		return allocPlan{}, errors.New("项目为多人标注，请按多人标注分配")
+	}
+	filter := bson.M{
+		"projectId": req.ProjectID,
+		"status":    model.TaskStatusAllocate,
+		"permissions.labeler": bson.M{
+			"$exists": false,
+		},
+		"gold":       bson.M{"$exists": false},
+		"goldSource": bson.M{"$exists": false},
+	}
+	return t.planAlloc(ctx, req, labelerRole, filter, nil, nil)
+}
+
+// AllocLabeler 按项目的分配策略将未分配的任务分给标注员，并按金标准比例混入金标准任务
+func (s *TaskStore[T]) AllocLabeler(ctx context.Context, req BatchAllocReq) (int64, error) {
+	plan, err := s.planLabeler(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	gold, err := s.projectGold(ctx, req.ProjectID)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, id := range plan.Persons {
+		tasks := plan.Assign[id]
+		if len(tasks) == 0 {
+			continue
+		}
+		ft := bson.M{
+			"_id": bson.M{
+				"$in": util.Map(tasks, func(v model.TaskMeta) primitive.ObjectID { return v.ID }),
+			},
+			"status": model.TaskStatusAllocate,
+		}
+		now := util.Datetime(time.Now())
+		update := bson.M{
+			"$set": bson.M{
+				"permissions.labeler": model.Person{ID: id},
+				"status":              model.TaskStatusLabeling,
+				"updateTime":          now,
+				"allocatedTime":       now,
+			},
+			"$inc": bson.M{"version": 1},
+		}
+		result, err := s.Tasks.UpdateMany(ctx, ft, update)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return total, err
+		}
+		total += result.ModifiedCount
+		records := util.Map(tasks, func(v model.TaskMeta) model.TaskTransition {
+			record := s.newTransition(v, model.TaskStatusLabeling)
+			record.Actor = req.Actor
+			record.Role = PermissionTypeAdmin
+			record.Reason = "分配标注：" + id
+			return record
+		})
+		if err := s.recordTransitions(ctx, records); err != nil {
+			return total, err
+		}
+		activities := util.Map(tasks, func(v model.TaskMeta) model.TaskActivity {
+			return s.newActivity(ctx, v, model.ActivityAllocate, []model.FieldChange{
+				{Field: "status", Old: v.Status, New: model.TaskStatusLabeling},
+				{Field: "permissions.labeler.id", New: id},
+			})
+		})
+		if err := s.recordActivities(ctx, activities); err != nil {
+			return total, err
+		}
+		if s.Gold != nil && gold.Ratio > 0 {
+			if err := s.allocGold(ctx, req, id, goldCount(result.ModifiedCount, gold.Ratio)); err != nil {
+				return total, err
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// planChecker 按分配策略为已提交的任务选择审核员，审核员不能是任务的标注员；
+// 金标准任务提交时已自动评分，不再审核，金标准准确率低于阈值的标注员的任务优先审核
+func (t *TaskType) planChecker(ctx context.Context, req BatchAllocReq) (allocPlan, error) {
+	if req.Number <= 0 {
+		return allocPlan{}, errors.New("分配任务数量不合法")
+	}
+	if len(req.Persons) == 0 {
+		return allocPlan{}, errors.New("分配人员数量不能为0")
+	}
+	filter := bson.M{
+		"projectId":  req.ProjectID,
+		"status":     model.TaskStatusSubmit,
+		"goldSource": bson.M{"$exists": false},
+	}
+	exclude := func(task model.TaskMeta, person string) bool {
+		return task.Permissions.IsLabeler(person)
+	}
+	order := func(tasks []AllocTask) error {
+		if len(tasks) == 0 {
+			return errors.New("当前无可分配任务")
+		}
+		flagged, err := t.flaggedLabelers(ctx, req.ProjectID)
+		if err != nil {
+			return err
+		}
+		if len(flagged) > 0 {
+			sort.SliceStable(tasks, func(i, j int) bool {
+				return flagged[tasks[i].Meta.Permissions.LabelerID()] && !flagged[tasks[j].Meta.Permissions.LabelerID()]
+			})
+		}
+		return nil
+	}
+	return t.planAlloc(ctx, req, checkerRole, filter, exclude, order)
+}
+
+// AllocChecker 按项目的分配策略将已提交的任务分给审核员
+func (s *TaskStore[T]) AllocChecker(ctx context.Context, req BatchAllocReq) (int64, error) {
+	plan, err := s.planChecker(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	nowTime := util.Datetime(time.Now())
+	var totalCount int64
+	for _, id := range plan.Persons {
+		for _, task := range plan.Assign[id] {
+			ft := bson.M{
+				"_id":    task.ID,
+				"status": model.TaskStatusSubmit,
+			}
+			update := bson.M{
+				"$set": bson.M{
+					"permissions.checker": model.Person{ID: id},
+					"status":              model.TaskStatusChecking,
+					"updateTime":          nowTime,
+					"checkAllocatedTime":  nowTime,
+				},
+				"$inc": bson.M{"version": 1},
+			}
+			result, err := s.Tasks.UpdateOne(ctx, ft, update)
+			if err != nil {
+				log.Logger().WithContext(ctx).Error(err.Error())
+				return totalCount, err
+			}
+			if result.ModifiedCount == 0 {
+				continue
+			}
+			record := s.newTransition(task, model.TaskStatusChecking)
+			record.Actor = req.Actor
+			record.Role = PermissionTypeAdmin
+			record.Reason = "分配审核：" + id
+			if err := s.recordTransitions(ctx, []model.TaskTransition{record}); err != nil {
+				return totalCount, err
+			}
+			activity := s.newActivity(ctx, task, model.ActivityAllocate, []model.FieldChange{
+				{Field: "status", Old: task.Status, New: model.TaskStatusChecking},
+				{Field: "permissions.checker.id", New: id},
+			})
+			if err := s.recordActivities(ctx, []model.TaskActivity{activity}); err != nil {
+				return totalCount, err
+			}
+			totalCount++
+		}
+	}
+	if totalCount == 0 {
+		return 0, errors.New("分配失败：标注员和审核员不能是同一人")
+	}
+	return totalCount, nil
+}
+
+type ResetTasksReq struct {
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Persons   []string           `json:"persons"`
+	Statuses  []string           `json:"statuses"`
+	// ResetType 0 重置标注，任务回到未分配；1 重置审核，任务回到已提交
+	ResetType int64  `json:"resetType"`
+	Actor     string `json:"-"`
+}
+
+type ResetTasksResp struct {
+	Count int64 `json:"count"`
+}
+
+func (s *TaskStore[T]) Reset(ctx context.Context, req ResetTasksReq) (int64, error) {
+	filter := bson.M{}
+	if !req.ProjectID.IsZero() {
+		filter["projectId"] = req.ProjectID
+	}
+	if len(req.Statuses) > 0 {
+		filter["status"] = bson.M{
+			"$in": req.Statuses,
+		}
+	}
+	var update bson.M
+	to, reason := model.TaskStatusAllocate, "重置标注"
+	if req.ResetType == 0 {
+		if len(req.Persons) > 0 {
+			if s.ResetMatchChecker {
+				filter["$or"] = bson.A{
+					bson.M{"permissions.labeler.id": bson.M{"$in": req.Persons}},
+					bson.M{"permissions.checker.id": bson.M{"$in": req.Persons}},
+				}
+			} else {
+				filter["permissions.labeler.id"] = bson.M{"$in": req.Persons}
+			}
+		}
+		update = bson.M{
+			"$set": bson.M{
+				"permissions": model.Permissions{},
+				"status":      model.TaskStatusAllocate,
+				"updateTime":  util.Datetime(time.Now()),
+			},
+			"$unset": bson.M{
+				"allocatedTime":      "",
+				"checkAllocatedTime": "",
+				"leaseExpireTime":    "",
+			},
+			"$inc": bson.M{"version": 1},
+		}
+	} else {
+		to, reason = model.TaskStatusSubmit, "重置审核"
+		if len(req.Persons) > 0 {
+			filter["permissions.checker.id"] = bson.M{"$in": req.Persons}
+		}
+		update = bson.M{
+			"$set": bson.M{
+				"status":     model.TaskStatusSubmit,
+				"updateTime": util.Datetime(time.Now()),
+			},
+			"$unset": bson.M{
+				"permissions.checker": "",
+				"checkAllocatedTime":  "",
+			},
+			"$inc": bson.M{"version": 1},
+		}
+	}
+	tasks, err := findMeta(ctx, s.Tasks, filter, options.Find().SetProjection(bson.M{
+		"_id":         1,
+		"projectId":   1,
+		"status":      1,
+		"permissions": 1,
+	}))
+	if err != nil {
+		return 0, err
+	}
+	if len(tasks) == 0 {
+		return 0, nil
+	}
+	filter["_id"] = bson.M{
+		"$in": util.Map(tasks, func(v model.TaskMeta) primitive.ObjectID { return v.ID }),
+	}
+	result, err := s.Tasks.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	records := util.Map(tasks, func(v model.TaskMeta) model.TaskTransition {
+		record := s.newTransition(v, to)
+		record.Actor = req.Actor
+		record.Role = PermissionTypeAdmin
+		record.Reason = reason
+		return record
+	})
+	if err := s.recordTransitions(ctx, records); err != nil {
+		return result.ModifiedCount, err
+	}
+	activities := util.Map(tasks, func(v model.TaskMeta) model.TaskActivity {
+		changes := []model.FieldChange{{Field: "status", Old: v.Status, New: to}}
+		if v.Permissions.Checker != nil {
+			changes = append(changes, model.FieldChange{Field: "permissions.checker.id", Old: v.Permissions.Checker.ID})
+		}
+		if req.ResetType == 0 && v.Permissions.Labeler != nil {
+			changes = append(changes, model.FieldChange{Field: "permissions.labeler.id", Old: v.Permissions.Labeler.ID})
+		}
+		return s.newActivity(ctx, v, model.ActivityReset, changes)
+	})
+	if err := s.recordActivities(ctx, activities); err != nil {
+		return result.ModifiedCount, err
+	}
+	return result.ModifiedCount, nil
+}
+
+type BatchSetStatusReq struct {
+	UserID string
+	// Admin 管理员不限制任务归属，按管理员角色校验流程
+	Admin  bool
+	IDs    []primitive.ObjectID
+	Status string
+	Reason string
+}
+
+type BatchSetStatusResp struct {
+	Count int64 `json:"count"`
+}
+
+// statusSet 修改状态时一并写入的时间字段。租约只用于 t5 领取的对话，回到待标注的任务清除租约，不会被回收
+func (t *TaskType) statusSet(status string, now util.Datetime) bson.M {
+	set := bson.M{
+		"status":     status,
+		"updateTime": now,
+	}
+	switch status {
+	case model.TaskStatusLabeling:
+		set["leaseExpireTime"] = util.Datetime{}
+	case model.TaskStatusSubmit:
+		set["submittedTime"] = now
+	case model.TaskStatusPassed:
+		set["approvedTime"] = now
+	case model.TaskStatusFailed:
+		set["unsanctionTime"] = now
+	}
+	return set
+}
+
+// SetStatus 批量修改任务状态，每个任务按所在项目的流程校验，不允许的流转会被跳过
+func (s *TaskStore[T]) SetStatus(ctx context.Context, req BatchSetStatusReq) (int64, error) {
+	if len(req.IDs) == 0 {
+		return 0, errors.New("什么也没有发生")
+	}
+	filter := bson.M{
+		"_id": bson.M{
+			"$in": req.IDs,
+		},
+	}
+	if !req.Admin {
+		filter["$or"] = bson.A{
+			bson.M{"permissions.labeler.id": req.UserID},
+			bson.M{"permissions.checker.id": req.UserID},
+		}
+	}
+	docs, err := findRaw(ctx, s.Tasks, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	workflows := make(map[primitive.ObjectID]model.Workflow)
+	var records []model.TaskTransition
+	for _, doc := range docs {
+		var meta model.TaskMeta
+		if err := bson.Unmarshal(doc, &meta); err != nil {
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return 0, err
+		}
+		wf, ok := workflows[meta.ProjectID]
+		if !ok {
+			if wf, err = s.Workflow(ctx, meta.ProjectID); err != nil {
+				return 0, err
+			}
+			workflows[meta.ProjectID] = wf
+		}
+		roles := taskRoles(meta.Permissions, req.UserID, req.Admin)
+		transition, ok := wf.Find(meta.Status, req.Status, roles)
+		if !ok || !wf.HasState(req.Status) {
+			continue
+		}
+		if missing := missingFields(transition.Required, doc); len(missing) > 0 {
+			return 0, fmt.Errorf("任务%s未填写：%s", meta.Name, strings.Join(missing, "、"))
+		}
+		record := s.newTransition(meta, req.Status)
+		record.Actor = req.UserID
+		record.Role = roles[0]
+		record.Reason = req.Reason
+		records = append(records, record)
+	}
+
+	now := util.Datetime(time.Now())
+	done := make([]model.TaskTransition, 0, len(records))
+	for _, record := range records {
+		ft := bson.M{
+			"_id":    record.TaskID,
+			"status": record.From,
+		}
+		matched, err := s.updateOne(ctx, ft, bson.M{"$set": s.statusSet(req.Status, now)}, statusAction(req.Status))
+		if err != nil && !errors.Is(err, ErrVersionConflict) {
+			_ = s.recordTransitions(ctx, done)
+			return int64(len(done)), err
+		}
+		if matched {
+			record.CreateTime = now
+			done = append(done, record)
+		}
+	}
+	if err := s.recordTransitions(ctx, done); err != nil {
+		return int64(len(done)), err
+	}
+	if req.Status == model.TaskStatusSubmit {
+		s.gradeGold(ctx, util.Map(done, func(v model.TaskTransition) primitive.ObjectID { return v.TaskID }))
+	}
+	count := int64(len(done))
+	if int(count) < len(req.IDs) {
+		if req.Status == model.TaskStatusSubmit {
+			return count, errors.New("提交失败：任务已被分配审核")
+		}
+		return count, errors.New("部分任务状态没有修改")
+	}
+	return count, nil
+}
+
+type TransitReq struct {
+	ID     primitive.ObjectID
+	Status string
+	UserID string
+	// Roles 用户以哪些角色执行本次修改
+	Roles  []string
+	Reason string
+	// Version 客户端读取到的任务版本号
+	Version int
+	// Set 与状态一起写入的字段，必填字段在写入后的任务上校验
+	Set bson.M
+}
+
+// Transit 修改单个任务的内容和状态，按项目流程校验
+func (s *TaskStore[T]) Transit(ctx context.Context, req TransitReq) error {
+	doc, err := s.Tasks.FindOne(ctx, notDeleted(bson.M{"_id": req.ID})).DecodeBytes()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrTaskNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	var meta model.TaskMeta
+	if err := bson.Unmarshal(doc, &meta); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if meta.Version != req.Version {
+		return ErrVersionConflict
+	}
+	wf, err := s.Workflow(ctx, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	transition, ok := wf.Find(meta.Status, req.Status, req.Roles)
+	if !ok || !wf.HasState(req.Status) {
+		return fmt.Errorf("当前任务状态为:%s,无法修改为:%s", meta.Status, req.Status)
+	}
+	merged, err := mergeSet(doc, req.Set)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if missing := missingFields(transition.Required, merged); len(missing) > 0 {
+		return fmt.Errorf("未填写：%s", strings.Join(missing, "、"))
+	}
+
+	now := util.Datetime(time.Now())
+	update := s.statusSet(req.Status, now)
+	for k, v := range req.Set {
+		update[k] = v
+	}
+	action := statusAction(req.Status)
+	if req.Status == meta.Status {
+		action = model.ActivitySave
+	}
+	filter := versionFilter(bson.M{"_id": req.ID, "status": meta.Status}, req.Version)
+	matched, err := s.updateOne(ctx, filter, bson.M{"$set": update}, action)
+	if err != nil && !errors.Is(err, ErrVersionConflict) {
+		return ErrDatabase
+	}
+	if !matched {
+		return ErrVersionConflict
+	}
+	record := s.newTransition(meta, req.Status)
+	record.Actor = req.UserID
+	record.Role = req.Roles[0]
+	record.Reason = req.Reason
+	record.CreateTime = now
+	if err := s.recordTransitions(ctx, []model.TaskTransition{record}); err != nil {
+		return err
+	}
+	if req.Status == model.TaskStatusSubmit {
+		s.gradeGold(ctx, []primitive.ObjectID{req.ID})
+	}
+	if req.Status == model.TaskStatusLabeling {
+		if _, _, err := s.renewLease(ctx, []primitive.ObjectID{req.ID}, req.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update 按版本号修改一个任务并返回修改后的任务，version 为客户端读取到的版本号。
+// 标注员保存自己待标注的任务时同时续约。任务已被其他人修改时返回服务器上的任务和 ErrVersionConflict
+func (s *TaskStore[T]) Update(ctx context.Context, id primitive.ObjectID, version int, update bson.M) (T, error) {
+	matched, err := s.updateOne(ctx, versionFilter(bson.M{"_id": id}, version), update, model.ActivitySave)
+	if err != nil && !errors.Is(err, ErrVersionConflict) {
+		var task T
+		return task, err
+	}
+	if userID, _ := operator(ctx); matched && userID != "" {
+		if _, _, err := s.renewLease(ctx, []primitive.ObjectID{id}, userID); err != nil {
+			var task T
+			return task, err
+		}
+	}
+	task, err := s.Get(ctx, id)
+	if err != nil {
+		return task, err
+	}
+	if !matched {
+		return task, ErrVersionConflict
+	}
+	return task, nil
+}
+
+// versionFilter 在 filter 上增加版本号条件，旧数据没有版本号，按 0 匹配
+func versionFilter(filter bson.M, version int) bson.M {
+	if version == 0 {
+		filter["$or"] = bson.A{
+			bson.M{"version": 0},
+			bson.M{"version": bson.M{"$exists": false}},
+		}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// Delete 将任务移入回收站
+func (s *TaskStore[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return s.deleteTask(ctx, id)
+}
+
+// CountByStatus 按状态统计满足条件的任务数
+func (s *TaskStore[T]) CountByStatus(ctx context.Context, filter any) (map[string]int64, error) {
+	pipe := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: notDeleted(filter)}},
+		bson.D{
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$status"},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}},
+		},
+	}
+	cursor, err := s.Tasks.Aggregate(ctx, pipe)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var results []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	counts := make(map[string]int64, len(results))
+	for _, result := range results {
+		counts[result.Status] = result.Count
+	}
+	return counts, nil
+}
+
+// CountMy 按状态统计分配给当前用户的任务，TaskType 为"标注"时按标注员匹配，否则按审核员匹配
+func (s *TaskStore[T]) CountMy(ctx context.Context, projectID primitive.ObjectID, userID string, taskType string) (map[string]int64, error) {
+	filter := bson.M{
+		"projectId": projectID,
+	}
+	if taskType == PermissionTypeLabeler {
+		filter["permissions.labeler.id"] = userID
+	} else {
+		filter["permissions.checker.id"] = userID
+	}
+	return s.CountByStatus(ctx, filter)
+}
+
+type TaskDetailReq struct {
+	ID     primitive.ObjectID
+	UserID string
+	// WorkType 1 标注员、2 审核员进入，只能在自己的任务间切换；0 管理员进入，按 Filter 切换
+	WorkType int64
+	Status   []string
+	Filter   bson.M
+}
+
+type TaskDetail[T any] struct {
+	Task T
+	Meta model.TaskMeta
+	Last primitive.ObjectID
+	Next primitive.ObjectID
+}
+
+// Detail 查询任务详情以及同一筛选条件下的上一个、下一个任务
+func (s *TaskStore[T]) Detail(ctx context.Context, req TaskDetailReq) (TaskDetail[T], error) {
+	var res TaskDetail[T]
+	raw, err := s.Tasks.FindOne(ctx, notDeleted(bson.D{{Key: "_id", Value: req.ID}})).DecodeBytes()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return res, ErrNoDoc
+		}
+		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+		return res, err
+	}
+	if err := bson.Unmarshal(raw, &res.Task); err != nil {
+		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+		return res, err
+	}
+	if err := bson.Unmarshal(raw, &res.Meta); err != nil {
+		log.Logger().WithContext(ctx).Error("get task: ", err.Error())
+		return res, err
+	}
+
+	filter := bson.M{}
+	switch req.WorkType {
+	case 1:
+		if !res.Meta.Permissions.IsLabeler(req.UserID) {
+			return res, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
+		}
+		filter = bson.M{
+			"projectId":              res.Meta.ProjectID,
+			"permissions.labeler.id": req.UserID,
+			"status": bson.M{
+				"$in": req.Status,
+			},
+		}
+	case 2:
+		if !res.Meta.Permissions.IsChecker(req.UserID) {
+			return res, errors.New("任务已被撤回/删除，请刷新任务列表重新进入")
+		}
+		filter = bson.M{
+			"projectId":              res.Meta.ProjectID,
+			"permissions.checker.id": req.UserID,
+			"status": bson.M{
+				"$in": req.Status,
+			},
+		}
+	case 0:
+		for k, v := range req.Filter {
+			filter[k] = v
+		}
+		filter["projectId"] = res.Meta.ProjectID
+	}
+	res.Last, res.Next, err = s.Neighbors(ctx, filter, res.Meta.ID)
+	return res, err
+}
+
+// Neighbors 返回按 _id 排序时 id 前后相邻的任务
+func (s *TaskStore[T]) Neighbors(ctx context.Context, filter bson.M, id primitive.ObjectID) (last, next primitive.ObjectID, err error) {
+	find := func(op string, order int) (primitive.ObjectID, error) {
+		ft := bson.M{}
+		for k, v := range filter {
+			ft[k] = v
+		}
+		ft["_id"] = bson.M{op: id}
+		opts := options.FindOne().SetSort(bson.M{"_id": order}).SetProjection(bson.M{"_id": 1})
+		var task model.TaskMeta
+		if err := s.Tasks.FindOne(ctx, notDeleted(ft), opts).Decode(&task); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return primitive.NilObjectID, nil
+			}
+			log.Logger().WithContext(ctx).Error(err.Error())
+			return primitive.NilObjectID, err
+		}
+		return task.ID, nil
+	}
+	if last, err = find("$lt", -1); err != nil {
+		return
+	}
+	next, err = find("$gt", 1)
+	return
+}
+
+// findMeta 查询满足条件且不在回收站中的任务
+func findMeta(ctx context.Context, collection *mongo.Collection, filter any, opts ...*options.FindOptions) ([]model.TaskMeta, error) {
+	cursor, err := collection.Find(ctx, notDeleted(filter), opts...)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	var tasks []model.TaskMeta
+	if err := cursor.All(ctx, &tasks); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// findRaw 查询满足条件且不在回收站中的任务原始文档
+func findRaw(ctx context.Context, collection *mongo.Collection, filter any, opts ...*options.FindOptions) ([]bson.Raw, error) {
+	cursor, err := collection.Find(ctx, notDeleted(filter), opts...)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+	var docs []bson.Raw
+	for cursor.Next(ctx) {
+		docs = append(docs, append(bson.Raw(nil), cursor.Current...))
+	}
+	if err := cursor.Err(); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return docs, nil
+}
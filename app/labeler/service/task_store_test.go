@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/database"
+	ext "go-admin/config"
+)
+
+// newTestService 连接 LABELER_TEST_MONGO_DSN 指定的 mongo，每个测试使用单独的库，结束后删除
+func newTestService(t *testing.T) *LabelerService {
+	t.Helper()
+	dsn := os.Getenv("LABELER_TEST_MONGO_DSN")
+	if dsn == "" {
+		t.Skip("LABELER_TEST_MONGO_DSN 未设置")
+	}
+	ctx := context.Background()
+	client, err := database.NewMongoClient(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext.ExtConfig.Mongodb.LabelerDB = "labeler_test_" + primitive.NewObjectID().Hex()
+	svc := NewLabelerService(client, nil, nil)
+	t.Cleanup(func() {
+		_ = svc.MongodbDB.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	// 与迁移 1792195320000 中的索引一致
+	_, err = svc.CollectionLabeledTask5.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "sessionId", Value: 1},
+			{Key: "permissions.labeler.id", Value: 1},
+			{Key: "deletedBatch", Value: 1},
+		},
+		Options: options.Index().
+			SetName("sessionId_labeler_assigned_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{
+				"sessionId":              bson.M{"$type": "string"},
+				"permissions.labeler.id": bson.M{"$type": "string"},
+			}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestTaskStoreUpdateVersionConflict(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	task := model.Task2{
+		ID:        primitive.NewObjectID(),
+		ProjectID: primitive.NewObjectID(),
+		Name:      "a",
+		Status:    model.TaskStatusLabeling,
+	}
+	if _, err := svc.StoreTask2.Insert(ctx, []model.Task2{task}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := svc.StoreTask2.Update(ctx, task.ID, 0, bson.M{"$set": bson.M{"name": "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 1 || got.Name != "b" {
+		t.Fatalf("version %d name %s", got.Version, got.Name)
+	}
+
+	// 按旧版本号修改，返回服务器上的任务
+	got, err = svc.StoreTask2.Update(ctx, task.ID, 0, bson.M{"$set": bson.M{"name": "c"}})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("want ErrVersionConflict got %v", err)
+	}
+	if got.Version != 1 || got.Name != "b" {
+		t.Fatalf("version %d name %s", got.Version, got.Name)
+	}
+
+	// 调用方的 $inc 与版本号合并
+	_, err = svc.StoreTask2.Update(ctx, task.ID, 1, bson.M{"$inc": bson.M{"workQuantity": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Version      int `bson:"version"`
+		WorkQuantity int `bson:"workQuantity"`
+	}
+	if err := svc.CollectionTask2.FindOne(ctx, bson.M{"_id": task.ID}).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 2 || doc.WorkQuantity != 2 {
+		t.Fatalf("version %d workQuantity %d", doc.Version, doc.WorkQuantity)
+	}
+}
+
+func TestTaskStoreTransit(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	task := model.Task{
+		ID:        primitive.NewObjectID(),
+		ProjectID: primitive.NewObjectID(),
+		Name:      "a",
+		Status:    model.TaskStatusLabeling,
+		Permissions: model.Permissions{
+			Labeler: &model.Person{ID: "1"},
+			Checker: &model.Person{ID: "2"},
+		},
+	}
+	if _, err := svc.StoreTask.Insert(ctx, []model.Task{task}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := svc.StoreTask.Transit(ctx, TransitReq{
+		ID:     task.ID,
+		Status: model.TaskStatusSubmit,
+		UserID: "2",
+		Roles:  []string{PermissionTypeChecker},
+	})
+	if err == nil {
+		t.Fatal("审核员不能提交")
+	}
+	err = svc.StoreTask.Transit(ctx, TransitReq{
+		ID:     task.ID,
+		Status: model.TaskStatusSubmit,
+		UserID: "1",
+		Roles:  []string{PermissionTypeLabeler},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.StoreTask.Get(ctx, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.TaskStatusSubmit || got.Version != 1 {
+		t.Fatalf("status %s version %d", got.Status, got.Version)
+	}
+
+	// 按旧版本号修改
+	err = svc.StoreTask.Transit(ctx, TransitReq{
+		ID:     task.ID,
+		Status: model.TaskStatusChecking,
+		UserID: "2",
+		Roles:  []string{PermissionTypeChecker},
+	})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("want ErrVersionConflict got %v", err)
+	}
+
+	count, err := svc.CollectionTaskTransition.CountDocuments(ctx, bson.M{"taskId": task.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("transitions %d", count)
+	}
+}
+
+func TestTaskStoreSetStatus(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	task := model.Task3{
+		ID:        primitive.NewObjectID(),
+		ProjectID: primitive.NewObjectID(),
+		Name:      "a",
+		Status:    model.TaskStatusSubmit,
+		Permissions: model.Permissions{
+			Labeler: &model.Person{ID: "1"},
+			Checker: &model.Person{ID: "2"},
+		},
+	}
+	if _, err := svc.StoreTask3.Insert(ctx, []model.Task3{task}); err != nil {
+		t.Fatal(err)
+	}
+
+	// t3 只有标注员和管理员可以修改状态
+	count, err := svc.StoreTask3.SetStatus(ctx, BatchSetStatusReq{
+		UserID: "2",
+		IDs:    []primitive.ObjectID{task.ID},
+		Status: model.TaskStatusPassed,
+	})
+	if err == nil || count != 0 {
+		t.Fatalf("审核员修改了 %d 个任务", count)
+	}
+	// 不是自己的任务
+	count, err = svc.StoreTask3.SetStatus(ctx, BatchSetStatusReq{
+		UserID: "3",
+		IDs:    []primitive.ObjectID{task.ID},
+		Status: model.TaskStatusPassed,
+	})
+	if err == nil || count != 0 {
+		t.Fatalf("其他人修改了 %d 个任务", count)
+	}
+	count, err = svc.StoreTask3.SetStatus(ctx, BatchSetStatusReq{
+		UserID: "1",
+		IDs:    []primitive.ObjectID{task.ID},
+		Status: model.TaskStatusPassed,
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("count %d err %v", count, err)
+	}
+	got, err := svc.StoreTask3.Get(ctx, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.TaskStatusPassed || got.Version != 1 {
+		t.Fatalf("status %s version %d", got.Status, got.Version)
+	}
+}
+
+func TestTaskStoreReset(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	projectID := primitive.NewObjectID()
+	tasks := []model.Task2{
+		{
+			ID:        primitive.NewObjectID(),
+			ProjectID: projectID,
+			Status:    model.TaskStatusSubmit,
+			Permissions: model.Permissions{
+				Labeler: &model.Person{ID: "1"},
+				Checker: &model.Person{ID: "2"},
+			},
+		},
+		{
+			ID:        primitive.NewObjectID(),
+			ProjectID: projectID,
+			Status:    model.TaskStatusLabeling,
+			Permissions: model.Permissions{
+				Labeler: &model.Person{ID: "3"},
+			},
+		},
+	}
+	if _, err := svc.StoreTask2.Insert(ctx, tasks); err != nil {
+		t.Fatal(err)
+	}
+
+	// t2 重置标注时审核员也匹配
+	count, err := svc.StoreTask2.Reset(ctx, ResetTasksReq{
+		ProjectID: projectID,
+		Persons:   []string{"2"},
+		Actor:     "9",
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("count %d err %v", count, err)
+	}
+	got, err := svc.StoreTask2.Get(ctx, tasks[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.TaskStatusAllocate || got.Permissions.Labeler != nil || got.Permissions.Checker != nil || got.Version != 1 {
+		t.Fatalf("status %s permissions %+v version %d", got.Status, got.Permissions, got.Version)
+	}
+	other, err := svc.StoreTask2.Get(ctx, tasks[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Status != model.TaskStatusLabeling || other.Version != 0 {
+		t.Fatalf("status %s version %d", other.Status, other.Version)
+	}
+
+	var record model.TaskTransition
+	if err := svc.CollectionTaskTransition.FindOne(ctx, bson.M{"taskId": tasks[0].ID}).Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	if record.From != model.TaskStatusSubmit || record.To != model.TaskStatusAllocate || record.Actor != "9" || record.Role != PermissionTypeAdmin {
+		t.Fatalf("transition %+v", record)
+	}
+}
+
+// insertTask5Pool 插入一个项目和一个待领取的对话
+func insertTask5Pool(t *testing.T, svc *LabelerService, sessionID string, priority int) model.Task5 {
+	t.Helper()
+	ctx := context.Background()
+	project := model.Project5{ID: primitive.NewObjectID(), Name: "p"}
+	if _, err := svc.CollectionProject5.InsertOne(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	task := model.Task5{
+		ID:        primitive.NewObjectID(),
+		ProjectID: project.ID,
+		Name:      sessionID,
+		Status:    model.TaskStatusAllocate,
+		Dialog: []model.ContentText{
+			{SessionID: sessionID, TurnID: 1, Priority: priority},
+			{SessionID: sessionID, TurnID: 2, Priority: priority},
+		},
+	}
+	if _, err := svc.CollectionTask5.InsertOne(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func poolPriorities(t *testing.T, svc *LabelerService, id primitive.ObjectID) []int {
+	t.Helper()
+	var task model.Task5
+	if err := svc.CollectionTask5.FindOne(context.Background(), bson.M{"_id": id}).Decode(&task); err != nil {
+		t.Fatal(err)
+	}
+	return []int{task.Dialog[0].Priority, task.Dialog[1].Priority}
+}
+
+func TestAllocOneTask5Race(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	pool := insertTask5Pool(t, svc, "s1", 1)
+
+	const labelers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, labelers)
+	for i := 0; i < labelers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = svc.AllocOneTask5(ctx, AllocOneTaskReq{
+				ProjectID: pool.ProjectID,
+				UserId:    primitive.NewObjectID().Hex(),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	claimed := 0
+	for _, err := range errs {
+		if err == nil {
+			claimed++
+		}
+	}
+	if claimed != 1 {
+		t.Fatalf("领取成功 %d 次：%v", claimed, errs)
+	}
+	if p := poolPriorities(t, svc, pool.ID); p[0] != 0 || p[1] != 0 {
+		t.Fatalf("priority %v", p)
+	}
+	count, err := svc.CollectionLabeledTask5.CountDocuments(ctx, bson.M{"sessionId": "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("labeledtask5 %d", count)
+	}
+}
+
+func TestAllocOneTask5RestorePriority(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	pool := insertTask5Pool(t, svc, "s1", 2)
+
+	// 已删除项目中领取过同一会话，不在 personSessionID 中，插入时违反唯一索引
+	claimed := model.Task5{
+		ID:          primitive.NewObjectID(),
+		ProjectID:   primitive.NewObjectID(),
+		SessionID:   "s1",
+		Status:      model.TaskStatusSubmit,
+		Permissions: model.Permissions{Labeler: &model.Person{ID: "1"}},
+		Dialog:      []model.ContentText{{SessionID: "s1"}},
+	}
+	if _, err := svc.CollectionLabeledTask5.InsertOne(ctx, claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := svc.AllocOneTask5(ctx, AllocOneTaskReq{ProjectID: pool.ProjectID, UserId: "1"})
+	if err == nil || err.Error() != "该会话已经领取过，请重新领取" {
+		t.Fatalf("err %v", err)
+	}
+	if p := poolPriorities(t, svc, pool.ID); p[0] != 2 || p[1] != 2 {
+		t.Fatalf("priority %v", p)
+	}
+
+	task, err := svc.AllocOneTask5(ctx, AllocOneTaskReq{ProjectID: pool.ProjectID, UserId: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != model.TaskStatusLabeling || task.SessionID != "s1" || task.ID == pool.ID {
+		t.Fatalf("task %+v", task)
+	}
+	if p := poolPriorities(t, svc, pool.ID); p[0] != 1 || p[1] != 1 {
+		t.Fatalf("priority %v", p)
+	}
+}
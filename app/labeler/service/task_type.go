@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"go-admin/app/labeler/model"
+)
+
+var ErrUnknownTaskType = errors.New("任务类型不存在")
+
+// TaskType 一种标注任务类型，对应路由 /api/v1/labeler/{Name}/
+type TaskType struct {
+	Name     string
+	Tasks    *mongo.Collection
+	Projects *mongo.Collection
+	Folders  *mongo.Collection
+	// Workflows 项目的状态流程配置，TaskTransitions 任务的状态流转记录，Activities 任务动态，各类型共用
+	Workflows       *mongo.Collection
+	TaskTransitions *mongo.Collection
+	Activities      *mongo.Collection
+	// Trash 回收站记录，各类型共用
+	Trash *mongo.Collection
+	// Submissions 多人标注时各标注员的标注，各类型共用，随任务一起删除和恢复
+	Submissions *mongo.Collection
+	// Allocations 项目的分配策略配置，各类型共用
+	Allocations *mongo.Collection
+	// GoldResults 金标准任务的评分，各类型共用
+	GoldResults *mongo.Collection
+	// Snapshots 任务提交、审核和裁决后的快照，各类型共用
+	Snapshots *mongo.Collection
+	// Comments 任务的讨论，QAItems 质检抽中的任务，各类型共用
+	Comments *mongo.Collection
+	QAItems  *mongo.Collection
+	// Gold 金标准任务的标准答案和评分方式，不支持金标准的类型为空
+	Gold *goldType
+	// Pool t5 待领取的对话，随项目一起删除和恢复
+	Pool *mongo.Collection
+	// ResetMatchChecker 重置标注时同时匹配审核员
+	ResetMatchChecker bool
+	// DefaultWorkflow 项目没有配置流程时使用
+	DefaultWorkflow model.Workflow
+	// Lease 领取的任务的租约时长，到期未续约的任务被回收；批量分配的任务没有租约
+	Lease time.Duration
+	// SearchFields 内容搜索的字段，用 . 分隔，为空时不支持内容搜索
+	SearchFields []string
+}
+
+func (svc *LabelerService) registerTaskType(t *TaskType) *TaskType {
+	if svc.TaskTypes == nil {
+		svc.TaskTypes = make(map[string]*TaskType)
+	}
+	t.Workflows = svc.CollectionWorkflow
+	t.TaskTransitions = svc.CollectionTaskTransition
+	t.Activities = svc.CollectionTaskActivity
+	t.Trash = svc.CollectionTrash
+	t.Submissions = svc.CollectionSubmission
+	t.GoldResults = svc.CollectionGoldResult
+	t.Allocations = svc.CollectionAllocationSetting
+	t.Snapshots = svc.CollectionTaskSnapshot
+	t.Comments = svc.CollectionTaskComment
+	t.QAItems = svc.CollectionQAItem
+	t.Lease = svc.TaskLease
+	svc.TaskTypes[t.Name] = t
+	return t
+}
+
+// TaskType 按路由中的类型名称查找任务类型
+func (svc *LabelerService) TaskType(name string) (*TaskType, error) {
+	t, ok := svc.TaskTypes[name]
+	if !ok {
+		return nil, ErrUnknownTaskType
+	}
+	return t, nil
+}
@@ -0,0 +1,477 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/dto"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+const (
+	// DefaultTrashRetentionDays 没有配置时回收站保留的天数
+	DefaultTrashRetentionDays = 30
+	trashPurgeInterval        = time.Hour
+	// purgeBatchSize 彻底删除时每次删除关联记录的任务数
+	purgeBatchSize = 1000
+)
+
+var ErrTrashNotFound = errors.New("回收站中不存在该记录")
+
+// notDeleted 在查询条件上排除回收站中的数据
+func notDeleted(filter any) any {
+	live := bson.E{Key: "deletedAt", Value: bson.M{"$exists": false}}
+	switch f := filter.(type) {
+	case nil:
+		return bson.D{live}
+	case bson.M:
+		ft := make(bson.M, len(f)+1)
+		for k, v := range f {
+			ft[k] = v
+		}
+		ft[live.Key] = live.Value
+		return ft
+	case bson.D:
+		return append(append(bson.D{}, f...), live)
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, bson.D{live}}}}
+}
+
+// trashCollections 任务类型中会被删除的集合，恢复和彻底删除时按 deletedBatch 处理
+func (t *TaskType) trashCollections() []*mongo.Collection {
+	collections := []*mongo.Collection{t.Tasks, t.Projects, t.Folders, t.Submissions}
+	if t.Pool != nil {
+		collections = append(collections, t.Pool)
+	}
+	return collections
+}
+
+// taskDataCollections 按 taskId 关联任务的集合，彻底删除任务时一并删除
+func (t *TaskType) taskDataCollections() []*mongo.Collection {
+	return []*mongo.Collection{t.Activities, t.TaskTransitions, t.Snapshots, t.Comments, t.GoldResults, t.QAItems}
+}
+
+// purgeTaskData 删除任务的动态、状态流转、快照、讨论、金标准评分和质检记录，ids 较多时分批删除
+func (t *TaskType) purgeTaskData(ctx context.Context, ids []primitive.ObjectID) error {
+	for start := 0; start < len(ids); start += purgeBatchSize {
+		end := start + purgeBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		filter := bson.M{"taskType": t.Name, "taskId": bson.M{"$in": ids[start:end]}}
+		for _, collection := range t.taskDataCollections() {
+			if _, err := collection.DeleteMany(ctx, filter); err != nil {
+				log.Logger().WithContext(ctx).Error(collection.Name(), ": ", err.Error())
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newTrash 插入一条回收站记录，删除的数量在标记完成后更新
+func (t *TaskType) newTrash(ctx context.Context, kind string, id primitive.ObjectID, name string) (model.Trash, error) {
+	userID, _ := operator(ctx)
+	trash := model.Trash{
+		ID:        primitive.NewObjectID(),
+		TaskType:  t.Name,
+		Kind:      kind,
+		TargetID:  id,
+		Name:      name,
+		DeletedBy: userID,
+		DeletedAt: util.Datetime(time.Now()),
+	}
+	if _, err := t.Trash.InsertOne(ctx, trash); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return trash, err
+	}
+	return trash, nil
+}
+
+func (t *TaskType) saveTrashCounts(ctx context.Context, trash model.Trash) error {
+	update := bson.M{"$set": bson.M{
+		"folders":  trash.Folders,
+		"projects": trash.Projects,
+		"tasks":    trash.Tasks,
+	}}
+	if _, err := t.Trash.UpdateByID(ctx, trash.ID, update); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// moveToTrash 给满足条件且没有被删除的文档写入删除标记
+func moveToTrash(ctx context.Context, collection *mongo.Collection, filter bson.M, trash model.Trash) (int64, error) {
+	update := bson.M{"$set": bson.M{
+		"deletedAt":    trash.DeletedAt,
+		"deletedBy":    trash.DeletedBy,
+		"deletedBatch": trash.ID,
+	}}
+	result, err := collection.UpdateMany(ctx, notDeleted(filter), update)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(collection.Name(), ": ", err.Error())
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// findIDs 查询满足条件且没有被删除的文档 ID
+func findIDs(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := collection.Find(ctx, notDeleted(filter), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	var docs []model.TaskMeta
+	if err := cursor.All(ctx, &docs); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return util.Map(docs, func(v model.TaskMeta) primitive.ObjectID { return v.ID }), nil
+}
+
+// trashProjectTasks 删除项目下的任务和多人标注的标注，t5 还要删除待领取的对话
+func (t *TaskType) trashProjectTasks(ctx context.Context, projectIDs []primitive.ObjectID, trash model.Trash) (int64, error) {
+	filter := bson.M{"projectId": bson.M{"$in": projectIDs}}
+	count, err := moveToTrash(ctx, t.Tasks, filter, trash)
+	if err != nil {
+		return count, err
+	}
+	if _, err := moveToTrash(ctx, t.Submissions, bson.M{"taskType": t.Name, "projectId": bson.M{"$in": projectIDs}}, trash); err != nil {
+		return count, err
+	}
+	if t.Pool != nil {
+		if _, err := moveToTrash(ctx, t.Pool, filter, trash); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// DeleteFolder 将文件夹以及其下的子文件夹、项目和任务移入回收站
+func (t *TaskType) DeleteFolder(ctx context.Context, id primitive.ObjectID) error {
+	var folder model.Folder
+	if err := t.Folders.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&folder); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		log.Logger().WithContext(ctx).Error("delete folder: ", err.Error())
+		return ErrDatabase
+	}
+	folderIDs := []primitive.ObjectID{id}
+	for parents := folderIDs; len(parents) > 0; {
+		children, err := findIDs(ctx, t.Folders, bson.M{"parentId": bson.M{"$in": parents}})
+		if err != nil {
+			return ErrDatabase
+		}
+		folderIDs = append(folderIDs, children...)
+		parents = children
+	}
+	projectIDs, err := findIDs(ctx, t.Projects, bson.M{"folderId": bson.M{"$in": folderIDs}})
+	if err != nil {
+		return ErrDatabase
+	}
+
+	trash, err := t.newTrash(ctx, model.TrashKindFolder, id, folder.Name)
+	if err != nil {
+		return ErrDatabase
+	}
+	// 由下往上标记，中途出错时不会出现文件夹已删除而项目、任务还在的情况
+	if trash.Tasks, err = t.trashProjectTasks(ctx, projectIDs, trash); err != nil {
+		return ErrDatabase
+	}
+	if trash.Projects, err = moveToTrash(ctx, t.Projects, bson.M{"_id": bson.M{"$in": projectIDs}}, trash); err != nil {
+		return ErrDatabase
+	}
+	if trash.Folders, err = moveToTrash(ctx, t.Folders, bson.M{"_id": bson.M{"$in": folderIDs}}, trash); err != nil {
+		return ErrDatabase
+	}
+	log.Logger().WithContext(ctx).Warnf("delete folder:%s", id.Hex())
+	return t.saveTrashCounts(ctx, trash)
+}
+
+// deleteProject 将项目以及其下的任务移入回收站，项目不存在时返回 0
+func (t *TaskType) deleteProject(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	var project struct {
+		Name string `bson:"name"`
+	}
+	if err := t.Projects.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, nil
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return 0, err
+	}
+	trash, err := t.newTrash(ctx, model.TrashKindProject, id, project.Name)
+	if err != nil {
+		return 0, err
+	}
+	if trash.Tasks, err = t.trashProjectTasks(ctx, []primitive.ObjectID{id}, trash); err != nil {
+		return 0, err
+	}
+	if trash.Projects, err = moveToTrash(ctx, t.Projects, bson.M{"_id": id}, trash); err != nil {
+		return 0, err
+	}
+	return trash.Projects, t.saveTrashCounts(ctx, trash)
+}
+
+// deleteTask 将一个任务移入回收站
+func (t *TaskType) deleteTask(ctx context.Context, id primitive.ObjectID) error {
+	tasks, err := findMeta(ctx, t.Tasks, bson.M{"_id": id})
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+	meta := tasks[0]
+	trash, err := t.newTrash(ctx, model.TrashKindTask, id, meta.Name)
+	if err != nil {
+		return err
+	}
+	if trash.Tasks, err = moveToTrash(ctx, t.Tasks, bson.M{"_id": id}, trash); err != nil {
+		return err
+	}
+	if _, err := moveToTrash(ctx, t.Submissions, bson.M{"taskId": id}, trash); err != nil {
+		return err
+	}
+	if err := t.saveTrashCounts(ctx, trash); err != nil {
+		return err
+	}
+	return t.recordActivities(ctx, []model.TaskActivity{t.newActivity(ctx, meta, model.ActivityDelete, nil)})
+}
+
+// inTrash 文档是否在回收站中，文档不存在时返回 false
+func inTrash(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) (bool, error) {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id, "deletedAt": bson.M{"$exists": true}})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// checkRestoreParent 恢复的内容所在的文件夹或项目也在回收站中时不能恢复
+func (t *TaskType) checkRestoreParent(ctx context.Context, trash model.Trash) error {
+	var parent struct {
+		ParentID  *primitive.ObjectID `bson:"parentId"`
+		FolderID  primitive.ObjectID  `bson:"folderId"`
+		ProjectID primitive.ObjectID  `bson:"projectId"`
+	}
+	var (
+		collection *mongo.Collection
+		parentID   *primitive.ObjectID
+		msg        string
+	)
+	switch trash.Kind {
+	case model.TrashKindFolder:
+		collection, msg = t.Folders, "请先恢复上级文件夹"
+	case model.TrashKindProject:
+		collection, msg = t.Projects, "请先恢复项目所在的文件夹"
+	default:
+		collection, msg = t.Tasks, "请先恢复任务所在的项目"
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": trash.TargetID}).Decode(&parent); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	switch trash.Kind {
+	case model.TrashKindFolder:
+		parentID = parent.ParentID
+	case model.TrashKindProject:
+		collection, parentID = t.Folders, &parent.FolderID
+	default:
+		collection, parentID = t.Projects, &parent.ProjectID
+	}
+	if parentID == nil {
+		return nil
+	}
+	deleted, err := inTrash(ctx, collection, *parentID)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// restore 清除这次删除写入的标记，先恢复任务，中途出错时上级仍然在回收站中
+func (t *TaskType) restore(ctx context.Context, trash model.Trash) error {
+	if err := t.checkRestoreParent(ctx, trash); err != nil {
+		return err
+	}
+	update := bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": "", "deletedBatch": ""}}
+	for _, collection := range t.trashCollections() {
+		if _, err := collection.UpdateMany(ctx, bson.M{"deletedBatch": trash.ID}, update); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return errors.New("会话已被标注员重新领取，无法恢复")
+			}
+			log.Logger().WithContext(ctx).Error(collection.Name(), ": ", err.Error())
+			return err
+		}
+	}
+	if _, err := t.Trash.DeleteOne(ctx, bson.M{"_id": trash.ID}); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	if trash.Kind != model.TrashKindTask {
+		return nil
+	}
+	tasks, err := findMeta(ctx, t.Tasks, bson.M{"_id": trash.TargetID})
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+	return t.recordActivities(ctx, []model.TaskActivity{t.newActivity(ctx, tasks[0], model.ActivityRestore, nil)})
+}
+
+// purge 彻底删除这次删除的所有文档，先删除任务的关联记录，中途出错时下次清理重试
+func (t *TaskType) purge(ctx context.Context, trash model.Trash) error {
+	values, err := t.Tasks.Distinct(ctx, "_id", bson.M{"deletedBatch": trash.ID})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	if err := t.purgeTaskData(ctx, ids); err != nil {
+		return err
+	}
+	for _, collection := range t.trashCollections() {
+		if _, err := collection.DeleteMany(ctx, bson.M{"deletedBatch": trash.ID}); err != nil {
+			log.Logger().WithContext(ctx).Error(collection.Name(), ": ", err.Error())
+			return err
+		}
+	}
+	if _, err := t.Trash.DeleteOne(ctx, bson.M{"_id": trash.ID}); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (t *TaskType) getTrash(ctx context.Context, id primitive.ObjectID) (model.Trash, error) {
+	var trash model.Trash
+	if err := t.Trash.FindOne(ctx, bson.M{"_id": id, "taskType": t.Name}).Decode(&trash); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return trash, ErrTrashNotFound
+		}
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return trash, err
+	}
+	return trash, nil
+}
+
+type SearchTrashReq struct {
+	Kind string `form:"kind"`
+	dto.Pagination
+}
+
+// SearchTrash 查询任务类型的回收站，最近删除的在前
+func (svc *LabelerService) SearchTrash(ctx context.Context, taskType string, req SearchTrashReq) ([]model.Trash, int, error) {
+	filter := bson.M{"taskType": taskType}
+	if req.Kind != "" {
+		filter["kind"] = req.Kind
+	}
+	count, err := svc.CollectionTrash.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	opts := pageOptions(req.Pagination).SetSort(bson.D{{Key: "_id", Value: -1}})
+	cursor, err := svc.CollectionTrash.Find(ctx, filter, opts)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	res := make([]model.Trash, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, 0, err
+	}
+	userMap := svc.userNickNames(ctx, util.Map(res, func(v model.Trash) string { return v.DeletedBy }))
+	for i := range res {
+		res[i].NickName = userMap[res[i].DeletedBy]
+	}
+	return res, int(count), nil
+}
+
+// RestoreTrash 从回收站恢复一次删除
+func (svc *LabelerService) RestoreTrash(ctx context.Context, taskType string, id primitive.ObjectID) error {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return err
+	}
+	trash, err := t.getTrash(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := t.restore(ctx, trash); err != nil {
+		return err
+	}
+	if t == svc.StoreTask5.TaskType && trash.Kind == model.TrashKindTask {
+		return svc.restoreTask5Priority(ctx, trash.TargetID)
+	}
+	return nil
+}
+
+// PurgeTrash 不等保留期到期，立即彻底删除
+func (svc *LabelerService) PurgeTrash(ctx context.Context, taskType string, id primitive.ObjectID) error {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return err
+	}
+	trash, err := t.getTrash(ctx, id)
+	if err != nil {
+		return err
+	}
+	return t.purge(ctx, trash)
+}
+
+// RunTrashPurge 定期彻底删除回收站中超过保留天数的数据，需要在单独的 goroutine 中运行
+func (svc *LabelerService) RunTrashPurge(retentionDays int) {
+	if retentionDays <= 0 {
+		retentionDays = DefaultTrashRetentionDays
+	}
+	for {
+		_ = log.WithTracer(context.Background(), PackageName, "Labeler Trash Purge", func(ctx context.Context) error {
+			return svc.purgeExpiredTrash(ctx, time.Now().AddDate(0, 0, -retentionDays))
+		})
+		time.Sleep(trashPurgeInterval)
+	}
+}
+
+func (svc *LabelerService) purgeExpiredTrash(ctx context.Context, before time.Time) error {
+	cursor, err := svc.CollectionTrash.Find(ctx, bson.M{"deletedAt": bson.M{"$lt": before}})
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	var expired []model.Trash
+	if err := cursor.All(ctx, &expired); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	for _, trash := range expired {
+		t, err := svc.TaskType(trash.TaskType)
+		if err != nil {
+			log.Logger().WithContext(ctx).Error(trash.ID.Hex(), ": ", err.Error())
+			continue
+		}
+		if err := t.purge(ctx, trash); err != nil {
+			return err
+		}
+		log.Logger().WithContext(ctx).Infof("purge trash:%s %s %s", trash.TaskType, trash.Kind, trash.TargetID.Hex())
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package service
 
 import (
 	"context"
+	"strconv"
+
 	"go-admin/app/admin/models"
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
 )
 
 func (svc *LabelerService) GetUserList(ctx context.Context) ([]models.SysUser, int, error) {
@@ -14,3 +18,51 @@ func (svc *LabelerService) GetUserList(ctx context.Context) ([]models.SysUser, i
 	}
 	return users, len(users), nil
 }
+
+// nickNames 查询任务标注员和审核员的昵称，key 为用户ID
+func (svc *LabelerService) nickNames(ctx context.Context, permissions []model.Permissions) map[string]string {
+	ids := make([]string, 0)
+	for _, p := range permissions {
+		if p.Labeler != nil {
+			ids = append(ids, p.Labeler.ID)
+		}
+		if p.Checker != nil {
+			ids = append(ids, p.Checker.ID)
+		}
+	}
+	return svc.userNickNames(ctx, ids)
+}
+
+// userNickNames 按用户ID查询昵称
+func (svc *LabelerService) userNickNames(ctx context.Context, ids []string) map[string]string {
+	userMap := make(map[string]string)
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			valid = append(valid, id)
+		}
+	}
+	if len(valid) == 0 {
+		return userMap
+	}
+	var users []models.SysUser
+	db := svc.GormDB.WithContext(ctx).Select("user_id, nick_name").Where("user_id in ?", valid).Find(&users)
+	if err := db.Error; err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+	}
+	for _, v := range users {
+		userMap[strconv.Itoa(v.UserId)] = v.NickName
+	}
+	return userMap
+}
+
+// fillNickNames 补全任务标注员和审核员的昵称
+func (svc *LabelerService) fillNickNames(ctx context.Context, p *model.Permissions) {
+	userMap := svc.nickNames(ctx, []model.Permissions{*p})
+	if p.Labeler != nil {
+		p.Labeler.NickName = userMap[p.Labeler.ID]
+	}
+	if p.Checker != nil {
+		p.Checker.NickName = userMap[p.Checker.ID]
+	}
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/common/log"
+	"go-admin/common/util"
+)
+
+// workflowFromRules 由“目标状态 -> 允许的源状态”表生成默认流程。
+// normal 用于标注员和审核员，special 用于管理员；表中没有的目标状态不限制源状态，源状态为空切片表示不允许。
+func workflowFromRules(normal, special map[string][]string) model.Workflow {
+	wf := model.Workflow{States: model.TaskStatuses}
+	wf.Transitions = append(wf.Transitions, ruleTransitions(normal, PermissionTypeLabeler, PermissionTypeChecker)...)
+	wf.Transitions = append(wf.Transitions, ruleTransitions(special, PermissionTypeAdmin)...)
+	return wf
+}
+
+// ruleTransitions 由“目标状态 -> 允许的源状态”表生成 roles 可以执行的状态转换，规则同 workflowFromRules
+func ruleTransitions(rules map[string][]string, roles ...string) []model.Transition {
+	var transitions []model.Transition
+	for _, to := range model.TaskStatuses {
+		from, ok := rules[to]
+		if ok && len(from) == 0 {
+			continue
+		}
+		transitions = append(transitions, model.Transition{From: from, To: to, Roles: roles})
+	}
+	return transitions
+}
+
+// workflowFromRoleMaps 由“源状态 -> 目标状态”表生成默认流程，labeler 用于标注员，checker 用于审核员，admin 用于管理员
+func workflowFromRoleMaps(labeler, checker, admin map[string]map[string]bool) model.Workflow {
+	wf := model.Workflow{States: model.TaskStatuses}
+	add := func(rules map[string]map[string]bool, role string) {
+		for _, from := range model.TaskStatuses {
+			for _, to := range model.TaskStatuses {
+				if rules[from][to] {
+					wf.Transitions = append(wf.Transitions, model.Transition{
+						From:  []string{from},
+						To:    to,
+						Roles: []string{role},
+					})
+				}
+			}
+		}
+	}
+	add(labeler, PermissionTypeLabeler)
+	add(checker, PermissionTypeChecker)
+	add(admin, PermissionTypeAdmin)
+	return wf
+}
+
+// Workflow 查询项目的状态流程，没有配置时返回任务类型的默认流程
+func (t *TaskType) Workflow(ctx context.Context, projectID primitive.ObjectID) (model.Workflow, error) {
+	var wf model.Workflow
+	err := t.Workflows.FindOne(ctx, bson.M{"projectId": projectID}).Decode(&wf)
+	if err == nil {
+		return wf, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return wf, err
+	}
+	wf = t.DefaultWorkflow
+	wf.ProjectID = projectID
+	wf.TaskType = t.Name
+	return wf, nil
+}
+
+func (t *TaskType) SaveWorkflow(ctx context.Context, wf model.Workflow) (model.Workflow, error) {
+	if err := validateWorkflow(wf); err != nil {
+		return model.Workflow{}, err
+	}
+	count, err := t.Projects.CountDocuments(ctx, notDeleted(bson.M{"_id": wf.ProjectID}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.Workflow{}, err
+	}
+	if count == 0 {
+		return model.Workflow{}, ErrProjectNotFound
+	}
+	wf.TaskType = t.Name
+	wf.UpdateTime = util.Datetime(time.Now())
+	update := bson.M{
+		"$set": bson.M{
+			"taskType":    wf.TaskType,
+			"states":      wf.States,
+			"transitions": wf.Transitions,
+			"updateTime":  wf.UpdateTime,
+		},
+		"$setOnInsert": bson.M{
+			"_id": primitive.NewObjectID(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := t.Workflows.FindOneAndUpdate(ctx, bson.M{"projectId": wf.ProjectID}, update, opts).Decode(&wf); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return model.Workflow{}, err
+	}
+	return wf, nil
+}
+
+// DeleteWorkflow 删除项目的流程配置，恢复为默认流程
+func (t *TaskType) DeleteWorkflow(ctx context.Context, projectID primitive.ObjectID) error {
+	if _, err := t.Workflows.DeleteOne(ctx, bson.M{"projectId": projectID}); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func validateWorkflow(wf model.Workflow) error {
+	if wf.ProjectID.IsZero() {
+		return errors.New("项目id不能为空")
+	}
+	if len(wf.States) == 0 {
+		return errors.New("流程至少需要一个状态")
+	}
+	states := make(map[string]bool, len(wf.States))
+	for _, s := range wf.States {
+		if s == "" {
+			return errors.New("状态名称不能为空")
+		}
+		if states[s] {
+			return fmt.Errorf("状态重复：%s", s)
+		}
+		states[s] = true
+	}
+	for _, s := range []string{model.TaskStatusAllocate, model.TaskStatusLabeling, model.TaskStatusSubmit} {
+		if !states[s] {
+			return fmt.Errorf("流程必须包含状态：%s", s)
+		}
+	}
+	for _, t := range wf.Transitions {
+		if !states[t.To] {
+			return fmt.Errorf("流转的目标状态不存在：%s", t.To)
+		}
+		for _, from := range t.From {
+			if !states[from] {
+				return fmt.Errorf("流转的源状态不存在：%s", from)
+			}
+		}
+		if len(t.Roles) == 0 {
+			return fmt.Errorf("流转到%s没有配置角色", t.To)
+		}
+		for _, role := range t.Roles {
+			if role != PermissionTypeLabeler && role != PermissionTypeChecker && role != PermissionTypeAdmin {
+				return fmt.Errorf("角色不存在：%s", role)
+			}
+		}
+	}
+	return nil
+}
+
+// Transitions 查询任务的状态流转记录，按时间先后排列
+func (t *TaskType) Transitions(ctx context.Context, taskID primitive.ObjectID) ([]model.TaskTransition, error) {
+	filter := bson.M{
+		"taskType": t.Name,
+		"taskId":   taskID,
+	}
+	cursor, err := t.TaskTransitions.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	res := make([]model.TaskTransition, 0)
+	if err := cursor.All(ctx, &res); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return res, nil
+}
+
+// newTransition 生成一条流转记录，调用方填写 Actor、Role 和 Reason
+func (t *TaskType) newTransition(meta model.TaskMeta, to string) model.TaskTransition {
+	return model.TaskTransition{
+		ID:         primitive.NewObjectID(),
+		TaskType:   t.Name,
+		ProjectID:  meta.ProjectID,
+		TaskID:     meta.ID,
+		From:       meta.Status,
+		To:         to,
+		CreateTime: util.Datetime(time.Now()),
+	}
+}
+
+func (t *TaskType) recordTransitions(ctx context.Context, records []model.TaskTransition) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if _, err := t.TaskTransitions.InsertMany(ctx, util.Map(records, func(v model.TaskTransition) any { return v })); err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// taskRoles 用户对任务拥有的角色
+func taskRoles(p model.Permissions, userID string, admin bool) []string {
+	if admin {
+		return []string{PermissionTypeAdmin}
+	}
+	roles := make([]string, 0, 2)
+	if p.IsLabeler(userID) {
+		roles = append(roles, PermissionTypeLabeler)
+	}
+	if p.IsChecker(userID) {
+		roles = append(roles, PermissionTypeChecker)
+	}
+	return roles
+}
+
+// missingFields 返回文档中为空的字段，字段用 . 分隔，数组用下标
+func missingFields(fields []string, doc bson.Raw) []string {
+	var missing []string
+	for _, field := range fields {
+		v, err := doc.LookupErr(strings.Split(field, ".")...)
+		if err != nil || emptyValue(v) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// mergeSet 返回按 $set 修改后的文档，用于在修改前校验必填字段。set 的键用 . 分隔，数组用下标
+func mergeSet(doc bson.Raw, set bson.M) (bson.Raw, error) {
+	var merged bson.M
+	if err := bson.Unmarshal(doc, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range set {
+		setPath(merged, strings.Split(key, "."), value)
+	}
+	return bson.Marshal(merged)
+}
+
+// setPath 按路径设置值，中间的字段不存在时创建
+func setPath(parent any, path []string, value any) {
+	switch p := parent.(type) {
+	case bson.M:
+		if len(path) == 1 {
+			p[path[0]] = value
+			return
+		}
+		child, ok := p[path[0]]
+		if !ok || child == nil {
+			child = bson.M{}
+			p[path[0]] = child
+		}
+		setPath(child, path[1:], value)
+	case bson.A:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(p) {
+			return
+		}
+		if len(path) == 1 {
+			p[i] = value
+			return
+		}
+		if p[i] == nil {
+			p[i] = bson.M{}
+		}
+		setPath(p[i], path[1:], value)
+	}
+}
+
+func emptyValue(v bson.RawValue) bool {
+	switch v.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return true
+	case bsontype.String:
+		return v.StringValue() == ""
+	case bsontype.Array:
+		values, err := v.Array().Values()
+		return err != nil || len(values) == 0
+	case bsontype.EmbeddedDocument:
+		elements, err := v.Document().Elements()
+		return err != nil || len(elements) == 0
+	}
+	return false
+}
+
+type SaveWorkflowReq = model.Workflow
+
+func (svc *LabelerService) GetWorkflow(ctx context.Context, taskType string, projectID primitive.ObjectID) (model.Workflow, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return model.Workflow{}, err
+	}
+	return t.Workflow(ctx, projectID)
+}
+
+func (svc *LabelerService) SaveWorkflow(ctx context.Context, taskType string, req SaveWorkflowReq) (model.Workflow, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return model.Workflow{}, err
+	}
+	return t.SaveWorkflow(ctx, req)
+}
+
+func (svc *LabelerService) DeleteWorkflow(ctx context.Context, taskType string, projectID primitive.ObjectID) error {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return err
+	}
+	return t.DeleteWorkflow(ctx, projectID)
+}
+
+func (svc *LabelerService) GetTaskTransitions(ctx context.Context, taskType string, taskID primitive.ObjectID) ([]model.TaskTransition, error) {
+	t, err := svc.TaskType(taskType)
+	if err != nil {
+		return nil, err
+	}
+	return t.Transitions(ctx, taskID)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"go-admin/app/labeler/model"
+)
+
+func TestMergeSetMissingFields(t *testing.T) {
+	doc, _ := bson.Marshal(bson.M{
+		"result": bson.M{"label": "a", "note": "b"},
+		"output": bson.A{bson.M{"text": "x"}},
+	})
+	merged, err := mergeSet(doc, bson.M{
+		"result.label":  "",
+		"output.0.text": "y",
+		"remark":        "z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := missingFields([]string{"result.label", "result.note", "output.0.text", "remark", "score"}, merged)
+	want := []string{"result.label", "score"}
+	if len(missing) != len(want) {
+		t.Fatalf("missing %v", missing)
+	}
+	for i := range want {
+		if missing[i] != want[i] {
+			t.Errorf("want %v got %v", want, missing)
+		}
+	}
+}
+
+func TestDefaultWorkflowRoles(t *testing.T) {
+	cases := []struct {
+		name     string
+		wf       model.Workflow
+		from, to string
+		role     string
+		want     bool
+	}{
+		{"t 标注员提交", workflowFromRoleMaps(Labeler, Checker, taskAdminStatusMap), model.TaskStatusLabeling, model.TaskStatusSubmit, PermissionTypeLabeler, true},
+		{"t 审核员不能提交", workflowFromRoleMaps(Labeler, Checker, taskAdminStatusMap), model.TaskStatusLabeling, model.TaskStatusSubmit, PermissionTypeChecker, false},
+		{"t 管理员审核", workflowFromRoleMaps(Labeler, Checker, taskAdminStatusMap), model.TaskStatusChecking, model.TaskStatusPassed, PermissionTypeAdmin, true},
+		{"t 管理员提交", workflowFromRoleMaps(Labeler, Checker, taskAdminStatusMap), model.TaskStatusLabeling, model.TaskStatusSubmit, PermissionTypeAdmin, true},
+		{"t3 标注员", task3Workflow, model.TaskStatusPassed, model.TaskStatusLabeling, PermissionTypeLabeler, true},
+		{"t3 审核员", task3Workflow, model.TaskStatusSubmit, model.TaskStatusPassed, PermissionTypeChecker, false},
+		{"t3 管理员", task3Workflow, model.TaskStatusSubmit, model.TaskStatusAllocate, PermissionTypeAdmin, true},
+		{"t4 管理员不能由待标注改为审核不通过", task4Workflow, model.TaskStatusLabeling, model.TaskStatusFailed, PermissionTypeAdmin, false},
+		{"t5 管理员不能提交", task5Workflow, model.TaskStatusLabeling, model.TaskStatusSubmit, PermissionTypeAdmin, false},
+		{"t5 审核员", task5Workflow, model.TaskStatusChecking, model.TaskStatusPassed, PermissionTypeChecker, true},
+	}
+	for _, c := range cases {
+		if _, ok := c.wf.Find(c.from, c.to, []string{c.role}); ok != c.want {
+			t.Errorf("%s: %s -> %s want %v", c.name, c.from, c.to, c.want)
+		}
+	}
+}
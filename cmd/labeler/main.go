@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"reflect"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,14 +14,12 @@ import (
 	sdkapi "github.com/go-admin-team/go-admin-core/sdk/api"
 	"github.com/go-admin-team/go-admin-core/sdk/config"
 	"github.com/go-admin-team/go-admin-core/sdk/pkg"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/spf13/cobra"
 	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
-	"go.mongodb.org/mongo-driver/bson/bsoncodec"
-	"go.mongodb.org/mongo-driver/bson/bsonoptions"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 	"gorm.io/gorm"
 
 	"go-admin/app/labeler/api"
@@ -32,7 +29,6 @@ import (
 	"go-admin/common/log"
 	common "go-admin/common/middleware"
 	"go-admin/common/storage"
-	"go-admin/common/util"
 	ext "go-admin/config"
 )
 
@@ -85,14 +81,7 @@ func run() error {
 		cfg := ext.ExtConfig.Mongodb
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-
-		rb := bsoncodec.NewRegistryBuilder()
-		bsoncodec.DefaultValueEncoders{}.RegisterDefaultEncoders(rb)
-		bsoncodec.DefaultValueDecoders{}.RegisterDefaultDecoders(rb)
-		timeCodec := util.NewTimeCodec(bsonoptions.TimeCodec().SetUseLocalTimeZone(true))
-		rb.RegisterCodec(reflect.TypeOf(util.Datetime{}), timeCodec)
-		rb.RegisterCodec(util.GzipJSONType, &util.JSONCodec{})
-		client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.DSN).SetMonitor(otelmongo.NewMonitor()).SetRegistry(rb.Build()))
+		client, err := database.NewMongoClient(ctx, cfg.DSN)
 		if err != nil {
 			panic(err)
 		}
@@ -100,7 +89,36 @@ func run() error {
 		return nil
 	})
 
-	service := service2.NewLabelerService(mongodbClient, gormDB)
+	var minioClient *minio.Client
+	_ = log.WithTracer(startingCtx, PackageName, "初始化MinIO", func(ctx context.Context) error {
+		cfg := ext.ExtConfig.MinIO
+		client, err := minio.New(cfg.Endpoint, &minio.Options{
+			Creds: credentials.NewStaticV4(cfg.Key, cfg.Secret, ""),
+		})
+		if err != nil {
+			log.Logger().WithContext(ctx).Fatal(err)
+		}
+		minioClient = client
+		return nil
+	})
+
+	service := service2.NewLabelerService(mongodbClient, gormDB, minioClient)
+	_ = log.WithTracer(startingCtx, PackageName, "启动后台导出", func(ctx context.Context) error {
+		go service.RunExports()
+		return nil
+	})
+	_ = log.WithTracer(startingCtx, PackageName, "启动后台预标注", func(ctx context.Context) error {
+		go service.RunPreAnnotations()
+		return nil
+	})
+	_ = log.WithTracer(startingCtx, PackageName, "启动回收站清理", func(ctx context.Context) error {
+		go service.RunTrashPurge(ext.ExtConfig.TrashRetentionDays)
+		return nil
+	})
+	_ = log.WithTracer(startingCtx, PackageName, "启动任务租约回收", func(ctx context.Context) error {
+		go service.RunLeaseReclaim()
+		return nil
+	})
 	labelerAPI := api.NewLabelerAPI(service)
 
 	r := gin.New()
@@ -0,0 +1,72 @@
+package mongo_version
+
+import (
+	"context"
+	"runtime"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/cmd/migrate/migration"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.MongoMigrate.SetVersion(migration.GetFilename(fileName), _1792195200000LabelerIndexes)
+}
+
+// _1792195200000LabelerIndexes 标注任务常用查询的索引：按项目和状态筛选、按标注员和审核员查询、t5 按会话领取
+func _1792195200000LabelerIndexes(ctx context.Context, db *mongo.Database) error {
+	taskIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "projectId", Value: 1}, {Key: "status", Value: 1}},
+			Options: options.Index().SetName("projectId_status"),
+		},
+		{
+			Keys:    bson.D{{Key: "permissions.labeler.id", Value: 1}, {Key: "projectId", Value: 1}},
+			Options: options.Index().SetName("labeler_projectId"),
+		},
+		{
+			Keys:    bson.D{{Key: "permissions.checker.id", Value: 1}, {Key: "projectId", Value: 1}},
+			Options: options.Index().SetName("checker_projectId"),
+		},
+	}
+	indexes := map[string][]mongo.IndexModel{
+		"task":         taskIndexes,
+		"task2":        taskIndexes,
+		"task3":        taskIndexes,
+		"task4":        taskIndexes,
+		"labeledtask5": taskIndexes,
+		"task6":        taskIndexes,
+		// task5 中是待领取的对话，按优先级领取
+		"task5": {
+			{
+				Keys:    bson.D{{Key: "projectId", Value: 1}, {Key: "dialog.0.sessionId", Value: 1}},
+				Options: options.Index().SetName("projectId_sessionId"),
+			},
+			{
+				Keys:    bson.D{{Key: "projectId", Value: 1}, {Key: "dialog.0.priority", Value: -1}},
+				Options: options.Index().SetName("projectId_priority"),
+			},
+		},
+	}
+	for _, name := range []string{"project", "project2", "project3", "project4", "project5", "project6"} {
+		indexes[name] = []mongo.IndexModel{{
+			Keys:    bson.D{{Key: "folderId", Value: 1}},
+			Options: options.Index().SetName("folderId"),
+		}}
+	}
+	for _, name := range []string{"folder", "folder2", "folder3", "folder4", "folder5", "folder6"} {
+		indexes[name] = []mongo.IndexModel{{
+			Keys:    bson.D{{Key: "parentId", Value: 1}},
+			Options: options.Index().SetName("parentId"),
+		}}
+	}
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
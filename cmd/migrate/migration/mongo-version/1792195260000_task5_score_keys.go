@@ -0,0 +1,115 @@
+package mongo_version
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/model"
+	"go-admin/cmd/migrate/migration"
+	"go-admin/common/util"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.MongoMigrate.SetVersion(migration.GetFilename(fileName), _1792195260000Task5ScoreKeys)
+}
+
+// task5ScoreKeys 旧的 Scores 结构体中 bson 标签和字段错位，按字段含义改为新的键，没有错位的维度不变
+var task5ScoreKeys = [][2]string{
+	{"identifyRisk", "identifyRisk"},
+	{"understandingVisitor", "understandingVisitor"},
+	{"respondingVisitor", "expressingCare"},
+	{"respectVisitor", "acceptFeedback"},
+	{"acceptFeedback", "advanceProcess"},
+	{"advanceProcess", "promoteProcess"},
+	{"findSolution", "inspirationAssistance"},
+	{"enoughContent", "relieveEmotions"},
+	{"visitorFeedback", "visitorFeedback"},
+}
+
+// renameScoreKeys 按 task5ScoreKeys 改写 field 中打分的键并把 versionField 设为 1。键之间有交换，
+// 用聚合管道按改写前的文档一次性生成新的键，再删除只在旧模板中出现的键
+func renameScoreKeys(field, versionField string) mongo.Pipeline {
+	score := bson.M{}
+	renamed := map[string]bool{}
+	for _, k := range task5ScoreKeys {
+		score[k[1]] = "$" + field + "." + k[0]
+		renamed[k[1]] = true
+	}
+	var unset bson.A
+	for _, k := range task5ScoreKeys {
+		if !renamed[k[0]] {
+			unset = append(unset, field+"."+k[0])
+		}
+	}
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{field: score, versionField: 1}}},
+		{{Key: "$unset", Value: unset}},
+	}
+}
+
+// task5RubricV1 旧打分模板改为新键后的版本 1，维度的含义、分值和权重与 LegacyRubric 相同
+func task5RubricV1() model.ScoreRubric {
+	keys := make(map[string]string, len(task5ScoreKeys))
+	for _, k := range task5ScoreKeys {
+		keys[k[0]] = k[1]
+	}
+	rubric := model.ScoreRubric{
+		Version:    1,
+		Dimensions: make([]model.ScoreDimension, len(model.LegacyRubric.Dimensions)),
+		CreateTime: util.Datetime(time.Now()),
+	}
+	copy(rubric.Dimensions, model.LegacyRubric.Dimensions)
+	for i := range rubric.Dimensions {
+		rubric.Dimensions[i].Key = keys[rubric.Dimensions[i].Key]
+	}
+	return rubric
+}
+
+// _1792195260000Task5ScoreKeys 没有配置打分模板的项目改用版本 1 的打分模板：按旧模板（版本 0）保存的打分和
+// 金标准答案改为新的键并记为版本 1。LegacyRubric 不变，旧键只在版本 0 中有效。
+// 每个项目最后写入打分模板，中途失败后重新执行只处理还没有转换的数据
+func _1792195260000Task5ScoreKeys(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection("project5").Find(ctx, bson.M{"rubrics.0": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var projects []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &projects); err != nil {
+		return err
+	}
+	rubric := task5RubricV1()
+	for _, p := range projects {
+		filter := bson.M{
+			"projectId":    p.ID,
+			"score":        bson.M{"$type": "object"},
+			"scoreVersion": bson.M{"$in": bson.A{0, nil}},
+		}
+		if _, err := db.Collection("labeledtask5").UpdateMany(ctx, filter, renameScoreKeys("score", "scoreVersion")); err != nil {
+			return err
+		}
+		filter = bson.M{
+			"projectId":                p.ID,
+			"gold.answer.score":        bson.M{"$type": "object"},
+			"gold.answer.scoreVersion": bson.M{"$exists": false},
+		}
+		update := renameScoreKeys("gold.answer.score", "gold.answer.scoreVersion")
+		if _, err := db.Collection("task5").UpdateMany(ctx, filter, update); err != nil {
+			return err
+		}
+		filter = bson.M{"_id": p.ID, "rubrics.0": bson.M{"$exists": false}}
+		if _, err := db.Collection("project5").UpdateOne(ctx, filter, bson.M{"$push": bson.M{"rubrics": rubric}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package mongo_version
+
+import (
+	"context"
+	"errors"
+	"runtime"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/cmd/migrate/migration"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.MongoMigrate.SetVersion(migration.GetFilename(fileName), _1792195320000LabelerServiceIndexes)
+}
+
+// 删除不存在的索引或集合时 MongoDB 返回的错误码
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
+// _1792195320000LabelerServiceIndexes 导出、预标注、多人标注、回收站、租约、讨论、质检和内容搜索依赖的索引，
+// 并删除 labeledtask5 上旧的会话唯一索引
+func _1792195320000LabelerServiceIndexes(ctx context.Context, db *mongo.Database) error {
+	// 旧的唯一索引：sessionId_labeler_unique 不包含 deletedBatch，回收站中的任务会阻止重新领取；
+	// sessionId_labeler_batch_unique 包含重置后没有标注员的副本，同一会话的第二个副本重置时冲突
+	for _, name := range []string{"sessionId_labeler_unique", "sessionId_labeler_batch_unique"} {
+		if _, err := db.Collection("labeledtask5").Indexes().DropOne(ctx, name); err != nil {
+			var cmdErr mongo.CommandError
+			if !errors.As(err, &cmdErr) || !(cmdErr.HasErrorCode(indexNotFoundCode) || cmdErr.HasErrorCode(namespaceNotFoundCode)) {
+				return err
+			}
+		}
+	}
+	indexes := map[string][]mongo.IndexModel{
+		// 同一会话只能被同一标注员领取一次，历史数据没有 sessionId 字段，不参与约束。
+		// 回收站中的任务 deletedBatch 各不相同，删除后可以重新领取；重置后没有标注员的副本不参与约束
+		"labeledtask5": {
+			{
+				Keys: bson.D{{Key: "sessionId", Value: 1}, {Key: "permissions.labeler.id", Value: 1}, {Key: "deletedBatch", Value: 1}},
+				Options: options.Index().
+					SetName("sessionId_labeler_assigned_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{
+						"sessionId":              bson.M{"$type": "string"},
+						"permissions.labeler.id": bson.M{"$type": "string"},
+					}),
+			},
+		},
+		"export_job": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("status"),
+			},
+			{
+				Keys:    bson.D{{Key: "creator", Value: 1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("creator"),
+			},
+		},
+		"pre_annotate_job": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("status"),
+			},
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "projectId", Value: 1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("project"),
+			},
+		},
+		"task_submission": {
+			{
+				Keys:    bson.D{{Key: "taskId", Value: 1}, {Key: "labeler.id", Value: 1}},
+				Options: options.Index().SetName("taskId_labeler_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "projectId", Value: 1}, {Key: "status", Value: 1}},
+				Options: options.Index().SetName("project_status"),
+			},
+			{
+				Keys:    bson.D{{Key: "labeler.id", Value: 1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("labeler"),
+			},
+		},
+		"gold_result": {
+			{
+				Keys:    bson.D{{Key: "taskId", Value: 1}},
+				Options: options.Index().SetName("taskId_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "projectId", Value: 1}, {Key: "createTime", Value: 1}},
+				Options: options.Index().SetName("project_createTime"),
+			},
+		},
+		"allocation_setting": {
+			{
+				Keys:    bson.D{{Key: "projectId", Value: 1}},
+				Options: options.Index().SetName("projectId_unique").SetUnique(true),
+			},
+		},
+		"trash": {
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("taskType"),
+			},
+			{
+				Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+				Options: options.Index().SetName("deletedAt"),
+			},
+		},
+		"task_activity": {
+			{
+				Keys:    bson.D{{Key: "taskId", Value: 1}},
+				Options: options.Index().SetName("taskId"),
+			},
+			// 工作量统计按动态统计标注员保存过的任务
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "action", Value: 1}, {Key: "createTime", Value: 1}},
+				Options: options.Index().SetName("taskType_action_createTime"),
+			},
+		},
+		// 任务的讨论和回复，收件箱查询未解决的讨论
+		"task_comment": {
+			{
+				Keys:    bson.D{{Key: "taskId", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("taskId"),
+			},
+			{
+				Keys:    bson.D{{Key: "threadId", Value: 1}},
+				Options: options.Index().SetName("threadId").SetSparse(true),
+			},
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "resolved", Value: 1}, {Key: "taskId", Value: 1}},
+				Options: options.Index().SetName("taskType_resolved"),
+			},
+			{
+				Keys:    bson.D{{Key: "participants", Value: 1}, {Key: "resolved", Value: 1}},
+				Options: options.Index().SetName("participants_resolved"),
+			},
+		},
+		"task_snapshot": {
+			{
+				Keys:    bson.D{{Key: "taskId", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("taskId"),
+			},
+		},
+		"qa_batch": {
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "projectId", Value: 1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("project"),
+			},
+		},
+		// 质检队列，抽样时排除已抽中的任务
+		"qa_item": {
+			{
+				Keys:    bson.D{{Key: "batchId", Value: 1}, {Key: "status", Value: 1}},
+				Options: options.Index().SetName("batchId_status"),
+			},
+			{
+				Keys:    bson.D{{Key: "reviewer", Value: 1}, {Key: "status", Value: 1}},
+				Options: options.Index().SetName("reviewer_status"),
+			},
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "projectId", Value: 1}, {Key: "taskId", Value: 1}},
+				Options: options.Index().SetName("project_taskId"),
+			},
+		},
+		"task_transition": {
+			{
+				Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "taskId", Value: 1}},
+				Options: options.Index().SetName("taskType_taskId"),
+			},
+		},
+	}
+	// 回收租约到期的任务
+	for _, name := range []string{"task", "task2", "task3", "task4", "labeledtask5", "task6"} {
+		indexes[name] = append(indexes[name], mongo.IndexModel{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "leaseExpireTime", Value: 1}},
+			Options: options.Index().SetName("status_leaseExpireTime"),
+		})
+	}
+	// 内容搜索的二元组
+	for _, name := range []string{"task", "task2", "task3", "task4", "labeledtask5"} {
+		indexes[name] = append(indexes[name], mongo.IndexModel{
+			Keys:    bson.D{{Key: "searchGrams", Value: 1}},
+			Options: options.Index().SetName("searchGrams"),
+		})
+	}
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package mongo_version
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"go-admin/app/labeler/service"
+	"go-admin/cmd/migrate/migration"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.MongoMigrate.SetVersion(migration.GetFilename(fileName), _1792195380000SearchGrams)
+}
+
+// _1792195380000SearchGrams 为升级前的任务建立内容搜索的二元组，字段和各任务类型的 SearchFields 一致
+func _1792195380000SearchGrams(ctx context.Context, db *mongo.Database) error {
+	fields := map[string][]string{
+		"task":         {"contents.raw.groups.entities.sentences.text"},
+		"task2":        {"contents.value"},
+		"task3":        {"command.content"},
+		"task4":        {"text"},
+		"labeledtask5": {"dialog.userContent", "dialog.botResponse"},
+	}
+	for name, f := range fields {
+		count, err := service.BackfillSearchGrams(ctx, db.Collection(name), f)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d 个任务建立了内容搜索索引\n", name, count)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package mongo_version
+
+import (
+	"context"
+	"runtime"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/cmd/migrate/migration"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.MongoMigrate.SetVersion(migration.GetFilename(fileName), _1792195440000QAItemTaskIndex)
+}
+
+// _1792195440000QAItemTaskIndex 彻底删除任务时按任务删除质检记录
+func _1792195440000QAItemTaskIndex(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("qa_item").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "taskType", Value: 1}, {Key: "taskId", Value: 1}},
+		Options: options.Index().SetName("taskType_taskId"),
+	})
+	return err
+}
@@ -0,0 +1,36 @@
+package mongo_version
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-admin/app/labeler/service"
+	"go-admin/cmd/migrate/migration"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.MongoMigrate.SetVersion(migration.GetFilename(fileName), _1792195500000Task6SearchGrams)
+}
+
+// _1792195500000Task6SearchGrams t6 支持按任务名称和文件名搜索，建立索引并为已有的任务生成二元组
+func _1792195500000Task6SearchGrams(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("task6")
+	if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "searchGrams", Value: 1}},
+		Options: options.Index().SetName("searchGrams"),
+	}); err != nil {
+		return err
+	}
+	count, err := service.BackfillSearchGrams(ctx, collection, []string{"name", "fullName"})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("task6: %d 个任务建立了内容搜索索引\n", count)
+	return nil
+}
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoMigrationCollection 记录已执行的 MongoDB 迁移，_id 为版本号
+const MongoMigrationCollection = "migrations"
+
+var MongoMigrate = &MongoMigration{
+	version: make(map[string]func(ctx context.Context, db *mongo.Database) error),
+}
+
+// MongoMigration 标注服务 MongoDB 的迁移，按版本号顺序执行，每个版本只执行一次
+type MongoMigration struct {
+	version map[string]func(ctx context.Context, db *mongo.Database) error
+	mutex   sync.Mutex
+}
+
+func (e *MongoMigration) SetVersion(k string, f func(ctx context.Context, db *mongo.Database) error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.version[k] = f
+}
+
+// Migrate 执行还没有记录在 migrations 中的版本，某个版本失败时停止，之后的版本不执行
+func (e *MongoMigration) Migrate(ctx context.Context, db *mongo.Database) error {
+	versions := make([]string, 0, len(e.version))
+	for k := range e.version {
+		versions = append(versions, k)
+	}
+	sort.Strings(versions)
+	collection := db.Collection(MongoMigrationCollection)
+	for _, v := range versions {
+		count, err := collection.CountDocuments(ctx, bson.M{"_id": v})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		log.Println("mongo migrate", v)
+		if err := e.version[v](ctx, db); err != nil {
+			log.Println("mongo migrate", v, "failed:", err)
+			return err
+		}
+		if _, err := collection.InsertOne(ctx, bson.M{"_id": v, "appliedAt": time.Now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-admin-team/go-admin-core/config/source/file"
+	"github.com/go-admin-team/go-admin-core/sdk/config"
+	"github.com/spf13/cobra"
+
+	"go-admin/cmd/migrate/migration"
+	_ "go-admin/cmd/migrate/migration/mongo-version"
+	"go-admin/common/database"
+	ext "go-admin/config"
+)
+
+var mongoCmd = &cobra.Command{
+	Use:     "mongo",
+	Short:   "Migrate the labeler MongoDB collections",
+	Example: "go-admin migrate mongo -c config/settings.yml",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMongo()
+	},
+}
+
+func init() {
+	StartCmd.AddCommand(mongoCmd)
+}
+
+// runMongo 执行 migration/mongo-version 中还没有执行过的 MongoDB 迁移，已执行的版本记录在 migrations 集合中
+func runMongo() error {
+	config.ExtendConfig = &ext.ExtConfig
+	config.Setup(file.NewSource(file.WithPath(configYml)))
+	cfg := ext.ExtConfig.Mongodb
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	client, err := database.NewMongoClient(ctx, cfg.DSN)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	fmt.Println("MongoDB 迁移开始")
+	if err := migration.MongoMigrate.Migrate(context.Background(), client.Database(cfg.LabelerDB)); err != nil {
+		return err
+	}
+	fmt.Println("MongoDB 迁移完成")
+	return nil
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonoptions"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+
+	"go-admin/common/util"
+)
+
+// NewMongoClient 连接 MongoDB，util.Datetime 按本地时区编码，util.GzipJSON 压缩存储
+func NewMongoClient(ctx context.Context, dsn string) (*mongo.Client, error) {
+	rb := bsoncodec.NewRegistryBuilder()
+	bsoncodec.DefaultValueEncoders{}.RegisterDefaultEncoders(rb)
+	bsoncodec.DefaultValueDecoders{}.RegisterDefaultDecoders(rb)
+	timeCodec := util.NewTimeCodec(bsonoptions.TimeCodec().SetUseLocalTimeZone(true))
+	rb.RegisterCodec(reflect.TypeOf(util.Datetime{}), timeCodec)
+	rb.RegisterCodec(util.GzipJSONType, &util.JSONCodec{})
+	return mongo.Connect(ctx, options.Client().ApplyURI(dsn).SetMonitor(otelmongo.NewMonitor()).SetRegistry(rb.Build()))
+}
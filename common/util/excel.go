@@ -1,9 +1,11 @@
 package util
 
 import (
+	"bytes"
 	"context"
 	"embed"
 	"encoding/base64"
+	"io"
 	"time"
 
 	"github.com/xuri/excelize/v2"
@@ -69,13 +71,27 @@ var task5excel embed.FS
 func EmbedExcelData(excelName string, data [][]interface{}, ctx context.Context) (*string, string, error) {
 	var result string
 	excelName = excelName + ".xlsx"
+	buf := new(bytes.Buffer)
+	if err := WriteEmbedExcel(ctx, buf, data); err != nil {
+		return &result, excelName, err
+	}
+	result = base64.StdEncoding.EncodeToString(buf.Bytes())
+	return &result, excelName, nil
+}
+
+// WriteEmbedExcel 把数据从第 3 行开始写入内置的打分模板，文件写入 w
+func WriteEmbedExcel(ctx context.Context, w io.Writer, data [][]interface{}) error {
 	r, err := task5excel.Open("task5score.xlsx")
 	if err != nil {
 		log.Logger().WithContext(ctx).Error(err.Error())
-		return &result, excelName, err
+		return err
 	}
 
 	f, err := excelize.OpenReader(r)
+	if err != nil {
+		log.Logger().WithContext(ctx).Error(err.Error())
+		return err
+	}
 	defer func() {
 		// Close the spreadsheet.
 		if err := f.Close(); err != nil {
@@ -83,30 +99,15 @@ func EmbedExcelData(excelName string, data [][]interface{}, ctx context.Context)
 			return
 		}
 	}()
-	if err != nil {
-		panic(err)
-	}
-	//if err := f.SetSheetRow(f.GetSheetName(0), "A3", &[]any{"a", "b", "c"}); err != nil {
-	//	panic(err)
-	//}
 	for row, rowValues := range data {
 		aixs, _ := excelize.CoordinatesToCellName(1, row+3)
 		err := f.SetSheetRow("Sheet1", aixs, &rowValues)
 		if err != nil {
 			log.Logger().WithContext(ctx).Error(err.Error())
-			return &result, excelName, err
+			return err
 		}
 	}
-
-	//if err := f.SaveAs("测试.xlsx"); err != nil {
-	//	fmt.Println(err)
-	//}
-
-	//f.SaveAs(excelName)
-	buf, _ := f.WriteToBuffer()
-	result = base64.StdEncoding.EncodeToString(buf.Bytes())
-	return &result, excelName, nil
-
+	return f.Write(w)
 }
 
 var ColMap = map[int]string{
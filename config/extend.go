@@ -22,7 +22,14 @@ type Extend struct {
 	WeComInteractive WeComInteractiveConfig `yaml:"wecominteractive"`
 	MinIO            MinIOConfig            `yaml:"minio"`
 	Mongodb          MongodbConfig          `yaml:"mongodb"`
-	ModelServerURL   string                 `yaml:"modelServerURL"`
+	// ModelServerURL 模型服务地址，用于解析和预标注，为空时不能解析和预标注
+	ModelServerURL string `yaml:"modelServerURL"`
+	// ModelStub 没有配置模型服务时使用本地的模拟模型，只用于开发调试
+	ModelStub bool `yaml:"modelstub"`
+	// TrashRetentionDays 标注回收站保留的天数，超过后彻底删除，默认 30 天
+	TrashRetentionDays int `yaml:"trashretentiondays"`
+	// TaskLeaseMinutes t5 领取的对话的租约分钟数，到期未续约的对话被回收，默认 120 分钟
+	TaskLeaseMinutes int `yaml:"taskleaseminutes"`
 }
 
 type AMap struct {
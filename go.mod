@@ -26,6 +26,7 @@ require (
 	github.com/prometheus/client_golang v1.11.0
 	github.com/qiniu/go-sdk/v7 v7.11.1
 	github.com/robfig/cron/v3 v3.0.1
+	github.com/santhosh-tekuri/jsonschema/v5 v5.2.0
 	github.com/shirou/gopsutil/v3 v3.22.1
 	github.com/sirupsen/logrus v1.9.0
 	github.com/spf13/cobra v1.0.0